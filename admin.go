@@ -0,0 +1,389 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/tidwall/gjson"
+)
+
+const adminAPIPrefix = "/_palace/api"
+
+const defaultAdminListN = 50
+
+// requestSummary is the shape of requests in lists, bodies and headers are
+// left out to keep lists small.
+type requestSummary struct {
+	ID         int64    `json:"id"`
+	Ident      string   `json:"ident"`
+	Method     string   `json:"method"`
+	Path       string   `json:"path"`
+	Status     int64    `json:"status,omitempty"`
+	ChatCmpl   string   `json:"chatcmpl,omitempty"`
+	RequestID  string   `json:"request_id,omitempty"`
+	Model      string   `json:"model,omitempty"`
+	Latency    int64    `json:"latency,omitempty"`
+	Cost       *float64 `json:"cost,omitempty"`
+	HasError   bool     `json:"has_error"`
+	Stream     bool     `json:"stream"`
+	Endpoint   string   `json:"endpoint,omitempty"`
+	RetryOf    int64    `json:"retry_of,omitempty"`
+	Attempt    int64    `json:"attempt,omitempty"`
+	Requested  string   `json:"requested_at"`
+	ErrMessage string   `json:"error,omitempty"`
+}
+
+func summarizeRequest(request *Request) *requestSummary {
+	summary := &requestSummary{
+		ID:         request.ID,
+		Ident:      request.Ident(),
+		Method:     request.RequestMethod,
+		Path:       request.RequestPath,
+		Status:     request.ResponseStatusCode.Int64,
+		ChatCmpl:   request.ChatCmpl(),
+		RequestID:  request.MoonshotRequestID.String,
+		Latency:    request.Latency.Int64 / int64(time.Millisecond),
+		HasError:   request.HasError(),
+		Stream:     request.ResponseContentType.String == "text/event-stream",
+		Endpoint:   request.Endpoint.String,
+		RetryOf:    request.RetryOf.Int64,
+		Attempt:    request.Attempt.Int64,
+		Requested:  request.CreatedAt.Format(time.DateTime),
+		ErrMessage: request.Error.String,
+	}
+	if request.IsChat() {
+		summary.Model = gjson.Get(request.RequestBody.String, "model").String()
+	}
+	if request.Cost.Valid {
+		summary.Cost = &request.Cost.Float64
+	}
+	return summary
+}
+
+// registerAdminAPI registers the admin API, which mirrors the list, inspect,
+// export, tag and cleanup commands. Single requests are addressed by idents in
+// the same form as Request.Ident, such as "id=13", "chatcmpl=chatcmpl-xxx" and
+// "requestid=xxx", a bare number is taken as the row id.
+func registerAdminAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+adminAPIPrefix+"/requests", handleListRequests)
+	mux.HandleFunc("GET "+adminAPIPrefix+"/requests/{ident}", handleGetRequest)
+	mux.HandleFunc("GET "+adminAPIPrefix+"/requests/{ident}/export", handleExportRequest)
+	mux.HandleFunc("POST "+adminAPIPrefix+"/requests/{ident}/export", guardAdminWrite(handleExportRequest))
+	mux.HandleFunc("GET "+adminAPIPrefix+"/requests/{ident}/curl", handleCurlRequest)
+	mux.HandleFunc("POST "+adminAPIPrefix+"/requests/{ident}/tag", guardAdminWrite(handleTagRequest))
+	mux.HandleFunc("GET "+adminAPIPrefix+"/tail", handleTailRequests)
+	mux.HandleFunc("POST "+adminAPIPrefix+"/cleanup", guardAdminWrite(handleCleanup))
+}
+
+// guardAdminHost only lets requests addressed to the proxy itself through, that
+// is, the Host is 127.0.0.1, localhost or [::1] with the port the proxy listens
+// on. Otherwise a web page on a domain resolved to 127.0.0.1 by DNS rebinding
+// would be of the same origin as the admin API, and read the captured requests.
+func guardAdminHost(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackHost(r) {
+			writeAdminError(w, http.StatusForbidden, "permission_denied_error",
+				fmt.Errorf("host: requests to %s are not allowed", r.Host))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func isLoopbackHost(r *http.Request) bool {
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		return false
+	}
+	switch host {
+	case "127.0.0.1", "localhost", "::1":
+	default:
+		return false
+	}
+	localAddr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return false
+	}
+	_, localPort, err := net.SplitHostPort(localAddr.String())
+	return err == nil && port == localPort
+}
+
+// guardAdminWrite only lets requests with a JSON body from the same origin
+// through. The API is not authenticated, without the guard a plain form on any
+// web page could post to it, since forms are sent without a CORS preflight.
+// Cross-origin requests with a JSON body always need a preflight, which is not
+// answered by the API.
+func guardAdminWrite(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			writeAdminError(w, http.StatusUnsupportedMediaType, "invalid_request_error",
+				errors.New("content type: application/json is required"))
+			return
+		}
+		// Browsers send Sec-Fetch-Site, which is none for requests made by users
+		// themselves, such as typing the URL.
+		switch site := r.Header.Get("Sec-Fetch-Site"); site {
+		case "", "same-origin", "none":
+		default:
+			writeAdminError(w, http.StatusForbidden, "permission_denied_error",
+				fmt.Errorf("sec-fetch-site: %s requests are not allowed", site))
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				writeAdminError(w, http.StatusForbidden, "permission_denied_error",
+					fmt.Errorf("origin: requests from %s are not allowed", origin))
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+func handleListRequests(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	n := int64(defaultAdminListN)
+	if value := query.Get("n"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			writeAdminError(w, http.StatusBadRequest, "invalid_request_error", fmt.Errorf("n: invalid value %q", value))
+			return
+		}
+		n = parsed
+	}
+	chatOnly, _ := strconv.ParseBool(query.Get("chatonly"))
+	predicate, err := Predicates(query["predicate"]).Parse()
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid_request_error", fmt.Errorf("predicate: %w", err))
+		return
+	}
+	requests, err := persistence.ListRequests(n, chatOnly, predicate)
+	if err != nil {
+		writeAdminQueryError(w, err)
+		return
+	}
+	// With full=true, requests are returned in the same form as the export
+	// command, which is what list --export writes.
+	if full, _ := strconv.ParseBool(query.Get("full")); full {
+		for _, request := range requests {
+			redactRequest(request)
+		}
+		writeAdminJSON(w, http.StatusOK, object{"requests": requests})
+		return
+	}
+	summaries := make([]*requestSummary, 0, len(requests))
+	for _, request := range requests {
+		summaries = append(summaries, summarizeRequest(request))
+	}
+	writeAdminJSON(w, http.StatusOK, object{"requests": summaries})
+}
+
+func handleGetRequest(w http.ResponseWriter, r *http.Request) {
+	request, ok := getAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	redactRequest(request)
+	// Event streams are shown as the completion merged from their chunks.
+	if request.ResponseContentType.String == "text/event-stream" && request.ResponseBody.Valid {
+		request.ResponseBody.String = mergeCompletion(request.ResponseBody.String)
+	}
+	writeAdminJSON(w, http.StatusOK, request)
+}
+
+// exportOptions are the options of the export command that change the
+// exported content, they are given as query parameters or as a JSON body.
+type exportOptions struct {
+	Category string   `json:"category"`
+	Tags     []string `json:"tags"`
+}
+
+func handleExportRequest(w http.ResponseWriter, r *http.Request) {
+	request, ok := getAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	options := exportOptions{
+		Category: query.Get("category"),
+		Tags:     query["tag"],
+	}
+	if r.Method == http.MethodPost && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+			writeAdminError(w, http.StatusBadRequest, "invalid_request_error", fmt.Errorf("body: %w", err))
+			return
+		}
+	}
+	switch options.Category {
+	case "", categoryGoodCase, categoryBadCase:
+	default:
+		writeAdminError(w, http.StatusBadRequest, "invalid_request_error",
+			fmt.Errorf("category: unknown category %q, expected one of goodcase and badcase", options.Category))
+		return
+	}
+	redactRequest(request)
+	if request.IsChat() {
+		if options.Category != "" {
+			request.Category = options.Category
+		}
+		if len(options.Tags) > 0 {
+			request.Tags = options.Tags
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(genFilename(request)))
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(request)
+}
+
+func handleCurlRequest(w http.ResponseWriter, r *http.Request) {
+	request, ok := getAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	redactRequest(request)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writeCurlCommand(w, request)
+}
+
+// handleTagRequest changes the annotations of a request in the same way as the
+// tag command, and returns the request with its annotations.
+func handleTagRequest(w http.ResponseWriter, r *http.Request) {
+	request, ok := getAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var a annotation
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid_request_error", fmt.Errorf("body: %w", err))
+		return
+	}
+	if err := a.validate(); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid_request_error", err)
+		return
+	}
+	if err := a.apply(request.ID); err != nil {
+		writeAdminQueryError(w, err)
+		return
+	}
+	request, err := persistence.GetRequest(request.ID, "", "")
+	if err != nil {
+		writeAdminQueryError(w, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, request)
+}
+
+// handleCleanup deletes requests in the same way as the cleanup command, the
+// options are only taken from the JSON body.
+func handleCleanup(w http.ResponseWriter, r *http.Request) {
+	var options struct {
+		Before    string   `json:"before"`
+		Predicate []string `json:"predicate"`
+		NoVacuum  bool     `json:"no_vacuum"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid_request_error", fmt.Errorf("body: %w", err))
+		return
+	}
+	predicate, err := Predicates(options.Predicate).Parse()
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid_request_error", fmt.Errorf("predicate: %w", err))
+		return
+	}
+	if options.Before == "" && predicate == "" {
+		writeAdminError(w, http.StatusBadRequest, "invalid_request_error", errors.New("before: required without predicate"))
+		return
+	}
+	if options.Before != "" {
+		if err = validateBefore(options.Before); err != nil {
+			writeAdminError(w, http.StatusBadRequest, "invalid_request_error", fmt.Errorf("before: %w", err))
+			return
+		}
+	}
+	rowsAffected, err := cleanupRequests(options.Before, predicate, options.NoVacuum)
+	if err != nil {
+		writeAdminQueryError(w, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, object{"cleanup": rowsAffected})
+}
+
+func getAdminRequest(w http.ResponseWriter, r *http.Request) (*Request, bool) {
+	var (
+		id        int64
+		chatcmpl  string
+		requestID string
+		ident     = r.PathValue("ident")
+	)
+	key, value, found := strings.Cut(ident, "=")
+	if !found {
+		key, value = "id", ident
+	}
+	switch key {
+	case "id":
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			writeAdminError(w, http.StatusBadRequest, "invalid_request_error", fmt.Errorf("id: invalid value %q", value))
+			return nil, false
+		}
+		id = parsed
+	case "chatcmpl":
+		chatcmpl = value
+	case "requestid":
+		requestID = value
+	}
+	if id == 0 && chatcmpl == "" && requestID == "" {
+		writeAdminError(w, http.StatusBadRequest, "invalid_request_error",
+			fmt.Errorf("ident: invalid ident %q, expected one of id=, chatcmpl= and requestid=", ident))
+		return nil, false
+	}
+	request, err := persistence.GetRequest(id, chatcmpl, requestID)
+	if err != nil {
+		writeAdminQueryError(w, err)
+		return nil, false
+	}
+	return request, true
+}
+
+// writeAdminQueryError reports errors made by users, such as predicates that
+// reference unknown fields, as bad requests.
+func writeAdminQueryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeAdminError(w, http.StatusNotFound, "resource_not_found_error", sql.ErrNoRows)
+	case errors.As(err, new(sqlite3.Error)):
+		writeAdminError(w, http.StatusBadRequest, "invalid_request_error", err)
+	default:
+		writeAdminError(w, http.StatusInternalServerError, "server_error", err)
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, statusCode int, typ string, err error) {
+	writeAdminJSON(w, statusCode, object{
+		"error": object{
+			"type":    typ,
+			"message": err.Error(),
+		},
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(v)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/MoonshotAI/moonpalace/redact"
+)
+
+func TestAdminCleanup(t *testing.T) {
+	var testcases = []struct {
+		name       string
+		url        string
+		header     map[string]string
+		body       string
+		statusCode int
+		deleted    bool
+	}{
+		{
+			name:       "form",
+			url:        "/_palace/api/cleanup?before=2099-01-01",
+			header:     map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			body:       "before=2099-01-01",
+			statusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:       "text",
+			url:        "/_palace/api/cleanup",
+			header:     map[string]string{"Content-Type": "text/plain"},
+			body:       `{"before": "2099-01-01", "no_vacuum": true}`,
+			statusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "cross-site",
+			url:  "/_palace/api/cleanup",
+			header: map[string]string{
+				"Content-Type":   "application/json",
+				"Sec-Fetch-Site": "cross-site",
+			},
+			body:       `{"before": "2099-01-01", "no_vacuum": true}`,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name: "foreign origin",
+			url:  "/_palace/api/cleanup",
+			header: map[string]string{
+				"Content-Type": "application/json",
+				"Origin":       "https://attacker.test",
+			},
+			body:       `{"before": "2099-01-01", "no_vacuum": true}`,
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "before in query",
+			url:        "/_palace/api/cleanup?before=2099-01-01",
+			header:     map[string]string{"Content-Type": "application/json"},
+			body:       `{"no_vacuum": true}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "unmatched predicate",
+			url:        "/_palace/api/cleanup",
+			header:     map[string]string{"Content-Type": "application/json"},
+			body:       `{"predicate": ["response_status_code == 500"], "no_vacuum": true}`,
+			statusCode: http.StatusOK,
+		},
+		{
+			name: "same origin",
+			url:  "/_palace/api/cleanup",
+			header: map[string]string{
+				"Content-Type":   "application/json; charset=utf-8",
+				"Origin":         "http://example.com",
+				"Sec-Fetch-Site": "same-origin",
+			},
+			body:       `{"predicate": ["response_status_code == 200"], "no_vacuum": true}`,
+			statusCode: http.StatusOK,
+			deleted:    true,
+		},
+	}
+	for _, testcase := range testcases {
+		usePersistenceForTest(t)
+		id := storeTestRequest(t,
+			`{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}]}`,
+			`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hello"}}]}`,
+		)
+		mux := http.NewServeMux()
+		registerAdminAPI(mux)
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, testcase.url, strings.NewReader(testcase.body))
+		for key, value := range testcase.header {
+			request.Header.Set(key, value)
+		}
+		mux.ServeHTTP(recorder, request)
+		if recorder.Code != testcase.statusCode {
+			t.Errorf("%s: status code: want %d, got %d: %s", testcase.name, testcase.statusCode, recorder.Code, recorder.Body)
+		}
+		_, err := persistence.GetRequest(id, "", "")
+		if deleted := err != nil; deleted != testcase.deleted {
+			t.Errorf("%s: want deleted %v, got %v", testcase.name, testcase.deleted, deleted)
+		}
+	}
+}
+
+// newAdminTestRequest creates a request received by a proxy listening on port
+// 9988 of 127.0.0.1, with the given Host.
+func newAdminTestRequest(method string, target string, host string) *http.Request {
+	request := httptest.NewRequest(method, target, nil)
+	request.Host = host
+	localAddr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9988}
+	return request.WithContext(context.WithValue(request.Context(), http.LocalAddrContextKey, localAddr))
+}
+
+func TestAdminHost(t *testing.T) {
+	usePersistenceForTest(t)
+	var testcases = []struct {
+		name       string
+		url        string
+		host       string
+		statusCode int
+	}{
+		{name: "127.0.0.1", url: "/_palace/api/requests", host: "127.0.0.1:9988", statusCode: http.StatusOK},
+		{name: "localhost", url: "/_palace/api/requests", host: "localhost:9988", statusCode: http.StatusOK},
+		{name: "[::1]", url: "/_palace/api/requests", host: "[::1]:9988", statusCode: http.StatusOK},
+		{name: "dashboard", url: "/_palace/", host: "127.0.0.1:9988", statusCode: http.StatusOK},
+		{name: "foreign host", url: "/_palace/api/requests", host: "attacker.example:9988", statusCode: http.StatusForbidden},
+		{name: "foreign host of dashboard", url: "/_palace/", host: "attacker.example:9988", statusCode: http.StatusForbidden},
+		{name: "foreign host of tail", url: "/_palace/api/tail", host: "attacker.example:9988", statusCode: http.StatusForbidden},
+		{name: "other port", url: "/_palace/api/requests", host: "127.0.0.1:80", statusCode: http.StatusForbidden},
+		{name: "no port", url: "/_palace/api/requests", host: "localhost", statusCode: http.StatusForbidden},
+	}
+	mux := http.NewServeMux()
+	registerDashboard(mux)
+	for _, testcase := range testcases {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, newAdminTestRequest(http.MethodGet, testcase.url, testcase.host))
+		if recorder.Code != testcase.statusCode {
+			t.Errorf("%s: status code: want %d, got %d: %s", testcase.name, testcase.statusCode, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+func TestAdminRedaction(t *testing.T) {
+	usePersistenceForTest(t)
+	rules, err := newRedactor([]*RedactConfig{{Name: "api-key", Regex: `sk-[A-Za-z0-9]+`}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := redactor
+	redactor = rules
+	t.Cleanup(func() { redactor = previous })
+	// The request is captured before the rules are configured.
+	id := storeTestRequest(t,
+		`{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"my key is sk-abcdef123456"}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hello"}}]}`,
+	)
+	var testcases = []struct {
+		name string
+		url  string
+	}{
+		{name: "list", url: "/_palace/api/requests?full=true"},
+		{name: "get", url: "/_palace/api/requests/" + strconv.FormatInt(id, 10)},
+	}
+	mux := http.NewServeMux()
+	registerDashboard(mux)
+	for _, testcase := range testcases {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, newAdminTestRequest(http.MethodGet, testcase.url, "127.0.0.1:9988"))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: status code: want %d, got %d: %s", testcase.name, http.StatusOK, recorder.Code, recorder.Body)
+		}
+		if body := recorder.Body.String(); strings.Contains(body, "sk-abcdef123456") || !strings.Contains(body, redact.Masked) {
+			t.Errorf("%s: want the key redacted, got %s", testcase.name, body)
+		}
+	}
+}
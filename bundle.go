@@ -0,0 +1,325 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MoonshotAI/moonpalace/redact"
+)
+
+// bundleManifestName is the name of the manifest in bundles, next to the files
+// of the exported requests.
+const bundleManifestName = "manifest.json"
+
+type bundleManifest struct {
+	Version    string           `json:"moonpalace_version"`
+	CreatedAt  string           `json:"created_at"`
+	Predicates []string         `json:"predicates,omitempty"`
+	Count      int              `json:"count"`
+	Categories map[string]int   `json:"categories"`
+	Tags       map[string]int   `json:"tags"`
+	Redaction  *bundleRedaction `json:"redaction"`
+	Files      []*bundleFile    `json:"files"`
+}
+
+type bundleRedaction struct {
+	Rules []*bundleRedactionRule `json:"rules"`
+	// Redacted is the number of values redacted on export, values redacted on
+	// capture are not counted.
+	Redacted int `json:"redacted"`
+}
+
+type bundleRedactionRule struct {
+	Name     string   `json:"name,omitempty"`
+	Regex    string   `json:"regex,omitempty"`
+	JSONPath string   `json:"json_path,omitempty"`
+	Header   string   `json:"header,omitempty"`
+	In       []string `json:"in,omitempty"`
+	Mode     string   `json:"mode,omitempty"`
+}
+
+type bundleFile struct {
+	Name     string   `json:"name"`
+	ID       int64    `json:"moonpalace_id"`
+	Ident    string   `json:"ident"`
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+func newBundleManifest(predicates []string) *bundleManifest {
+	manifest := &bundleManifest{
+		Version:    MoonPalace.Version,
+		CreatedAt:  time.Now().Format(time.DateTime),
+		Predicates: predicates,
+		Categories: make(map[string]int, 3),
+		Tags:       make(map[string]int),
+		Redaction:  &bundleRedaction{Rules: make([]*bundleRedactionRule, 0, len(MoonConfig.Redact))},
+		Files:      make([]*bundleFile, 0),
+	}
+	for _, rule := range MoonConfig.Redact {
+		if rule == nil {
+			continue
+		}
+		mode := strings.ToLower(rule.Mode)
+		if mode == "" {
+			mode = redact.ModeMask
+		}
+		manifest.Redaction.Rules = append(manifest.Redaction.Rules, &bundleRedactionRule{
+			Name:     rule.Name,
+			Regex:    rule.Regex,
+			JSONPath: rule.JSONPath,
+			Header:   rule.Header,
+			In:       rule.In,
+			Mode:     mode,
+		})
+	}
+	return manifest
+}
+
+// add records the request exported to the file named name.
+func (m *bundleManifest) add(name string, request *Request, redacted int) {
+	m.Count++
+	category := request.Category
+	if category == "" {
+		category = "uncategorized"
+	}
+	m.Categories[category]++
+	for _, tag := range request.Tags {
+		m.Tags[tag]++
+	}
+	m.Redaction.Redacted += redacted
+	m.Files = append(m.Files, &bundleFile{
+		Name:     name,
+		ID:       request.ID,
+		Ident:    request.Ident(),
+		Category: request.Category,
+		Tags:     request.Tags,
+	})
+}
+
+type bundleWriter interface {
+	add(name string, data []byte) error
+	Close() error
+}
+
+// newBundleWriter chooses the format of the bundle by the extension of path,
+// which is either a gzipped tarball or a zip archive.
+func newBundleWriter(w io.Writer, path string) (bundleWriter, error) {
+	switch lower := strings.ToLower(path); {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		gz := gzip.NewWriter(w)
+		return &tarBundle{gz: gz, tw: tar.NewWriter(gz), modTime: time.Now()}, nil
+	case strings.HasSuffix(lower, ".zip"):
+		return &zipBundle{zw: zip.NewWriter(w), modTime: time.Now()}, nil
+	default:
+		return nil, fmt.Errorf("bundle: unknown format of %s, expected one of .tar.gz, .tgz and .zip", filepath.Base(path))
+	}
+}
+
+type tarBundle struct {
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	modTime time.Time
+}
+
+func (b *tarBundle) add(name string, data []byte) error {
+	if err := b.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0644,
+		ModTime:  b.modTime,
+	}); err != nil {
+		return err
+	}
+	_, err := b.tw.Write(data)
+	return err
+}
+
+func (b *tarBundle) Close() error {
+	if err := b.tw.Close(); err != nil {
+		return err
+	}
+	return b.gz.Close()
+}
+
+type zipBundle struct {
+	zw      *zip.Writer
+	modTime time.Time
+}
+
+func (b *zipBundle) add(name string, data []byte) error {
+	w, err := b.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: b.modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (b *zipBundle) Close() error {
+	return b.zw.Close()
+}
+
+// writeBundle writes the requests to a bundle at path, each of them is named by
+// genFilename, along with a manifest. label is called on each request after it
+// is redacted, to apply the labels given by command-line flags. The bundle is
+// removed if any error occurs.
+func writeBundle(
+	path string,
+	requests []*Request,
+	manifest *bundleManifest,
+	label func(*Request),
+	escapeHTML bool,
+) (err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+	bundle, err := newBundleWriter(file, path)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]struct{}, len(requests))
+	for _, request := range requests {
+		redacted := len(redactRequest(request))
+		label(request)
+		name := uniqueFilename(names, request)
+		var data []byte
+		if data, err = encodeRequest(request, escapeHTML); err != nil {
+			return err
+		}
+		if err = bundle.add(name, data); err != nil {
+			return err
+		}
+		manifest.add(name, request, redacted)
+	}
+	var manifestJSON bytes.Buffer
+	encoder := json.NewEncoder(&manifestJSON)
+	encoder.SetIndent("", "    ")
+	encoder.SetEscapeHTML(false)
+	if err = encoder.Encode(manifest); err != nil {
+		return err
+	}
+	if err = bundle.add(bundleManifestName, manifestJSON.Bytes()); err != nil {
+		return err
+	}
+	return bundle.Close()
+}
+
+// encodeRequest encodes the request in the same way as the export command.
+func encodeRequest(request *Request, escapeHTML bool) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "    ")
+	encoder.SetEscapeHTML(escapeHTML)
+	if err := encoder.Encode(request); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isBundle reports whether path is named as a bundle written by writeBundle.
+func isBundle(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") || strings.HasSuffix(lower, ".zip")
+}
+
+// readBundle calls fn on each JSON file in the bundle at path in order, except
+// for the manifest.
+func readBundle(path string, fn func(name string, data []byte) error) error {
+	if strings.HasSuffix(strings.ToLower(path), ".zip") {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if !isBundleFile(f.Name) || f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			if err = fn(f.Name, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg || !isBundleFile(header.Name) {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err = fn(header.Name, data); err != nil {
+			return err
+		}
+	}
+}
+
+func isBundleFile(name string) bool {
+	return strings.HasSuffix(name, ".json") && filepath.Base(name) != bundleManifestName
+}
+
+// uniqueFilename returns the filename of the request which is not in names, and
+// adds it to names. Filenames of requests without chatcmpl and request id may
+// collide, they are prefixed with the ids of the requests then.
+func uniqueFilename(names map[string]struct{}, request *Request) string {
+	name := genFilename(request)
+	if _, ok := names[name]; ok {
+		name = strconv.FormatInt(request.ID, 10) + "-" + name
+	}
+	names[name] = struct{}{}
+	return name
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+// Bodies are stored as gzip-compressed BLOBs, rows captured before bodies were
+// compressed keep their bodies as TEXT until they are compacted, so that bodies
+// are only decompressed if they start with the magic number of gzip.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// compressBody compresses the body with a writer from gzipWriterPool, empty
+// bodies are stored as NULL.
+func compressBody(body []byte) []byte {
+	if len(body) == 0 {
+		return nil
+	}
+	var buffer bytes.Buffer
+	gzipWriter := getGzipWriter(&buffer)
+	defer putGzipWriter(gzipWriter)
+	// Writes to bytes.Buffer never fail.
+	gzipWriter.Write(body)
+	gzipWriter.Close()
+	return buffer.Bytes()
+}
+
+// decompressBody decrypts the body first if it is encrypted.
+func decompressBody(data []byte) ([]byte, error) {
+	data, err := decryptField(data)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	gzipReader, err := getGzipReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer putGzipReader(gzipReader)
+	return io.ReadAll(gzipReader)
+}
+
+func sqliteCompress(body string) []byte {
+	return compressBody([]byte(body))
+}
+
+// sqliteDecompress returns bodies as TEXT, so that they can be used by other
+// functions such as json_extract and merge_cmpl.
+func sqliteDecompress(value any) (any, error) {
+	data, ok := value.([]byte)
+	if !ok || data == nil {
+		return value, nil
+	}
+	body, err := decompressBody(data)
+	if err != nil {
+		return nil, err
+	}
+	return string(body), nil
+}
+
+// vacuum rebuilds the database file to release the space of deleted or
+// compacted rows. VACUUM cannot run within a transaction, while every method of
+// Persistence runs within one, so a separate connection is used.
+func vacuum() error {
+	db, err := sql.Open(sqlDriver, "file:"+getPalaceSqlite())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec("vacuum;")
+	return err
+}
+
+func dbCompactCommand() *cobra.Command {
+	var noVacuum bool
+	cmd := &cobra.Command{
+		Use:   "compact",
+		Short: "Compress bodies of requests captured by earlier versions of MoonPalace",
+		Run: func(cmd *cobra.Command, args []string) {
+			sizeBefore, err := databaseSize()
+			if err != nil {
+				logFatal(err)
+			}
+			result, err := persistence.CompactRequests()
+			if err != nil {
+				logFatal(err)
+			}
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				logFatal(err)
+			}
+			if !noVacuum {
+				if err = vacuum(); err != nil {
+					logFatal(err)
+				}
+			}
+			sizeAfter, err := databaseSize()
+			if err != nil {
+				logFatal(err)
+			}
+			t.AppendRows([]table.Row{
+				{"compact", rowsAffected},
+				{"size_before", formatSize(sizeBefore)},
+				{"size_after", formatSize(sizeAfter)},
+			})
+			t.Render()
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.BoolVar(&noVacuum, "no-vacuum", false, "do not rebuild the database file, the space of compacted rows is reused by new rows but not released")
+	return cmd
+}
+
+func databaseSize() (int64, error) {
+	stat, err := os.Stat(getPalaceSqlite())
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
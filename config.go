@@ -5,8 +5,18 @@ import "gopkg.in/yaml.v3"
 var MoonConfig Config
 
 type Config struct {
-	Endpoint string       `yaml:"endpoint"`
-	Start    *StartConfig `yaml:"start"`
+	Endpoint string          `yaml:"endpoint"`
+	Routes   []*RouteConfig  `yaml:"routes"`
+	Pricing  []*PriceConfig  `yaml:"pricing"`
+	Redact   []*RedactConfig `yaml:"redact"`
+	// RedactSecret is the key of the hashes of values redacted in mode hash,
+	// which is overridden by MOONPALACE_REDACT_SECRET.
+	RedactSecret string           `yaml:"redact-secret"`
+	Storage      []*StorageConfig `yaml:"storage"`
+	Source       string           `yaml:"source"`
+	Retention    *RetentionConfig `yaml:"retention"`
+	Start        *StartConfig     `yaml:"start"`
+	Replay       *ReplayConfig    `yaml:"replay"`
 }
 
 func init() {
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+type unlinkedRequest struct {
+	ID           int64 `db:"id"`
+	RequestBody  Body  `db:"request_body"`
+	ResponseBody Body  `db:"response_body"`
+}
+
+type conversationTurn struct {
+	ID               int64  `db:"id"`
+	ConversationID   int64  `db:"conversation_id"`
+	ConversationTurn int64  `db:"conversation_turn"`
+	ReplyHash        string `db:"reply_hash"`
+}
+
+// hashConversation hashes every prefix of the messages in the same way as
+// hashPrefix, along with the messages followed by the assistant reply. A request
+// continues an earlier one when one of its prefix hashes is the reply hash of
+// the earlier request, that is, its messages extend the earlier messages plus
+// the earlier reply.
+func hashConversation(requestBody string, responseBody string) (prefixHashList []string, replyHash string) {
+	var requestObject struct {
+		Messages []*MoonshotMessage `json:"messages"`
+		Tools    json.RawMessage    `json:"tools"`
+	}
+	if err := json.Unmarshal([]byte(requestBody), &requestObject); err != nil || len(requestObject.Messages) == 0 {
+		return nil, ""
+	}
+	messages := requestObject.Messages
+	if reply := choiceMessage(gjson.Get(responseBody, "choices.0")); reply.IsObject() {
+		var replyMessage MoonshotMessage
+		if err := json.Unmarshal([]byte(reply.Raw), &replyMessage); err == nil {
+			if replyMessage.Role == "" {
+				replyMessage.Role = "assistant"
+			}
+			messages = append(messages[:len(messages):len(messages)], &replyMessage)
+		}
+	}
+	// The hash list is pooled by hashPrefix, so it is cloned before the next call.
+	hashList, _ := hashPrefix(-1, requestObject.Tools, messages)
+	hashList = slices.Clone(hashList)
+	if len(messages) > len(requestObject.Messages) {
+		replyHash = hashList[len(hashList)-1]
+		hashList = hashList[:len(hashList)-1]
+	}
+	return hashList, replyHash
+}
+
+// linkConversation links the request to the conversation of the request it
+// continues with the longest messages, or starts a new conversation with the
+// request's own id.
+func linkConversation(id int64, requestBody string, responseBody string) error {
+	prefixHashList, replyHash := hashConversation(requestBody, responseBody)
+	if len(prefixHashList) == 0 {
+		return nil
+	}
+	var (
+		conversationID = id
+		turnIndex      = int64(1)
+	)
+	turns, err := persistence.ListConversationTurns(id, prefixHashList)
+	if err != nil {
+		return err
+	}
+	var (
+		previous      *conversationTurn
+		previousIndex = -1
+	)
+	for _, turn := range turns {
+		index := slices.Index(prefixHashList, turn.ReplyHash)
+		if index > previousIndex || (previous != nil && index == previousIndex && turn.ID > previous.ID) {
+			previous, previousIndex = turn, index
+		}
+	}
+	if previous != nil {
+		conversationID = previous.ConversationID
+		turnIndex = previous.ConversationTurn + 1
+	}
+	return persistence.SetConversation(id, conversationID, turnIndex, replyHash)
+}
+
+// linkConversations links requests captured before the columns of
+// conversations were introduced, in the order they were captured. Failed
+// attempts which were retried are skipped if skipAttempts, since they are not
+// turns of conversations, it is false only before the column of attempts is
+// added.
+func linkConversations(skipAttempts bool) error {
+	requests, err := persistence.ListUnlinkedRequests(skipAttempts)
+	if err != nil {
+		return err
+	}
+	for _, request := range requests {
+		if err = linkConversation(request.ID, request.RequestBody.String, request.ResponseBody.String); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// conversationTranscript picks one request of each turn, walking back from the
+// latest request. Regenerated replies start branches in a conversation, only the
+// branch of the latest request is shown, so each turn is the request whose reply
+// is continued by the next turn, or the latest one of the turn when none of the
+// replies are.
+func conversationTranscript(requests []*Request) []*Request {
+	if len(requests) == 0 {
+		return nil
+	}
+	last := requests[len(requests)-1]
+	for _, request := range requests {
+		if request.ConversationTurn.Int64 > last.ConversationTurn.Int64 ||
+			(request.ConversationTurn.Int64 == last.ConversationTurn.Int64 && request.ID > last.ID) {
+			last = request
+		}
+	}
+	transcript := []*Request{last}
+	for next := last; next.ConversationTurn.Int64 > 1; {
+		var (
+			prefixHashList, _ = hashConversation(next.RequestBody.String, "")
+			previous          *Request
+		)
+		for i := len(requests) - 1; i >= 0; i-- {
+			request := requests[i]
+			if request.ID >= next.ID || request.ConversationTurn.Int64 != next.ConversationTurn.Int64-1 {
+				continue
+			}
+			if previous == nil {
+				previous = request
+			}
+			if request.ReplyHash.Valid && slices.Contains(prefixHashList, request.ReplyHash.String) {
+				previous = request
+				break
+			}
+		}
+		if previous == nil {
+			break
+		}
+		transcript = append(transcript, previous)
+		next = previous
+	}
+	slices.Reverse(transcript)
+	return transcript
+}
+
+type transcriptTurn struct {
+	Turn      int64             `json:"turn"`
+	ID        int64             `json:"id"`
+	ChatCmpl  string            `json:"chatcmpl,omitempty"`
+	Requested string            `json:"requested_at"`
+	Messages  []json.RawMessage `json:"messages"`
+	Reply     json.RawMessage   `json:"reply,omitempty"`
+}
+
+// transcriptTurns leaves out the messages which have been shown in previous
+// turns, which are the previous messages and the previous reply.
+func transcriptTurns(transcript []*Request) []*transcriptTurn {
+	turns := make([]*transcriptTurn, 0, len(transcript))
+	shown := 0
+	for _, request := range transcript {
+		var (
+			messages = gjson.Get(request.RequestBody.String, "messages").Array()
+			turn     = &transcriptTurn{
+				Turn:      request.ConversationTurn.Int64,
+				ID:        request.ID,
+				ChatCmpl:  request.ChatCmpl(),
+				Requested: request.CreatedAt.Format(time.DateTime),
+				Messages:  make([]json.RawMessage, 0, len(messages)),
+			}
+		)
+		for _, message := range messages[min(shown, len(messages)):] {
+			turn.Messages = append(turn.Messages, json.RawMessage(message.Raw))
+		}
+		shown = len(messages)
+		if reply := choiceMessage(gjson.Get(request.ResponseBody.String, "choices.0")); reply.IsObject() {
+			turn.Reply = json.RawMessage(reply.Raw)
+			shown++
+		}
+		turns = append(turns, turn)
+	}
+	return turns
+}
+
+func conversationCommand() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "conversation ID",
+		Short: "Show the conversation of a Moonshot AI request as one transcript",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				logFatal(fmt.Errorf("invalid id %q", args[0]))
+			}
+			if err = linkConversations(true); err != nil {
+				logFatal(err)
+			}
+			request, err := persistence.GetRequest(id, "", "")
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					logFatal(sql.ErrNoRows)
+				}
+				logFatal(err)
+			}
+			if !request.ConversationID.Valid {
+				logFatal(fmt.Errorf("request %d is not a chat completions request", id))
+			}
+			requests, err := persistence.ListConversation(request.ConversationID.Int64)
+			if err != nil {
+				logFatalQuery(err)
+			}
+			turns := transcriptTurns(conversationTranscript(requests))
+			if asJSON {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "    ")
+				encoder.SetEscapeHTML(false)
+				if err = encoder.Encode(map[string]any{
+					"conversation_id": request.ConversationID.Int64,
+					"requests":        len(requests),
+					"turns":           turns,
+				}); err != nil {
+					logFatal(err)
+				}
+				return
+			}
+			for _, turn := range turns {
+				header := fmt.Sprintf("── turn %d · id=%d", turn.Turn, turn.ID)
+				if turn.ChatCmpl != "" {
+					header += " · " + turn.ChatCmpl
+				}
+				fmt.Println(boldWhite(header + " · " + turn.Requested))
+				for _, message := range turn.Messages {
+					printTranscriptMessage(gjson.ParseBytes(message))
+				}
+				if turn.Reply != nil {
+					printTranscriptMessage(gjson.ParseBytes(turn.Reply))
+				}
+			}
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.BoolVar(&asJSON, "json", false, "output in JSON format")
+	return cmd
+}
+
+func printTranscriptMessage(message gjson.Result) {
+	role := message.Get("role").String()
+	if role == "" {
+		role = "assistant"
+	}
+	if name := message.Get("name").String(); name != "" {
+		role += " (" + name + ")"
+	}
+	var text strings.Builder
+	if content := message.Get("content"); content.IsArray() {
+		content.ForEach(func(_, part gjson.Result) bool {
+			if part.Get("type").String() == "text" {
+				text.WriteString(part.Get("text").String())
+			} else {
+				text.WriteString("[" + part.Get("type").String() + "]")
+			}
+			return true
+		})
+	} else {
+		text.WriteString(content.String())
+	}
+	fmt.Printf("%s %s\n", boldYellow(role+":"), text.String())
+	message.Get("tool_calls").ForEach(func(_, call gjson.Result) bool {
+		fmt.Printf("  %s %s(%s)\n",
+			boldGreen("→"),
+			call.Get("function.name").String(),
+			call.Get("function.arguments").String(),
+		)
+		return true
+	})
+	fmt.Println()
+}
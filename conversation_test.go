@@ -0,0 +1,198 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/MoonshotAI/moonpalace/storage"
+)
+
+func TestHashConversation(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		requestBody  string
+		responseBody string
+		prefixes     int
+		reply        bool
+	}{
+		{
+			name:         "completion",
+			requestBody:  `{"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`,
+			responseBody: `{"choices":[{"index":0,"message":{"role":"assistant","content":"hello"}}]}`,
+			prefixes:     2,
+			reply:        true,
+		},
+		{
+			name:         "merged event stream",
+			requestBody:  `{"messages":[{"role":"user","content":"hi"}]}`,
+			responseBody: `{"choices":[{"index":0,"delta":{"content":"hello"}}]}`,
+			prefixes:     1,
+			reply:        true,
+		},
+		{
+			name:         "failed request",
+			requestBody:  `{"messages":[{"role":"user","content":"hi"}]}`,
+			responseBody: `{"error":{"type":"rate_limit_reached_error"}}`,
+			prefixes:     1,
+		},
+		{
+			name:        "no messages",
+			requestBody: `{"model":"moonshot-v1-8k"}`,
+		},
+	}
+	for _, testcase := range testcases {
+		prefixHashList, replyHash := hashConversation(testcase.requestBody, testcase.responseBody)
+		if len(prefixHashList) != testcase.prefixes {
+			t.Errorf("%s: want %d prefix hashes, got %d", testcase.name, testcase.prefixes, len(prefixHashList))
+		}
+		if (replyHash != "") != testcase.reply {
+			t.Errorf("%s: want reply hash %v, got %q", testcase.name, testcase.reply, replyHash)
+		}
+	}
+	// The reply hash of a request is a prefix hash of the request continuing it.
+	_, replyHash := hashConversation(
+		`{"messages":[{"role":"user","content":"hi"}]}`,
+		`{"choices":[{"index":0,"message":{"role":"assistant","content":"hello"}}]}`,
+	)
+	prefixHashList, _ := hashConversation(
+		`{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"bye"}]}`,
+		"",
+	)
+	if !slices.Contains(prefixHashList, replyHash) {
+		t.Errorf("continued request: want reply hash %q in %v", replyHash, prefixHashList)
+	}
+}
+
+func TestLinkConversations(t *testing.T) {
+	usePersistenceForTest(t)
+	var (
+		first = storeTestRequest(t,
+			`{"messages":[{"role":"user","content":"hi"}]}`,
+			`{"choices":[{"index":0,"message":{"role":"assistant","content":"hello"}}]}`,
+		)
+		streamed = storeTestRequest(t,
+			`{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"weather"}]}`,
+			"data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"sun\"}}]}\n\n"+
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ny\"},\"finish_reason\":\"stop\"}]}\n\n"+
+				"data: [DONE]",
+		)
+		regenerated = storeTestRequest(t,
+			`{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"weather"}]}`,
+			`{"choices":[{"index":0,"message":{"role":"assistant","content":"rainy"}}]}`,
+		)
+		continued = storeTestRequest(t,
+			`{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"weather"},{"role":"assistant","content":"sunny"},{"role":"user","content":"thanks"}]}`,
+			`{"choices":[{"index":0,"message":{"role":"assistant","content":"you are welcome"}}]}`,
+		)
+		other = storeTestRequest(t,
+			`{"messages":[{"role":"user","content":"weather"}]}`,
+			`{"choices":[{"index":0,"message":{"role":"assistant","content":"sunny"}}]}`,
+		)
+	)
+	if err := linkConversations(true); err != nil {
+		t.Fatal(err)
+	}
+	var testcases = []struct {
+		name         string
+		id           int64
+		conversation int64
+		turn         int64
+	}{
+		{name: "first", id: first, conversation: first, turn: 1},
+		{name: "streamed", id: streamed, conversation: first, turn: 2},
+		{name: "regenerated", id: regenerated, conversation: first, turn: 2},
+		{name: "continued", id: continued, conversation: first, turn: 3},
+		{name: "other", id: other, conversation: other, turn: 1},
+	}
+	for _, testcase := range testcases {
+		request, err := persistence.GetRequest(testcase.id, "", "")
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		if request.ConversationID.Int64 != testcase.conversation || request.ConversationTurn.Int64 != testcase.turn {
+			t.Errorf("%s: want conversation %d turn %d, got conversation %d turn %d",
+				testcase.name,
+				testcase.conversation,
+				testcase.turn,
+				request.ConversationID.Int64,
+				request.ConversationTurn.Int64,
+			)
+		}
+	}
+	requests, err := persistence.ListConversation(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The regenerated reply starts a branch, which is not continued by the
+	// latest request.
+	turns := transcriptTurns(conversationTranscript(requests))
+	var want = []struct {
+		id       int64
+		messages int
+		reply    string
+	}{
+		{id: first, messages: 1, reply: "hello"},
+		{id: streamed, messages: 1, reply: "sunny"},
+		{id: continued, messages: 1, reply: "you are welcome"},
+	}
+	if len(turns) != len(want) {
+		t.Fatalf("transcript: want %d turns, got %d", len(want), len(turns))
+	}
+	for i, turn := range turns {
+		if turn.ID != want[i].id || turn.Turn != int64(i+1) || len(turn.Messages) != want[i].messages {
+			t.Errorf("transcript[%d]: want id %d turn %d with %d messages, got id %d turn %d with %d messages",
+				i, want[i].id, i+1, want[i].messages, turn.ID, turn.Turn, len(turn.Messages))
+		}
+		if reply := gjson.GetBytes(turn.Reply, "content").String(); reply != want[i].reply {
+			t.Errorf("transcript[%d]: want reply %q, got %q", i, want[i].reply, reply)
+		}
+	}
+}
+
+func TestLinkConversationsAttempts(t *testing.T) {
+	usePersistenceForTest(t)
+	const requestBody = `{"messages":[{"role":"user","content":"hi"}]}`
+	store := func(attempt int, statusCode int, responseBody string) int64 {
+		id, err := (sqliteStorage{}).Store(&storage.Record{
+			RequestID:          "moonpalace-1",
+			RequestMethod:      "POST",
+			RequestPath:        "/v1/chat/completions",
+			ResponseStatusCode: statusCode,
+			RequestBody:        []byte(requestBody),
+			ResponseBody:       []byte(responseBody),
+			Attempt:            attempt,
+			CreatedAt:          time.Now(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	var (
+		failed = store(1, 429, `{"error":{"type":"rate_limit_reached_error"}}`)
+		last   = store(2, 200, `{"choices":[{"index":0,"message":{"role":"assistant","content":"hello"}}]}`)
+	)
+	if err := linkConversations(true); err != nil {
+		t.Fatal(err)
+	}
+	var testcases = []struct {
+		name   string
+		id     int64
+		linked bool
+	}{
+		{name: "failed attempt", id: failed},
+		{name: "last attempt", id: last, linked: true},
+	}
+	for _, testcase := range testcases {
+		request, err := persistence.GetRequest(testcase.id, "", "")
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		if request.ConversationID.Valid != testcase.linked {
+			t.Errorf("%s: want linked %v, got conversation %v", testcase.name, testcase.linked, request.ConversationID)
+		}
+	}
+}
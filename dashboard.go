@@ -0,0 +1,26 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed dashboard
+var dashboardFS embed.FS
+
+const dashboardPrefix = "/_palace/"
+
+// registerDashboard serves the embedded single-page dashboard and the admin API
+// it is built on, both of them are only served to requests whose Host is the
+// proxy itself.
+func registerDashboard(mux *http.ServeMux) {
+	static, err := fs.Sub(dashboardFS, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	palace := http.NewServeMux()
+	palace.Handle("GET "+dashboardPrefix, http.StripPrefix(dashboardPrefix, http.FileServerFS(static)))
+	registerAdminAPI(palace)
+	mux.Handle(dashboardPrefix, guardAdminHost(palace))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Formats of the export command, datasets are written as one sample per line.
+const (
+	exportFormatJSON          = "json"
+	exportFormatFinetuneJSONL = "finetune-jsonl"
+	exportFormatEvalJSONL     = "eval-jsonl"
+)
+
+// datasetSample is a line of the datasets in the format of OpenAI fine-tuning
+// files, which is the request messages followed by the assistant reply. Samples
+// of eval datasets carry metadata of the requests in addition.
+type datasetSample struct {
+	Messages []json.RawMessage `json:"messages"`
+	Tools    json.RawMessage   `json:"tools,omitempty"`
+	Metadata *datasetMetadata  `json:"metadata,omitempty"`
+}
+
+type datasetMetadata struct {
+	ID       int64    `json:"moonpalace_id"`
+	ChatCmpl string   `json:"chatcmpl,omitempty"`
+	Model    string   `json:"model,omitempty"`
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Note     string   `json:"note,omitempty"`
+}
+
+type datasetResult struct {
+	Written    int
+	Duplicates int
+	// Unusable is the number of requests which are not chat completions, or have
+	// no assistant reply.
+	Unusable int
+}
+
+// writeDataset writes the requests as samples in the format, in the order they
+// were made. Samples with the same tools, messages and reply are written once,
+// they are told apart by the hashes of conversations.
+func writeDataset(w io.Writer, requests []*Request, format string) (*datasetResult, error) {
+	requests = slices.Clone(requests)
+	slices.SortFunc(requests, func(a, b *Request) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	var (
+		result = new(datasetResult)
+		seen   = make(map[string]struct{}, len(requests))
+		writer = bufio.NewWriter(w)
+	)
+	for _, request := range requests {
+		sample, key := newDatasetSample(request)
+		if sample == nil {
+			result.Unusable++
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			result.Duplicates++
+			continue
+		}
+		seen[key] = struct{}{}
+		if format == exportFormatEvalJSONL {
+			sample.Metadata = &datasetMetadata{
+				ID:       request.ID,
+				ChatCmpl: request.ChatCmpl(),
+				Model:    gjson.Get(request.RequestBody.String, "model").String(),
+				Category: request.Category,
+				Tags:     request.Tags,
+				Note:     request.Note,
+			}
+		}
+		line, err := json.Marshal(sample)
+		if err != nil {
+			return result, err
+		}
+		writer.Write(line)
+		if err = writer.WriteByte('\n'); err != nil {
+			return result, err
+		}
+		result.Written++
+	}
+	return result, writer.Flush()
+}
+
+// newDatasetSample returns the sample of the request along with the key to
+// deduplicate it, or nil if the request has no assistant reply.
+func newDatasetSample(request *Request) (*datasetSample, string) {
+	if !request.IsChat() || request.HasError() {
+		return nil, ""
+	}
+	requestBody := request.RequestBody.String
+	messages := gjson.Get(requestBody, "messages")
+	if !messages.IsArray() || len(messages.Array()) == 0 {
+		return nil, ""
+	}
+	responseBody := request.ResponseBody.String
+	if request.ResponseContentType.String == "text/event-stream" {
+		responseBody = mergeCompletion(responseBody)
+	}
+	reply := datasetReply(choiceMessage(gjson.Get(responseBody, "choices.0")))
+	if reply == nil {
+		return nil, ""
+	}
+	sample := &datasetSample{Messages: make([]json.RawMessage, 0, len(messages.Array())+1)}
+	for _, message := range messages.Array() {
+		sample.Messages = append(sample.Messages, json.RawMessage(message.Raw))
+	}
+	sample.Messages = append(sample.Messages, reply)
+	if tools := gjson.Get(requestBody, "tools"); tools.IsArray() {
+		sample.Tools = json.RawMessage(tools.Raw)
+	}
+	// The reply hash covers the tools, the messages and the reply, messages which
+	// can not be hashed, such as the ones with images, are compared as they are.
+	_, key := hashConversation(requestBody, responseBody)
+	if key == "" {
+		line, _ := json.Marshal(sample)
+		key = hashKey(string(line))
+	}
+	return sample, key
+}
+
+// datasetReply converts the message of a choice to an assistant message, the
+// indexes of tool calls merged from event streams are left out.
+func datasetReply(message gjson.Result) json.RawMessage {
+	if !message.IsObject() {
+		return nil
+	}
+	type toolCall struct {
+		ID       string          `json:"id,omitempty"`
+		Type     string          `json:"type"`
+		Function json.RawMessage `json:"function"`
+	}
+	reply := struct {
+		Role      string     `json:"role"`
+		Content   *string    `json:"content,omitempty"`
+		ToolCalls []toolCall `json:"tool_calls,omitempty"`
+	}{Role: "assistant"}
+	if content := message.Get("content"); content.Exists() && content.Type != gjson.Null {
+		text := content.String()
+		reply.Content = &text
+	}
+	message.Get("tool_calls").ForEach(func(_, call gjson.Result) bool {
+		function := call.Get("function")
+		if !function.IsObject() {
+			return true
+		}
+		typ := call.Get("type").String()
+		if typ == "" {
+			typ = "function"
+		}
+		reply.ToolCalls = append(reply.ToolCalls, toolCall{
+			ID:       call.Get("id").String(),
+			Type:     typ,
+			Function: json.RawMessage(function.Raw),
+		})
+		return true
+	})
+	if (reply.Content == nil || strings.TrimSpace(*reply.Content) == "") && len(reply.ToolCalls) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func validateExportFormat(format string) error {
+	switch format {
+	case exportFormatJSON, exportFormatFinetuneJSONL, exportFormatEvalJSONL:
+		return nil
+	default:
+		return fmt.Errorf("format: unknown format %q, expected one of json, finetune-jsonl and eval-jsonl", format)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestWriteDataset(t *testing.T) {
+	newRequest := func(id int64, path string, statusCode int64, requestBody string, responseBody string) *Request {
+		contentType := "application/json"
+		if strings.HasPrefix(responseBody, "data:") {
+			contentType = "text/event-stream"
+		}
+		return &Request{
+			ID:                  id,
+			RequestPath:         path,
+			ResponseStatusCode:  sql.NullInt64{Int64: statusCode, Valid: true},
+			ResponseContentType: sql.NullString{String: contentType, Valid: true},
+			RequestBody:         Body{NullString: sql.NullString{String: requestBody, Valid: true}},
+			ResponseBody:        Body{NullString: sql.NullString{String: responseBody, Valid: true}},
+		}
+	}
+	const (
+		chat  = "/v1/chat/completions"
+		hi    = `{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}]}`
+		image = `{"model":"moonshot-v1-8k-vision-preview","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,"}}]}]}`
+		hello = `{"choices":[{"index":0,"message":{"role":"assistant","content":"hello"}}]}`
+	)
+	requests := []*Request{
+		// Requests are written in the order they were made.
+		newRequest(3, chat, 200, hi, `{"choices":[{"index":0,"message":{"role":"assistant","content":"hey"}}]}`),
+		newRequest(1, chat, 200, hi, hello),
+		// Formatting and streaming make no difference.
+		newRequest(2, chat, 200, `{"model": "moonshot-v1-8k", "messages": [{"role": "user", "content": "hi"}]}`,
+			"data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"hello\"}}]}\n\ndata: [DONE]"),
+		newRequest(4, chat, 200, image, hello),
+		newRequest(5, chat, 200, image, hello),
+		newRequest(6, chat, 200, hi, `{"choices":[{"index":0,"message":{"role":"assistant","content":" "}}]}`),
+		newRequest(7, chat, 500, hi, `{"error":{"type":"server_error"}}`),
+		newRequest(8, "/v1/files", 200, "", `{"data":[]}`),
+	}
+	var testcases = []struct {
+		format string
+		want   []string
+	}{
+		{
+			format: exportFormatFinetuneJSONL,
+			want: []string{
+				`{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"}]}`,
+				`{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hey"}]}`,
+				`{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,"}}]},{"role":"assistant","content":"hello"}]}`,
+			},
+		},
+		{
+			format: exportFormatEvalJSONL,
+			want: []string{
+				`{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"}],"metadata":{"moonpalace_id":1,"model":"moonshot-v1-8k"}}`,
+				`{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hey"}],"metadata":{"moonpalace_id":3,"model":"moonshot-v1-8k"}}`,
+				`{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,"}}]},{"role":"assistant","content":"hello"}],"metadata":{"moonpalace_id":4,"model":"moonshot-v1-8k-vision-preview"}}`,
+			},
+		},
+	}
+	for _, testcase := range testcases {
+		var buf bytes.Buffer
+		result, err := writeDataset(&buf, requests, testcase.format)
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.format, err)
+		}
+		if result.Written != 3 || result.Duplicates != 2 || result.Unusable != 3 {
+			t.Errorf("%s: want 3 written, 2 duplicates and 3 unusable, got %+v", testcase.format, result)
+		}
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) != len(testcase.want) {
+			t.Fatalf("%s: want %d lines, got %d", testcase.format, len(testcase.want), len(lines))
+		}
+		for i, line := range lines {
+			if !gjson.Valid(line) || line != testcase.want[i] {
+				t.Errorf("%s: line %d: want %s, got %s", testcase.format, i+1, testcase.want[i], line)
+			}
+		}
+	}
+	// The order of the requests is left intact.
+	if requests[0].ID != 3 {
+		t.Errorf("writeDataset: want requests intact, got id %d first", requests[0].ID)
+	}
+}
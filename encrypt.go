@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+// Headers and bodies are encrypted with AES-256-GCM if a key is given by one of
+// these environment variables, the key is 32 bytes encoded in base64, and the
+// keyfile contains the encoded key.
+const (
+	envEncryptionKey     = "MOONPALACE_KEY"
+	envEncryptionKeyfile = "MOONPALACE_KEYFILE"
+)
+
+// encryptedMagic starts encrypted fields, followed by the nonce and the sealed
+// data. The NUL byte never appears in headers or bodies stored as TEXT, neither
+// does it start a gzip-compressed body.
+var encryptedMagic = []byte{0x00, 'M', 'P', 0x01}
+
+var errNoEncryptionKey = errors.New("the database contains encrypted requests, " +
+	"set " + envEncryptionKey + " or " + envEncryptionKeyfile + " to decrypt them")
+
+var (
+	fieldCipher     cipher.AEAD
+	fieldCipherErr  error
+	fieldCipherOnce sync.Once
+)
+
+// getFieldCipher loads the key once, it returns nil if no key is given.
+func getFieldCipher() (cipher.AEAD, error) {
+	fieldCipherOnce.Do(func() {
+		var encoded string
+		switch keyfile := os.Getenv(envEncryptionKeyfile); {
+		case os.Getenv(envEncryptionKey) != "":
+			encoded = os.Getenv(envEncryptionKey)
+		case keyfile != "":
+			content, err := os.ReadFile(keyfile)
+			if err != nil {
+				fieldCipherErr = fmt.Errorf("%s: %w", envEncryptionKeyfile, err)
+				return
+			}
+			encoded = string(content)
+		default:
+			return
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			fieldCipherErr = fmt.Errorf("encryption key: %w", err)
+			return
+		}
+		if len(key) != 32 {
+			fieldCipherErr = fmt.Errorf("encryption key: expected 32 bytes, got %d bytes", len(key))
+			return
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			fieldCipherErr = fmt.Errorf("encryption key: %w", err)
+			return
+		}
+		fieldCipher, fieldCipherErr = cipher.NewGCM(block)
+	})
+	return fieldCipher, fieldCipherErr
+}
+
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// encryptField encrypts a header or a compressed body if a key is given,
+// otherwise it is returned as it is.
+func encryptField(data []byte) []byte {
+	aead, err := getFieldCipher()
+	if aead == nil || err != nil || len(data) == 0 {
+		return data
+	}
+	return sealField(aead, data)
+}
+
+func sealField(aead cipher.AEAD, data []byte) []byte {
+	headerSize := len(encryptedMagic) + aead.NonceSize()
+	sealed := make([]byte, headerSize, headerSize+len(data)+aead.Overhead())
+	copy(sealed, encryptedMagic)
+	nonce := sealed[len(encryptedMagic):]
+	if _, err := rand.Read(nonce); err != nil {
+		// crypto/rand never fails on supported platforms.
+		panic(err)
+	}
+	return aead.Seal(sealed, nonce, data, nil)
+}
+
+// decryptField decrypts fields encrypted by encryptField, fields stored before
+// a key is given are returned as they are.
+func decryptField(data []byte) ([]byte, error) {
+	if !isEncrypted(data) {
+		return data, nil
+	}
+	aead, err := getFieldCipher()
+	if err != nil {
+		return nil, err
+	}
+	if aead == nil {
+		return nil, errNoEncryptionKey
+	}
+	data = data[len(encryptedMagic):]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("decrypt: truncated field")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("decrypt: the encryption key does not match the one which the request was encrypted with")
+	}
+	return plain, nil
+}
+
+// sqliteEncrypt encrypts a field even if it is TEXT, it fails if no key is
+// given, so that fields are never left unencrypted silently.
+func sqliteEncrypt(value any) (any, error) {
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return value, nil
+	}
+	if isEncrypted(data) || len(data) == 0 {
+		return value, nil
+	}
+	aead, err := getFieldCipher()
+	if err != nil {
+		return nil, err
+	}
+	if aead == nil {
+		return nil, errors.New("no encryption key, set " + envEncryptionKey + " or " + envEncryptionKeyfile)
+	}
+	return sealField(aead, data), nil
+}
+
+// sqliteDecrypt returns headers as TEXT, so that they can be used in predicates.
+func sqliteDecrypt(value any) (any, error) {
+	data, ok := value.([]byte)
+	if !ok || data == nil {
+		return value, nil
+	}
+	plain, err := decryptField(data)
+	if err != nil {
+		return nil, err
+	}
+	return string(plain), nil
+}
+
+func sqliteEncrypted(value any) bool {
+	data, ok := value.([]byte)
+	return ok && isEncrypted(data)
+}
+
+// Header is a column of headers, which are decrypted when they are scanned.
+type Header struct {
+	sql.NullString
+}
+
+func (h *Header) Scan(src any) error {
+	if data, ok := src.([]byte); ok {
+		header, err := decryptField(data)
+		if err != nil {
+			return err
+		}
+		src = string(header)
+	}
+	return h.NullString.Scan(src)
+}
+
+func dbEncryptCommand() *cobra.Command {
+	var noVacuum bool
+	cmd := &cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypt headers and bodies of requests captured without an encryption key",
+		Run: func(cmd *cobra.Command, args []string) {
+			aead, err := getFieldCipher()
+			if err != nil {
+				logFatal(err)
+			}
+			if aead == nil {
+				logFatal(errors.New("no encryption key, set " + envEncryptionKey + " or " + envEncryptionKeyfile))
+			}
+			result, err := persistence.EncryptRequests()
+			if err != nil {
+				logFatal(err)
+			}
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				logFatal(err)
+			}
+			// The plain text of encrypted requests is removed from the full-text
+			// index as well.
+			if err = persistence.createFullTextTable(); err != nil {
+				logFatal(err)
+			}
+			if err = persistence.ClearFullTextIndex(); err != nil {
+				logFatal(err)
+			}
+			if err = persistence.indexNewRequests(); err != nil {
+				logFatal(err)
+			}
+			// Without VACUUM, the plain text is left in free pages of the file.
+			if !noVacuum {
+				if err = vacuum(); err != nil {
+					logFatal(err)
+				}
+			}
+			t.AppendRows([]table.Row{{"encrypt", rowsAffected}})
+			t.Render()
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.BoolVar(&noVacuum, "no-vacuum", false, "do not rebuild the database file, the plain text of encrypted rows may be left in the file")
+	return cmd
+}
@@ -4,9 +4,6 @@
 package main
 
 import (
-	"net/url"
-	"strings"
-
 	"github.com/spf13/cobra"
 )
 
@@ -19,12 +16,6 @@ func init() {
 		if !flags.Changed("endpoint") && MoonConfig.Endpoint != "" {
 			endpoint = MoonConfig.Endpoint
 		}
-		if eUrl, err := url.Parse(endpoint); err == nil {
-			if eUrl.Scheme == "" {
-				eUrl.Scheme = "https"
-			}
-			endpoint = eUrl.String()
-		}
-		endpoint = strings.TrimSuffix(endpoint, "/")
+		endpoint = normalizeEndpoint(endpoint)
 	})
 }
@@ -5,12 +5,15 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/textproto"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/mattn/go-sqlite3"
 	"github.com/spf13/cobra"
 )
 
@@ -19,45 +22,129 @@ func exportCommand() *cobra.Command {
 		id                int64
 		chatcmpl          string
 		requestID         string
+		predicates        []string
 		output            string
 		directory         string
+		bundle            string
+		format            string
 		escapeHTML        bool
 		goodCase, badCase bool
 		tags              []string
 		curl              bool
+		dryRun            bool
 	)
 	cmd := &cobra.Command{
 		Use:   "export",
 		Short: "Export a Moonshot AI request",
 		Run: func(cmd *cobra.Command, args []string) {
-			request, err := persistence.GetRequest(id, chatcmpl, requestID)
-			if err != nil {
-				if errors.Is(err, sql.ErrNoRows) {
-					logFatal(sql.ErrNoRows)
+			// label applies the labels given by flags, which take precedence over
+			// the ones saved by the tag command.
+			label := func(request *Request) {
+				if request.IsChat() {
+					switch {
+					case goodCase:
+						request.Category = categoryGoodCase
+					case badCase:
+						request.Category = categoryBadCase
+					}
+					if len(tags) > 0 {
+						request.Tags = tags
+					}
 				}
+			}
+			if err := validateExportFormat(format); err != nil {
 				logFatal(err)
 			}
-			if curl {
-				if err := writeCurlCommand(os.Stdout, request); err != nil {
+			if format != exportFormatJSON && (bundle != "" || directory != "" || curl || dryRun) {
+				logFatal(fmt.Errorf("--format %s writes to --output only", format))
+			}
+			if len(predicates) > 0 && format == exportFormatJSON && bundle == "" && directory == "" {
+				logFatal(errors.New("--predicate requires either --bundle or --directory"))
+			}
+			var requests []*Request
+			if len(predicates) > 0 {
+				predicate, err := Predicates(predicates).Parse()
+				if err != nil {
+					logFatal(fmt.Errorf("predicate: %w", err))
+				}
+				if requests, err = persistence.ListRequests(0, false, predicate); err != nil {
+					if sqliteErr := new(sqlite3.Error); errors.As(err, sqliteErr) {
+						logFatal(sqliteErr)
+					}
 					logFatal(err)
 				}
+			} else {
+				request, err := persistence.GetRequest(id, chatcmpl, requestID)
+				if err != nil {
+					if errors.Is(err, sql.ErrNoRows) {
+						logFatal(sql.ErrNoRows)
+					}
+					logFatal(err)
+				}
+				requests = []*Request{request}
+			}
+			loadRedactor()
+			switch {
+			case format != exportFormatJSON:
+				exportDataset(output, requests, format, label)
+				return
+			case bundle != "":
+				exportBundle(bundle, requests, predicates, label, escapeHTML)
+				return
+			case len(predicates) > 0:
+				names := make(map[string]struct{}, len(requests))
+				for _, request := range requests {
+					redactRequest(request)
+					label(request)
+					file, err := os.Create(filepath.Join(directory, uniqueFilename(names, request)))
+					if err != nil {
+						logFatal(err)
+					}
+					encoder := json.NewEncoder(file)
+					encoder.SetIndent("", "    ")
+					encoder.SetEscapeHTML(escapeHTML)
+					if err = encoder.Encode(request); err != nil {
+						logFatal(err)
+					}
+					logExport(file)
+					file.Close()
+				}
 				return
 			}
-			if request.IsChat() {
-				switch {
-				case goodCase:
-					request.Category = "goodcase"
-				case badCase:
-					request.Category = "badcase"
+			request := requests[0]
+			redactions := redactRequest(request)
+			if dryRun {
+				if len(redactions) == 0 {
+					fmt.Println("nothing would be redacted")
+					return
+				}
+				t.AppendHeader(table.Row{"rule", "in", "path", "value", "replacement"})
+				for _, redaction := range redactions {
+					t.AppendRow(table.Row{
+						redaction.Rule,
+						redaction.In,
+						redaction.Path,
+						redaction.Value,
+						redaction.Replacement,
+					})
 				}
-				if len(tags) > 0 {
-					request.Tags = tags
+				t.SetColumnConfigs([]table.ColumnConfig{
+					{Name: "value", WidthMax: 48},
+					{Name: "replacement", WidthMax: 48},
+				})
+				t.Render()
+				return
+			}
+			if curl {
+				if err := writeCurlCommand(os.Stdout, request); err != nil {
+					logFatal(err)
 				}
+				return
 			}
+			label(request)
 			var outputStream io.Writer
 			if directory != "" {
-				var file *os.File
-				file, err = os.Create(filepath.Join(directory, genFilename(request)))
+				file, err := os.Create(filepath.Join(directory, genFilename(request)))
 				if err != nil {
 					logFatal(err)
 				}
@@ -81,7 +168,7 @@ func exportCommand() *cobra.Command {
 			encoder := json.NewEncoder(outputStream)
 			encoder.SetIndent("", "    ")
 			encoder.SetEscapeHTML(escapeHTML)
-			if err = encoder.Encode(request); err != nil {
+			if err := encoder.Encode(request); err != nil {
 				logFatal(err)
 			}
 		},
@@ -90,20 +177,65 @@ func exportCommand() *cobra.Command {
 	flags.Int64Var(&id, "id", 0, "row id")
 	flags.StringVar(&chatcmpl, "chatcmpl", "", "chatcmpl")
 	flags.StringVar(&requestID, "requestid", "", "request id returned from Moonshot AI")
+	flags.StringArrayVarP(&predicates, "predicate", "p", nil, "predicate is used to set the conditions for exporting requests in batch")
 	flags.StringVarP(&output, "output", "o", "stdout", "output file path")
 	flags.StringVar(&directory, "directory", "", "output directory")
+	flags.StringVar(&bundle, "bundle", "", "output bundle path, either a .tar.gz (.tgz) or a .zip file")
+	flags.StringVar(&format, "format", exportFormatJSON, "output format, available formats are json, finetune-jsonl and eval-jsonl")
 	flags.BoolVar(&escapeHTML, "escape-html", false, "specifies whether problematic HTML characters should be escaped")
 	flags.BoolVar(&goodCase, "good", false, "good case")
 	flags.BoolVar(&badCase, "bad", false, "bad case")
 	flags.StringArrayVar(&tags, "tag", nil, "tags describe the current case")
 	flags.BoolVar(&curl, "curl", false, "export curl command")
-	cmd.MarkFlagsOneRequired("id", "chatcmpl", "requestid")
+	flags.BoolVar(&dryRun, "dry-run", false, "show what would be redacted without exporting")
+	cmd.MarkFlagsOneRequired("id", "chatcmpl", "requestid", "predicate")
 	cmd.MarkFlagsMutuallyExclusive("good", "bad")
+	cmd.MarkFlagsMutuallyExclusive("id", "predicate")
+	cmd.MarkFlagsMutuallyExclusive("chatcmpl", "predicate")
+	cmd.MarkFlagsMutuallyExclusive("requestid", "predicate")
+	cmd.MarkFlagsMutuallyExclusive("bundle", "output", "directory", "curl", "dry-run")
+	cmd.MarkFlagsMutuallyExclusive("predicate", "curl", "dry-run")
 	cmd.MarkPersistentFlagFilename("output")
 	cmd.MarkPersistentFlagDirname("directory")
+	cmd.MarkPersistentFlagFilename("bundle", "tar.gz", "tgz", "zip")
 	return cmd
 }
 
+// exportDataset writes the requests as a dataset to output, which is either a
+// file or stdout.
+func exportDataset(output string, requests []*Request, format string, label func(*Request)) {
+	for _, request := range requests {
+		redactRequest(request)
+		label(request)
+	}
+	var w io.Writer = os.Stdout
+	switch output {
+	case "stdout":
+	case "stderr":
+		w = os.Stderr
+	default:
+		file, err := os.Create(output)
+		if err != nil {
+			logFatal(err)
+		}
+		defer file.Close()
+		w = file
+	}
+	result, err := writeDataset(w, requests, format)
+	if err != nil {
+		logFatal(err)
+	}
+	logDataset(output, result)
+}
+
+func exportBundle(path string, requests []*Request, predicates []string, label func(*Request), escapeHTML bool) {
+	manifest := newBundleManifest(predicates)
+	if err := writeBundle(path, requests, manifest, label, escapeHTML); err != nil {
+		logFatal(err)
+	}
+	logBundle(path, manifest.Count)
+}
+
 func genFilename(request *Request) (filename string) {
 	if ident := request.Ident(); strings.HasPrefix(ident, "chatcmpl=") {
 		filename = strings.TrimPrefix(ident, "chatcmpl=") + ".json"
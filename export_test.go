@@ -0,0 +1,34 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestUniqueFilename(t *testing.T) {
+	var (
+		names     = make(map[string]struct{})
+		testcases = []struct {
+			request *Request
+			want    string
+		}{
+			{
+				request: &Request{ID: 1, RequestMethod: "GET", RequestPath: "/v1/models"},
+				want:    "get-models-00010101000000.json",
+			},
+			{
+				request: &Request{ID: 2, RequestMethod: "GET", RequestPath: "/v1/models"},
+				want:    "2-get-models-00010101000000.json",
+			},
+			{
+				request: &Request{ID: 3, RequestMethod: "POST", RequestPath: "/v1/chat/completions", MoonshotID: sql.NullString{String: "chatcmpl-1", Valid: true}},
+				want:    "chatcmpl-1.json",
+			},
+		}
+	)
+	for _, testcase := range testcases {
+		if got := uniqueFilename(names, testcase.request); got != testcase.want {
+			t.Errorf("request %d: want %s, got %s", testcase.request.ID, testcase.want, got)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+// Matched terms in snippets are enclosed by these markers, which are replaced
+// before snippets are printed.
+const (
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+type searchRow struct {
+	ID                 int64          `db:"id"`
+	RequestPath        string         `db:"request_path"`
+	MoonshotID         sql.NullString `db:"moonshot_id"`
+	MoonshotRequestID  sql.NullString `db:"moonshot_request_id"`
+	ResponseStatusCode sql.NullInt64  `db:"response_status_code"`
+	CreatedAt          SqliteTime     `db:"created_at"`
+	Model              sql.NullString `db:"model"`
+	Rank               float64        `db:"rank"`
+	Snippet            sql.NullString `db:"snippet"`
+}
+
+func fullTextPart(part string) string {
+	return fullTextParts[part]
+}
+
+// fullTextMessages extracts the text of chat messages, including the arguments
+// of tool calls, from the request body.
+func fullTextMessages(body string) string {
+	var text strings.Builder
+	gjson.Get(body, "messages").ForEach(func(_, message gjson.Result) bool {
+		writeMessageText(&text, message)
+		return true
+	})
+	return text.String()
+}
+
+// fullTextOutput extracts the text of the assistant outputs from the response
+// body, event streams are merged first.
+func fullTextOutput(body string, contentType string) string {
+	if contentType == "text/event-stream" {
+		body = mergeCompletion(body)
+	}
+	var text strings.Builder
+	gjson.Get(body, "choices").ForEach(func(_, choice gjson.Result) bool {
+		writeMessageText(&text, choiceMessage(choice))
+		return true
+	})
+	return text.String()
+}
+
+// choiceMessage returns the message of a choice, choices merged from event
+// streams carry the message in delta.
+func choiceMessage(choice gjson.Result) gjson.Result {
+	if message := choice.Get("message"); message.Exists() {
+		return message
+	}
+	return choice.Get("delta")
+}
+
+func writeMessageText(text *strings.Builder, message gjson.Result) {
+	write := func(s string) {
+		if s != "" {
+			if text.Len() > 0 {
+				text.WriteString("\n")
+			}
+			text.WriteString(s)
+		}
+	}
+	if content := message.Get("content"); content.IsArray() {
+		content.ForEach(func(_, part gjson.Result) bool {
+			write(part.Get("text").String())
+			return true
+		})
+	} else {
+		write(content.String())
+	}
+	write(message.Get("reasoning_content").String())
+	message.Get("tool_calls").ForEach(func(_, call gjson.Result) bool {
+		write(call.Get("function.name").String())
+		write(call.Get("function.arguments").String())
+		return true
+	})
+}
+
+// fullTextRank ranks FTS4 matches by matchinfo(..., 'pcx'), the fraction of all
+// hits of each phrase which are in the row is summed up. FTS4 has no built-in
+// ranking function, the rank is negated to be ordered like bm25 of FTS5.
+func fullTextRank(matchinfo []byte) float64 {
+	if len(matchinfo) < 8 {
+		return 0
+	}
+	info := make([]uint32, len(matchinfo)/4)
+	for i := range info {
+		info[i] = binary.NativeEndian.Uint32(matchinfo[i*4:])
+	}
+	var (
+		phrases = int(info[0])
+		columns = int(info[1])
+		score   float64
+	)
+	for i := 0; i < phrases*columns && 2+i*3+1 < len(info); i++ {
+		hits, globalHits := info[2+i*3], info[2+i*3+1]
+		if hits > 0 && globalHits > 0 {
+			score += float64(hits) / float64(globalHits)
+		}
+	}
+	return -score
+}
+
+func searchCommand() *cobra.Command {
+	var (
+		n          int64
+		column     string
+		predicates []string
+		asJSON     bool
+	)
+	cmd := &cobra.Command{
+		Use:   "search QUERY",
+		Short: "Search Moonshot AI requests by the content of messages and outputs",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			switch column {
+			case "messages", "output":
+			case "", "content":
+				column = ""
+			default:
+				logFatal(fmt.Errorf("in: unknown column %q, expected one of content, messages and output", column))
+			}
+			predicate, err := Predicates(predicates).Parse()
+			if err != nil {
+				logFatal(fmt.Errorf("predicate: %w", err))
+			}
+			rows, err := persistence.SearchRequests(args[0], column, n, predicate)
+			if err != nil {
+				logFatalQuery(err)
+			}
+			if asJSON {
+				type result struct {
+					ID        int64   `json:"id"`
+					ChatCmpl  string  `json:"chatcmpl,omitempty"`
+					RequestID string  `json:"request_id,omitempty"`
+					Status    int64   `json:"status,omitempty"`
+					Model     string  `json:"model,omitempty"`
+					Rank      float64 `json:"rank"`
+					Snippet   string  `json:"snippet"`
+					Requested string  `json:"requested_at"`
+				}
+				results := make([]*result, 0, len(rows))
+				for _, row := range rows {
+					results = append(results, &result{
+						ID:        row.ID,
+						ChatCmpl:  row.MoonshotID.String,
+						RequestID: row.MoonshotRequestID.String,
+						Status:    row.ResponseStatusCode.Int64,
+						Model:     row.Model.String,
+						Rank:      row.Rank,
+						Snippet:   highlightSnippet(row.Snippet.String, "<mark>", "</mark>"),
+						Requested: row.CreatedAt.Format(time.DateTime),
+					})
+				}
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "    ")
+				encoder.SetEscapeHTML(false)
+				if err = encoder.Encode(results); err != nil {
+					logFatal(err)
+				}
+				return
+			}
+			t.AppendHeader(table.Row{
+				"id",
+				"status",
+				"chatcmpl",
+				"model",
+				"rank",
+				"snippet",
+				"requested_at",
+			})
+			highlight := boldYellow(snippetOpen)
+			highlightOpen, highlightClose, _ := strings.Cut(highlight, snippetOpen)
+			for _, row := range rows {
+				t.AppendRow(table.Row{
+					strconv.FormatInt(row.ID, 10),
+					strconv.FormatInt(row.ResponseStatusCode.Int64, 10),
+					row.MoonshotID.String,
+					row.Model.String,
+					strconv.FormatFloat(-row.Rank, 'f', 4, 64),
+					highlightSnippet(strings.Join(strings.Fields(row.Snippet.String), " "), highlightOpen, highlightClose),
+					row.CreatedAt.Format(time.DateTime),
+				})
+			}
+			t.SetColumnConfigs([]table.ColumnConfig{
+				{Name: "snippet", WidthMax: 64},
+			})
+			t.Render()
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.Int64VarP(&n, "n", "n", 10, "number of results to return")
+	flags.StringVar(&column, "in", "content", "search in content (both messages and output), messages or output")
+	flags.StringArrayVarP(&predicates, "predicate", "p", nil, "predicate is used to set the conditions for searched requests")
+	flags.BoolVar(&asJSON, "json", false, "output in JSON format")
+	return cmd
+}
+
+func highlightSnippet(snippet string, open, close string) string {
+	return strings.NewReplacer(snippetOpen, open, snippetClose, close).Replace(snippet)
+}
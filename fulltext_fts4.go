@@ -0,0 +1,15 @@
+//go:build !sqlite_fts5
+
+package main
+
+// FTS5 is only available with the sqlite_fts5 build tag, FTS4 is used as the
+// fallback. Tables of both modules have their own names, so that databases can
+// be shared by binaries built with and without the tag.
+const fullTextTable = "moonshot_requests_fts4"
+
+var fullTextParts = map[string]string{
+	"table":   fullTextTable,
+	"module":  "fts4(messages, output)",
+	"rank":    "fts_rank(matchinfo(" + fullTextTable + ", 'pcx'))",
+	"snippet": "snippet(" + fullTextTable + ", char(2), char(3), '...', -1, 16)",
+}
@@ -0,0 +1,14 @@
+//go:build sqlite_fts5
+
+package main
+
+// With FTS5, the trigram tokenizer is used so that text without spaces between
+// words, such as Chinese, can be searched by substrings of at least 3 characters.
+const fullTextTable = "moonshot_requests_fts5"
+
+var fullTextParts = map[string]string{
+	"table":   fullTextTable,
+	"module":  "fts5(messages, output, tokenize = 'trigram')",
+	"rank":    "bm25(" + fullTextTable + ")",
+	"snippet": "snippet(" + fullTextTable + ", -1, char(2), char(3), '...', 48)",
+}
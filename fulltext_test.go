@@ -0,0 +1,105 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestFullTextText(t *testing.T) {
+	var testcases = []struct {
+		name        string
+		body        string
+		contentType string
+		messages    string
+		output      string
+	}{
+		{
+			name:     "messages",
+			body:     `{"messages":[{"role":"system","content":"be brief"},{"role":"user","content":[{"type":"text","text":"what is"},{"type":"image_url","image_url":{"url":"data:"}}]}]}`,
+			messages: "be brief\nwhat is",
+		},
+		{
+			name:     "tool calls",
+			body:     `{"messages":[{"role":"assistant","content":"","tool_calls":[{"function":{"name":"search","arguments":"{\"q\":\"moon\"}"}}]}]}`,
+			messages: "search\n{\"q\":\"moon\"}",
+		},
+		{
+			name:   "completion",
+			body:   `{"choices":[{"index":0,"message":{"role":"assistant","content":"hello","reasoning_content":"think"}}]}`,
+			output: "hello\nthink",
+		},
+		{
+			name: "event stream",
+			body: "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"hel\"}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n" +
+				"data: [DONE]",
+			contentType: "text/event-stream",
+			output:      "hello",
+		},
+	}
+	for _, testcase := range testcases {
+		if got := fullTextMessages(testcase.body); got != testcase.messages {
+			t.Errorf("%s: messages: want %q, got %q", testcase.name, testcase.messages, got)
+		}
+		if got := fullTextOutput(testcase.body, testcase.contentType); got != testcase.output {
+			t.Errorf("%s: output: want %q, got %q", testcase.name, testcase.output, got)
+		}
+	}
+}
+
+func TestFullTextPredicate(t *testing.T) {
+	usePersistenceForTest(t)
+	var (
+		sunny = storeTestRequest(t,
+			`{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"how is the weather"}]}`,
+			`{"choices":[{"index":0,"message":{"role":"assistant","content":"it is sunny"}}]}`,
+		)
+		timeout = storeTestRequest(t,
+			`{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"why did my invoice fail"}]}`,
+			"data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"a connection \"}}]}\n\n"+
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"timeout\"},\"finish_reason\":\"stop\"}]}\n\n"+
+				"data: [DONE]",
+		)
+	)
+	var testcases = []struct {
+		predicate string
+		want      []int64
+	}{
+		{predicate: "output ~~ 'timeout'", want: []int64{timeout}},
+		{predicate: "messages ~~ 'invoice'", want: []int64{timeout}},
+		{predicate: "messages ~~ 'timeout'", want: nil},
+		{predicate: "content ~~ 'sunny'", want: []int64{sunny}},
+		{predicate: "content ~~ 'weather OR invoice'", want: []int64{timeout, sunny}},
+		{predicate: "output !~~ 'timeout'", want: []int64{sunny}},
+		{predicate: "output ~~ 'timeout' && response_status_code == 200", want: []int64{timeout}},
+	}
+	for _, testcase := range testcases {
+		predicate, err := Predicates{testcase.predicate}.Parse()
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.predicate, err)
+		}
+		requests, err := persistence.ListRequests(10, false, predicate)
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.predicate, err)
+		}
+		var got []int64
+		for _, request := range requests {
+			got = append(got, request.ID)
+		}
+		if !slices.Equal(got, testcase.want) {
+			t.Errorf("%s: want %v, got %v", testcase.predicate, testcase.want, got)
+		}
+	}
+	// Rows of deleted requests are removed from the index.
+	if _, err := cleanupRequests("", "id = "+strconv.FormatInt(timeout, 10), true); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := persistence.SearchRequests("timeout OR sunny", "", 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].ID != sunny {
+		t.Errorf("search after cleanup: want only %d, got %v", sunny, rows)
+	}
+}
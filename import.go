@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+
+	"github.com/MoonshotAI/moonpalace/redact"
+	"github.com/MoonshotAI/moonpalace/storage"
+)
+
+// exportedRequest is the shape of requests written by Request.MarshalJSON.
+type exportedRequest struct {
+	Metadata map[string]string `json:"metadata"`
+	Request  struct {
+		Method string          `json:"method"`
+		Url    string          `json:"url"`
+		Header string          `json:"header"`
+		Body   json.RawMessage `json:"body"`
+	} `json:"request"`
+	Response struct {
+		Status string          `json:"status"`
+		Header string          `json:"header"`
+		Body   json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error    string   `json:"error"`
+	Category string   `json:"category"`
+	Tags     []string `json:"tags"`
+	Note     string   `json:"note"`
+}
+
+// importedID is the id of the request in the database it is exported from, the
+// id of the original one is kept if it has been imported before.
+func (e *exportedRequest) importedID() int64 {
+	for _, key := range []string{"imported_id", "moonpalace_id"} {
+		if id, err := strconv.ParseInt(e.Metadata[key], 10, 64); err == nil && id > 0 {
+			return id
+		}
+	}
+	return 0
+}
+
+// record converts the exported request back to what the proxy stores. The ids
+// of retries and conversations refer to rows in the original database, they are
+// left out, conversations are linked again after the request is imported.
+func (e *exportedRequest) record() (*storage.Record, error) {
+	metadata := e.Metadata
+	record := &storage.Record{
+		Source:              recordSource,
+		RequestMethod:       e.Request.Method,
+		RequestHeader:       e.Request.Header,
+		RequestBody:         unmarshalBody(e.Request.Body),
+		ResponseHeader:      e.Response.Header,
+		ResponseBody:        unmarshalBody(e.Response.Body),
+		RequestContentType:  metadata["request_content_type"],
+		ResponseContentType: metadata["response_content_type"],
+		MoonshotID:          metadata["chatcmpl"],
+		MoonshotRequestID:   metadata["request_id"],
+		MoonshotUID:         metadata["user_id"],
+		MoonshotGID:         metadata["group_id"],
+		Endpoint:            metadata["endpoint"],
+		KIdent:              metadata["k_ident"],
+		Error:               e.Error,
+	}
+	// Files exported by earlier versions have content_type only, which is the
+	// content type of the response.
+	if record.ResponseContentType == "" {
+		record.ResponseContentType = metadata["content_type"]
+	}
+	if record.RequestMethod == "" {
+		record.RequestMethod = "GET"
+		if len(record.RequestBody) > 0 {
+			record.RequestMethod = "POST"
+		}
+	}
+	u, err := url.Parse(e.Request.Url)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+	// Requests without an endpoint were made to the default endpoint.
+	requestEndpoint := record.Endpoint
+	if requestEndpoint == "" {
+		requestEndpoint = endpoint
+	}
+	if strings.HasPrefix(e.Request.Url, requestEndpoint) {
+		pathQuery := strings.TrimPrefix(e.Request.Url, requestEndpoint)
+		record.RequestPath, record.RequestQuery, _ = strings.Cut(pathQuery, "?")
+	} else {
+		record.Endpoint = u.Scheme + "://" + u.Host
+		record.RequestPath, record.RequestQuery = u.EscapedPath(), u.RawQuery
+	}
+	if record.RequestPath == "" {
+		return nil, fmt.Errorf("url: missing path in %q", e.Request.Url)
+	}
+	status := metadata["status"]
+	if status == "" {
+		status = e.Response.Status
+	}
+	code, _, _ := strings.Cut(status, " ")
+	record.ResponseStatusCode, _ = strconv.Atoi(code)
+	record.MoonshotServerTiming, _ = strconv.Atoi(metadata["server_timing"])
+	record.ResponseTTFT, _ = strconv.Atoi(metadata["response_ttft"])
+	record.ResponseTPOT, _ = strconv.Atoi(metadata["response_tpot"])
+	record.ResponseOTPS, _ = strconv.ParseFloat(metadata["response_otps"], 64)
+	if cost, err := strconv.ParseFloat(metadata["cost"], 64); err == nil {
+		record.Cost = &cost
+	}
+	if latency, err := strconv.ParseInt(metadata["latency"], 10, 64); err == nil {
+		record.Latency = time.Duration(latency) * time.Millisecond
+	}
+	record.CreatedAt = time.Now()
+	if requestedAt := metadata["requested_at"]; requestedAt != "" {
+		if record.CreatedAt, err = time.ParseInLocation(time.DateTime, requestedAt, time.Local); err != nil {
+			return nil, fmt.Errorf("requested_at: %w", err)
+		}
+	}
+	if strings.HasSuffix(record.RequestPath, "/chat/completions") {
+		record.RequestHash = hashRequest(record.RequestBody)
+	}
+	return record, nil
+}
+
+// unmarshalBody reverses marshalBody, JSON bodies are compacted since they are
+// indented on export.
+func unmarshalBody(raw json.RawMessage) []byte {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil
+	}
+	if raw[0] == '"' {
+		var body string
+		if err := json.Unmarshal(raw, &body); err != nil || body == "" {
+			return nil
+		}
+		return []byte(body)
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, raw); err != nil {
+		return raw
+	}
+	return compacted.Bytes()
+}
+
+// redactImport applies the rules to the imported request in the same way as
+// they are applied to captured requests.
+func redactImport(record *storage.Record) {
+	if redactor.Empty() {
+		return
+	}
+	redactRecord := &redact.Record{
+		RequestHeader:  parseHeader(record.RequestHeader),
+		RequestBody:    record.RequestBody,
+		ResponseHeader: parseHeader(record.ResponseHeader),
+		ResponseBody:   record.ResponseBody,
+	}
+	redactor.Redact(redactRecord)
+	if record.RequestHeader != "" {
+		record.RequestHeader = writeHeader(redactRecord.RequestHeader)
+	}
+	if record.ResponseHeader != "" {
+		record.ResponseHeader = writeHeader(redactRecord.ResponseHeader)
+	}
+	record.RequestBody, record.ResponseBody = redactRecord.RequestBody, redactRecord.ResponseBody
+}
+
+// findImported returns the request which the record has been imported as, the
+// request with the same chatcmpl and request id as the record, or the one
+// imported from the same request of the exported database, which tells apart
+// requests without chatcmpl and request id. Requests are not imported twice.
+func findImported(record *storage.Record, importedID int64) (*Request, error) {
+	var (
+		chatcmpl  = record.MoonshotID
+		requestID = record.MoonshotRequestID
+	)
+	if !strings.HasSuffix(record.RequestPath, "/chat/completions") {
+		chatcmpl = ""
+	}
+	var id int64
+	if chatcmpl == "" && requestID == "" {
+		if importedID == 0 {
+			return nil, nil
+		}
+		// Ids of different databases may be the same, so the time and path of the
+		// request are compared as well.
+		var err error
+		id, err = persistence.FindImportedRequest(
+			importedID,
+			record.CreatedAt.Format(time.DateTime),
+			record.RequestMethod,
+			record.RequestPath,
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	request, err := persistence.GetRequest(id, chatcmpl, requestID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return request, err
+}
+
+type importResult struct {
+	File       string
+	ID         int64
+	ImportedID int64
+	Ident      string
+	Skipped    bool
+}
+
+// importRequest imports the request in one transaction, so that a request which
+// fails to be imported is left out entirely, instead of being skipped as already
+// imported next time.
+func importRequest(ctx context.Context, name string, exported *exportedRequest) (result *importResult, err error) {
+	record, err := exported.record()
+	if err != nil {
+		return nil, err
+	}
+	result = &importResult{File: name, ImportedID: exported.importedID()}
+	// The queries of storing, linking and annotating the request use persistence,
+	// which is replaced by the transaction while the request is imported. Nothing
+	// else queries the database during the import command.
+	err = persistence.WithTx(ctx, func(tx Persistence) error {
+		previous := persistence
+		persistence = tx
+		defer func() { persistence = previous }()
+		return importRecord(result, record, exported)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func importRecord(result *importResult, record *storage.Record, exported *exportedRequest) error {
+	existing, err := findImported(record, result.ImportedID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		result.ID, result.Ident, result.Skipped = existing.ID, existing.Ident(), true
+		return nil
+	}
+	redactImport(record)
+	// Imported requests are only written to the local SQLite database.
+	if result.ID, err = (sqliteStorage{}).Store(record); err != nil {
+		return err
+	}
+	if result.ImportedID != 0 {
+		if err = persistence.SetImportedID(result.ID, result.ImportedID); err != nil {
+			return err
+		}
+	}
+	if strings.HasSuffix(record.RequestPath, "/chat/completions") {
+		responseBody := string(record.ResponseBody)
+		if record.ResponseContentType == "text/event-stream" {
+			responseBody = mergeCompletion(responseBody)
+		}
+		if err = linkConversation(result.ID, string(record.RequestBody), responseBody); err != nil {
+			return err
+		}
+	}
+	a := &annotation{Tags: exported.Tags}
+	if exported.Category != "" {
+		a.Category = &exported.Category
+	}
+	if exported.Note != "" {
+		a.Note = &exported.Note
+	}
+	if err = a.apply(result.ID); err != nil {
+		return err
+	}
+	request, err := persistence.GetRequest(result.ID, "", "")
+	if err != nil {
+		return err
+	}
+	result.Ident = request.Ident()
+	return nil
+}
+
+type importEntry struct {
+	name     string
+	exported *exportedRequest
+}
+
+// decodeFile decodes the requests in a file, which holds one or more requests
+// in the shape of the export command.
+func decodeFile(name string, data []byte) ([]*importEntry, error) {
+	var (
+		entries []*importEntry
+		decoder = json.NewDecoder(bytes.NewReader(data))
+	)
+	for {
+		exported := new(exportedRequest)
+		if err := decoder.Decode(exported); err != nil {
+			if errors.Is(err, io.EOF) {
+				return entries, nil
+			}
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		entries = append(entries, &importEntry{name: name, exported: exported})
+	}
+}
+
+// sortImportEntries sorts the entries in the order the requests were made, so
+// that they are linked into conversations in the same way as they were captured.
+func sortImportEntries(entries []*importEntry) {
+	slices.SortStableFunc(entries, func(a, b *importEntry) int {
+		if c := cmp.Compare(a.exported.Metadata["requested_at"], b.exported.Metadata["requested_at"]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.exported.importedID(), b.exported.importedID())
+	})
+}
+
+func importCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <file|directory|bundle>...",
+		Short: "Import requests exported by MoonPalace",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var entries []*importEntry
+			decodeData := func(name string, data []byte) error {
+				decoded, err := decodeFile(name, data)
+				entries = append(entries, decoded...)
+				return err
+			}
+			for _, arg := range args {
+				info, err := os.Stat(arg)
+				if err != nil {
+					logFatal(err)
+				}
+				switch {
+				case info.IsDir():
+					err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+						if err != nil || d.IsDir() || !isBundleFile(path) {
+							return err
+						}
+						data, err := os.ReadFile(path)
+						if err != nil {
+							return err
+						}
+						return decodeData(path, data)
+					})
+				case isBundle(arg):
+					err = readBundle(arg, func(name string, data []byte) error {
+						return decodeData(filepath.Join(arg, name), data)
+					})
+				default:
+					var data []byte
+					if data, err = os.ReadFile(arg); err == nil {
+						err = decodeData(arg, data)
+					}
+				}
+				if err != nil {
+					logFatal(err)
+				}
+			}
+			sortImportEntries(entries)
+			loadRedactor()
+			results := make([]*importResult, 0, len(entries))
+			for _, entry := range entries {
+				result, err := importRequest(cmd.Context(), entry.name, entry.exported)
+				if err != nil {
+					printImportResults(results)
+					logFatal(fmt.Errorf("%s: %w", entry.name, err))
+				}
+				results = append(results, result)
+			}
+			printImportResults(results)
+		},
+	}
+	return cmd
+}
+
+func printImportResults(results []*importResult) {
+	if len(results) == 0 {
+		return
+	}
+	t.AppendHeader(table.Row{"file", "id", "imported_id", "ident", "result"})
+	for _, result := range results {
+		importedID := ""
+		if result.ImportedID != 0 {
+			importedID = strconv.FormatInt(result.ImportedID, 10)
+		}
+		status := green("imported")
+		if result.Skipped {
+			status = boldYellow("skipped, already exists")
+		}
+		t.AppendRow(table.Row{result.File, result.ID, importedID, result.Ident, status})
+	}
+	t.Render()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MoonshotAI/moonpalace/storage"
+)
+
+// importBundle imports the requests in the bundle into the current database.
+func importBundle(t *testing.T, path string) []*importResult {
+	t.Helper()
+	var entries []*importEntry
+	if err := readBundle(path, func(name string, data []byte) error {
+		decoded, err := decodeFile(name, data)
+		entries = append(entries, decoded...)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sortImportEntries(entries)
+	results := make([]*importResult, 0, len(entries))
+	for _, entry := range entries {
+		result, err := importRequest(context.Background(), entry.name, entry.exported)
+		if err != nil {
+			t.Fatalf("%s: %s", entry.name, err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func TestImportBundle(t *testing.T) {
+	usePersistenceForTest(t)
+	store := func(record *storage.Record) int64 {
+		record.ResponseStatusCode = 200
+		record.CreatedAt = time.Now()
+		id, err := (sqliteStorage{}).Store(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	var (
+		first = store(&storage.Record{
+			RequestMethod:       "POST",
+			RequestPath:         "/v1/chat/completions",
+			RequestBody:         []byte(`{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}]}`),
+			MoonshotID:          "chatcmpl-1",
+			ResponseContentType: "application/json",
+			ResponseBody:        []byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hello"}}]}`),
+		})
+		second = store(&storage.Record{
+			RequestMethod:       "POST",
+			RequestPath:         "/v1/chat/completions",
+			RequestBody:         []byte(`{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"bye"}]}`),
+			MoonshotID:          "chatcmpl-2",
+			ResponseContentType: "text/event-stream",
+			ResponseBody: []byte("data: {\"id\":\"chatcmpl-2\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"see you\"}}]}\n\n" +
+				"data: [DONE]"),
+		})
+		// Requests without chatcmpl and request id are told apart by imported_id.
+		models = store(&storage.Record{
+			RequestMethod:       "GET",
+			RequestPath:         "/v1/models",
+			ResponseContentType: "application/json",
+			ResponseBody:        []byte(`{"data":[]}`),
+		})
+	)
+	if err := linkConversations(true); err != nil {
+		t.Fatal(err)
+	}
+	goodcase := categoryGoodCase
+	if err := (&annotation{Category: &goodcase, Tags: []string{"weather"}}).apply(second); err != nil {
+		t.Fatal(err)
+	}
+	requests, err := persistence.ListRequests(10, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "requests.tar.gz")
+	if err = writeBundle(path, requests, newBundleManifest(nil), func(*Request) {}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	usePersistenceForTest(t)
+	results := importBundle(t, path)
+	imported := make(map[int64]int64, len(results))
+	for _, result := range results {
+		if result.Skipped {
+			t.Errorf("%s: want imported, got skipped", result.File)
+		}
+		imported[result.ImportedID] = result.ID
+	}
+	var testcases = []struct {
+		name         string
+		id           int64
+		ident        string
+		conversation int64
+		turn         int64
+		category     string
+	}{
+		{name: "first", id: first, ident: "chatcmpl=chatcmpl-1", conversation: first, turn: 1},
+		{name: "streamed", id: second, ident: "chatcmpl=chatcmpl-2", conversation: first, turn: 2, category: categoryGoodCase},
+		{name: "models", id: models},
+	}
+	if len(imported) != len(testcases) {
+		t.Fatalf("want %d requests imported, got %d", len(testcases), len(imported))
+	}
+	for _, testcase := range testcases {
+		request, err := persistence.GetRequest(imported[testcase.id], "", "")
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		if request.ImportedID.Int64 != testcase.id {
+			t.Errorf("%s: want imported_id %d, got %v", testcase.name, testcase.id, request.ImportedID)
+		}
+		if testcase.ident != "" && request.Ident() != testcase.ident {
+			t.Errorf("%s: want %s, got %s", testcase.name, testcase.ident, request.Ident())
+		}
+		if testcase.conversation != 0 &&
+			(request.ConversationID.Int64 != imported[testcase.conversation] || request.ConversationTurn.Int64 != testcase.turn) {
+			t.Errorf("%s: want conversation %d turn %d, got conversation %v turn %v",
+				testcase.name, imported[testcase.conversation], testcase.turn, request.ConversationID, request.ConversationTurn)
+		}
+		if request.Category != testcase.category {
+			t.Errorf("%s: want category %q, got %q", testcase.name, testcase.category, request.Category)
+		}
+	}
+
+	// Importing the bundle again imports nothing.
+	for _, result := range importBundle(t, path) {
+		if !result.Skipped || result.ID != imported[result.ImportedID] {
+			t.Errorf("%s: want skipped as %d, got %+v", result.File, imported[result.ImportedID], result)
+		}
+	}
+}
+
+func TestImportRollback(t *testing.T) {
+	usePersistenceForTest(t)
+	entries, err := decodeFile("invalid.json", []byte(`{
+    "metadata": {"chatcmpl": "chatcmpl-1", "moonpalace_id": "7", "requested_at": "2024-08-01 12:00:00"},
+    "request": {"method": "POST", "url": "https://api.moonshot.cn/v1/chat/completions", "body": {"messages": [{"role": "user", "content": "hi"}]}},
+    "response": {"status": "200 OK", "body": {"id": "chatcmpl-1"}},
+    "category": "unknown"
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = importRequest(context.Background(), "invalid.json", entries[0].exported); err == nil {
+		t.Fatal("want error for unknown category")
+	}
+	// The request is stored before its category is found invalid, which is
+	// rolled back.
+	count, err := persistence.CountRequests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("want no request left, got %d", count)
+	}
+}
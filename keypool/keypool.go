@@ -0,0 +1,192 @@
+package keypool
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	StrategyRoundRobin  = "round-robin"
+	StrategyLeastLoaded = "least-loaded"
+)
+
+// window is the period RPM and TPM limits are measured in.
+const window = time.Minute
+
+type Key struct {
+	Key string
+	RPM int
+	TPM int
+}
+
+// UnavailableError is returned by Acquire when every key in the pool is either
+// cooling down or has reached its limits.
+type UnavailableError struct {
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return "all keys are cooling down or rate limited"
+}
+
+type Pool struct {
+	mu       sync.Mutex
+	keys     []*key
+	strategy string
+	cooldown time.Duration
+	next     int
+	now      func() time.Time
+}
+
+type key struct {
+	Key
+	inflight      int
+	requests      []time.Time
+	usages        []usage
+	cooldownUntil time.Time
+}
+
+type usage struct {
+	at     time.Time
+	tokens int
+}
+
+func New(keys []Key, strategy string, cooldown time.Duration) *Pool {
+	pool := &Pool{
+		keys:     make([]*key, 0, len(keys)),
+		strategy: strategy,
+		cooldown: cooldown,
+		now:      time.Now,
+	}
+	for _, k := range keys {
+		pool.keys = append(pool.keys, &key{Key: k})
+	}
+	return pool
+}
+
+func (p *Pool) Len() int {
+	return len(p.keys)
+}
+
+// Acquire picks an available key according to the strategy of the pool, the
+// returned Lease must be released once the request finishes.
+func (p *Pool) Acquire() (*Lease, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	var (
+		picked   = -1
+		earliest time.Time
+	)
+	for i := range p.keys {
+		index := i
+		if p.strategy != StrategyLeastLoaded {
+			index = (p.next + i) % len(p.keys)
+		}
+		k := p.keys[index]
+		k.expire(now)
+		if availableAt := k.availableAt(now); availableAt.After(now) {
+			if earliest.IsZero() || availableAt.Before(earliest) {
+				earliest = availableAt
+			}
+			continue
+		}
+		if p.strategy != StrategyLeastLoaded {
+			picked = index
+			break
+		}
+		if picked < 0 || k.less(p.keys[picked]) {
+			picked = index
+		}
+	}
+	if picked < 0 {
+		return nil, &UnavailableError{RetryAfter: earliest.Sub(now)}
+	}
+	p.next = picked + 1
+	k := p.keys[picked]
+	k.inflight++
+	k.requests = append(k.requests, now)
+	return &Lease{pool: p, key: k}, nil
+}
+
+// expire drops requests and usages out of the current window.
+func (k *key) expire(now time.Time) {
+	var i int
+	for i < len(k.requests) && now.Sub(k.requests[i]) >= window {
+		i++
+	}
+	k.requests = k.requests[i:]
+	i = 0
+	for i < len(k.usages) && now.Sub(k.usages[i].at) >= window {
+		i++
+	}
+	k.usages = k.usages[i:]
+}
+
+// availableAt returns the time when the key can serve the next request, it is
+// not after now if the key is available right now.
+func (k *key) availableAt(now time.Time) time.Time {
+	availableAt := now
+	if k.cooldownUntil.After(availableAt) {
+		availableAt = k.cooldownUntil
+	}
+	if k.RPM > 0 && len(k.requests) >= k.RPM {
+		if at := k.requests[len(k.requests)-k.RPM].Add(window); at.After(availableAt) {
+			availableAt = at
+		}
+	}
+	if k.TPM > 0 {
+		var tokens int
+		for _, u := range k.usages {
+			tokens += u.tokens
+		}
+		for _, u := range k.usages {
+			if tokens < k.TPM {
+				break
+			}
+			tokens -= u.tokens
+			if at := u.at.Add(window); at.After(availableAt) {
+				availableAt = at
+			}
+		}
+	}
+	return availableAt
+}
+
+// less reports whether k is less loaded than other, keys with fewer in-flight
+// requests come first, then keys with fewer requests in the current window.
+func (k *key) less(other *key) bool {
+	if k.inflight != other.inflight {
+		return k.inflight < other.inflight
+	}
+	return len(k.requests) < len(other.requests)
+}
+
+type Lease struct {
+	pool *Pool
+	key  *key
+	once sync.Once
+}
+
+func (l *Lease) Key() string {
+	return l.key.Key.Key
+}
+
+// Release returns the key to the pool, statusCode is the status code of the
+// upstream response (0 if there is none) and tokens is the number of tokens the
+// request consumed. A key is skipped for the cooldown period of the pool after
+// it gets a 429 response.
+func (l *Lease) Release(statusCode int, tokens int) {
+	l.once.Do(func() {
+		l.pool.mu.Lock()
+		defer l.pool.mu.Unlock()
+		now := l.pool.now()
+		l.key.inflight--
+		if tokens > 0 {
+			l.key.usages = append(l.key.usages, usage{at: now, tokens: tokens})
+		}
+		if statusCode == 429 {
+			l.key.cooldownUntil = now.Add(l.pool.cooldown)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package keypool
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestPool(keys []Key, strategy string) (*Pool, *clock) {
+	c := &clock{now: time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)}
+	pool := New(keys, strategy, 30*time.Second)
+	pool.now = c.Now
+	return pool, c
+}
+
+func acquire(t *testing.T, pool *Pool) *Lease {
+	t.Helper()
+	lease, err := pool.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire: %s", err)
+	}
+	return lease
+}
+
+func TestRoundRobin(t *testing.T) {
+	pool, _ := newTestPool([]Key{{Key: "a"}, {Key: "b"}, {Key: "c"}}, StrategyRoundRobin)
+	var got []string
+	for i := 0; i < 5; i++ {
+		lease := acquire(t, pool)
+		got = append(got, lease.Key())
+		lease.Release(200, 0)
+	}
+	want := []string{"a", "b", "c", "a", "b"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("want %v, got %v", want, got)
+		}
+	}
+}
+
+func TestLeastLoaded(t *testing.T) {
+	pool, _ := newTestPool([]Key{{Key: "a"}, {Key: "b"}}, StrategyLeastLoaded)
+	first := acquire(t, pool)
+	second := acquire(t, pool)
+	if first.Key() != "a" || second.Key() != "b" {
+		t.Fatalf("want a and b, got %s and %s", first.Key(), second.Key())
+	}
+	second.Release(200, 0)
+	// "a" is still in flight, "b" has been released.
+	if lease := acquire(t, pool); lease.Key() != "b" {
+		t.Errorf("want b, got %s", lease.Key())
+	}
+}
+
+func TestCooldown(t *testing.T) {
+	pool, c := newTestPool([]Key{{Key: "a"}, {Key: "b"}}, StrategyRoundRobin)
+	acquire(t, pool).Release(429, 0)
+	for i := 0; i < 3; i++ {
+		lease := acquire(t, pool)
+		if lease.Key() != "b" {
+			t.Fatalf("want b while a is cooling down, got %s", lease.Key())
+		}
+		lease.Release(200, 0)
+	}
+	acquire(t, pool).Release(429, 0)
+	_, err := pool.Acquire()
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("want UnavailableError, got %v", err)
+	}
+	if unavailable.RetryAfter != 30*time.Second {
+		t.Errorf("want retry after 30s, got %s", unavailable.RetryAfter)
+	}
+	c.now = c.now.Add(30 * time.Second)
+	if lease := acquire(t, pool); lease.Key() != "a" {
+		t.Errorf("want a after cooldown, got %s", lease.Key())
+	}
+}
+
+func TestRPM(t *testing.T) {
+	pool, c := newTestPool([]Key{{Key: "a", RPM: 2}}, StrategyRoundRobin)
+	acquire(t, pool).Release(200, 0)
+	c.now = c.now.Add(10 * time.Second)
+	acquire(t, pool).Release(200, 0)
+	_, err := pool.Acquire()
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("want UnavailableError, got %v", err)
+	}
+	if unavailable.RetryAfter != 50*time.Second {
+		t.Errorf("want retry after 50s, got %s", unavailable.RetryAfter)
+	}
+	c.now = c.now.Add(50 * time.Second)
+	acquire(t, pool)
+}
+
+func TestTPM(t *testing.T) {
+	pool, c := newTestPool([]Key{{Key: "a", TPM: 1000}, {Key: "b"}}, StrategyRoundRobin)
+	acquire(t, pool).Release(200, 600)
+	acquire(t, pool).Release(200, 0)
+	acquire(t, pool).Release(200, 600)
+	for i := 0; i < 2; i++ {
+		lease := acquire(t, pool)
+		if lease.Key() != "b" {
+			t.Fatalf("want b while a exceeds its TPM, got %s", lease.Key())
+		}
+		lease.Release(200, 0)
+	}
+	c.now = c.now.Add(time.Minute)
+	if lease := acquire(t, pool); lease.Key() != "a" {
+		t.Errorf("want a after a minute, got %s", lease.Key())
+	}
+}
+
+func TestReleaseOnce(t *testing.T) {
+	pool, _ := newTestPool([]Key{{Key: "a"}}, StrategyLeastLoaded)
+	lease := acquire(t, pool)
+	lease.Release(200, 0)
+	lease.Release(200, 0)
+	if inflight := pool.keys[0].inflight; inflight != 0 {
+		t.Errorf("want 0 in-flight requests, got %d", inflight)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/MoonshotAI/moonpalace/keypool"
+)
+
+type KeyConfig struct {
+	Key string `yaml:"key"`
+	RPM int    `yaml:"rpm"`
+	TPM int    `yaml:"tpm"`
+}
+
+const (
+	defaultKeyStrategy = keypool.StrategyRoundRobin
+	defaultKeyCooldown = 60
+)
+
+func newKeyPool(keys []*KeyConfig, strategy string, cooldown int) (*keypool.Pool, error) {
+	switch strategy {
+	case keypool.StrategyRoundRobin, keypool.StrategyLeastLoaded:
+	default:
+		return nil, fmt.Errorf("keys: unknown strategy %q, expected one of round-robin and least-loaded", strategy)
+	}
+	if cooldown < 0 {
+		return nil, errors.New("keys: cooldown should not be negative")
+	}
+	poolKeys := make([]keypool.Key, 0, len(keys))
+	for i, key := range keys {
+		if key == nil || key.Key == "" {
+			return nil, fmt.Errorf("keys[%d]: key is required", i)
+		}
+		if key.RPM < 0 || key.TPM < 0 {
+			return nil, fmt.Errorf("keys[%d]: rpm and tpm should not be negative", i)
+		}
+		poolKeys = append(poolKeys, keypool.Key{
+			Key: key.Key,
+			RPM: key.RPM,
+			TPM: key.TPM,
+		})
+	}
+	return keypool.New(poolKeys, strategy, time.Duration(cooldown)*time.Second), nil
+}
+
+// retryAfterSeconds formats a duration as the value of a Retry-After header,
+// which only accepts whole seconds.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// kIdentOf returns the fingerprint of the key recorded with each request, the
+// raw key is never persisted.
+func kIdentOf(key string) string {
+	if key == "" {
+		return ""
+	}
+	return hashKey(key)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MoonshotAI/moonpalace/ratelimit"
+)
+
+type LimitConfig struct {
+	RPM         int `yaml:"rpm"`
+	TPM         int `yaml:"tpm"`
+	Concurrency int `yaml:"concurrency"`
+	Wait        int `yaml:"wait"`
+}
+
+// estimatedRunesPerToken is a rough ratio between characters and tokens, it
+// overestimates English text a bit, which errs on the safe side, estimations
+// are reconciled with the actual usage once requests finish.
+const estimatedRunesPerToken = 2
+
+// newLimiter returns nil if no limit is set.
+func newLimiter(cfg *LimitConfig) (*ratelimit.Limiter, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if cfg.RPM < 0 || cfg.TPM < 0 || cfg.Concurrency < 0 || cfg.Wait < 0 {
+		return nil, errors.New("rpm, tpm, concurrency and wait should not be negative")
+	}
+	if cfg.RPM == 0 && cfg.TPM == 0 && cfg.Concurrency == 0 {
+		return nil, nil
+	}
+	return ratelimit.New(ratelimit.Limits{
+		RPM:         cfg.RPM,
+		TPM:         cfg.TPM,
+		Concurrency: cfg.Concurrency,
+		Wait:        time.Duration(cfg.Wait) * time.Second,
+	}), nil
+}
+
+// estimateTokens estimates the tokens a chat completions request consumes from
+// the size of its messages and tools, plus max_tokens for the completion.
+func estimateTokens(requestBody []byte) int {
+	var requestObject struct {
+		Messages  json.RawMessage `json:"messages"`
+		Tools     json.RawMessage `json:"tools"`
+		MaxTokens int             `json:"max_tokens"`
+	}
+	if err := json.Unmarshal(requestBody, &requestObject); err != nil {
+		return 0
+	}
+	runes := utf8.RuneCount(requestObject.Messages) + utf8.RuneCount(requestObject.Tools)
+	return (runes+estimatedRunesPerToken-1)/estimatedRunesPerToken + requestObject.MaxTokens
+}
+
+// acquireLimits acquires all the limiters in order, nil limiters are skipped.
+// Once any of them fails, the reservations already made are released.
+func acquireLimits(ctx context.Context, tokens int, limiters ...*ratelimit.Limiter) ([]*ratelimit.Reservation, error) {
+	var reservations []*ratelimit.Reservation
+	for _, limiter := range limiters {
+		if limiter == nil {
+			continue
+		}
+		reservation, err := limiter.Acquire(ctx, tokens)
+		if err != nil {
+			releaseLimits(reservations, -1)
+			return nil, err
+		}
+		reservations = append(reservations, reservation)
+	}
+	return reservations, nil
+}
+
+func releaseLimits(reservations []*ratelimit.Reservation, tokens int) {
+	for _, reservation := range reservations {
+		reservation.Release(tokens)
+	}
+}
@@ -75,7 +75,9 @@ func listCommand() *cobra.Command {
 				logFatal(err)
 			}
 			if export != "" {
+				loadRedactor()
 				for _, request := range requests {
+					redactRequest(request)
 					var file *os.File
 					file, err = os.Create(filepath.Join(export, genFilename(request)))
 					if err != nil {
@@ -103,6 +105,7 @@ func listCommand() *cobra.Command {
 					"user_id",
 					"server_timing",
 					"content_type",
+					"cost",
 					"requested_at",
 				})
 			} else {
@@ -126,6 +129,7 @@ func listCommand() *cobra.Command {
 						request.MoonshotUID.String,
 						strconv.FormatInt(request.MoonshotServerTiming.Int64, 10),
 						request.ResponseContentType.String,
+						formatCostCell(request.Cost),
 						request.CreatedAt.Format(time.DateTime),
 					})
 				} else {
@@ -256,28 +260,33 @@ func inspectCommand() *cobra.Command {
 
 func cleanupCommand() *cobra.Command {
 	var (
-		before string
+		before     string
+		predicates []string
+		noVacuum   bool
 	)
 	cmd := &cobra.Command{
 		Use:   "cleanup",
 		Short: "Cleanup Moonshot AI requests",
 		Run: func(cmd *cobra.Command, args []string) {
-			_, errParseDateOnly := time.Parse(time.DateOnly, before)
-			_, errParseDateTime := time.Parse(time.DateTime, before)
-			if errParseDateOnly != nil && errParseDateTime != nil {
-				logFatal(
-					fmt.Errorf(
-						"the date(time) format is either YYYY-mm-dd or YYYY-mm-dd HH:MM:SS, got %s",
-						before,
-					),
-				)
-			}
-			result, err := persistence.Cleanup(before)
+			predicate, err := Predicates(predicates).Parse()
 			if err != nil {
-				logFatal(err)
+				logFatal(fmt.Errorf("predicate: %w", err))
+			}
+			// With predicates, requests are deleted regardless of the time they
+			// were made unless --before is set explicitly.
+			if predicate != "" && !cmd.Flags().Changed("before") {
+				before = ""
+			}
+			if before != "" {
+				if err = validateBefore(before); err != nil {
+					logFatal(err)
+				}
 			}
-			rowsAffected, err := result.RowsAffected()
+			rowsAffected, err := cleanupRequests(before, predicate, noVacuum)
 			if err != nil {
+				if sqliteErr := new(sqlite3.Error); errors.As(err, sqliteErr) {
+					logFatal(sqliteErr)
+				}
 				logFatal(err)
 			}
 			t.AppendRow(table.Row{"cleanup", rowsAffected})
@@ -291,5 +300,54 @@ func cleanupCommand() *cobra.Command {
 		time.Now().AddDate(0, 0, -7).Format(time.DateOnly),
 		"requests made before this time will be cleanup",
 	)
+	flags.StringArrayVarP(&predicates, "predicate", "p", nil, "predicate is used to set the conditions for cleanup requests")
+	flags.BoolVar(&noVacuum, "no-vacuum", false, "do not rebuild the database file, the space of deleted rows is reused by new rows but not released")
 	return cmd
 }
+
+// cleanupRequests deletes the requests made before the time which match the
+// predicate, either of them may be empty but not both. The database is VACUUMed
+// afterwards unless noVacuum is set. It is shared by the cleanup command and
+// the admin API.
+func cleanupRequests(before string, predicate string, noVacuum bool) (int64, error) {
+	var (
+		result sql.Result
+		err    error
+	)
+	if predicate == "" {
+		result, err = persistence.Cleanup(before)
+	} else {
+		result, err = persistence.DeleteRequests(before, 0, predicate, 0)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err = persistence.CleanupFullTextIndex(); err != nil {
+		return 0, err
+	}
+	if err = persistence.CleanupAnnotations(); err != nil {
+		return 0, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rowsAffected > 0 && !noVacuum {
+		if err = vacuum(); err != nil {
+			return rowsAffected, err
+		}
+	}
+	return rowsAffected, nil
+}
+
+func validateBefore(before string) error {
+	_, errParseDateOnly := time.Parse(time.DateOnly, before)
+	_, errParseDateTime := time.Parse(time.DateTime, before)
+	if errParseDateOnly != nil && errParseDateTime != nil {
+		return fmt.Errorf(
+			"the date(time) format is either YYYY-mm-dd or YYYY-mm-dd HH:MM:SS, got %s",
+			before,
+		)
+	}
+	return nil
+}
@@ -65,6 +65,8 @@ func logRequest(
 	warnings []error,
 	requestHeader http.Header,
 	responseHeader http.Header,
+	cost float64,
+	costKnown bool,
 ) {
 	if query != "" {
 		path += "?" + query
@@ -130,6 +132,9 @@ func logRequest(
 			if usage.CachedTokens > 0 {
 				logger.Printf("    - cached_tokens:     %d\n", usage.CachedTokens)
 			}
+			if costKnown {
+				logger.Printf("    - cost:              %s\n", boldYellowf("%s", formatCost(cost)))
+			}
 		} else {
 			logger.Printf("    - prompt_tokens:     %s\n", "unknown")
 			logger.Printf("    - completion_tokens: %s\n", "unknown")
@@ -159,6 +164,60 @@ func logRequest(
 	}
 }
 
+func logReplay(
+	method string,
+	path string,
+	responseStatus string,
+	ident string,
+	latency time.Duration,
+	err error,
+) {
+	loggingMutex.Lock()
+	defer loggingMutex.Unlock()
+	if strings.HasPrefix(responseStatus, "2") {
+		responseStatus = green(responseStatus)
+	} else {
+		responseStatus = red(responseStatus)
+	}
+	logger.Printf("%s %s %s %.2fs\n",
+		boldYellowf("%-6s", method),
+		boldWhite(path),
+		responseStatus,
+		float64(latency)/float64(time.Second),
+	)
+	if ident != "" {
+		logger.Printf("  - Replayed: %s\n", ident)
+	}
+	if err != nil {
+		if ident != "" {
+			logger.Printf("  %s %s\n", boldYellow("[WARNING]"), boldYellow(err.Error()))
+		} else {
+			logger.Printf("  %s\n", boldRed(err.Error()))
+		}
+	}
+}
+
+func logRetry(
+	method string,
+	path string,
+	id int64,
+	attempt int,
+	maxAttempts int,
+	delay time.Duration,
+) {
+	loggingMutex.Lock()
+	defer loggingMutex.Unlock()
+	logger.Printf("%s %s %s\n",
+		boldYellowf("%-6s", method),
+		boldWhite(path),
+		boldYellowf("retry %d/%d in %.2fs", attempt, maxAttempts, float64(delay)/float64(time.Second)),
+	)
+	logger.Println(
+		boldWhite("  Failed Attempt Inserted:"),
+		boldGreenf("last_insert_id=%d", id),
+	)
+}
+
 func _boolToInt(b bool) int {
 	if b {
 		return 1
@@ -173,10 +232,45 @@ func logNewRow(id int64) {
 	)
 }
 
+func logRetention(result *retentionResult, err error) {
+	loggingMutex.Lock()
+	defer loggingMutex.Unlock()
+	if err != nil {
+		logger.Println(boldWhite("Retention Failed:"), boldRed(err.Error()))
+	}
+	if result == nil || (result.Deleted == 0 && result.Dropped == 0) {
+		return
+	}
+	logger.Println(
+		boldWhite("Retention Applied:"),
+		boldGreenf("deleted=%d dropped_bodies=%d", result.Deleted, result.Dropped),
+	)
+}
+
+// logStorageError does not lock loggingMutex, since requests are stored while
+// they are logged with the mutex locked.
+func logStorageError(storageType string, err error) {
+	logger.Println(
+		boldWhite("  Storage Failed:"),
+		boldRed(storageType+": "+err.Error()),
+	)
+}
+
 func logExport(file *os.File) {
 	logger.Println("export to", boldGreen(file.Name()), "successfully")
 }
 
+func logBundle(path string, n int) {
+	logger.Println("export", n, "requests to", boldGreen(path), "successfully")
+}
+
+func logDataset(output string, result *datasetResult) {
+	logger.Printf(
+		"export %d samples to %s, skipped %d duplicates and %d requests without replies\n",
+		result.Written, boldGreen(output), result.Duplicates, result.Unusable,
+	)
+}
+
 func logFatal(err error) {
 	if errorMsg := err.Error(); errorMsg != "" {
 		for _, line := range strings.Split(errorMsg, "\n") {
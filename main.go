@@ -11,6 +11,14 @@ func init() {
 		inspectCommand(),
 		cleanupCommand(),
 		exportCommand(),
+		tagCommand(),
+		importCommand(),
+		replayCommand(),
+		statsCommand(),
+		tailCommand(),
+		searchCommand(),
+		conversationCommand(),
+		dbCommand(),
 	)
 }
 
@@ -21,6 +29,11 @@ var (
 		Short:         "MoonPalace is a command-line tool for debugging the Moonshot AI HTTP API",
 		SilenceErrors: true,
 		SilenceUsage:  true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if err := preparePersistence(); err != nil {
+				logFatal(err)
+			}
+		},
 	}
 )
 
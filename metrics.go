@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MoonshotAI/moonpalace/metrics"
+)
+
+var (
+	metricsRegistry = metrics.NewRegistry()
+
+	secondsBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 40, 80, 160, 300}
+
+	requestsTotal = metricsRegistry.NewCounter(
+		"moonpalace_requests_total",
+		"Total number of requests proxied to the upstream, by method, route and response status code.",
+		"method", "route", "status",
+	)
+	ttftSeconds = metricsRegistry.NewHistogram(
+		"moonpalace_ttft_seconds",
+		"Time to the first token of streaming chat completions, in seconds.",
+		secondsBuckets,
+		"model",
+	)
+	latencySeconds = metricsRegistry.NewHistogram(
+		"moonpalace_latency_seconds",
+		"Latency of requests proxied to the upstream, in seconds.",
+		secondsBuckets,
+		"model",
+	)
+	serverTimingSeconds = metricsRegistry.NewHistogram(
+		"moonpalace_server_timing_seconds",
+		"Server-Timing reported by the upstream, in seconds.",
+		secondsBuckets,
+		"model",
+	)
+	promptTokensTotal = metricsRegistry.NewCounter(
+		"moonpalace_prompt_tokens_total",
+		"Total number of prompt tokens, by model.",
+		"model",
+	)
+	completionTokensTotal = metricsRegistry.NewCounter(
+		"moonpalace_completion_tokens_total",
+		"Total number of completion tokens, by model.",
+		"model",
+	)
+	cachedTokensTotal = metricsRegistry.NewCounter(
+		"moonpalace_cached_tokens_total",
+		"Total number of cached tokens, by model.",
+		"model",
+	)
+	repeatDetectionsTotal = metricsRegistry.NewCounter(
+		"moonpalace_repeat_detections_total",
+		"Total number of responses interrupted by repeat detection, by model.",
+		"model",
+	)
+	lengthWarningsTotal = metricsRegistry.NewCounter(
+		"moonpalace_length_warnings_total",
+		"Total number of responses finished with finish_reason=length, by model.",
+		"model",
+	)
+)
+
+func recordMetrics(
+	method string,
+	path string,
+	statusCode int,
+	model string,
+	moonshot *Moonshot,
+	responseTTFT int,
+	moonshotServerTiming int,
+	latency time.Duration,
+	repeatDetected bool,
+	lengthWarned bool,
+) {
+	status := "error"
+	if statusCode != 0 {
+		status = strconv.Itoa(statusCode)
+	}
+	requestsTotal.Inc(method, metricsRoute(path), status)
+	if statusCode != 0 {
+		latencySeconds.Observe(latency.Seconds(), model)
+	}
+	if responseTTFT > 0 {
+		ttftSeconds.Observe(float64(responseTTFT)/1000, model)
+	}
+	if moonshotServerTiming > 0 {
+		serverTimingSeconds.Observe(float64(moonshotServerTiming)/1000, model)
+	}
+	if moonshot != nil && moonshot.Usage != nil {
+		promptTokensTotal.Add(float64(moonshot.Usage.PromptTokens), model)
+		completionTokensTotal.Add(float64(moonshot.Usage.CompletionTokens), model)
+		cachedTokensTotal.Add(float64(moonshot.Usage.CachedTokens), model)
+	}
+	if repeatDetected {
+		repeatDetectionsTotal.Inc(model)
+	}
+	if lengthWarned {
+		lengthWarningsTotal.Inc(model)
+	}
+}
+
+// routeSegments are the path segments of the Moonshot AI API, other segments
+// are ids of files, caches and so on.
+var routeSegments = map[string]struct{}{
+	"v1":                   {},
+	"chat":                 {},
+	"completions":          {},
+	"models":               {},
+	"files":                {},
+	"content":              {},
+	"tokenizers":           {},
+	"estimate-token-count": {},
+	"caching":              {},
+	"refs":                 {},
+	"tags":                 {},
+	"users":                {},
+	"me":                   {},
+	"balance":              {},
+	"embeddings":           {},
+}
+
+// metricsRoute replaces the ids in path with {id}, such as /v1/files/{id}, so
+// that the route label does not grow with every file or cache.
+func metricsRoute(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if _, ok := routeSegments[segment]; !ok && segment != "" {
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounter("requests_total", "Total number of requests.", "status")
+	latency := registry.NewHistogram("latency_seconds", "Request latency\nin seconds.", []float64{0.5, 1})
+	requests.Inc("200")
+	requests.Add(2, "200")
+	requests.Inc("500")
+	requests.Add(-1, "500")
+	latency.Observe(0.25)
+	latency.Observe(0.75)
+	latency.Observe(3)
+	var builder strings.Builder
+	if _, err := registry.WriteTo(&builder); err != nil {
+		t.Fatalf("WriteTo: %s", err)
+	}
+	want := `# HELP requests_total Total number of requests.
+# TYPE requests_total counter
+requests_total{status="200"} 3
+requests_total{status="500"} 1
+# HELP latency_seconds Request latency\nin seconds.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.5"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 4
+latency_seconds_count 3
+`
+	if got := builder.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	registry := NewRegistry()
+	tokens := registry.NewCounter("tokens_total", "Tokens.", "model", "kind")
+	ttft := registry.NewHistogram("ttft_seconds", "TTFT.", []float64{1}, "model")
+	tokens.Add(10, "moonshot-v1-8k", "prompt")
+	tokens.Add(5, `quoted"model\`)
+	tokens.Add(1, "a", "b", "extra")
+	ttft.Observe(0.5, "moonshot-v1-8k")
+	var builder strings.Builder
+	registry.WriteTo(&builder)
+	want := `# HELP tokens_total Tokens.
+# TYPE tokens_total counter
+tokens_total{model="a",kind="b"} 1
+tokens_total{model="moonshot-v1-8k",kind="prompt"} 10
+tokens_total{model="quoted\"model\\",kind=""} 5
+# HELP ttft_seconds TTFT.
+# TYPE ttft_seconds histogram
+ttft_seconds_bucket{model="moonshot-v1-8k",le="1"} 1
+ttft_seconds_bucket{model="moonshot-v1-8k",le="+Inf"} 1
+ttft_seconds_sum{model="moonshot-v1-8k"} 0.5
+ttft_seconds_count{model="moonshot-v1-8k"} 1
+`
+	if got := builder.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("empty_total", "Empty.")
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); contentType != ContentType {
+		t.Errorf("want Content-Type %q, got %q", ContentType, contentType)
+	}
+	want := "# HELP empty_total Empty.\n# TYPE empty_total counter\n"
+	if got := recorder.Body.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestMetricsRoute(t *testing.T) {
+	var testcases = []struct {
+		path, want string
+	}{
+		{path: "/v1/chat/completions", want: "/v1/chat/completions"},
+		{path: "/v1/files", want: "/v1/files"},
+		{path: "/v1/files/cqvs5o2jf0esa1eq1la0", want: "/v1/files/{id}"},
+		{path: "/v1/files/cqvs5o2jf0esa1eq1la0/content", want: "/v1/files/{id}/content"},
+		{path: "/v1/caching/cache-id-xyz/", want: "/v1/caching/{id}"},
+		{path: "/v1/caching/refs/tags/my-tag", want: "/v1/caching/refs/tags/{id}"},
+		{path: "/v1/users/me/balance", want: "/v1/users/me/balance"},
+		{path: "/", want: "/"},
+		{path: "/unknown/path", want: "/{id}/{id}"},
+	}
+	for _, testcase := range testcases {
+		if got := metricsRoute(testcase.path); got != testcase.want {
+			t.Errorf("metricsRoute(%q): want %q, got %q", testcase.path, testcase.want, got)
+		}
+	}
+}
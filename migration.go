@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+type migration struct {
+	Version int64
+	Name    string
+	Up      func(Persistence) error
+}
+
+type schemaMigration struct {
+	Version   int64      `db:"version"`
+	Name      string     `db:"name"`
+	AppliedAt SqliteTime `db:"applied_at"`
+}
+
+// migrations are applied in order and recorded in schema_migrations, each of
+// them should be idempotent, since databases created before schema_migrations
+// was introduced already have some of the columns, and a migration which fails
+// halfway is applied again next time. New migrations are appended to the end,
+// the versions of existing migrations should never be changed.
+var migrations = []*migration{
+	{1, "create_tables", Persistence.createTable},
+	{2, "add_response_ttft", addColumn("response_ttft", Persistence.addTTFTField)},
+	{3, "add_response_tpot", addColumn("response_tpot", Persistence.addTPOTField)},
+	{4, "add_response_otps", addColumn("response_otps", Persistence.addOTPSField)},
+	{5, "add_latency", addColumn("latency", Persistence.addLatencyField)},
+	{6, "add_endpoint", addColumn("endpoint", Persistence.addEndpointField)},
+	{7, "add_request_hash", addColumn("request_hash", Persistence.addRequestHashField)},
+	{8, "add_response_timing", addColumn("response_timing", Persistence.addResponseTimingField)},
+	{9, "add_retry_of", addColumn("retry_of", Persistence.addRetryOfField)},
+	{10, "add_k_ident", addColumn("k_ident", Persistence.addKIdentField)},
+	{11, "add_cost", addColumn("cost", Persistence.addCostField)},
+	{12, "add_conversation_id", addColumn("conversation_id", Persistence.addConversationIDField)},
+	{13, "add_conversation_turn", addColumn("conversation_turn", Persistence.addConversationTurnField)},
+	{14, "add_reply_hash", addColumn("reply_hash", Persistence.addReplyHashField)},
+	{15, "add_moonshot_id_index", Persistence.addMoonshotIDIndex},
+	{16, "add_moonshot_request_id_index", Persistence.addMoonshotRequestIDIndex},
+	{17, "add_created_at_index", Persistence.addCreatedAtIndex},
+	{18, "hash_requests", func(Persistence) error { return hashRequests() }},
+	// Attempts are added by a later migration, no request has been retried yet.
+	{19, "link_conversations", func(Persistence) error { return linkConversations(false) }},
+	{20, "add_request_hash_index", Persistence.addRequestHashIndex},
+	{21, "add_conversation_id_index", Persistence.addConversationIDIndex},
+	{22, "add_reply_hash_index", Persistence.addReplyHashIndex},
+	{23, "create_annotations", Persistence.createAnnotationTables},
+	{24, "add_imported_id", addColumn("imported_id", Persistence.addImportedIDField)},
+	{25, "add_attempt", addColumn("attempt", Persistence.addAttemptField)},
+	{26, "add_request_id_index", Persistence.addRequestIDIndex},
+}
+
+// addColumn skips adding the column if it exists, since createTable creates
+// moonshot_requests with all the columns added before schema_migrations was
+// introduced.
+func addColumn(name string, add func(Persistence) error) func(Persistence) error {
+	return func(p Persistence) error {
+		infos, err := p.inspectTable()
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			if info.Name == name {
+				return nil
+			}
+		}
+		return add(p)
+	}
+}
+
+// pendingMigrations returns the migrations which have not been applied, along
+// with the applied migrations recorded in schema_migrations.
+func pendingMigrations() ([]*migration, []*schemaMigration, error) {
+	if err := persistence.createMigrationTable(); err != nil {
+		return nil, nil, err
+	}
+	applied, err := persistence.ListMigrations()
+	if err != nil {
+		return nil, nil, err
+	}
+	appliedVersions := make(map[int64]struct{}, len(applied))
+	for _, m := range applied {
+		appliedVersions[m.Version] = struct{}{}
+	}
+	pending := make([]*migration, 0, len(migrations))
+	for _, m := range migrations {
+		if _, ok := appliedVersions[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, applied, nil
+}
+
+// migrate applies the pending migrations and returns them.
+func migrate() ([]*migration, error) {
+	pending, _, err := pendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range pending {
+		if err = m.Up(persistence); err != nil {
+			return pending[:i], fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if err = persistence.addMigration(m.Version, m.Name); err != nil {
+			return pending[:i], err
+		}
+	}
+	return pending, nil
+}
+
+func dbCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manage the schema of the MoonPalace database",
+	}
+	cmd.AddCommand(
+		dbMigrateCommand(),
+		dbStatusCommand(),
+		dbCompactCommand(),
+		dbEncryptCommand(),
+	)
+	return cmd
+}
+
+func dbMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply pending migrations to the MoonPalace database",
+		// Migrations are applied by the command itself instead of before it.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		Run: func(cmd *cobra.Command, args []string) {
+			applied, err := migrate()
+			if len(applied) > 0 {
+				t.AppendHeader(table.Row{"version", "name", "status"})
+				for _, m := range applied {
+					t.AppendRow(table.Row{strconv.FormatInt(m.Version, 10), m.Name, green("applied")})
+				}
+				t.Render()
+			}
+			if err != nil {
+				logFatal(err)
+			}
+			if len(applied) == 0 {
+				fmt.Println("the database is up to date")
+			}
+		},
+	}
+	return cmd
+}
+
+func dbStatusCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show applied and pending migrations of the MoonPalace database",
+		// Pending migrations are shown instead of applied before the command.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		Run: func(cmd *cobra.Command, args []string) {
+			pending, applied, err := pendingMigrations()
+			if err != nil {
+				logFatal(err)
+			}
+			t.AppendHeader(table.Row{"version", "name", "status", "applied_at"})
+			for _, m := range applied {
+				t.AppendRow(table.Row{
+					strconv.FormatInt(m.Version, 10),
+					m.Name,
+					green("applied"),
+					m.AppliedAt.Format(time.DateTime),
+				})
+			}
+			for _, m := range pending {
+				t.AppendRow(table.Row{strconv.FormatInt(m.Version, 10), m.Name, red("pending"), ""})
+			}
+			t.Render()
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// preMigrationSchema is moonshot_requests created by versions before
+// schema_migrations was introduced.
+const preMigrationSchema = `
+create table moonshot_requests
+(
+    id                     integer not null
+        constraint moonshot_requests_pk
+            primary key autoincrement,
+    request_method         text    not null,
+    request_path           text    not null,
+    request_query          text    not null,
+    request_content_type   text,
+    request_id             text,
+    moonshot_id            text,
+    moonshot_gid           text,
+    moonshot_uid           text,
+    moonshot_request_id    text,
+    moonshot_server_timing integer,
+    response_status_code   integer,
+    response_content_type  text,
+    request_header         text,
+    request_body           text,
+    response_header        text,
+    response_body          text,
+    error                  text,
+    response_ttft          integer,
+    response_tpot          integer,
+    response_otps          real,
+    latency                integer,
+    endpoint               text,
+    created_at             text    default (datetime('now', 'localtime')) not null
+)`
+
+func TestMigratePreMigrationDatabase(t *testing.T) {
+	db := openPersistenceForTest(t)
+	if _, err := db.Exec(preMigrationSchema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`
+insert into moonshot_requests (request_method, request_path, request_query, request_body, response_status_code, response_content_type, response_body)
+values ('POST', '/v1/chat/completions', '', ?, 200, 'application/json', ?)`,
+		`{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}]}`,
+		`{"choices":[{"index":0,"message":{"role":"assistant","content":"hello"}}]}`,
+	); err != nil {
+		t.Fatal(err)
+	}
+	// The second run finds nothing pending, and so does preparePersistence.
+	var testcases = []struct {
+		name    string
+		migrate func() ([]*migration, error)
+		applied int
+	}{
+		{name: "first run", migrate: migrate, applied: len(migrations)},
+		{name: "second run", migrate: migrate, applied: 0},
+		{name: "preparePersistence", migrate: func() ([]*migration, error) { return nil, preparePersistence() }, applied: 0},
+	}
+	for _, testcase := range testcases {
+		applied, err := testcase.migrate()
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		if len(applied) != testcase.applied {
+			t.Errorf("%s: want %d migrations applied, got %d", testcase.name, testcase.applied, len(applied))
+		}
+	}
+	recorded, err := persistence.ListMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != len(migrations) || recorded[len(recorded)-1].Version != migrations[len(migrations)-1].Version {
+		t.Errorf("schema_migrations: want versions up to %d, got %d rows", migrations[len(migrations)-1].Version, len(recorded))
+	}
+	infos, err := persistence.inspectTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var columns []string
+	for _, info := range infos {
+		columns = append(columns, info.Name)
+	}
+	for _, column := range []string{"request_hash", "retry_of", "cost", "conversation_id", "reply_hash", "imported_id"} {
+		if !slices.Contains(columns, column) {
+			t.Errorf("moonshot_requests: want column %s, got %v", column, columns)
+		}
+	}
+	// Requests captured before the migrations are hashed and linked.
+	request, err := persistence.GetRequest(1, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !request.RequestHash.Valid || request.ConversationID.Int64 != 1 || request.ConversationTurn.Int64 != 1 {
+		t.Errorf("pre-migration request: want hashed and linked, got hash %v conversation %v turn %v",
+			request.RequestHash, request.ConversationID, request.ConversationTurn)
+	}
+}
+
+func TestDBCommandPreRun(t *testing.T) {
+	var testcases = []struct {
+		command string
+		prepare bool
+	}{
+		{command: "migrate", prepare: false},
+		{command: "status", prepare: false},
+		{command: "compact", prepare: true},
+		{command: "encrypt", prepare: true},
+	}
+	root := &cobra.Command{
+		Use:              "moonpalace",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+	root.AddCommand(dbCommand())
+	for _, testcase := range testcases {
+		cmd, _, err := root.Find([]string{"db", testcase.command})
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.command, err)
+		}
+		// Cobra runs the nearest PersistentPreRun of the command and its parents,
+		// which prepares persistence only if it is the one of the root command.
+		for cmd.PersistentPreRun == nil {
+			cmd = cmd.Parent()
+		}
+		if prepare := cmd == root; prepare != testcase.prepare {
+			t.Errorf("%s: want persistence prepared %v, got %v", testcase.command, testcase.prepare, prepare)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"github.com/tidwall/pretty"
+)
+
+// mockEndpoint is recorded as the endpoint of requests answered in mock mode,
+// so that mocked rows can be told apart from real ones.
+const mockEndpoint = "mock://moonpalace"
+
+const (
+	mockMaxRows      = 1000
+	mockChunkRunes   = 4
+	mockSuccessQuery = "response_status_code == 200"
+)
+
+// MockConfig is the mock section in config.yaml, mock mode is only turned on by
+// an explicit enabled, so that an empty or partly commented-out section never
+// keeps requests from reaching the upstream.
+type MockConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	Fixtures  string   `yaml:"fixtures"`
+	Predicate []string `yaml:"predicate"`
+}
+
+// mockEnabled decides whether the start command runs in mock mode, --mock given
+// on the command line takes precedence over enabled in config.yaml.
+func mockEnabled(cfg *MockConfig, cmd *cobra.Command) bool {
+	if flag := cmd.Flags().Lookup("mock"); flag != nil && flag.Changed {
+		enabled, _ := cmd.Flags().GetBool("mock")
+		return enabled
+	}
+	return cfg != nil && cfg.Enabled
+}
+
+type mockFixture struct {
+	model      string
+	completion map[string]any
+}
+
+// mockTransport is a http.RoundTripper answering chat completions requests from
+// fixtures instead of sending them to the upstream, so everything else in the
+// proxy (logging, persistence, force-stream, repeat detection) works as usual.
+type mockTransport struct {
+	fixtures   []*mockFixture
+	byMessages map[string][]*mockFixture
+	byModel    map[string][]*mockFixture
+	counter    atomic.Uint64
+}
+
+func newMockTransport(fixtures []*mockFixture, messages []string) *mockTransport {
+	transport := &mockTransport{
+		fixtures:   fixtures,
+		byMessages: make(map[string][]*mockFixture),
+		byModel:    make(map[string][]*mockFixture),
+	}
+	for i, fixture := range fixtures {
+		if messages[i] != "" {
+			transport.byMessages[messages[i]] = append(transport.byMessages[messages[i]], fixture)
+		}
+		transport.byModel[fixture.model] = append(transport.byModel[fixture.model], fixture)
+	}
+	return transport
+}
+
+func (t *mockTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		return mockErrorResponse(r, http.StatusNotFound, "resource_not_found_error",
+			"mock mode only serves /v1/chat/completions, got "+r.URL.Path), nil
+	}
+	var requestObject struct {
+		Model    string          `json:"model"`
+		Messages json.RawMessage `json:"messages"`
+		Stream   bool            `json:"stream"`
+	}
+	if r.Body != nil {
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&requestObject); err != nil {
+			return mockErrorResponse(r, http.StatusBadRequest, "invalid_request_error", err.Error()), nil
+		}
+	}
+	fixture := t.pick(requestObject.Model, requestObject.Messages)
+	completion := cloneCompletion(fixture.completion)
+	completion["id"] = "chatcmpl-" + randomHex(16)
+	completion["created"] = time.Now().Unix()
+	if requestObject.Model != "" {
+		completion["model"] = requestObject.Model
+	}
+	var (
+		body        []byte
+		contentType string
+	)
+	if requestObject.Stream {
+		body = mockEventStream(completion)
+		contentType = "text/event-stream"
+	} else {
+		completion["object"] = "chat.completion"
+		body, _ = json.Marshal(completion)
+		contentType = "application/json; charset=utf-8"
+	}
+	response := mockResponse(r, http.StatusOK, contentType, body)
+	response.Header.Set("Server-Timing", "inner; dur=0")
+	return response, nil
+}
+
+// pick prefers a fixture recorded with exactly the same messages, then one
+// recorded with the same model, and finally falls back to any fixture. Fixtures
+// sharing the same priority are served in turn.
+func (t *mockTransport) pick(model string, messages json.RawMessage) *mockFixture {
+	candidates := t.fixtures
+	if matched := t.byModel[model]; len(matched) > 0 {
+		candidates = matched
+	}
+	if len(messages) > 0 {
+		if matched := t.byMessages[string(pretty.Ugly(messages))]; len(matched) > 0 {
+			candidates = matched
+		}
+	}
+	return candidates[int(t.counter.Add(1)-1)%len(candidates)]
+}
+
+func mockResponse(r *http.Request, statusCode int, contentType string, body []byte) *http.Response {
+	header := make(http.Header)
+	header.Set("Content-Type", contentType)
+	header.Set("Msh-Request-Id", randomHex(16))
+	return &http.Response{
+		Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+}
+
+func mockErrorResponse(r *http.Request, statusCode int, typ string, message string) *http.Response {
+	body, _ := json.Marshal(object{
+		"error": object{
+			"type":    typ,
+			"message": message,
+		},
+	})
+	return mockResponse(r, statusCode, "application/json; charset=utf-8", body)
+}
+
+// mockEventStream splits a completion into chunks in the same shape as the
+// Moonshot AI streaming output, usage is attached to the last chunk of each
+// choice.
+func mockEventStream(completion map[string]any) []byte {
+	var stream bytes.Buffer
+	writeChunk := func(choice map[string]any) {
+		chunk := map[string]any{
+			"id":      completion["id"],
+			"object":  "chat.completion.chunk",
+			"created": completion["created"],
+			"model":   completion["model"],
+			"choices": []any{choice},
+		}
+		data, _ := json.Marshal(chunk)
+		stream.WriteString("data: ")
+		stream.Write(data)
+		stream.WriteString("\n\n")
+	}
+	choices, _ := completion["choices"].([]any)
+	for _, choiceValue := range choices {
+		choice, isObj := choiceValue.(map[string]any)
+		if !isObj {
+			continue
+		}
+		index := choice["index"]
+		message, _ := choice["message"].(map[string]any)
+		writeChunk(map[string]any{
+			"index":         index,
+			"delta":         map[string]any{"role": "assistant", "content": ""},
+			"finish_reason": nil,
+		})
+		content, _ := message["content"].(string)
+		for len(content) > 0 {
+			size, runes := 0, 0
+			for size < len(content) && runes < mockChunkRunes {
+				_, n := utf8.DecodeRuneInString(content[size:])
+				size += n
+				runes++
+			}
+			writeChunk(map[string]any{
+				"index":         index,
+				"delta":         map[string]any{"content": content[:size]},
+				"finish_reason": nil,
+			})
+			content = content[size:]
+		}
+		if toolCalls, exists := message["tool_calls"]; exists && toolCalls != nil {
+			writeChunk(map[string]any{
+				"index":         index,
+				"delta":         map[string]any{"tool_calls": toolCalls},
+				"finish_reason": nil,
+			})
+		}
+		finishReason := choice["finish_reason"]
+		if finishReason == nil {
+			finishReason = "stop"
+		}
+		last := map[string]any{
+			"index":         index,
+			"delta":         map[string]any{},
+			"finish_reason": finishReason,
+		}
+		if usage, exists := completion["usage"]; exists && usage != nil {
+			last["usage"] = usage
+		} else if usage, exists = choice["usage"]; exists && usage != nil {
+			last["usage"] = usage
+		}
+		writeChunk(last)
+	}
+	stream.WriteString("data: [DONE]\n\n")
+	return stream.Bytes()
+}
+
+func cloneCompletion(completion map[string]any) map[string]any {
+	data, _ := json.Marshal(completion)
+	cloned := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	decoder.Decode(&cloned)
+	return cloned
+}
+
+// deltaToMessage converts a merged stream completion into the shape of a
+// non-streaming completion.
+func deltaToMessage(completion map[string]any) {
+	if choicesValue, exists := completion["choices"]; exists {
+		if choices, isArr := choicesValue.([]any); isArr {
+			for _, choiceValue := range choices {
+				if choice, isObj := choiceValue.(map[string]any); isObj {
+					if delta, exists := choice["delta"]; exists {
+						choice["message"] = delta
+						delete(choice, "delta")
+					}
+				}
+			}
+		}
+	}
+}
+
+func decodeCompletion(data string) (map[string]any, error) {
+	completion := make(map[string]any)
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&completion); err != nil {
+		return nil, err
+	}
+	if _, exists := completion["choices"]; !exists {
+		return nil, errors.New("no choices found in completion")
+	}
+	deltaToMessage(completion)
+	// Usage of a stream completion is attached to its choices, move it to the top
+	// level as what a non-streaming completion looks like.
+	if choices, isArr := completion["choices"].([]any); isArr {
+		for _, choiceValue := range choices {
+			if choice, isObj := choiceValue.(map[string]any); isObj {
+				if usage, exists := choice["usage"]; exists {
+					if _, exists = completion["usage"]; !exists {
+						completion["usage"] = usage
+					}
+					delete(choice, "usage")
+				}
+			}
+		}
+	}
+	return completion, nil
+}
+
+func loadMockFixtures(fixturesPath string, predicates []string) ([]*mockFixture, []string, error) {
+	var (
+		fixtures []*mockFixture
+		messages []string
+	)
+	addFixture := func(requestBody string, completion map[string]any) {
+		var requestObject struct {
+			Model    string          `json:"model"`
+			Messages json.RawMessage `json:"messages"`
+		}
+		json.Unmarshal([]byte(requestBody), &requestObject)
+		fixtures = append(fixtures, &mockFixture{
+			model:      requestObject.Model,
+			completion: completion,
+		})
+		if len(requestObject.Messages) > 0 {
+			messages = append(messages, string(pretty.Ugly(requestObject.Messages)))
+		} else {
+			messages = append(messages, "")
+		}
+	}
+	if fixturesPath != "" {
+		files, err := mockFixtureFiles(fixturesPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, file := range files {
+			requestBody, completion, err := readMockFixture(file)
+			if err != nil {
+				return nil, nil, fmt.Errorf("mock fixture %s: %w", file, err)
+			}
+			if completion != nil {
+				addFixture(requestBody, completion)
+			}
+		}
+	} else {
+		predicate, err := Predicates(append([]string{mockSuccessQuery}, predicates...)).Parse()
+		if err != nil {
+			return nil, nil, fmt.Errorf("predicate: %w", err)
+		}
+		requests, err := persistence.ListRequests(mockMaxRows, true, predicate)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, request := range requests {
+			if completion, err := decodeCompletion(request.ResponseBody.String); err == nil {
+				addFixture(request.RequestBody.String, completion)
+			}
+		}
+	}
+	if len(fixtures) == 0 {
+		return nil, nil, errors.New("no fixtures found for mock mode")
+	}
+	return fixtures, messages, nil
+}
+
+func mockFixtureFiles(fixturesPath string) ([]string, error) {
+	stat, err := os.Stat(fixturesPath)
+	if err != nil {
+		return nil, err
+	}
+	if !stat.IsDir() {
+		return []string{fixturesPath}, nil
+	}
+	return filepath.Glob(filepath.Join(fixturesPath, "*.json"))
+}
+
+// readMockFixture reads a file in the same shape as the export command writes,
+// the response body is either a completion object or the raw event stream.
+func readMockFixture(file string) (string, map[string]any, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", nil, err
+	}
+	var exported struct {
+		Request struct {
+			Body json.RawMessage `json:"body"`
+		} `json:"request"`
+		Response struct {
+			Status string          `json:"status"`
+			Body   json.RawMessage `json:"body"`
+		} `json:"response"`
+	}
+	if err = json.Unmarshal(data, &exported); err != nil {
+		return "", nil, err
+	}
+	if !strings.HasPrefix(exported.Response.Status, "2") {
+		return "", nil, nil
+	}
+	var responseBody string
+	if err = json.Unmarshal(exported.Response.Body, &responseBody); err == nil {
+		responseBody = mergeCompletion(responseBody)
+	} else {
+		responseBody = string(exported.Response.Body)
+	}
+	completion, err := decodeCompletion(responseBody)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(exported.Request.Body), completion, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMockEnabled(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		config string
+		args   []string
+		want   bool
+	}{
+		{name: "missing", config: "port: 8080\n", want: false},
+		{name: "empty", config: "mock:\n", want: false},
+		{name: "fixtures only", config: "mock:\n    fixtures: /tmp/fixtures\n", want: false},
+		{name: "disabled", config: "mock:\n    enabled: false\n", want: false},
+		{name: "enabled", config: "mock:\n    enabled: true\n", want: true},
+		{name: "flag", config: "port: 8080\n", args: []string{"--mock"}, want: true},
+		{name: "flag over disabled", config: "mock:\n    enabled: false\n", args: []string{"--mock"}, want: true},
+		{name: "flag over enabled", config: "mock:\n    enabled: true\n", args: []string{"--mock=false"}, want: false},
+	}
+	for _, testcase := range testcases {
+		var cfg StartConfig
+		if err := yaml.Unmarshal([]byte(testcase.config), &cfg); err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		cmd := startCommand()
+		if err := cmd.ParseFlags(testcase.args); err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		if got := mockEnabled(cfg.Mock, cmd); got != testcase.want {
+			t.Errorf("%s: want %v, got %v", testcase.name, testcase.want, got)
+		}
+	}
+}
+
+func newTestMockTransport() *mockTransport {
+	fixture := func(model string, content string) *mockFixture {
+		return &mockFixture{
+			model: model,
+			completion: map[string]any{
+				"model": model,
+				"choices": []any{map[string]any{
+					"index":         0,
+					"message":       map[string]any{"role": "assistant", "content": content},
+					"finish_reason": "stop",
+				}},
+			},
+		}
+	}
+	return newMockTransport(
+		[]*mockFixture{
+			fixture("moonshot-v1-8k", "hello"),
+			fixture("moonshot-v1-8k", "bye"),
+			fixture("moonshot-v1-32k", "long"),
+		},
+		[]string{
+			`[{"role":"user","content":"hi"}]`,
+			`[{"role":"user","content":"see you"}]`,
+			"",
+		},
+	)
+}
+
+func TestMockTransportPick(t *testing.T) {
+	var testcases = []struct {
+		name     string
+		model    string
+		messages string
+		want     []string
+	}{
+		{
+			name:     "same messages",
+			model:    "moonshot-v1-8k",
+			messages: `[ {"role": "user", "content": "see you"} ]`,
+			want:     []string{"bye", "bye"},
+		},
+		{
+			name:     "same messages of another model",
+			model:    "moonshot-v1-32k",
+			messages: `[{"role":"user","content":"hi"}]`,
+			want:     []string{"hello"},
+		},
+		{
+			name:     "same model",
+			model:    "moonshot-v1-32k",
+			messages: `[{"role":"user","content":"unknown"}]`,
+			want:     []string{"long", "long"},
+		},
+		{
+			name:  "same model in turn",
+			model: "moonshot-v1-8k",
+			want:  []string{"hello", "bye", "hello"},
+		},
+		{
+			name:  "any fixture",
+			model: "kimi-latest",
+			want:  []string{"hello", "bye", "long"},
+		},
+	}
+	for _, testcase := range testcases {
+		transport := newTestMockTransport()
+		for i, want := range testcase.want {
+			var messages json.RawMessage
+			if testcase.messages != "" {
+				messages = json.RawMessage(testcase.messages)
+			}
+			fixture := transport.pick(testcase.model, messages)
+			choice := fixture.completion["choices"].([]any)[0].(map[string]any)
+			got := choice["message"].(map[string]any)["content"]
+			if got != want {
+				t.Errorf("%s: pick #%d: want %q, got %q", testcase.name, i, want, got)
+			}
+		}
+	}
+}
+
+func TestMockTransportRoundTrip(t *testing.T) {
+	var testcases = []struct {
+		name        string
+		path        string
+		body        string
+		statusCode  int
+		contentType string
+		want        string
+	}{
+		{
+			name:        "completion",
+			path:        "/v1/chat/completions",
+			body:        `{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}]}`,
+			statusCode:  http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			want:        `"content":"hello"`,
+		},
+		{
+			name:        "event stream",
+			path:        "/v1/chat/completions",
+			body:        `{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}],"stream":true}`,
+			statusCode:  http.StatusOK,
+			contentType: "text/event-stream",
+			want:        "data: [DONE]",
+		},
+		{
+			name:        "other endpoints",
+			path:        "/v1/files",
+			statusCode:  http.StatusNotFound,
+			contentType: "application/json; charset=utf-8",
+			want:        "resource_not_found_error",
+		},
+		{
+			name:        "invalid body",
+			path:        "/v1/chat/completions",
+			body:        `{`,
+			statusCode:  http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			want:        "invalid_request_error",
+		},
+	}
+	for _, testcase := range testcases {
+		request, _ := http.NewRequest(http.MethodPost, mockEndpoint+testcase.path, strings.NewReader(testcase.body))
+		response, err := newTestMockTransport().RoundTrip(request)
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		body, _ := io.ReadAll(response.Body)
+		if response.StatusCode != testcase.statusCode {
+			t.Errorf("%s: status code: want %d, got %d", testcase.name, testcase.statusCode, response.StatusCode)
+		}
+		if got := response.Header.Get("Content-Type"); got != testcase.contentType {
+			t.Errorf("%s: content type: want %q, got %q", testcase.name, testcase.contentType, got)
+		}
+		if !strings.Contains(string(body), testcase.want) {
+			t.Errorf("%s: want %q in body, got %s", testcase.name, testcase.want, body)
+		}
+	}
+}
+
+// serveTestProxy serves the request with the proxy and waits for the request to
+// be stored, which happens after the response is written.
+func serveTestProxy(t *testing.T, proxy http.HandlerFunc, request *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	notification := newRows.subscribe()
+	defer newRows.unsubscribe(notification)
+	recorder := httptest.NewRecorder()
+	proxy(recorder, request)
+	select {
+	case <-notification:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request is not stored")
+	}
+	return recorder
+}
+
+func TestMockCost(t *testing.T) {
+	usePersistenceForTest(t)
+	transport := httpClient.Transport
+	httpClient.Transport = newTestMockTransport()
+	t.Cleanup(func() { httpClient.Transport = transport })
+	proxy := buildProxy(mockEndpoint, nil, "", nil, nil, false, 0, 0, false, false, 0, 0, 0, nil)
+	recorder := serveTestProxy(t, proxy, httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}]}`)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("want status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	id, err := persistence.LatestRequestID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := persistence.GetRequest(id, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Mocked responses cost nothing, rather than an unknown cost.
+	if !request.Cost.Valid || request.Cost.Float64 != 0 {
+		t.Errorf("want cost 0, got %v", request.Cost)
+	}
+}
@@ -63,15 +63,39 @@ func (__imp *implPersistence) Close() error {
 var (
 	_ = (*template.Template)(nil)
 
-	__PersistenceBaseTemplate = template.Must(template.New("PersistenceBaseTemplate").Funcs(template.FuncMap{"bindvars": __rt.BindVars, "fields": tableFields}).Parse(""))
-
-	sqlTmpladdTTFTField     = template.Must(__PersistenceBaseTemplate.New("addTTFTField").Parse("alter table moonshot_requests add response_ttft integer;\r\n"))
-	sqlTmpladdTPOTField     = template.Must(__PersistenceBaseTemplate.New("addTPOTField").Parse("alter table moonshot_requests add response_tpot integer;\r\n"))
-	sqlTmpladdOTPSField     = template.Must(__PersistenceBaseTemplate.New("addOTPSField").Parse("alter table moonshot_requests add response_otps real;\r\n"))
-	sqlTmpladdLatencyField  = template.Must(__PersistenceBaseTemplate.New("addLatencyField").Parse("alter table moonshot_requests add latency integer;\r\n"))
-	sqlTmpladdEndpointField = template.Must(__PersistenceBaseTemplate.New("addEndpointField").Parse("alter table moonshot_requests add endpoint text;\r\n"))
-	sqlTmplPersistence      = template.Must(__PersistenceBaseTemplate.New("Persistence").Parse("insert into moonshot_requests ( request_method, request_path, request_query, created_at {{ if .requestContentType }},request_content_type{{ end }} {{ if .requestID }},request_id{{ end }} {{ if .moonshotID }},moonshot_id{{ end }} {{ if .moonshotGID }},moonshot_gid{{ end }} {{ if .moonshotUID }},moonshot_uid{{ end }} {{ if .moonshotRequestID }},moonshot_request_id{{ end }} {{ if .moonshotServerTiming }},moonshot_server_timing{{ end }} {{ if .responseStatusCode }},response_status_code{{ end }} {{ if .responseContentType }},response_content_type{{ end }} {{ if .requestHeader }},request_header{{ end }} {{ if .requestBody }},request_body{{ end }} {{ if .responseHeader }},response_header{{ end }} {{ if .responseBody }},response_body{{ end }} {{ if .programError }},error{{ end }} {{ if .responseTTFT }},response_ttft{{ end }} {{ if .responseTPOT }},response_tpot{{ end }} {{ if .responseOTPS }},response_otps{{ end }} {{ if .latency }},latency{{ end }} {{ if .endpoint }},endpoint{{ end }} ) values ( :requestMethod, :requestPath, :requestQuery, :createdAt {{ if .requestContentType }},:requestContentType{{ end }} {{ if .requestID }},:requestID{{ end }} {{ if .moonshotID }},:moonshotID{{ end }} {{ if .moonshotGID }},:moonshotGID{{ end }} {{ if .moonshotUID }},:moonshotUID{{ end }} {{ if .moonshotRequestID }},:moonshotRequestID{{ end }} {{ if .moonshotServerTiming }},:moonshotServerTiming{{ end }} {{ if .responseStatusCode }},:responseStatusCode{{ end }} {{ if .responseContentType }},:responseContentType{{ end }} {{ if .requestHeader }},:requestHeader{{ end }} {{ if .requestBody }},:requestBody{{ end }} {{ if .responseHeader }},:responseHeader{{ end }} {{ if .responseBody }},:responseBody{{ end }} {{ if .programError }},:programError{{ end }} {{ if .responseTTFT }},:responseTTFT{{ end }} {{ if .responseTPOT }},:responseTPOT{{ end }} {{ if .responseOTPS }},:responseOTPS{{ end }} {{ if .latency }},:latency{{ end }} {{ if .endpoint }},:endpoint{{ end }} );\r\nselect last_insert_rowid();\r\n"))
-	sqlTmplGetRequest       = template.Must(__PersistenceBaseTemplate.New("GetRequest").Parse("select * from moonshot_requests where 1 = 1 {{ if .id }} and id = :id {{ end }} {{ if .chatcmpl }} and moonshot_id = :chatcmpl {{ end }} {{ if .requestid }} and moonshot_request_id = :requestid {{ end }} ;\r\n"))
+	__PersistenceBaseTemplate = template.Must(template.New("PersistenceBaseTemplate").Funcs(template.FuncMap{"bindvars": __rt.BindVars, "body": referencesBody, "fields": tableFields, "fts": fullTextPart}).Parse(""))
+
+	sqlTmpladdTTFTField              = template.Must(__PersistenceBaseTemplate.New("addTTFTField").Parse("alter table moonshot_requests add response_ttft integer;\r\n"))
+	sqlTmpladdTPOTField              = template.Must(__PersistenceBaseTemplate.New("addTPOTField").Parse("alter table moonshot_requests add response_tpot integer;\r\n"))
+	sqlTmpladdOTPSField              = template.Must(__PersistenceBaseTemplate.New("addOTPSField").Parse("alter table moonshot_requests add response_otps real;\r\n"))
+	sqlTmpladdLatencyField           = template.Must(__PersistenceBaseTemplate.New("addLatencyField").Parse("alter table moonshot_requests add latency integer;\r\n"))
+	sqlTmpladdEndpointField          = template.Must(__PersistenceBaseTemplate.New("addEndpointField").Parse("alter table moonshot_requests add endpoint text;\r\n"))
+	sqlTmpladdRequestHashField       = template.Must(__PersistenceBaseTemplate.New("addRequestHashField").Parse("alter table moonshot_requests add request_hash text;\r\n"))
+	sqlTmpladdResponseTimingField    = template.Must(__PersistenceBaseTemplate.New("addResponseTimingField").Parse("alter table moonshot_requests add response_timing text;\r\n"))
+	sqlTmpladdRetryOfField           = template.Must(__PersistenceBaseTemplate.New("addRetryOfField").Parse("alter table moonshot_requests add retry_of integer;\r\n"))
+	sqlTmpladdKIdentField            = template.Must(__PersistenceBaseTemplate.New("addKIdentField").Parse("alter table moonshot_requests add k_ident text;\r\n"))
+	sqlTmpladdCostField              = template.Must(__PersistenceBaseTemplate.New("addCostField").Parse("alter table moonshot_requests add cost real;\r\n"))
+	sqlTmpladdConversationIDField    = template.Must(__PersistenceBaseTemplate.New("addConversationIDField").Parse("alter table moonshot_requests add conversation_id integer;\r\n"))
+	sqlTmpladdConversationTurnField  = template.Must(__PersistenceBaseTemplate.New("addConversationTurnField").Parse("alter table moonshot_requests add conversation_turn integer;\r\n"))
+	sqlTmpladdReplyHashField         = template.Must(__PersistenceBaseTemplate.New("addReplyHashField").Parse("alter table moonshot_requests add reply_hash text;\r\n"))
+	sqlTmpladdImportedIDField        = template.Must(__PersistenceBaseTemplate.New("addImportedIDField").Parse("alter table moonshot_requests add imported_id integer;\r\n"))
+	sqlTmpladdAttemptField           = template.Must(__PersistenceBaseTemplate.New("addAttemptField").Parse("alter table moonshot_requests add attempt integer;\r\n"))
+	sqlTmpladdMoonshotIDIndex        = template.Must(__PersistenceBaseTemplate.New("addMoonshotIDIndex").Parse("create index if not exists moonshot_requests_moonshot_id_index on moonshot_requests (moonshot_id);\r\n"))
+	sqlTmpladdMoonshotRequestIDIndex = template.Must(__PersistenceBaseTemplate.New("addMoonshotRequestIDIndex").Parse("create index if not exists moonshot_requests_moonshot_request_id_index on moonshot_requests (moonshot_request_id);\r\n"))
+	sqlTmpladdCreatedAtIndex         = template.Must(__PersistenceBaseTemplate.New("addCreatedAtIndex").Parse("create index if not exists moonshot_requests_created_at_index on moonshot_requests (created_at);\r\n"))
+	sqlTmpladdRequestHashIndex       = template.Must(__PersistenceBaseTemplate.New("addRequestHashIndex").Parse("create index if not exists moonshot_requests_request_hash_index on moonshot_requests (request_hash);\r\n"))
+	sqlTmpladdConversationIDIndex    = template.Must(__PersistenceBaseTemplate.New("addConversationIDIndex").Parse("create index if not exists moonshot_requests_conversation_id_index on moonshot_requests (conversation_id);\r\n"))
+	sqlTmpladdReplyHashIndex         = template.Must(__PersistenceBaseTemplate.New("addReplyHashIndex").Parse("create index if not exists moonshot_requests_reply_hash_index on moonshot_requests (reply_hash);\r\n"))
+	sqlTmpladdRequestIDIndex         = template.Must(__PersistenceBaseTemplate.New("addRequestIDIndex").Parse("create index if not exists moonshot_requests_request_id_index on moonshot_requests (request_id, attempt) where attempt is not null;\r\n"))
+	sqlTmplcreateAnnotationTables    = template.Must(__PersistenceBaseTemplate.New("createAnnotationTables").Parse("create table if not exists moonshot_annotations ( request_id             integer not null constraint moonshot_annotations_pk primary key, category               text, note                   text, created_at             text    default (datetime('now', 'localtime')) not null, updated_at             text ); create table if not exists moonshot_tags ( request_id             integer not null, tag                    text    not null, created_at             text    default (datetime('now', 'localtime')) not null, constraint moonshot_tags_pk primary key (request_id, tag) ); create index if not exists moonshot_tags_tag_index on moonshot_tags (tag);\r\n"))
+	sqlTmplcreateFullTextTable       = template.Must(__PersistenceBaseTemplate.New("createFullTextTable").Parse("create virtual table if not exists {{ fts \"table\" }} using {{ fts \"module\" }};\r\n"))
+	sqlTmplindexNewRequests          = template.Must(__PersistenceBaseTemplate.New("indexNewRequests").Parse("insert into {{ fts \"table\" }} (rowid, messages, output) select id, iif(encrypted(request_body), '', fts_messages(coalesce(decompress(request_body), ''))), iif( encrypted(response_body), '', fts_output(coalesce(decompress(response_body), ''), coalesce(response_content_type, '')) ) from moonshot_requests where id > (select coalesce(max(rowid), 0) from {{ fts \"table\" }}) and request_path like '%/chat/completions' ;\r\n"))
+	sqlTmplClearFullTextIndex        = template.Must(__PersistenceBaseTemplate.New("ClearFullTextIndex").Parse("delete from {{ fts \"table\" }};\r\n"))
+	sqlTmplCleanupFullTextIndex      = template.Must(__PersistenceBaseTemplate.New("CleanupFullTextIndex").Parse("delete from {{ fts \"table\" }} where rowid not in ( select id from moonshot_requests where request_body is not null or response_body is not null );\r\n"))
+	sqlTmplPersistence               = template.Must(__PersistenceBaseTemplate.New("Persistence").Parse("insert into moonshot_requests ( request_method, request_path, request_query, created_at {{ if .requestContentType }},request_content_type{{ end }} {{ if .requestID }},request_id{{ end }} {{ if .moonshotID }},moonshot_id{{ end }} {{ if .moonshotGID }},moonshot_gid{{ end }} {{ if .moonshotUID }},moonshot_uid{{ end }} {{ if .moonshotRequestID }},moonshot_request_id{{ end }} {{ if .moonshotServerTiming }},moonshot_server_timing{{ end }} {{ if .responseStatusCode }},response_status_code{{ end }} {{ if .responseContentType }},response_content_type{{ end }} {{ if .requestHeader }},request_header{{ end }} {{ if .requestBody }},request_body{{ end }} {{ if .responseHeader }},response_header{{ end }} {{ if .responseBody }},response_body{{ end }} {{ if .programError }},error{{ end }} {{ if .responseTTFT }},response_ttft{{ end }} {{ if .responseTPOT }},response_tpot{{ end }} {{ if .responseOTPS }},response_otps{{ end }} {{ if .latency }},latency{{ end }} {{ if .endpoint }},endpoint{{ end }} {{ if .requestHash }},request_hash{{ end }} {{ if .responseTiming }},response_timing{{ end }} {{ if .attempt }},attempt{{ end }} {{ if gt .attempt 1 }},retry_of{{ end }} {{ if .kIdent }},k_ident{{ end }} {{ if .costKnown }},cost{{ end }} ) values ( :requestMethod, :requestPath, :requestQuery, :createdAt {{ if .requestContentType }},:requestContentType{{ end }} {{ if .requestID }},:requestID{{ end }} {{ if .moonshotID }},:moonshotID{{ end }} {{ if .moonshotGID }},:moonshotGID{{ end }} {{ if .moonshotUID }},:moonshotUID{{ end }} {{ if .moonshotRequestID }},:moonshotRequestID{{ end }} {{ if .moonshotServerTiming }},:moonshotServerTiming{{ end }} {{ if .responseStatusCode }},:responseStatusCode{{ end }} {{ if .responseContentType }},:responseContentType{{ end }} {{ if .requestHeader }},:requestHeader{{ end }} {{ if .requestBody }},:requestBody{{ end }} {{ if .responseHeader }},:responseHeader{{ end }} {{ if .responseBody }},:responseBody{{ end }} {{ if .programError }},:programError{{ end }} {{ if .responseTTFT }},:responseTTFT{{ end }} {{ if .responseTPOT }},:responseTPOT{{ end }} {{ if .responseOTPS }},:responseOTPS{{ end }} {{ if .latency }},:latency{{ end }} {{ if .endpoint }},:endpoint{{ end }} {{ if .requestHash }},:requestHash{{ end }} {{ if .responseTiming }},:responseTiming{{ end }} {{ if .attempt }},:attempt{{ end }} {{ if gt .attempt 1 }} ,( select max(id) from moonshot_requests where request_id = :requestID and attempt = :attempt - 1 ) {{ end }} {{ if .kIdent }},:kIdent{{ end }} {{ if .costKnown }},:cost{{ end }} );\r\nselect last_insert_rowid();\r\n"))
+	sqlTmplGetRequest                = template.Must(__PersistenceBaseTemplate.New("GetRequest").Parse("select *, coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category, coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note, (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags from moonshot_requests where 1 = 1 {{ if .id }} and id = :id {{ end }} {{ if .chatcmpl }} and moonshot_id = :chatcmpl {{ end }} {{ if .requestid }} and moonshot_request_id = :requestid {{ end }} ;\r\n"))
+	sqlTmplListUnlinkedRequests      = template.Must(__PersistenceBaseTemplate.New("ListUnlinkedRequests").Parse("select id, decompress(request_body) as request_body, iif( response_content_type = 'text/event-stream' and response_body is not null, merge_cmpl(decompress(response_body)), decompress(response_body) ) as response_body from moonshot_requests where conversation_id is null and request_body is not null and request_path like '%/chat/completions' {{ if .skipAttempts }} and not exists ( select 1 from moonshot_requests as next_attempt where next_attempt.request_id = moonshot_requests.request_id and next_attempt.attempt = moonshot_requests.attempt + 1 ) {{ end }} order by id;\r\n"))
+	sqlTmplListConversation          = template.Must(__PersistenceBaseTemplate.New("ListConversation").Parse("select * from ( select {{ fields \"request_header\" \"request_body\" \"response_header\" \"response_body\" }}, decrypt(request_header) as request_header, decrypt(response_header) as response_header, decompress(request_body) as request_body, iif( response_content_type = 'text/event-stream' and response_body is not null, merge_cmpl(decompress(response_body)), decompress(response_body) ) as response_body, coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category, coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note, (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags from moonshot_requests where conversation_id = :conversationID ) order by id;\r\n"))
 )
 
 func (__imp *implPersistence) createTable() error {
@@ -82,7 +106,7 @@ func (__imp *implPersistence) createTable() error {
 
 	argListcreateTable = __rt.Arguments{}
 
-	querycreateTable := "create table if not exists moonshot_requests ( id                     integer not null constraint moonshot_requests_pk primary key autoincrement, request_method         text    not null, request_path           text    not null, request_query          text    not null, request_content_type   text, request_id             text, moonshot_id            text, moonshot_gid           text, moonshot_uid           text, moonshot_request_id    text, moonshot_server_timing integer, response_status_code   integer, response_content_type  text, request_header         text, request_body           text, response_header        text, response_body          text, error                  text, response_ttft          integer, response_tpot          integer, response_otps          real, latency                integer, endpoint               text, created_at             text    default (datetime('now', 'localtime')) not null ); create table if not exists moonshot_caches ( id                     integer not null constraint moonshot_requests_pk primary key autoincrement, cache_id               text    not null, hash                   text    not null, n_bytes                integer not null, k_ident                text    not null, created_at             text    default (datetime('now', 'localtime')) not null, updated_at             text )\r\n"
+	querycreateTable := "create table if not exists moonshot_requests ( id                     integer not null constraint moonshot_requests_pk primary key autoincrement, request_method         text    not null, request_path           text    not null, request_query          text    not null, request_content_type   text, request_id             text, moonshot_id            text, moonshot_gid           text, moonshot_uid           text, moonshot_request_id    text, moonshot_server_timing integer, response_status_code   integer, response_content_type  text, request_header         text, request_body           text, response_header        text, response_body          text, error                  text, response_ttft          integer, response_tpot          integer, response_otps          real, latency                integer, endpoint               text, request_hash           text, response_timing        text, retry_of               integer, k_ident                text, cost                   real, conversation_id        integer, conversation_turn      integer, reply_hash             text, created_at             text    default (datetime('now', 'localtime')) not null ); create table if not exists moonshot_caches ( id                     integer not null constraint moonshot_requests_pk primary key autoincrement, cache_id               text    not null, hash                   text    not null, n_bytes                integer not null, k_ident                text    not null, created_at             text    default (datetime('now', 'localtime')) not null, updated_at             text )\r\n"
 
 	txcreateTable, errcreateTable := __imp.__core.Beginx()
 	if errcreateTable != nil {
@@ -169,6 +193,153 @@ func (__imp *implPersistence) inspectTable() ([]*tableInfo, error) {
 	return v0inspectTable, nil
 }
 
+func (__imp *implPersistence) createMigrationTable() error {
+	var (
+		errcreateMigrationTable     error
+		argListcreateMigrationTable = make(__rt.Arguments, 0, 8)
+	)
+
+	argListcreateMigrationTable = __rt.Arguments{}
+
+	querycreateMigrationTable := "create table if not exists schema_migrations ( version                integer not null constraint schema_migrations_pk primary key, name                   text    not null, applied_at             text    default (datetime('now', 'localtime')) not null );\r\n"
+
+	txcreateMigrationTable, errcreateMigrationTable := __imp.__core.Beginx()
+	if errcreateMigrationTable != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("createMigrationTable"), errcreateMigrationTable)
+	}
+	if !__imp.__withTx {
+		defer txcreateMigrationTable.Rollback()
+	}
+
+	offsetcreateMigrationTable := 0
+	argscreateMigrationTable := __rt.MergeArgs(argListcreateMigrationTable...)
+
+	sqlSlicecreateMigrationTable := __rt.Split(querycreateMigrationTable, ";")
+	for indexcreateMigrationTable, splitSqlcreateMigrationTable := range sqlSlicecreateMigrationTable {
+		_ = indexcreateMigrationTable
+
+		countcreateMigrationTable := __rt.Count(splitSqlcreateMigrationTable, "?")
+
+		_, errcreateMigrationTable = txcreateMigrationTable.Exec(splitSqlcreateMigrationTable, argscreateMigrationTable[offsetcreateMigrationTable:offsetcreateMigrationTable+countcreateMigrationTable]...)
+
+		if errcreateMigrationTable != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("createMigrationTable"), splitSqlcreateMigrationTable, errcreateMigrationTable)
+		}
+
+		offsetcreateMigrationTable += countcreateMigrationTable
+	}
+
+	if !__imp.__withTx {
+		if errcreateMigrationTable := txcreateMigrationTable.Commit(); errcreateMigrationTable != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("createMigrationTable"), errcreateMigrationTable)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) ListMigrations() ([]*schemaMigration, error) {
+	var (
+		v0ListMigrations      []*schemaMigration
+		errListMigrations     error
+		argListListMigrations = make(__rt.Arguments, 0, 8)
+	)
+
+	argListListMigrations = __rt.Arguments{}
+
+	queryListMigrations := "select version, name, applied_at from schema_migrations order by version;\r\n"
+
+	txListMigrations, errListMigrations := __imp.__core.Beginx()
+	if errListMigrations != nil {
+		return v0ListMigrations, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("ListMigrations"), errListMigrations)
+	}
+	if !__imp.__withTx {
+		defer txListMigrations.Rollback()
+	}
+
+	offsetListMigrations := 0
+	argsListMigrations := __rt.MergeArgs(argListListMigrations...)
+
+	sqlSliceListMigrations := __rt.Split(queryListMigrations, ";")
+	for indexListMigrations, splitSqlListMigrations := range sqlSliceListMigrations {
+		_ = indexListMigrations
+
+		countListMigrations := __rt.Count(splitSqlListMigrations, "?")
+
+		if indexListMigrations < len(sqlSliceListMigrations)-1 {
+			_, errListMigrations = txListMigrations.Exec(splitSqlListMigrations, argsListMigrations[offsetListMigrations:offsetListMigrations+countListMigrations]...)
+		} else {
+			errListMigrations = txListMigrations.Select(&v0ListMigrations, splitSqlListMigrations, argsListMigrations[offsetListMigrations:offsetListMigrations+countListMigrations]...)
+		}
+
+		if errListMigrations != nil {
+			return v0ListMigrations, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("ListMigrations"), splitSqlListMigrations, errListMigrations)
+		}
+
+		offsetListMigrations += countListMigrations
+	}
+
+	if !__imp.__withTx {
+		if errListMigrations := txListMigrations.Commit(); errListMigrations != nil {
+			return v0ListMigrations, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("ListMigrations"), errListMigrations)
+		}
+	}
+
+	return v0ListMigrations, nil
+}
+
+func (__imp *implPersistence) addMigration(version int64, name string) error {
+	var (
+		erraddMigration error
+	)
+
+	queryaddMigration := "insert into schema_migrations (version, name) values (:version, :name);\r\n"
+
+	txaddMigration, erraddMigration := __imp.__core.Beginx()
+	if erraddMigration != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addMigration"), erraddMigration)
+	}
+	if !__imp.__withTx {
+		defer txaddMigration.Rollback()
+	}
+
+	argsaddMigration := __rt.MergeNamedArgs(map[string]any{
+		"version": version,
+		"name":    name,
+	})
+
+	sqlSliceaddMigration := __rt.Split(queryaddMigration, ";")
+	for indexaddMigration, splitSqladdMigration := range sqlSliceaddMigration {
+		_ = indexaddMigration
+
+		var listArgsaddMigration []interface{}
+
+		splitSqladdMigration, listArgsaddMigration, erraddMigration = sqlx.Named(splitSqladdMigration, argsaddMigration)
+		if erraddMigration != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("addMigration"), erraddMigration)
+		}
+
+		splitSqladdMigration, listArgsaddMigration, erraddMigration = sqlx.In(splitSqladdMigration, listArgsaddMigration...)
+		if erraddMigration != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("addMigration"), erraddMigration)
+		}
+
+		_, erraddMigration = txaddMigration.Exec(splitSqladdMigration, listArgsaddMigration...)
+
+		if erraddMigration != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addMigration"), splitSqladdMigration, erraddMigration)
+		}
+	}
+
+	if !__imp.__withTx {
+		if erraddMigration := txaddMigration.Commit(); erraddMigration != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addMigration"), erraddMigration)
+		}
+	}
+
+	return nil
+}
+
 func (__imp *implPersistence) addTTFTField() error {
 	var (
 		erraddTTFTField     error
@@ -393,343 +564,3075 @@ func (__imp *implPersistence) addEndpointField() error {
 	defer __rt.PutBuffer(sqladdEndpointField)
 	defer sqladdEndpointField.Reset()
 
-	if erraddEndpointField = sqlTmpladdEndpointField.Execute(sqladdEndpointField, map[string]any{}); erraddEndpointField != nil {
-		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addEndpointField"), erraddEndpointField)
-	}
+	if erraddEndpointField = sqlTmpladdEndpointField.Execute(sqladdEndpointField, map[string]any{}); erraddEndpointField != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addEndpointField"), erraddEndpointField)
+	}
+
+	queryaddEndpointField := sqladdEndpointField.String()
+
+	txaddEndpointField, erraddEndpointField := __imp.__core.Beginx()
+	if erraddEndpointField != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addEndpointField"), erraddEndpointField)
+	}
+	if !__imp.__withTx {
+		defer txaddEndpointField.Rollback()
+	}
+
+	offsetaddEndpointField := 0
+	argsaddEndpointField := __rt.MergeArgs(argListaddEndpointField...)
+
+	sqlSliceaddEndpointField := __rt.Split(queryaddEndpointField, ";")
+	for indexaddEndpointField, splitSqladdEndpointField := range sqlSliceaddEndpointField {
+		_ = indexaddEndpointField
+
+		countaddEndpointField := __rt.Count(splitSqladdEndpointField, "?")
+
+		_, erraddEndpointField = txaddEndpointField.Exec(splitSqladdEndpointField, argsaddEndpointField[offsetaddEndpointField:offsetaddEndpointField+countaddEndpointField]...)
+
+		if erraddEndpointField != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addEndpointField"), splitSqladdEndpointField, erraddEndpointField)
+		}
+
+		offsetaddEndpointField += countaddEndpointField
+	}
+
+	if !__imp.__withTx {
+		if erraddEndpointField := txaddEndpointField.Commit(); erraddEndpointField != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addEndpointField"), erraddEndpointField)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addRequestHashField() error {
+	var (
+		erraddRequestHashField     error
+		argListaddRequestHashField = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddRequestHashField = __rt.Arguments{}
+
+	sqladdRequestHashField := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdRequestHashField)
+	defer sqladdRequestHashField.Reset()
+
+	if erraddRequestHashField = sqlTmpladdRequestHashField.Execute(sqladdRequestHashField, map[string]any{}); erraddRequestHashField != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addRequestHashField"), erraddRequestHashField)
+	}
+
+	queryaddRequestHashField := sqladdRequestHashField.String()
+
+	txaddRequestHashField, erraddRequestHashField := __imp.__core.Beginx()
+	if erraddRequestHashField != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addRequestHashField"), erraddRequestHashField)
+	}
+	if !__imp.__withTx {
+		defer txaddRequestHashField.Rollback()
+	}
+
+	offsetaddRequestHashField := 0
+	argsaddRequestHashField := __rt.MergeArgs(argListaddRequestHashField...)
+
+	sqlSliceaddRequestHashField := __rt.Split(queryaddRequestHashField, ";")
+	for indexaddRequestHashField, splitSqladdRequestHashField := range sqlSliceaddRequestHashField {
+		_ = indexaddRequestHashField
+
+		countaddRequestHashField := __rt.Count(splitSqladdRequestHashField, "?")
+
+		_, erraddRequestHashField = txaddRequestHashField.Exec(splitSqladdRequestHashField, argsaddRequestHashField[offsetaddRequestHashField:offsetaddRequestHashField+countaddRequestHashField]...)
+
+		if erraddRequestHashField != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addRequestHashField"), splitSqladdRequestHashField, erraddRequestHashField)
+		}
+
+		offsetaddRequestHashField += countaddRequestHashField
+	}
+
+	if !__imp.__withTx {
+		if erraddRequestHashField := txaddRequestHashField.Commit(); erraddRequestHashField != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addRequestHashField"), erraddRequestHashField)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addResponseTimingField() error {
+	var (
+		erraddResponseTimingField     error
+		argListaddResponseTimingField = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddResponseTimingField = __rt.Arguments{}
+
+	sqladdResponseTimingField := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdResponseTimingField)
+	defer sqladdResponseTimingField.Reset()
+
+	if erraddResponseTimingField = sqlTmpladdResponseTimingField.Execute(sqladdResponseTimingField, map[string]any{}); erraddResponseTimingField != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addResponseTimingField"), erraddResponseTimingField)
+	}
+
+	queryaddResponseTimingField := sqladdResponseTimingField.String()
+
+	txaddResponseTimingField, erraddResponseTimingField := __imp.__core.Beginx()
+	if erraddResponseTimingField != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addResponseTimingField"), erraddResponseTimingField)
+	}
+	if !__imp.__withTx {
+		defer txaddResponseTimingField.Rollback()
+	}
+
+	offsetaddResponseTimingField := 0
+	argsaddResponseTimingField := __rt.MergeArgs(argListaddResponseTimingField...)
+
+	sqlSliceaddResponseTimingField := __rt.Split(queryaddResponseTimingField, ";")
+	for indexaddResponseTimingField, splitSqladdResponseTimingField := range sqlSliceaddResponseTimingField {
+		_ = indexaddResponseTimingField
+
+		countaddResponseTimingField := __rt.Count(splitSqladdResponseTimingField, "?")
+
+		_, erraddResponseTimingField = txaddResponseTimingField.Exec(splitSqladdResponseTimingField, argsaddResponseTimingField[offsetaddResponseTimingField:offsetaddResponseTimingField+countaddResponseTimingField]...)
+
+		if erraddResponseTimingField != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addResponseTimingField"), splitSqladdResponseTimingField, erraddResponseTimingField)
+		}
+
+		offsetaddResponseTimingField += countaddResponseTimingField
+	}
+
+	if !__imp.__withTx {
+		if erraddResponseTimingField := txaddResponseTimingField.Commit(); erraddResponseTimingField != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addResponseTimingField"), erraddResponseTimingField)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addRetryOfField() error {
+	var (
+		erraddRetryOfField     error
+		argListaddRetryOfField = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddRetryOfField = __rt.Arguments{}
+
+	sqladdRetryOfField := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdRetryOfField)
+	defer sqladdRetryOfField.Reset()
+
+	if erraddRetryOfField = sqlTmpladdRetryOfField.Execute(sqladdRetryOfField, map[string]any{}); erraddRetryOfField != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addRetryOfField"), erraddRetryOfField)
+	}
+
+	queryaddRetryOfField := sqladdRetryOfField.String()
+
+	txaddRetryOfField, erraddRetryOfField := __imp.__core.Beginx()
+	if erraddRetryOfField != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addRetryOfField"), erraddRetryOfField)
+	}
+	if !__imp.__withTx {
+		defer txaddRetryOfField.Rollback()
+	}
+
+	offsetaddRetryOfField := 0
+	argsaddRetryOfField := __rt.MergeArgs(argListaddRetryOfField...)
+
+	sqlSliceaddRetryOfField := __rt.Split(queryaddRetryOfField, ";")
+	for indexaddRetryOfField, splitSqladdRetryOfField := range sqlSliceaddRetryOfField {
+		_ = indexaddRetryOfField
+
+		countaddRetryOfField := __rt.Count(splitSqladdRetryOfField, "?")
+
+		_, erraddRetryOfField = txaddRetryOfField.Exec(splitSqladdRetryOfField, argsaddRetryOfField[offsetaddRetryOfField:offsetaddRetryOfField+countaddRetryOfField]...)
+
+		if erraddRetryOfField != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addRetryOfField"), splitSqladdRetryOfField, erraddRetryOfField)
+		}
+
+		offsetaddRetryOfField += countaddRetryOfField
+	}
+
+	if !__imp.__withTx {
+		if erraddRetryOfField := txaddRetryOfField.Commit(); erraddRetryOfField != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addRetryOfField"), erraddRetryOfField)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addKIdentField() error {
+	var (
+		erraddKIdentField     error
+		argListaddKIdentField = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddKIdentField = __rt.Arguments{}
+
+	sqladdKIdentField := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdKIdentField)
+	defer sqladdKIdentField.Reset()
+
+	if erraddKIdentField = sqlTmpladdKIdentField.Execute(sqladdKIdentField, map[string]any{}); erraddKIdentField != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addKIdentField"), erraddKIdentField)
+	}
+
+	queryaddKIdentField := sqladdKIdentField.String()
+
+	txaddKIdentField, erraddKIdentField := __imp.__core.Beginx()
+	if erraddKIdentField != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addKIdentField"), erraddKIdentField)
+	}
+	if !__imp.__withTx {
+		defer txaddKIdentField.Rollback()
+	}
+
+	offsetaddKIdentField := 0
+	argsaddKIdentField := __rt.MergeArgs(argListaddKIdentField...)
+
+	sqlSliceaddKIdentField := __rt.Split(queryaddKIdentField, ";")
+	for indexaddKIdentField, splitSqladdKIdentField := range sqlSliceaddKIdentField {
+		_ = indexaddKIdentField
+
+		countaddKIdentField := __rt.Count(splitSqladdKIdentField, "?")
+
+		_, erraddKIdentField = txaddKIdentField.Exec(splitSqladdKIdentField, argsaddKIdentField[offsetaddKIdentField:offsetaddKIdentField+countaddKIdentField]...)
+
+		if erraddKIdentField != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addKIdentField"), splitSqladdKIdentField, erraddKIdentField)
+		}
+
+		offsetaddKIdentField += countaddKIdentField
+	}
+
+	if !__imp.__withTx {
+		if erraddKIdentField := txaddKIdentField.Commit(); erraddKIdentField != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addKIdentField"), erraddKIdentField)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addCostField() error {
+	var (
+		erraddCostField     error
+		argListaddCostField = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddCostField = __rt.Arguments{}
+
+	sqladdCostField := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdCostField)
+	defer sqladdCostField.Reset()
+
+	if erraddCostField = sqlTmpladdCostField.Execute(sqladdCostField, map[string]any{}); erraddCostField != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addCostField"), erraddCostField)
+	}
+
+	queryaddCostField := sqladdCostField.String()
+
+	txaddCostField, erraddCostField := __imp.__core.Beginx()
+	if erraddCostField != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addCostField"), erraddCostField)
+	}
+	if !__imp.__withTx {
+		defer txaddCostField.Rollback()
+	}
+
+	offsetaddCostField := 0
+	argsaddCostField := __rt.MergeArgs(argListaddCostField...)
+
+	sqlSliceaddCostField := __rt.Split(queryaddCostField, ";")
+	for indexaddCostField, splitSqladdCostField := range sqlSliceaddCostField {
+		_ = indexaddCostField
+
+		countaddCostField := __rt.Count(splitSqladdCostField, "?")
+
+		_, erraddCostField = txaddCostField.Exec(splitSqladdCostField, argsaddCostField[offsetaddCostField:offsetaddCostField+countaddCostField]...)
+
+		if erraddCostField != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addCostField"), splitSqladdCostField, erraddCostField)
+		}
+
+		offsetaddCostField += countaddCostField
+	}
+
+	if !__imp.__withTx {
+		if erraddCostField := txaddCostField.Commit(); erraddCostField != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addCostField"), erraddCostField)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addConversationIDField() error {
+	var (
+		erraddConversationIDField     error
+		argListaddConversationIDField = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddConversationIDField = __rt.Arguments{}
+
+	sqladdConversationIDField := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdConversationIDField)
+	defer sqladdConversationIDField.Reset()
+
+	if erraddConversationIDField = sqlTmpladdConversationIDField.Execute(sqladdConversationIDField, map[string]any{}); erraddConversationIDField != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addConversationIDField"), erraddConversationIDField)
+	}
+
+	queryaddConversationIDField := sqladdConversationIDField.String()
+
+	txaddConversationIDField, erraddConversationIDField := __imp.__core.Beginx()
+	if erraddConversationIDField != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addConversationIDField"), erraddConversationIDField)
+	}
+	if !__imp.__withTx {
+		defer txaddConversationIDField.Rollback()
+	}
+
+	offsetaddConversationIDField := 0
+	argsaddConversationIDField := __rt.MergeArgs(argListaddConversationIDField...)
+
+	sqlSliceaddConversationIDField := __rt.Split(queryaddConversationIDField, ";")
+	for indexaddConversationIDField, splitSqladdConversationIDField := range sqlSliceaddConversationIDField {
+		_ = indexaddConversationIDField
+
+		countaddConversationIDField := __rt.Count(splitSqladdConversationIDField, "?")
+
+		_, erraddConversationIDField = txaddConversationIDField.Exec(splitSqladdConversationIDField, argsaddConversationIDField[offsetaddConversationIDField:offsetaddConversationIDField+countaddConversationIDField]...)
+
+		if erraddConversationIDField != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addConversationIDField"), splitSqladdConversationIDField, erraddConversationIDField)
+		}
+
+		offsetaddConversationIDField += countaddConversationIDField
+	}
+
+	if !__imp.__withTx {
+		if erraddConversationIDField := txaddConversationIDField.Commit(); erraddConversationIDField != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addConversationIDField"), erraddConversationIDField)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addConversationTurnField() error {
+	var (
+		erraddConversationTurnField     error
+		argListaddConversationTurnField = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddConversationTurnField = __rt.Arguments{}
+
+	sqladdConversationTurnField := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdConversationTurnField)
+	defer sqladdConversationTurnField.Reset()
+
+	if erraddConversationTurnField = sqlTmpladdConversationTurnField.Execute(sqladdConversationTurnField, map[string]any{}); erraddConversationTurnField != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addConversationTurnField"), erraddConversationTurnField)
+	}
+
+	queryaddConversationTurnField := sqladdConversationTurnField.String()
+
+	txaddConversationTurnField, erraddConversationTurnField := __imp.__core.Beginx()
+	if erraddConversationTurnField != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addConversationTurnField"), erraddConversationTurnField)
+	}
+	if !__imp.__withTx {
+		defer txaddConversationTurnField.Rollback()
+	}
+
+	offsetaddConversationTurnField := 0
+	argsaddConversationTurnField := __rt.MergeArgs(argListaddConversationTurnField...)
+
+	sqlSliceaddConversationTurnField := __rt.Split(queryaddConversationTurnField, ";")
+	for indexaddConversationTurnField, splitSqladdConversationTurnField := range sqlSliceaddConversationTurnField {
+		_ = indexaddConversationTurnField
+
+		countaddConversationTurnField := __rt.Count(splitSqladdConversationTurnField, "?")
+
+		_, erraddConversationTurnField = txaddConversationTurnField.Exec(splitSqladdConversationTurnField, argsaddConversationTurnField[offsetaddConversationTurnField:offsetaddConversationTurnField+countaddConversationTurnField]...)
+
+		if erraddConversationTurnField != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addConversationTurnField"), splitSqladdConversationTurnField, erraddConversationTurnField)
+		}
+
+		offsetaddConversationTurnField += countaddConversationTurnField
+	}
+
+	if !__imp.__withTx {
+		if erraddConversationTurnField := txaddConversationTurnField.Commit(); erraddConversationTurnField != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addConversationTurnField"), erraddConversationTurnField)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addReplyHashField() error {
+	var (
+		erraddReplyHashField     error
+		argListaddReplyHashField = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddReplyHashField = __rt.Arguments{}
+
+	sqladdReplyHashField := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdReplyHashField)
+	defer sqladdReplyHashField.Reset()
+
+	if erraddReplyHashField = sqlTmpladdReplyHashField.Execute(sqladdReplyHashField, map[string]any{}); erraddReplyHashField != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addReplyHashField"), erraddReplyHashField)
+	}
+
+	queryaddReplyHashField := sqladdReplyHashField.String()
+
+	txaddReplyHashField, erraddReplyHashField := __imp.__core.Beginx()
+	if erraddReplyHashField != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addReplyHashField"), erraddReplyHashField)
+	}
+	if !__imp.__withTx {
+		defer txaddReplyHashField.Rollback()
+	}
+
+	offsetaddReplyHashField := 0
+	argsaddReplyHashField := __rt.MergeArgs(argListaddReplyHashField...)
+
+	sqlSliceaddReplyHashField := __rt.Split(queryaddReplyHashField, ";")
+	for indexaddReplyHashField, splitSqladdReplyHashField := range sqlSliceaddReplyHashField {
+		_ = indexaddReplyHashField
+
+		countaddReplyHashField := __rt.Count(splitSqladdReplyHashField, "?")
+
+		_, erraddReplyHashField = txaddReplyHashField.Exec(splitSqladdReplyHashField, argsaddReplyHashField[offsetaddReplyHashField:offsetaddReplyHashField+countaddReplyHashField]...)
+
+		if erraddReplyHashField != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addReplyHashField"), splitSqladdReplyHashField, erraddReplyHashField)
+		}
+
+		offsetaddReplyHashField += countaddReplyHashField
+	}
+
+	if !__imp.__withTx {
+		if erraddReplyHashField := txaddReplyHashField.Commit(); erraddReplyHashField != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addReplyHashField"), erraddReplyHashField)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addImportedIDField() error {
+	var (
+		erraddImportedIDField     error
+		argListaddImportedIDField = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddImportedIDField = __rt.Arguments{}
+
+	sqladdImportedIDField := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdImportedIDField)
+	defer sqladdImportedIDField.Reset()
+
+	if erraddImportedIDField = sqlTmpladdImportedIDField.Execute(sqladdImportedIDField, map[string]any{}); erraddImportedIDField != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addImportedIDField"), erraddImportedIDField)
+	}
+
+	queryaddImportedIDField := sqladdImportedIDField.String()
+
+	txaddImportedIDField, erraddImportedIDField := __imp.__core.Beginx()
+	if erraddImportedIDField != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addImportedIDField"), erraddImportedIDField)
+	}
+	if !__imp.__withTx {
+		defer txaddImportedIDField.Rollback()
+	}
+
+	offsetaddImportedIDField := 0
+	argsaddImportedIDField := __rt.MergeArgs(argListaddImportedIDField...)
+
+	sqlSliceaddImportedIDField := __rt.Split(queryaddImportedIDField, ";")
+	for indexaddImportedIDField, splitSqladdImportedIDField := range sqlSliceaddImportedIDField {
+		_ = indexaddImportedIDField
+
+		countaddImportedIDField := __rt.Count(splitSqladdImportedIDField, "?")
+
+		_, erraddImportedIDField = txaddImportedIDField.Exec(splitSqladdImportedIDField, argsaddImportedIDField[offsetaddImportedIDField:offsetaddImportedIDField+countaddImportedIDField]...)
+
+		if erraddImportedIDField != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addImportedIDField"), splitSqladdImportedIDField, erraddImportedIDField)
+		}
+
+		offsetaddImportedIDField += countaddImportedIDField
+	}
+
+	if !__imp.__withTx {
+		if erraddImportedIDField := txaddImportedIDField.Commit(); erraddImportedIDField != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addImportedIDField"), erraddImportedIDField)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addAttemptField() error {
+	var (
+		erraddAttemptField     error
+		argListaddAttemptField = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddAttemptField = __rt.Arguments{}
+
+	sqladdAttemptField := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdAttemptField)
+	defer sqladdAttemptField.Reset()
+
+	if erraddAttemptField = sqlTmpladdAttemptField.Execute(sqladdAttemptField, map[string]any{}); erraddAttemptField != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addAttemptField"), erraddAttemptField)
+	}
+
+	queryaddAttemptField := sqladdAttemptField.String()
+
+	txaddAttemptField, erraddAttemptField := __imp.__core.Beginx()
+	if erraddAttemptField != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addAttemptField"), erraddAttemptField)
+	}
+	if !__imp.__withTx {
+		defer txaddAttemptField.Rollback()
+	}
+
+	offsetaddAttemptField := 0
+	argsaddAttemptField := __rt.MergeArgs(argListaddAttemptField...)
+
+	sqlSliceaddAttemptField := __rt.Split(queryaddAttemptField, ";")
+	for indexaddAttemptField, splitSqladdAttemptField := range sqlSliceaddAttemptField {
+		_ = indexaddAttemptField
+
+		countaddAttemptField := __rt.Count(splitSqladdAttemptField, "?")
+
+		_, erraddAttemptField = txaddAttemptField.Exec(splitSqladdAttemptField, argsaddAttemptField[offsetaddAttemptField:offsetaddAttemptField+countaddAttemptField]...)
+
+		if erraddAttemptField != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addAttemptField"), splitSqladdAttemptField, erraddAttemptField)
+		}
+
+		offsetaddAttemptField += countaddAttemptField
+	}
+
+	if !__imp.__withTx {
+		if erraddAttemptField := txaddAttemptField.Commit(); erraddAttemptField != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addAttemptField"), erraddAttemptField)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addMoonshotIDIndex() error {
+	var (
+		erraddMoonshotIDIndex     error
+		argListaddMoonshotIDIndex = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddMoonshotIDIndex = __rt.Arguments{}
+
+	sqladdMoonshotIDIndex := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdMoonshotIDIndex)
+	defer sqladdMoonshotIDIndex.Reset()
+
+	if erraddMoonshotIDIndex = sqlTmpladdMoonshotIDIndex.Execute(sqladdMoonshotIDIndex, map[string]any{}); erraddMoonshotIDIndex != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addMoonshotIDIndex"), erraddMoonshotIDIndex)
+	}
+
+	queryaddMoonshotIDIndex := sqladdMoonshotIDIndex.String()
+
+	txaddMoonshotIDIndex, erraddMoonshotIDIndex := __imp.__core.Beginx()
+	if erraddMoonshotIDIndex != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addMoonshotIDIndex"), erraddMoonshotIDIndex)
+	}
+	if !__imp.__withTx {
+		defer txaddMoonshotIDIndex.Rollback()
+	}
+
+	offsetaddMoonshotIDIndex := 0
+	argsaddMoonshotIDIndex := __rt.MergeArgs(argListaddMoonshotIDIndex...)
+
+	sqlSliceaddMoonshotIDIndex := __rt.Split(queryaddMoonshotIDIndex, ";")
+	for indexaddMoonshotIDIndex, splitSqladdMoonshotIDIndex := range sqlSliceaddMoonshotIDIndex {
+		_ = indexaddMoonshotIDIndex
+
+		countaddMoonshotIDIndex := __rt.Count(splitSqladdMoonshotIDIndex, "?")
+
+		_, erraddMoonshotIDIndex = txaddMoonshotIDIndex.Exec(splitSqladdMoonshotIDIndex, argsaddMoonshotIDIndex[offsetaddMoonshotIDIndex:offsetaddMoonshotIDIndex+countaddMoonshotIDIndex]...)
+
+		if erraddMoonshotIDIndex != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addMoonshotIDIndex"), splitSqladdMoonshotIDIndex, erraddMoonshotIDIndex)
+		}
+
+		offsetaddMoonshotIDIndex += countaddMoonshotIDIndex
+	}
+
+	if !__imp.__withTx {
+		if erraddMoonshotIDIndex := txaddMoonshotIDIndex.Commit(); erraddMoonshotIDIndex != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addMoonshotIDIndex"), erraddMoonshotIDIndex)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addMoonshotRequestIDIndex() error {
+	var (
+		erraddMoonshotRequestIDIndex     error
+		argListaddMoonshotRequestIDIndex = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddMoonshotRequestIDIndex = __rt.Arguments{}
+
+	sqladdMoonshotRequestIDIndex := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdMoonshotRequestIDIndex)
+	defer sqladdMoonshotRequestIDIndex.Reset()
+
+	if erraddMoonshotRequestIDIndex = sqlTmpladdMoonshotRequestIDIndex.Execute(sqladdMoonshotRequestIDIndex, map[string]any{}); erraddMoonshotRequestIDIndex != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addMoonshotRequestIDIndex"), erraddMoonshotRequestIDIndex)
+	}
+
+	queryaddMoonshotRequestIDIndex := sqladdMoonshotRequestIDIndex.String()
+
+	txaddMoonshotRequestIDIndex, erraddMoonshotRequestIDIndex := __imp.__core.Beginx()
+	if erraddMoonshotRequestIDIndex != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addMoonshotRequestIDIndex"), erraddMoonshotRequestIDIndex)
+	}
+	if !__imp.__withTx {
+		defer txaddMoonshotRequestIDIndex.Rollback()
+	}
+
+	offsetaddMoonshotRequestIDIndex := 0
+	argsaddMoonshotRequestIDIndex := __rt.MergeArgs(argListaddMoonshotRequestIDIndex...)
+
+	sqlSliceaddMoonshotRequestIDIndex := __rt.Split(queryaddMoonshotRequestIDIndex, ";")
+	for indexaddMoonshotRequestIDIndex, splitSqladdMoonshotRequestIDIndex := range sqlSliceaddMoonshotRequestIDIndex {
+		_ = indexaddMoonshotRequestIDIndex
+
+		countaddMoonshotRequestIDIndex := __rt.Count(splitSqladdMoonshotRequestIDIndex, "?")
+
+		_, erraddMoonshotRequestIDIndex = txaddMoonshotRequestIDIndex.Exec(splitSqladdMoonshotRequestIDIndex, argsaddMoonshotRequestIDIndex[offsetaddMoonshotRequestIDIndex:offsetaddMoonshotRequestIDIndex+countaddMoonshotRequestIDIndex]...)
+
+		if erraddMoonshotRequestIDIndex != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addMoonshotRequestIDIndex"), splitSqladdMoonshotRequestIDIndex, erraddMoonshotRequestIDIndex)
+		}
+
+		offsetaddMoonshotRequestIDIndex += countaddMoonshotRequestIDIndex
+	}
+
+	if !__imp.__withTx {
+		if erraddMoonshotRequestIDIndex := txaddMoonshotRequestIDIndex.Commit(); erraddMoonshotRequestIDIndex != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addMoonshotRequestIDIndex"), erraddMoonshotRequestIDIndex)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addCreatedAtIndex() error {
+	var (
+		erraddCreatedAtIndex     error
+		argListaddCreatedAtIndex = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddCreatedAtIndex = __rt.Arguments{}
+
+	sqladdCreatedAtIndex := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdCreatedAtIndex)
+	defer sqladdCreatedAtIndex.Reset()
+
+	if erraddCreatedAtIndex = sqlTmpladdCreatedAtIndex.Execute(sqladdCreatedAtIndex, map[string]any{}); erraddCreatedAtIndex != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addCreatedAtIndex"), erraddCreatedAtIndex)
+	}
+
+	queryaddCreatedAtIndex := sqladdCreatedAtIndex.String()
+
+	txaddCreatedAtIndex, erraddCreatedAtIndex := __imp.__core.Beginx()
+	if erraddCreatedAtIndex != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addCreatedAtIndex"), erraddCreatedAtIndex)
+	}
+	if !__imp.__withTx {
+		defer txaddCreatedAtIndex.Rollback()
+	}
+
+	offsetaddCreatedAtIndex := 0
+	argsaddCreatedAtIndex := __rt.MergeArgs(argListaddCreatedAtIndex...)
+
+	sqlSliceaddCreatedAtIndex := __rt.Split(queryaddCreatedAtIndex, ";")
+	for indexaddCreatedAtIndex, splitSqladdCreatedAtIndex := range sqlSliceaddCreatedAtIndex {
+		_ = indexaddCreatedAtIndex
+
+		countaddCreatedAtIndex := __rt.Count(splitSqladdCreatedAtIndex, "?")
+
+		_, erraddCreatedAtIndex = txaddCreatedAtIndex.Exec(splitSqladdCreatedAtIndex, argsaddCreatedAtIndex[offsetaddCreatedAtIndex:offsetaddCreatedAtIndex+countaddCreatedAtIndex]...)
+
+		if erraddCreatedAtIndex != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addCreatedAtIndex"), splitSqladdCreatedAtIndex, erraddCreatedAtIndex)
+		}
+
+		offsetaddCreatedAtIndex += countaddCreatedAtIndex
+	}
+
+	if !__imp.__withTx {
+		if erraddCreatedAtIndex := txaddCreatedAtIndex.Commit(); erraddCreatedAtIndex != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addCreatedAtIndex"), erraddCreatedAtIndex)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addRequestHashIndex() error {
+	var (
+		erraddRequestHashIndex     error
+		argListaddRequestHashIndex = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddRequestHashIndex = __rt.Arguments{}
+
+	sqladdRequestHashIndex := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdRequestHashIndex)
+	defer sqladdRequestHashIndex.Reset()
+
+	if erraddRequestHashIndex = sqlTmpladdRequestHashIndex.Execute(sqladdRequestHashIndex, map[string]any{}); erraddRequestHashIndex != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addRequestHashIndex"), erraddRequestHashIndex)
+	}
+
+	queryaddRequestHashIndex := sqladdRequestHashIndex.String()
+
+	txaddRequestHashIndex, erraddRequestHashIndex := __imp.__core.Beginx()
+	if erraddRequestHashIndex != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addRequestHashIndex"), erraddRequestHashIndex)
+	}
+	if !__imp.__withTx {
+		defer txaddRequestHashIndex.Rollback()
+	}
+
+	offsetaddRequestHashIndex := 0
+	argsaddRequestHashIndex := __rt.MergeArgs(argListaddRequestHashIndex...)
+
+	sqlSliceaddRequestHashIndex := __rt.Split(queryaddRequestHashIndex, ";")
+	for indexaddRequestHashIndex, splitSqladdRequestHashIndex := range sqlSliceaddRequestHashIndex {
+		_ = indexaddRequestHashIndex
+
+		countaddRequestHashIndex := __rt.Count(splitSqladdRequestHashIndex, "?")
+
+		_, erraddRequestHashIndex = txaddRequestHashIndex.Exec(splitSqladdRequestHashIndex, argsaddRequestHashIndex[offsetaddRequestHashIndex:offsetaddRequestHashIndex+countaddRequestHashIndex]...)
+
+		if erraddRequestHashIndex != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addRequestHashIndex"), splitSqladdRequestHashIndex, erraddRequestHashIndex)
+		}
+
+		offsetaddRequestHashIndex += countaddRequestHashIndex
+	}
+
+	if !__imp.__withTx {
+		if erraddRequestHashIndex := txaddRequestHashIndex.Commit(); erraddRequestHashIndex != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addRequestHashIndex"), erraddRequestHashIndex)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addConversationIDIndex() error {
+	var (
+		erraddConversationIDIndex     error
+		argListaddConversationIDIndex = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddConversationIDIndex = __rt.Arguments{}
+
+	sqladdConversationIDIndex := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdConversationIDIndex)
+	defer sqladdConversationIDIndex.Reset()
+
+	if erraddConversationIDIndex = sqlTmpladdConversationIDIndex.Execute(sqladdConversationIDIndex, map[string]any{}); erraddConversationIDIndex != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addConversationIDIndex"), erraddConversationIDIndex)
+	}
+
+	queryaddConversationIDIndex := sqladdConversationIDIndex.String()
+
+	txaddConversationIDIndex, erraddConversationIDIndex := __imp.__core.Beginx()
+	if erraddConversationIDIndex != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addConversationIDIndex"), erraddConversationIDIndex)
+	}
+	if !__imp.__withTx {
+		defer txaddConversationIDIndex.Rollback()
+	}
+
+	offsetaddConversationIDIndex := 0
+	argsaddConversationIDIndex := __rt.MergeArgs(argListaddConversationIDIndex...)
+
+	sqlSliceaddConversationIDIndex := __rt.Split(queryaddConversationIDIndex, ";")
+	for indexaddConversationIDIndex, splitSqladdConversationIDIndex := range sqlSliceaddConversationIDIndex {
+		_ = indexaddConversationIDIndex
+
+		countaddConversationIDIndex := __rt.Count(splitSqladdConversationIDIndex, "?")
+
+		_, erraddConversationIDIndex = txaddConversationIDIndex.Exec(splitSqladdConversationIDIndex, argsaddConversationIDIndex[offsetaddConversationIDIndex:offsetaddConversationIDIndex+countaddConversationIDIndex]...)
+
+		if erraddConversationIDIndex != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addConversationIDIndex"), splitSqladdConversationIDIndex, erraddConversationIDIndex)
+		}
+
+		offsetaddConversationIDIndex += countaddConversationIDIndex
+	}
+
+	if !__imp.__withTx {
+		if erraddConversationIDIndex := txaddConversationIDIndex.Commit(); erraddConversationIDIndex != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addConversationIDIndex"), erraddConversationIDIndex)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addReplyHashIndex() error {
+	var (
+		erraddReplyHashIndex     error
+		argListaddReplyHashIndex = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddReplyHashIndex = __rt.Arguments{}
+
+	sqladdReplyHashIndex := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdReplyHashIndex)
+	defer sqladdReplyHashIndex.Reset()
+
+	if erraddReplyHashIndex = sqlTmpladdReplyHashIndex.Execute(sqladdReplyHashIndex, map[string]any{}); erraddReplyHashIndex != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addReplyHashIndex"), erraddReplyHashIndex)
+	}
+
+	queryaddReplyHashIndex := sqladdReplyHashIndex.String()
+
+	txaddReplyHashIndex, erraddReplyHashIndex := __imp.__core.Beginx()
+	if erraddReplyHashIndex != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addReplyHashIndex"), erraddReplyHashIndex)
+	}
+	if !__imp.__withTx {
+		defer txaddReplyHashIndex.Rollback()
+	}
+
+	offsetaddReplyHashIndex := 0
+	argsaddReplyHashIndex := __rt.MergeArgs(argListaddReplyHashIndex...)
+
+	sqlSliceaddReplyHashIndex := __rt.Split(queryaddReplyHashIndex, ";")
+	for indexaddReplyHashIndex, splitSqladdReplyHashIndex := range sqlSliceaddReplyHashIndex {
+		_ = indexaddReplyHashIndex
+
+		countaddReplyHashIndex := __rt.Count(splitSqladdReplyHashIndex, "?")
+
+		_, erraddReplyHashIndex = txaddReplyHashIndex.Exec(splitSqladdReplyHashIndex, argsaddReplyHashIndex[offsetaddReplyHashIndex:offsetaddReplyHashIndex+countaddReplyHashIndex]...)
+
+		if erraddReplyHashIndex != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addReplyHashIndex"), splitSqladdReplyHashIndex, erraddReplyHashIndex)
+		}
+
+		offsetaddReplyHashIndex += countaddReplyHashIndex
+	}
+
+	if !__imp.__withTx {
+		if erraddReplyHashIndex := txaddReplyHashIndex.Commit(); erraddReplyHashIndex != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addReplyHashIndex"), erraddReplyHashIndex)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) addRequestIDIndex() error {
+	var (
+		erraddRequestIDIndex     error
+		argListaddRequestIDIndex = make(__rt.Arguments, 0, 8)
+	)
+
+	argListaddRequestIDIndex = __rt.Arguments{}
+
+	sqladdRequestIDIndex := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqladdRequestIDIndex)
+	defer sqladdRequestIDIndex.Reset()
+
+	if erraddRequestIDIndex = sqlTmpladdRequestIDIndex.Execute(sqladdRequestIDIndex, map[string]any{}); erraddRequestIDIndex != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("addRequestIDIndex"), erraddRequestIDIndex)
+	}
+
+	queryaddRequestIDIndex := sqladdRequestIDIndex.String()
+
+	txaddRequestIDIndex, erraddRequestIDIndex := __imp.__core.Beginx()
+	if erraddRequestIDIndex != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addRequestIDIndex"), erraddRequestIDIndex)
+	}
+	if !__imp.__withTx {
+		defer txaddRequestIDIndex.Rollback()
+	}
+
+	offsetaddRequestIDIndex := 0
+	argsaddRequestIDIndex := __rt.MergeArgs(argListaddRequestIDIndex...)
+
+	sqlSliceaddRequestIDIndex := __rt.Split(queryaddRequestIDIndex, ";")
+	for indexaddRequestIDIndex, splitSqladdRequestIDIndex := range sqlSliceaddRequestIDIndex {
+		_ = indexaddRequestIDIndex
+
+		countaddRequestIDIndex := __rt.Count(splitSqladdRequestIDIndex, "?")
+
+		_, erraddRequestIDIndex = txaddRequestIDIndex.Exec(splitSqladdRequestIDIndex, argsaddRequestIDIndex[offsetaddRequestIDIndex:offsetaddRequestIDIndex+countaddRequestIDIndex]...)
+
+		if erraddRequestIDIndex != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addRequestIDIndex"), splitSqladdRequestIDIndex, erraddRequestIDIndex)
+		}
+
+		offsetaddRequestIDIndex += countaddRequestIDIndex
+	}
+
+	if !__imp.__withTx {
+		if erraddRequestIDIndex := txaddRequestIDIndex.Commit(); erraddRequestIDIndex != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addRequestIDIndex"), erraddRequestIDIndex)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) createAnnotationTables() error {
+	var (
+		errcreateAnnotationTables     error
+		argListcreateAnnotationTables = make(__rt.Arguments, 0, 8)
+	)
+
+	argListcreateAnnotationTables = __rt.Arguments{}
+
+	sqlcreateAnnotationTables := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlcreateAnnotationTables)
+	defer sqlcreateAnnotationTables.Reset()
+
+	if errcreateAnnotationTables = sqlTmplcreateAnnotationTables.Execute(sqlcreateAnnotationTables, map[string]any{}); errcreateAnnotationTables != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("createAnnotationTables"), errcreateAnnotationTables)
+	}
+
+	querycreateAnnotationTables := sqlcreateAnnotationTables.String()
+
+	txcreateAnnotationTables, errcreateAnnotationTables := __imp.__core.Beginx()
+	if errcreateAnnotationTables != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("createAnnotationTables"), errcreateAnnotationTables)
+	}
+	if !__imp.__withTx {
+		defer txcreateAnnotationTables.Rollback()
+	}
+
+	offsetcreateAnnotationTables := 0
+	argscreateAnnotationTables := __rt.MergeArgs(argListcreateAnnotationTables...)
+
+	sqlSlicecreateAnnotationTables := __rt.Split(querycreateAnnotationTables, ";")
+	for indexcreateAnnotationTables, splitSqlcreateAnnotationTables := range sqlSlicecreateAnnotationTables {
+		_ = indexcreateAnnotationTables
+
+		countcreateAnnotationTables := __rt.Count(splitSqlcreateAnnotationTables, "?")
+
+		_, errcreateAnnotationTables = txcreateAnnotationTables.Exec(splitSqlcreateAnnotationTables, argscreateAnnotationTables[offsetcreateAnnotationTables:offsetcreateAnnotationTables+countcreateAnnotationTables]...)
+
+		if errcreateAnnotationTables != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("createAnnotationTables"), splitSqlcreateAnnotationTables, errcreateAnnotationTables)
+		}
+
+		offsetcreateAnnotationTables += countcreateAnnotationTables
+	}
+
+	if !__imp.__withTx {
+		if errcreateAnnotationTables := txcreateAnnotationTables.Commit(); errcreateAnnotationTables != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("createAnnotationTables"), errcreateAnnotationTables)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) Cleanup(before string) (sql.Result, error) {
+	var (
+		v0Cleanup  sql.Result
+		errCleanup error
+	)
+
+	queryCleanup := "delete from moonshot_requests where created_at < :before;\r\n"
+
+	txCleanup, errCleanup := __imp.__core.Beginx()
+	if errCleanup != nil {
+		return v0Cleanup, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("Cleanup"), errCleanup)
+	}
+	if !__imp.__withTx {
+		defer txCleanup.Rollback()
+	}
+
+	argsCleanup := __rt.MergeNamedArgs(map[string]any{
+		"before": before,
+	})
+
+	sqlSliceCleanup := __rt.Split(queryCleanup, ";")
+	for indexCleanup, splitSqlCleanup := range sqlSliceCleanup {
+		_ = indexCleanup
+
+		var listArgsCleanup []interface{}
+
+		splitSqlCleanup, listArgsCleanup, errCleanup = sqlx.Named(splitSqlCleanup, argsCleanup)
+		if errCleanup != nil {
+			return v0Cleanup, fmt.Errorf("error building %s query: %w", strconv.Quote("Cleanup"), errCleanup)
+		}
+
+		splitSqlCleanup, listArgsCleanup, errCleanup = sqlx.In(splitSqlCleanup, listArgsCleanup...)
+		if errCleanup != nil {
+			return v0Cleanup, fmt.Errorf("error building %s query: %w", strconv.Quote("Cleanup"), errCleanup)
+		}
+
+		v0Cleanup, errCleanup = txCleanup.Exec(splitSqlCleanup, listArgsCleanup...)
+
+		if errCleanup != nil {
+			return v0Cleanup, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("Cleanup"), splitSqlCleanup, errCleanup)
+		}
+	}
+
+	if !__imp.__withTx {
+		if errCleanup := txCleanup.Commit(); errCleanup != nil {
+			return v0Cleanup, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("Cleanup"), errCleanup)
+		}
+	}
+
+	return v0Cleanup, nil
+}
+
+func (__imp *implPersistence) SetImportedID(id int64, importedID int64) error {
+	var (
+		errSetImportedID error
+	)
+
+	querySetImportedID := "update moonshot_requests set imported_id = :importedID where id = :id;\r\n"
+
+	txSetImportedID, errSetImportedID := __imp.__core.Beginx()
+	if errSetImportedID != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("SetImportedID"), errSetImportedID)
+	}
+	if !__imp.__withTx {
+		defer txSetImportedID.Rollback()
+	}
+
+	argsSetImportedID := __rt.MergeNamedArgs(map[string]any{
+		"id":         id,
+		"importedID": importedID,
+	})
+
+	sqlSliceSetImportedID := __rt.Split(querySetImportedID, ";")
+	for indexSetImportedID, splitSqlSetImportedID := range sqlSliceSetImportedID {
+		_ = indexSetImportedID
+
+		var listArgsSetImportedID []interface{}
+
+		splitSqlSetImportedID, listArgsSetImportedID, errSetImportedID = sqlx.Named(splitSqlSetImportedID, argsSetImportedID)
+		if errSetImportedID != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("SetImportedID"), errSetImportedID)
+		}
+
+		splitSqlSetImportedID, listArgsSetImportedID, errSetImportedID = sqlx.In(splitSqlSetImportedID, listArgsSetImportedID...)
+		if errSetImportedID != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("SetImportedID"), errSetImportedID)
+		}
+
+		_, errSetImportedID = txSetImportedID.Exec(splitSqlSetImportedID, listArgsSetImportedID...)
+
+		if errSetImportedID != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("SetImportedID"), splitSqlSetImportedID, errSetImportedID)
+		}
+	}
+
+	if !__imp.__withTx {
+		if errSetImportedID := txSetImportedID.Commit(); errSetImportedID != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("SetImportedID"), errSetImportedID)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) FindImportedRequest(importedID int64, createdAt string, requestMethod string, requestPath string) (int64, error) {
+	var (
+		v0FindImportedRequest  int64
+		errFindImportedRequest error
+	)
+
+	queryFindImportedRequest := "select id from moonshot_requests where imported_id = :importedID and created_at = :createdAt and request_method = :requestMethod and request_path = :requestPath order by id limit 1;\r\n"
+
+	txFindImportedRequest, errFindImportedRequest := __imp.__core.Beginx()
+	if errFindImportedRequest != nil {
+		return v0FindImportedRequest, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("FindImportedRequest"), errFindImportedRequest)
+	}
+	if !__imp.__withTx {
+		defer txFindImportedRequest.Rollback()
+	}
+
+	argsFindImportedRequest := __rt.MergeNamedArgs(map[string]any{
+		"importedID":    importedID,
+		"createdAt":     createdAt,
+		"requestMethod": requestMethod,
+		"requestPath":   requestPath,
+	})
+
+	sqlSliceFindImportedRequest := __rt.Split(queryFindImportedRequest, ";")
+	for indexFindImportedRequest, splitSqlFindImportedRequest := range sqlSliceFindImportedRequest {
+		_ = indexFindImportedRequest
+
+		var listArgsFindImportedRequest []interface{}
+
+		splitSqlFindImportedRequest, listArgsFindImportedRequest, errFindImportedRequest = sqlx.Named(splitSqlFindImportedRequest, argsFindImportedRequest)
+		if errFindImportedRequest != nil {
+			return v0FindImportedRequest, fmt.Errorf("error building %s query: %w", strconv.Quote("FindImportedRequest"), errFindImportedRequest)
+		}
+
+		splitSqlFindImportedRequest, listArgsFindImportedRequest, errFindImportedRequest = sqlx.In(splitSqlFindImportedRequest, listArgsFindImportedRequest...)
+		if errFindImportedRequest != nil {
+			return v0FindImportedRequest, fmt.Errorf("error building %s query: %w", strconv.Quote("FindImportedRequest"), errFindImportedRequest)
+		}
+
+		if indexFindImportedRequest < len(sqlSliceFindImportedRequest)-1 {
+			_, errFindImportedRequest = txFindImportedRequest.Exec(splitSqlFindImportedRequest, listArgsFindImportedRequest...)
+		} else {
+			errFindImportedRequest = txFindImportedRequest.Get(&v0FindImportedRequest, splitSqlFindImportedRequest, listArgsFindImportedRequest...)
+		}
+
+		if errFindImportedRequest != nil {
+			return v0FindImportedRequest, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("FindImportedRequest"), splitSqlFindImportedRequest, errFindImportedRequest)
+		}
+	}
+
+	if !__imp.__withTx {
+		if errFindImportedRequest := txFindImportedRequest.Commit(); errFindImportedRequest != nil {
+			return v0FindImportedRequest, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("FindImportedRequest"), errFindImportedRequest)
+		}
+	}
+
+	return v0FindImportedRequest, nil
+}
+
+func (__imp *implPersistence) SetCategory(id int64, category string) error {
+	var (
+		errSetCategory error
+	)
+
+	querySetCategory := "insert into moonshot_annotations (request_id, category) values (:id, nullif(:category, '')) on conflict (request_id) do update set category   = excluded.category, updated_at = datetime('now', 'localtime');\r\n"
+
+	txSetCategory, errSetCategory := __imp.__core.Beginx()
+	if errSetCategory != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("SetCategory"), errSetCategory)
+	}
+	if !__imp.__withTx {
+		defer txSetCategory.Rollback()
+	}
+
+	argsSetCategory := __rt.MergeNamedArgs(map[string]any{
+		"id":       id,
+		"category": category,
+	})
+
+	sqlSliceSetCategory := __rt.Split(querySetCategory, ";")
+	for indexSetCategory, splitSqlSetCategory := range sqlSliceSetCategory {
+		_ = indexSetCategory
+
+		var listArgsSetCategory []interface{}
+
+		splitSqlSetCategory, listArgsSetCategory, errSetCategory = sqlx.Named(splitSqlSetCategory, argsSetCategory)
+		if errSetCategory != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("SetCategory"), errSetCategory)
+		}
+
+		splitSqlSetCategory, listArgsSetCategory, errSetCategory = sqlx.In(splitSqlSetCategory, listArgsSetCategory...)
+		if errSetCategory != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("SetCategory"), errSetCategory)
+		}
+
+		_, errSetCategory = txSetCategory.Exec(splitSqlSetCategory, listArgsSetCategory...)
+
+		if errSetCategory != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("SetCategory"), splitSqlSetCategory, errSetCategory)
+		}
+	}
+
+	if !__imp.__withTx {
+		if errSetCategory := txSetCategory.Commit(); errSetCategory != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("SetCategory"), errSetCategory)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) SetNote(id int64, note string) error {
+	var (
+		errSetNote error
+	)
+
+	querySetNote := "insert into moonshot_annotations (request_id, note) values (:id, nullif(:note, '')) on conflict (request_id) do update set note       = excluded.note, updated_at = datetime('now', 'localtime');\r\n"
+
+	txSetNote, errSetNote := __imp.__core.Beginx()
+	if errSetNote != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("SetNote"), errSetNote)
+	}
+	if !__imp.__withTx {
+		defer txSetNote.Rollback()
+	}
+
+	argsSetNote := __rt.MergeNamedArgs(map[string]any{
+		"id":   id,
+		"note": note,
+	})
+
+	sqlSliceSetNote := __rt.Split(querySetNote, ";")
+	for indexSetNote, splitSqlSetNote := range sqlSliceSetNote {
+		_ = indexSetNote
+
+		var listArgsSetNote []interface{}
+
+		splitSqlSetNote, listArgsSetNote, errSetNote = sqlx.Named(splitSqlSetNote, argsSetNote)
+		if errSetNote != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("SetNote"), errSetNote)
+		}
+
+		splitSqlSetNote, listArgsSetNote, errSetNote = sqlx.In(splitSqlSetNote, listArgsSetNote...)
+		if errSetNote != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("SetNote"), errSetNote)
+		}
+
+		_, errSetNote = txSetNote.Exec(splitSqlSetNote, listArgsSetNote...)
+
+		if errSetNote != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("SetNote"), splitSqlSetNote, errSetNote)
+		}
+	}
+
+	if !__imp.__withTx {
+		if errSetNote := txSetNote.Commit(); errSetNote != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("SetNote"), errSetNote)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) AddTag(id int64, tag string) error {
+	var (
+		errAddTag error
+	)
+
+	queryAddTag := "insert or ignore into moonshot_tags (request_id, tag) values (:id, :tag);\r\n"
+
+	txAddTag, errAddTag := __imp.__core.Beginx()
+	if errAddTag != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("AddTag"), errAddTag)
+	}
+	if !__imp.__withTx {
+		defer txAddTag.Rollback()
+	}
+
+	argsAddTag := __rt.MergeNamedArgs(map[string]any{
+		"id":  id,
+		"tag": tag,
+	})
+
+	sqlSliceAddTag := __rt.Split(queryAddTag, ";")
+	for indexAddTag, splitSqlAddTag := range sqlSliceAddTag {
+		_ = indexAddTag
+
+		var listArgsAddTag []interface{}
+
+		splitSqlAddTag, listArgsAddTag, errAddTag = sqlx.Named(splitSqlAddTag, argsAddTag)
+		if errAddTag != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("AddTag"), errAddTag)
+		}
+
+		splitSqlAddTag, listArgsAddTag, errAddTag = sqlx.In(splitSqlAddTag, listArgsAddTag...)
+		if errAddTag != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("AddTag"), errAddTag)
+		}
+
+		_, errAddTag = txAddTag.Exec(splitSqlAddTag, listArgsAddTag...)
+
+		if errAddTag != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("AddTag"), splitSqlAddTag, errAddTag)
+		}
+	}
+
+	if !__imp.__withTx {
+		if errAddTag := txAddTag.Commit(); errAddTag != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("AddTag"), errAddTag)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) RemoveTag(id int64, tag string) error {
+	var (
+		errRemoveTag error
+	)
+
+	queryRemoveTag := "delete from moonshot_tags where request_id = :id and tag = :tag;\r\n"
+
+	txRemoveTag, errRemoveTag := __imp.__core.Beginx()
+	if errRemoveTag != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("RemoveTag"), errRemoveTag)
+	}
+	if !__imp.__withTx {
+		defer txRemoveTag.Rollback()
+	}
+
+	argsRemoveTag := __rt.MergeNamedArgs(map[string]any{
+		"id":  id,
+		"tag": tag,
+	})
+
+	sqlSliceRemoveTag := __rt.Split(queryRemoveTag, ";")
+	for indexRemoveTag, splitSqlRemoveTag := range sqlSliceRemoveTag {
+		_ = indexRemoveTag
+
+		var listArgsRemoveTag []interface{}
+
+		splitSqlRemoveTag, listArgsRemoveTag, errRemoveTag = sqlx.Named(splitSqlRemoveTag, argsRemoveTag)
+		if errRemoveTag != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("RemoveTag"), errRemoveTag)
+		}
+
+		splitSqlRemoveTag, listArgsRemoveTag, errRemoveTag = sqlx.In(splitSqlRemoveTag, listArgsRemoveTag...)
+		if errRemoveTag != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("RemoveTag"), errRemoveTag)
+		}
+
+		_, errRemoveTag = txRemoveTag.Exec(splitSqlRemoveTag, listArgsRemoveTag...)
+
+		if errRemoveTag != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("RemoveTag"), splitSqlRemoveTag, errRemoveTag)
+		}
+	}
+
+	if !__imp.__withTx {
+		if errRemoveTag := txRemoveTag.Commit(); errRemoveTag != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("RemoveTag"), errRemoveTag)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) ClearAnnotations(id int64) error {
+	var (
+		errClearAnnotations error
+	)
+
+	queryClearAnnotations := "delete from moonshot_annotations where request_id = :id; delete from moonshot_tags where request_id = :id;\r\n"
+
+	txClearAnnotations, errClearAnnotations := __imp.__core.Beginx()
+	if errClearAnnotations != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("ClearAnnotations"), errClearAnnotations)
+	}
+	if !__imp.__withTx {
+		defer txClearAnnotations.Rollback()
+	}
+
+	argsClearAnnotations := __rt.MergeNamedArgs(map[string]any{
+		"id": id,
+	})
+
+	sqlSliceClearAnnotations := __rt.Split(queryClearAnnotations, ";")
+	for indexClearAnnotations, splitSqlClearAnnotations := range sqlSliceClearAnnotations {
+		_ = indexClearAnnotations
+
+		var listArgsClearAnnotations []interface{}
+
+		splitSqlClearAnnotations, listArgsClearAnnotations, errClearAnnotations = sqlx.Named(splitSqlClearAnnotations, argsClearAnnotations)
+		if errClearAnnotations != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("ClearAnnotations"), errClearAnnotations)
+		}
+
+		splitSqlClearAnnotations, listArgsClearAnnotations, errClearAnnotations = sqlx.In(splitSqlClearAnnotations, listArgsClearAnnotations...)
+		if errClearAnnotations != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("ClearAnnotations"), errClearAnnotations)
+		}
+
+		_, errClearAnnotations = txClearAnnotations.Exec(splitSqlClearAnnotations, listArgsClearAnnotations...)
+
+		if errClearAnnotations != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("ClearAnnotations"), splitSqlClearAnnotations, errClearAnnotations)
+		}
+	}
+
+	if !__imp.__withTx {
+		if errClearAnnotations := txClearAnnotations.Commit(); errClearAnnotations != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("ClearAnnotations"), errClearAnnotations)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) CleanupAnnotations() error {
+	var (
+		errCleanupAnnotations     error
+		argListCleanupAnnotations = make(__rt.Arguments, 0, 8)
+	)
+
+	argListCleanupAnnotations = __rt.Arguments{}
+
+	queryCleanupAnnotations := "delete from moonshot_annotations where request_id not in (select id from moonshot_requests); delete from moonshot_tags where request_id not in (select id from moonshot_requests);\r\n"
+
+	txCleanupAnnotations, errCleanupAnnotations := __imp.__core.Beginx()
+	if errCleanupAnnotations != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("CleanupAnnotations"), errCleanupAnnotations)
+	}
+	if !__imp.__withTx {
+		defer txCleanupAnnotations.Rollback()
+	}
+
+	offsetCleanupAnnotations := 0
+	argsCleanupAnnotations := __rt.MergeArgs(argListCleanupAnnotations...)
+
+	sqlSliceCleanupAnnotations := __rt.Split(queryCleanupAnnotations, ";")
+	for indexCleanupAnnotations, splitSqlCleanupAnnotations := range sqlSliceCleanupAnnotations {
+		_ = indexCleanupAnnotations
+
+		countCleanupAnnotations := __rt.Count(splitSqlCleanupAnnotations, "?")
+
+		_, errCleanupAnnotations = txCleanupAnnotations.Exec(splitSqlCleanupAnnotations, argsCleanupAnnotations[offsetCleanupAnnotations:offsetCleanupAnnotations+countCleanupAnnotations]...)
+
+		if errCleanupAnnotations != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("CleanupAnnotations"), splitSqlCleanupAnnotations, errCleanupAnnotations)
+		}
+
+		offsetCleanupAnnotations += countCleanupAnnotations
+	}
+
+	if !__imp.__withTx {
+		if errCleanupAnnotations := txCleanupAnnotations.Commit(); errCleanupAnnotations != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("CleanupAnnotations"), errCleanupAnnotations)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) DeleteRequests(before string, beforeID int64, predicate string, n int64) (sql.Result, error) {
+	var (
+		v0DeleteRequests      sql.Result
+		errDeleteRequests     error
+		argListDeleteRequests = make(__rt.Arguments, 0, 8)
+	)
+
+	__DeleteRequestsBindFunc := func(arg any) string {
+		argListDeleteRequests = append(argListDeleteRequests, arg)
+		return __rt.BindVars(len(__rt.MergeArgs(arg)))
+	}
+	sqlTmplDeleteRequests := template.Must(template.New("DeleteRequests").Funcs(template.FuncMap{"bind": __DeleteRequestsBindFunc, "bindvars": __rt.BindVars, "body": referencesBody, "fields": tableFields, "fts": fullTextPart}).Parse("delete from moonshot_requests where id in ( select id from ( select {{ fields \"request_header\" \"request_body\" \"response_header\" \"response_body\" }}, decrypt(request_header) as request_header, decrypt(response_header) as response_header, decompress(request_body) as request_body, iif( response_content_type = 'text/event-stream' and response_body is not null, merge_cmpl(decompress(response_body)), decompress(response_body) ) as response_body, coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category, coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note, (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags from moonshot_requests where 1 = 1 {{ if .before }} and created_at < {{ bind .before }} {{ end }} {{ if .beforeID }} and id < {{ bind .beforeID }} {{ end }} order by id {{ if body .predicate }} limit -1 {{ end }} ) where 1 = 1 {{ if .predicate }} and ({{ .predicate }}) {{ end }} {{ if .n }} limit {{ bind .n }} {{ end }} );\r\n"))
+
+	sqlDeleteRequests := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlDeleteRequests)
+	defer sqlDeleteRequests.Reset()
+
+	if errDeleteRequests = sqlTmplDeleteRequests.Execute(sqlDeleteRequests, map[string]any{
+		"before":    before,
+		"beforeID":  beforeID,
+		"predicate": predicate,
+		"n":         n,
+	}); errDeleteRequests != nil {
+		return v0DeleteRequests, fmt.Errorf("error executing %s template: %w", strconv.Quote("DeleteRequests"), errDeleteRequests)
+	}
+
+	queryDeleteRequests := sqlDeleteRequests.String()
+
+	txDeleteRequests, errDeleteRequests := __imp.__core.Beginx()
+	if errDeleteRequests != nil {
+		return v0DeleteRequests, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("DeleteRequests"), errDeleteRequests)
+	}
+	if !__imp.__withTx {
+		defer txDeleteRequests.Rollback()
+	}
+
+	offsetDeleteRequests := 0
+	argsDeleteRequests := __rt.MergeArgs(argListDeleteRequests...)
+
+	sqlSliceDeleteRequests := __rt.Split(queryDeleteRequests, ";")
+	for indexDeleteRequests, splitSqlDeleteRequests := range sqlSliceDeleteRequests {
+		_ = indexDeleteRequests
+
+		countDeleteRequests := __rt.Count(splitSqlDeleteRequests, "?")
+
+		v0DeleteRequests, errDeleteRequests = txDeleteRequests.Exec(splitSqlDeleteRequests, argsDeleteRequests[offsetDeleteRequests:offsetDeleteRequests+countDeleteRequests]...)
+
+		if errDeleteRequests != nil {
+			return v0DeleteRequests, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("DeleteRequests"), splitSqlDeleteRequests, errDeleteRequests)
+		}
+
+		offsetDeleteRequests += countDeleteRequests
+	}
+
+	if !__imp.__withTx {
+		if errDeleteRequests := txDeleteRequests.Commit(); errDeleteRequests != nil {
+			return v0DeleteRequests, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("DeleteRequests"), errDeleteRequests)
+		}
+	}
+
+	return v0DeleteRequests, nil
+}
+
+func (__imp *implPersistence) DropBodies(before string, predicate string, n int64) (sql.Result, error) {
+	var (
+		v0DropBodies      sql.Result
+		errDropBodies     error
+		argListDropBodies = make(__rt.Arguments, 0, 8)
+	)
+
+	__DropBodiesBindFunc := func(arg any) string {
+		argListDropBodies = append(argListDropBodies, arg)
+		return __rt.BindVars(len(__rt.MergeArgs(arg)))
+	}
+	sqlTmplDropBodies := template.Must(template.New("DropBodies").Funcs(template.FuncMap{"bind": __DropBodiesBindFunc, "bindvars": __rt.BindVars, "body": referencesBody, "fields": tableFields, "fts": fullTextPart}).Parse("update moonshot_requests set request_body  = null, response_body = null where id in ( select id from ( select {{ fields \"request_header\" \"request_body\" \"response_header\" \"response_body\" }}, decrypt(request_header) as request_header, decrypt(response_header) as response_header, decompress(request_body) as request_body, iif( response_content_type = 'text/event-stream' and response_body is not null, merge_cmpl(decompress(response_body)), decompress(response_body) ) as response_body, coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category, coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note, (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags from moonshot_requests where created_at < {{ bind .before }} and (request_body is not null or response_body is not null) {{ if body .predicate }} limit -1 {{ end }} ) where 1 = 1 {{ if .predicate }} and ({{ .predicate }}) {{ end }} {{ if .n }} limit {{ bind .n }} {{ end }} );\r\n"))
+
+	sqlDropBodies := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlDropBodies)
+	defer sqlDropBodies.Reset()
+
+	if errDropBodies = sqlTmplDropBodies.Execute(sqlDropBodies, map[string]any{
+		"before":    before,
+		"predicate": predicate,
+		"n":         n,
+	}); errDropBodies != nil {
+		return v0DropBodies, fmt.Errorf("error executing %s template: %w", strconv.Quote("DropBodies"), errDropBodies)
+	}
+
+	queryDropBodies := sqlDropBodies.String()
+
+	txDropBodies, errDropBodies := __imp.__core.Beginx()
+	if errDropBodies != nil {
+		return v0DropBodies, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("DropBodies"), errDropBodies)
+	}
+	if !__imp.__withTx {
+		defer txDropBodies.Rollback()
+	}
+
+	offsetDropBodies := 0
+	argsDropBodies := __rt.MergeArgs(argListDropBodies...)
+
+	sqlSliceDropBodies := __rt.Split(queryDropBodies, ";")
+	for indexDropBodies, splitSqlDropBodies := range sqlSliceDropBodies {
+		_ = indexDropBodies
+
+		countDropBodies := __rt.Count(splitSqlDropBodies, "?")
+
+		v0DropBodies, errDropBodies = txDropBodies.Exec(splitSqlDropBodies, argsDropBodies[offsetDropBodies:offsetDropBodies+countDropBodies]...)
+
+		if errDropBodies != nil {
+			return v0DropBodies, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("DropBodies"), splitSqlDropBodies, errDropBodies)
+		}
+
+		offsetDropBodies += countDropBodies
+	}
+
+	if !__imp.__withTx {
+		if errDropBodies := txDropBodies.Commit(); errDropBodies != nil {
+			return v0DropBodies, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("DropBodies"), errDropBodies)
+		}
+	}
+
+	return v0DropBodies, nil
+}
+
+func (__imp *implPersistence) NthLatestRequestID(offset int64) (int64, error) {
+	var (
+		v0NthLatestRequestID  int64
+		errNthLatestRequestID error
+	)
+
+	queryNthLatestRequestID := "select id from moonshot_requests order by id desc limit 1 offset :offset;\r\n"
+
+	txNthLatestRequestID, errNthLatestRequestID := __imp.__core.Beginx()
+	if errNthLatestRequestID != nil {
+		return v0NthLatestRequestID, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("NthLatestRequestID"), errNthLatestRequestID)
+	}
+	if !__imp.__withTx {
+		defer txNthLatestRequestID.Rollback()
+	}
+
+	argsNthLatestRequestID := __rt.MergeNamedArgs(map[string]any{
+		"offset": offset,
+	})
+
+	sqlSliceNthLatestRequestID := __rt.Split(queryNthLatestRequestID, ";")
+	for indexNthLatestRequestID, splitSqlNthLatestRequestID := range sqlSliceNthLatestRequestID {
+		_ = indexNthLatestRequestID
+
+		var listArgsNthLatestRequestID []interface{}
+
+		splitSqlNthLatestRequestID, listArgsNthLatestRequestID, errNthLatestRequestID = sqlx.Named(splitSqlNthLatestRequestID, argsNthLatestRequestID)
+		if errNthLatestRequestID != nil {
+			return v0NthLatestRequestID, fmt.Errorf("error building %s query: %w", strconv.Quote("NthLatestRequestID"), errNthLatestRequestID)
+		}
+
+		splitSqlNthLatestRequestID, listArgsNthLatestRequestID, errNthLatestRequestID = sqlx.In(splitSqlNthLatestRequestID, listArgsNthLatestRequestID...)
+		if errNthLatestRequestID != nil {
+			return v0NthLatestRequestID, fmt.Errorf("error building %s query: %w", strconv.Quote("NthLatestRequestID"), errNthLatestRequestID)
+		}
+
+		if indexNthLatestRequestID < len(sqlSliceNthLatestRequestID)-1 {
+			_, errNthLatestRequestID = txNthLatestRequestID.Exec(splitSqlNthLatestRequestID, listArgsNthLatestRequestID...)
+		} else {
+			errNthLatestRequestID = txNthLatestRequestID.Get(&v0NthLatestRequestID, splitSqlNthLatestRequestID, listArgsNthLatestRequestID...)
+		}
+
+		if errNthLatestRequestID != nil {
+			return v0NthLatestRequestID, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("NthLatestRequestID"), splitSqlNthLatestRequestID, errNthLatestRequestID)
+		}
+	}
+
+	if !__imp.__withTx {
+		if errNthLatestRequestID := txNthLatestRequestID.Commit(); errNthLatestRequestID != nil {
+			return v0NthLatestRequestID, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("NthLatestRequestID"), errNthLatestRequestID)
+		}
+	}
+
+	return v0NthLatestRequestID, nil
+}
+
+func (__imp *implPersistence) CountRequests() (int64, error) {
+	var (
+		v0CountRequests      int64
+		errCountRequests     error
+		argListCountRequests = make(__rt.Arguments, 0, 8)
+	)
+
+	argListCountRequests = __rt.Arguments{}
+
+	queryCountRequests := "select count(*) from moonshot_requests;\r\n"
+
+	txCountRequests, errCountRequests := __imp.__core.Beginx()
+	if errCountRequests != nil {
+		return v0CountRequests, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("CountRequests"), errCountRequests)
+	}
+	if !__imp.__withTx {
+		defer txCountRequests.Rollback()
+	}
+
+	offsetCountRequests := 0
+	argsCountRequests := __rt.MergeArgs(argListCountRequests...)
+
+	sqlSliceCountRequests := __rt.Split(queryCountRequests, ";")
+	for indexCountRequests, splitSqlCountRequests := range sqlSliceCountRequests {
+		_ = indexCountRequests
+
+		countCountRequests := __rt.Count(splitSqlCountRequests, "?")
+
+		if indexCountRequests < len(sqlSliceCountRequests)-1 {
+			_, errCountRequests = txCountRequests.Exec(splitSqlCountRequests, argsCountRequests[offsetCountRequests:offsetCountRequests+countCountRequests]...)
+		} else {
+			errCountRequests = txCountRequests.Get(&v0CountRequests, splitSqlCountRequests, argsCountRequests[offsetCountRequests:offsetCountRequests+countCountRequests]...)
+		}
+
+		if errCountRequests != nil {
+			return v0CountRequests, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("CountRequests"), splitSqlCountRequests, errCountRequests)
+		}
+
+		offsetCountRequests += countCountRequests
+	}
+
+	if !__imp.__withTx {
+		if errCountRequests := txCountRequests.Commit(); errCountRequests != nil {
+			return v0CountRequests, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("CountRequests"), errCountRequests)
+		}
+	}
+
+	return v0CountRequests, nil
+}
+
+func (__imp *implPersistence) databaseUsage() (int64, error) {
+	var (
+		v0databaseUsage      int64
+		errdatabaseUsage     error
+		argListdatabaseUsage = make(__rt.Arguments, 0, 8)
+	)
+
+	argListdatabaseUsage = __rt.Arguments{}
+
+	querydatabaseUsage := "select (page_count - freelist_count) * page_size from pragma_page_count(), pragma_freelist_count(), pragma_page_size();\r\n"
+
+	txdatabaseUsage, errdatabaseUsage := __imp.__core.Beginx()
+	if errdatabaseUsage != nil {
+		return v0databaseUsage, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("databaseUsage"), errdatabaseUsage)
+	}
+	if !__imp.__withTx {
+		defer txdatabaseUsage.Rollback()
+	}
+
+	offsetdatabaseUsage := 0
+	argsdatabaseUsage := __rt.MergeArgs(argListdatabaseUsage...)
+
+	sqlSlicedatabaseUsage := __rt.Split(querydatabaseUsage, ";")
+	for indexdatabaseUsage, splitSqldatabaseUsage := range sqlSlicedatabaseUsage {
+		_ = indexdatabaseUsage
+
+		countdatabaseUsage := __rt.Count(splitSqldatabaseUsage, "?")
+
+		if indexdatabaseUsage < len(sqlSlicedatabaseUsage)-1 {
+			_, errdatabaseUsage = txdatabaseUsage.Exec(splitSqldatabaseUsage, argsdatabaseUsage[offsetdatabaseUsage:offsetdatabaseUsage+countdatabaseUsage]...)
+		} else {
+			errdatabaseUsage = txdatabaseUsage.Get(&v0databaseUsage, splitSqldatabaseUsage, argsdatabaseUsage[offsetdatabaseUsage:offsetdatabaseUsage+countdatabaseUsage]...)
+		}
+
+		if errdatabaseUsage != nil {
+			return v0databaseUsage, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("databaseUsage"), splitSqldatabaseUsage, errdatabaseUsage)
+		}
+
+		offsetdatabaseUsage += countdatabaseUsage
+	}
+
+	if !__imp.__withTx {
+		if errdatabaseUsage := txdatabaseUsage.Commit(); errdatabaseUsage != nil {
+			return v0databaseUsage, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("databaseUsage"), errdatabaseUsage)
+		}
+	}
+
+	return v0databaseUsage, nil
+}
+
+func (__imp *implPersistence) CompactRequests() (sql.Result, error) {
+	var (
+		v0CompactRequests      sql.Result
+		errCompactRequests     error
+		argListCompactRequests = make(__rt.Arguments, 0, 8)
+	)
+
+	argListCompactRequests = __rt.Arguments{}
+
+	queryCompactRequests := "update moonshot_requests set request_body  = iif(typeof(request_body) = 'text', compress(request_body), request_body), response_body = iif(typeof(response_body) = 'text', compress(response_body), response_body) where typeof(request_body) = 'text' or typeof(response_body) = 'text';\r\n"
+
+	txCompactRequests, errCompactRequests := __imp.__core.Beginx()
+	if errCompactRequests != nil {
+		return v0CompactRequests, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("CompactRequests"), errCompactRequests)
+	}
+	if !__imp.__withTx {
+		defer txCompactRequests.Rollback()
+	}
+
+	offsetCompactRequests := 0
+	argsCompactRequests := __rt.MergeArgs(argListCompactRequests...)
+
+	sqlSliceCompactRequests := __rt.Split(queryCompactRequests, ";")
+	for indexCompactRequests, splitSqlCompactRequests := range sqlSliceCompactRequests {
+		_ = indexCompactRequests
+
+		countCompactRequests := __rt.Count(splitSqlCompactRequests, "?")
+
+		v0CompactRequests, errCompactRequests = txCompactRequests.Exec(splitSqlCompactRequests, argsCompactRequests[offsetCompactRequests:offsetCompactRequests+countCompactRequests]...)
+
+		if errCompactRequests != nil {
+			return v0CompactRequests, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("CompactRequests"), splitSqlCompactRequests, errCompactRequests)
+		}
+
+		offsetCompactRequests += countCompactRequests
+	}
+
+	if !__imp.__withTx {
+		if errCompactRequests := txCompactRequests.Commit(); errCompactRequests != nil {
+			return v0CompactRequests, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("CompactRequests"), errCompactRequests)
+		}
+	}
+
+	return v0CompactRequests, nil
+}
+
+func (__imp *implPersistence) EncryptRequests() (sql.Result, error) {
+	var (
+		v0EncryptRequests      sql.Result
+		errEncryptRequests     error
+		argListEncryptRequests = make(__rt.Arguments, 0, 8)
+	)
+
+	argListEncryptRequests = __rt.Arguments{}
+
+	queryEncryptRequests := "update moonshot_requests set request_header  = encrypt(request_header), request_body    = encrypt(iif(typeof(request_body) = 'text', compress(request_body), request_body)), response_header = encrypt(response_header), response_body   = encrypt(iif(typeof(response_body) = 'text', compress(response_body), response_body)) where (request_header is not null and not encrypted(request_header)) or (request_body is not null and not encrypted(request_body)) or (response_header is not null and not encrypted(response_header)) or (response_body is not null and not encrypted(response_body));\r\n"
+
+	txEncryptRequests, errEncryptRequests := __imp.__core.Beginx()
+	if errEncryptRequests != nil {
+		return v0EncryptRequests, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("EncryptRequests"), errEncryptRequests)
+	}
+	if !__imp.__withTx {
+		defer txEncryptRequests.Rollback()
+	}
+
+	offsetEncryptRequests := 0
+	argsEncryptRequests := __rt.MergeArgs(argListEncryptRequests...)
+
+	sqlSliceEncryptRequests := __rt.Split(queryEncryptRequests, ";")
+	for indexEncryptRequests, splitSqlEncryptRequests := range sqlSliceEncryptRequests {
+		_ = indexEncryptRequests
+
+		countEncryptRequests := __rt.Count(splitSqlEncryptRequests, "?")
+
+		v0EncryptRequests, errEncryptRequests = txEncryptRequests.Exec(splitSqlEncryptRequests, argsEncryptRequests[offsetEncryptRequests:offsetEncryptRequests+countEncryptRequests]...)
+
+		if errEncryptRequests != nil {
+			return v0EncryptRequests, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("EncryptRequests"), splitSqlEncryptRequests, errEncryptRequests)
+		}
+
+		offsetEncryptRequests += countEncryptRequests
+	}
+
+	if !__imp.__withTx {
+		if errEncryptRequests := txEncryptRequests.Commit(); errEncryptRequests != nil {
+			return v0EncryptRequests, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("EncryptRequests"), errEncryptRequests)
+		}
+	}
+
+	return v0EncryptRequests, nil
+}
+
+func (__imp *implPersistence) createFullTextTable() error {
+	var (
+		errcreateFullTextTable     error
+		argListcreateFullTextTable = make(__rt.Arguments, 0, 8)
+	)
+
+	argListcreateFullTextTable = __rt.Arguments{}
+
+	sqlcreateFullTextTable := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlcreateFullTextTable)
+	defer sqlcreateFullTextTable.Reset()
+
+	if errcreateFullTextTable = sqlTmplcreateFullTextTable.Execute(sqlcreateFullTextTable, map[string]any{}); errcreateFullTextTable != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("createFullTextTable"), errcreateFullTextTable)
+	}
+
+	querycreateFullTextTable := sqlcreateFullTextTable.String()
+
+	txcreateFullTextTable, errcreateFullTextTable := __imp.__core.Beginx()
+	if errcreateFullTextTable != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("createFullTextTable"), errcreateFullTextTable)
+	}
+	if !__imp.__withTx {
+		defer txcreateFullTextTable.Rollback()
+	}
+
+	offsetcreateFullTextTable := 0
+	argscreateFullTextTable := __rt.MergeArgs(argListcreateFullTextTable...)
+
+	sqlSlicecreateFullTextTable := __rt.Split(querycreateFullTextTable, ";")
+	for indexcreateFullTextTable, splitSqlcreateFullTextTable := range sqlSlicecreateFullTextTable {
+		_ = indexcreateFullTextTable
+
+		countcreateFullTextTable := __rt.Count(splitSqlcreateFullTextTable, "?")
+
+		_, errcreateFullTextTable = txcreateFullTextTable.Exec(splitSqlcreateFullTextTable, argscreateFullTextTable[offsetcreateFullTextTable:offsetcreateFullTextTable+countcreateFullTextTable]...)
+
+		if errcreateFullTextTable != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("createFullTextTable"), splitSqlcreateFullTextTable, errcreateFullTextTable)
+		}
+
+		offsetcreateFullTextTable += countcreateFullTextTable
+	}
+
+	if !__imp.__withTx {
+		if errcreateFullTextTable := txcreateFullTextTable.Commit(); errcreateFullTextTable != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("createFullTextTable"), errcreateFullTextTable)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) IndexRequest(id int64) error {
+	var (
+		errIndexRequest     error
+		argListIndexRequest = make(__rt.Arguments, 0, 8)
+	)
+
+	__IndexRequestBindFunc := func(arg any) string {
+		argListIndexRequest = append(argListIndexRequest, arg)
+		return __rt.BindVars(len(__rt.MergeArgs(arg)))
+	}
+	sqlTmplIndexRequest := template.Must(template.New("IndexRequest").Funcs(template.FuncMap{"bind": __IndexRequestBindFunc, "bindvars": __rt.BindVars, "body": referencesBody, "fields": tableFields, "fts": fullTextPart}).Parse("insert into {{ fts \"table\" }} (rowid, messages, output) select id, iif(encrypted(request_body), '', fts_messages(coalesce(decompress(request_body), ''))), iif( encrypted(response_body), '', fts_output(coalesce(decompress(response_body), ''), coalesce(response_content_type, '')) ) from moonshot_requests where id = {{ bind .id }} and request_path like '%/chat/completions' ;\r\n"))
+
+	sqlIndexRequest := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlIndexRequest)
+	defer sqlIndexRequest.Reset()
+
+	if errIndexRequest = sqlTmplIndexRequest.Execute(sqlIndexRequest, map[string]any{
+		"id": id,
+	}); errIndexRequest != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("IndexRequest"), errIndexRequest)
+	}
+
+	queryIndexRequest := sqlIndexRequest.String()
+
+	txIndexRequest, errIndexRequest := __imp.__core.Beginx()
+	if errIndexRequest != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("IndexRequest"), errIndexRequest)
+	}
+	if !__imp.__withTx {
+		defer txIndexRequest.Rollback()
+	}
+
+	offsetIndexRequest := 0
+	argsIndexRequest := __rt.MergeArgs(argListIndexRequest...)
+
+	sqlSliceIndexRequest := __rt.Split(queryIndexRequest, ";")
+	for indexIndexRequest, splitSqlIndexRequest := range sqlSliceIndexRequest {
+		_ = indexIndexRequest
+
+		countIndexRequest := __rt.Count(splitSqlIndexRequest, "?")
+
+		_, errIndexRequest = txIndexRequest.Exec(splitSqlIndexRequest, argsIndexRequest[offsetIndexRequest:offsetIndexRequest+countIndexRequest]...)
+
+		if errIndexRequest != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("IndexRequest"), splitSqlIndexRequest, errIndexRequest)
+		}
+
+		offsetIndexRequest += countIndexRequest
+	}
+
+	if !__imp.__withTx {
+		if errIndexRequest := txIndexRequest.Commit(); errIndexRequest != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("IndexRequest"), errIndexRequest)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) indexNewRequests() error {
+	var (
+		errindexNewRequests     error
+		argListindexNewRequests = make(__rt.Arguments, 0, 8)
+	)
+
+	argListindexNewRequests = __rt.Arguments{}
+
+	sqlindexNewRequests := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlindexNewRequests)
+	defer sqlindexNewRequests.Reset()
+
+	if errindexNewRequests = sqlTmplindexNewRequests.Execute(sqlindexNewRequests, map[string]any{}); errindexNewRequests != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("indexNewRequests"), errindexNewRequests)
+	}
+
+	queryindexNewRequests := sqlindexNewRequests.String()
+
+	txindexNewRequests, errindexNewRequests := __imp.__core.Beginx()
+	if errindexNewRequests != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("indexNewRequests"), errindexNewRequests)
+	}
+	if !__imp.__withTx {
+		defer txindexNewRequests.Rollback()
+	}
+
+	offsetindexNewRequests := 0
+	argsindexNewRequests := __rt.MergeArgs(argListindexNewRequests...)
+
+	sqlSliceindexNewRequests := __rt.Split(queryindexNewRequests, ";")
+	for indexindexNewRequests, splitSqlindexNewRequests := range sqlSliceindexNewRequests {
+		_ = indexindexNewRequests
+
+		countindexNewRequests := __rt.Count(splitSqlindexNewRequests, "?")
+
+		_, errindexNewRequests = txindexNewRequests.Exec(splitSqlindexNewRequests, argsindexNewRequests[offsetindexNewRequests:offsetindexNewRequests+countindexNewRequests]...)
+
+		if errindexNewRequests != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("indexNewRequests"), splitSqlindexNewRequests, errindexNewRequests)
+		}
+
+		offsetindexNewRequests += countindexNewRequests
+	}
+
+	if !__imp.__withTx {
+		if errindexNewRequests := txindexNewRequests.Commit(); errindexNewRequests != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("indexNewRequests"), errindexNewRequests)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) ClearFullTextIndex() error {
+	var (
+		errClearFullTextIndex     error
+		argListClearFullTextIndex = make(__rt.Arguments, 0, 8)
+	)
+
+	argListClearFullTextIndex = __rt.Arguments{}
+
+	sqlClearFullTextIndex := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlClearFullTextIndex)
+	defer sqlClearFullTextIndex.Reset()
+
+	if errClearFullTextIndex = sqlTmplClearFullTextIndex.Execute(sqlClearFullTextIndex, map[string]any{}); errClearFullTextIndex != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("ClearFullTextIndex"), errClearFullTextIndex)
+	}
+
+	queryClearFullTextIndex := sqlClearFullTextIndex.String()
+
+	txClearFullTextIndex, errClearFullTextIndex := __imp.__core.Beginx()
+	if errClearFullTextIndex != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("ClearFullTextIndex"), errClearFullTextIndex)
+	}
+	if !__imp.__withTx {
+		defer txClearFullTextIndex.Rollback()
+	}
+
+	offsetClearFullTextIndex := 0
+	argsClearFullTextIndex := __rt.MergeArgs(argListClearFullTextIndex...)
+
+	sqlSliceClearFullTextIndex := __rt.Split(queryClearFullTextIndex, ";")
+	for indexClearFullTextIndex, splitSqlClearFullTextIndex := range sqlSliceClearFullTextIndex {
+		_ = indexClearFullTextIndex
+
+		countClearFullTextIndex := __rt.Count(splitSqlClearFullTextIndex, "?")
+
+		_, errClearFullTextIndex = txClearFullTextIndex.Exec(splitSqlClearFullTextIndex, argsClearFullTextIndex[offsetClearFullTextIndex:offsetClearFullTextIndex+countClearFullTextIndex]...)
+
+		if errClearFullTextIndex != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("ClearFullTextIndex"), splitSqlClearFullTextIndex, errClearFullTextIndex)
+		}
+
+		offsetClearFullTextIndex += countClearFullTextIndex
+	}
+
+	if !__imp.__withTx {
+		if errClearFullTextIndex := txClearFullTextIndex.Commit(); errClearFullTextIndex != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("ClearFullTextIndex"), errClearFullTextIndex)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) CleanupFullTextIndex() error {
+	var (
+		errCleanupFullTextIndex     error
+		argListCleanupFullTextIndex = make(__rt.Arguments, 0, 8)
+	)
+
+	argListCleanupFullTextIndex = __rt.Arguments{}
+
+	sqlCleanupFullTextIndex := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlCleanupFullTextIndex)
+	defer sqlCleanupFullTextIndex.Reset()
+
+	if errCleanupFullTextIndex = sqlTmplCleanupFullTextIndex.Execute(sqlCleanupFullTextIndex, map[string]any{}); errCleanupFullTextIndex != nil {
+		return fmt.Errorf("error executing %s template: %w", strconv.Quote("CleanupFullTextIndex"), errCleanupFullTextIndex)
+	}
+
+	queryCleanupFullTextIndex := sqlCleanupFullTextIndex.String()
+
+	txCleanupFullTextIndex, errCleanupFullTextIndex := __imp.__core.Beginx()
+	if errCleanupFullTextIndex != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("CleanupFullTextIndex"), errCleanupFullTextIndex)
+	}
+	if !__imp.__withTx {
+		defer txCleanupFullTextIndex.Rollback()
+	}
+
+	offsetCleanupFullTextIndex := 0
+	argsCleanupFullTextIndex := __rt.MergeArgs(argListCleanupFullTextIndex...)
+
+	sqlSliceCleanupFullTextIndex := __rt.Split(queryCleanupFullTextIndex, ";")
+	for indexCleanupFullTextIndex, splitSqlCleanupFullTextIndex := range sqlSliceCleanupFullTextIndex {
+		_ = indexCleanupFullTextIndex
+
+		countCleanupFullTextIndex := __rt.Count(splitSqlCleanupFullTextIndex, "?")
+
+		_, errCleanupFullTextIndex = txCleanupFullTextIndex.Exec(splitSqlCleanupFullTextIndex, argsCleanupFullTextIndex[offsetCleanupFullTextIndex:offsetCleanupFullTextIndex+countCleanupFullTextIndex]...)
+
+		if errCleanupFullTextIndex != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("CleanupFullTextIndex"), splitSqlCleanupFullTextIndex, errCleanupFullTextIndex)
+		}
+
+		offsetCleanupFullTextIndex += countCleanupFullTextIndex
+	}
+
+	if !__imp.__withTx {
+		if errCleanupFullTextIndex := txCleanupFullTextIndex.Commit(); errCleanupFullTextIndex != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("CleanupFullTextIndex"), errCleanupFullTextIndex)
+		}
+	}
+
+	return nil
+}
+
+func (__imp *implPersistence) Persistence(requestID string, requestContentType string, requestMethod string, requestPath string, requestQuery string, moonshotID string, moonshotGID string, moonshotUID string, moonshotRequestID string, moonshotServerTiming int, responseStatusCode int, responseContentType string, requestHeader []byte, requestBody []byte, responseHeader []byte, responseBody []byte, programError string, responseTTFT int, responseTPOT int, responseOTPS float64, createdAt string, latency time.Duration, endpoint string, requestHash string, responseTiming string, attempt int, kIdent string, cost float64, costKnown bool) (int64, error) {
+	var (
+		v0Persistence  int64
+		errPersistence error
+	)
+
+	sqlPersistence := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlPersistence)
+	defer sqlPersistence.Reset()
+
+	if errPersistence = sqlTmplPersistence.Execute(sqlPersistence, map[string]any{
+		"requestID":            requestID,
+		"requestContentType":   requestContentType,
+		"requestMethod":        requestMethod,
+		"requestPath":          requestPath,
+		"requestQuery":         requestQuery,
+		"moonshotID":           moonshotID,
+		"moonshotGID":          moonshotGID,
+		"moonshotUID":          moonshotUID,
+		"moonshotRequestID":    moonshotRequestID,
+		"moonshotServerTiming": moonshotServerTiming,
+		"responseStatusCode":   responseStatusCode,
+		"responseContentType":  responseContentType,
+		"requestHeader":        requestHeader,
+		"requestBody":          requestBody,
+		"responseHeader":       responseHeader,
+		"responseBody":         responseBody,
+		"programError":         programError,
+		"responseTTFT":         responseTTFT,
+		"responseTPOT":         responseTPOT,
+		"responseOTPS":         responseOTPS,
+		"createdAt":            createdAt,
+		"latency":              latency,
+		"endpoint":             endpoint,
+		"requestHash":          requestHash,
+		"responseTiming":       responseTiming,
+		"attempt":              attempt,
+		"kIdent":               kIdent,
+		"cost":                 cost,
+		"costKnown":            costKnown,
+	}); errPersistence != nil {
+		return v0Persistence, fmt.Errorf("error executing %s template: %w", strconv.Quote("Persistence"), errPersistence)
+	}
+
+	queryPersistence := sqlPersistence.String()
+
+	txPersistence, errPersistence := __imp.__core.Beginx()
+	if errPersistence != nil {
+		return v0Persistence, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("Persistence"), errPersistence)
+	}
+	if !__imp.__withTx {
+		defer txPersistence.Rollback()
+	}
+
+	argsPersistence := __rt.MergeNamedArgs(map[string]any{
+		"requestID":            requestID,
+		"requestContentType":   requestContentType,
+		"requestMethod":        requestMethod,
+		"requestPath":          requestPath,
+		"requestQuery":         requestQuery,
+		"moonshotID":           moonshotID,
+		"moonshotGID":          moonshotGID,
+		"moonshotUID":          moonshotUID,
+		"moonshotRequestID":    moonshotRequestID,
+		"moonshotServerTiming": moonshotServerTiming,
+		"responseStatusCode":   responseStatusCode,
+		"responseContentType":  responseContentType,
+		"requestHeader":        requestHeader,
+		"requestBody":          requestBody,
+		"responseHeader":       responseHeader,
+		"responseBody":         responseBody,
+		"programError":         programError,
+		"responseTTFT":         responseTTFT,
+		"responseTPOT":         responseTPOT,
+		"responseOTPS":         responseOTPS,
+		"createdAt":            createdAt,
+		"latency":              latency,
+		"endpoint":             endpoint,
+		"requestHash":          requestHash,
+		"responseTiming":       responseTiming,
+		"attempt":              attempt,
+		"kIdent":               kIdent,
+		"cost":                 cost,
+		"costKnown":            costKnown,
+	})
+
+	sqlSlicePersistence := __rt.Split(queryPersistence, ";")
+	for indexPersistence, splitSqlPersistence := range sqlSlicePersistence {
+		_ = indexPersistence
+
+		var listArgsPersistence []interface{}
+
+		splitSqlPersistence, listArgsPersistence, errPersistence = sqlx.Named(splitSqlPersistence, argsPersistence)
+		if errPersistence != nil {
+			return v0Persistence, fmt.Errorf("error building %s query: %w", strconv.Quote("Persistence"), errPersistence)
+		}
+
+		splitSqlPersistence, listArgsPersistence, errPersistence = sqlx.In(splitSqlPersistence, listArgsPersistence...)
+		if errPersistence != nil {
+			return v0Persistence, fmt.Errorf("error building %s query: %w", strconv.Quote("Persistence"), errPersistence)
+		}
+
+		if indexPersistence < len(sqlSlicePersistence)-1 {
+			_, errPersistence = txPersistence.Exec(splitSqlPersistence, listArgsPersistence...)
+		} else {
+			errPersistence = txPersistence.Get(&v0Persistence, splitSqlPersistence, listArgsPersistence...)
+		}
+
+		if errPersistence != nil {
+			return v0Persistence, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("Persistence"), splitSqlPersistence, errPersistence)
+		}
+	}
+
+	if !__imp.__withTx {
+		if errPersistence := txPersistence.Commit(); errPersistence != nil {
+			return v0Persistence, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("Persistence"), errPersistence)
+		}
+	}
+
+	return v0Persistence, nil
+}
+
+func (__imp *implPersistence) ListRequests(n int64, chatOnly bool, predicate string) ([]*Request, error) {
+	var (
+		v0ListRequests      []*Request
+		errListRequests     error
+		argListListRequests = make(__rt.Arguments, 0, 8)
+	)
+
+	__ListRequestsBindFunc := func(arg any) string {
+		argListListRequests = append(argListListRequests, arg)
+		return __rt.BindVars(len(__rt.MergeArgs(arg)))
+	}
+	sqlTmplListRequests := template.Must(template.New("ListRequests").Funcs(template.FuncMap{"bind": __ListRequestsBindFunc, "bindvars": __rt.BindVars, "body": referencesBody, "fields": tableFields, "fts": fullTextPart}).Parse("select * from ( select {{ fields \"request_header\" \"request_body\" \"response_header\" \"response_body\" }}, decrypt(request_header) as request_header, decrypt(response_header) as response_header, decompress(request_body) as request_body, iif( response_content_type = 'text/event-stream' and response_body is not null, merge_cmpl(decompress(response_body)), decompress(response_body) ) as response_body, coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category, coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note, (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags from moonshot_requests where 1 = 1 {{ if .chatOnly }} and request_path like '%/chat/completions' {{ end }} order by id desc {{ if body .predicate }} limit -1 {{ end }} ) where 1 = 1 {{ if .predicate }} and ({{ .predicate }}) {{ end }} {{ if .n }} limit {{ bind .n }} {{ end }} ;\r\n"))
+
+	sqlListRequests := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlListRequests)
+	defer sqlListRequests.Reset()
+
+	if errListRequests = sqlTmplListRequests.Execute(sqlListRequests, map[string]any{
+		"n":         n,
+		"chatOnly":  chatOnly,
+		"predicate": predicate,
+	}); errListRequests != nil {
+		return v0ListRequests, fmt.Errorf("error executing %s template: %w", strconv.Quote("ListRequests"), errListRequests)
+	}
+
+	queryListRequests := sqlListRequests.String()
+
+	txListRequests, errListRequests := __imp.__core.Beginx()
+	if errListRequests != nil {
+		return v0ListRequests, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("ListRequests"), errListRequests)
+	}
+	if !__imp.__withTx {
+		defer txListRequests.Rollback()
+	}
+
+	offsetListRequests := 0
+	argsListRequests := __rt.MergeArgs(argListListRequests...)
+
+	sqlSliceListRequests := __rt.Split(queryListRequests, ";")
+	for indexListRequests, splitSqlListRequests := range sqlSliceListRequests {
+		_ = indexListRequests
+
+		countListRequests := __rt.Count(splitSqlListRequests, "?")
+
+		if indexListRequests < len(sqlSliceListRequests)-1 {
+			_, errListRequests = txListRequests.Exec(splitSqlListRequests, argsListRequests[offsetListRequests:offsetListRequests+countListRequests]...)
+		} else {
+			errListRequests = txListRequests.Select(&v0ListRequests, splitSqlListRequests, argsListRequests[offsetListRequests:offsetListRequests+countListRequests]...)
+		}
+
+		if errListRequests != nil {
+			return v0ListRequests, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("ListRequests"), splitSqlListRequests, errListRequests)
+		}
+
+		offsetListRequests += countListRequests
+	}
+
+	if !__imp.__withTx {
+		if errListRequests := txListRequests.Commit(); errListRequests != nil {
+			return v0ListRequests, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("ListRequests"), errListRequests)
+		}
+	}
+
+	return v0ListRequests, nil
+}
+
+func (__imp *implPersistence) TailRequests(after int64, chatOnly bool, predicate string) ([]*Request, error) {
+	var (
+		v0TailRequests      []*Request
+		errTailRequests     error
+		argListTailRequests = make(__rt.Arguments, 0, 8)
+	)
+
+	__TailRequestsBindFunc := func(arg any) string {
+		argListTailRequests = append(argListTailRequests, arg)
+		return __rt.BindVars(len(__rt.MergeArgs(arg)))
+	}
+	sqlTmplTailRequests := template.Must(template.New("TailRequests").Funcs(template.FuncMap{"bind": __TailRequestsBindFunc, "bindvars": __rt.BindVars, "body": referencesBody, "fields": tableFields, "fts": fullTextPart}).Parse("select * from ( select {{ fields \"request_header\" \"request_body\" \"response_header\" \"response_body\" }}, decrypt(request_header) as request_header, decrypt(response_header) as response_header, decompress(request_body) as request_body, iif( response_content_type = 'text/event-stream' and response_body is not null, merge_cmpl(decompress(response_body)), decompress(response_body) ) as response_body, coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category, coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note, (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags from moonshot_requests where id > {{ bind .after }} ) where 1 = 1 {{ if .chatOnly }} and request_path like '%/chat/completions' {{ end }} {{ if .predicate }} and ({{ .predicate }}) {{ end }} order by id ;\r\n"))
+
+	sqlTailRequests := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlTailRequests)
+	defer sqlTailRequests.Reset()
+
+	if errTailRequests = sqlTmplTailRequests.Execute(sqlTailRequests, map[string]any{
+		"after":     after,
+		"chatOnly":  chatOnly,
+		"predicate": predicate,
+	}); errTailRequests != nil {
+		return v0TailRequests, fmt.Errorf("error executing %s template: %w", strconv.Quote("TailRequests"), errTailRequests)
+	}
+
+	queryTailRequests := sqlTailRequests.String()
+
+	txTailRequests, errTailRequests := __imp.__core.Beginx()
+	if errTailRequests != nil {
+		return v0TailRequests, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("TailRequests"), errTailRequests)
+	}
+	if !__imp.__withTx {
+		defer txTailRequests.Rollback()
+	}
+
+	offsetTailRequests := 0
+	argsTailRequests := __rt.MergeArgs(argListTailRequests...)
+
+	sqlSliceTailRequests := __rt.Split(queryTailRequests, ";")
+	for indexTailRequests, splitSqlTailRequests := range sqlSliceTailRequests {
+		_ = indexTailRequests
+
+		countTailRequests := __rt.Count(splitSqlTailRequests, "?")
+
+		if indexTailRequests < len(sqlSliceTailRequests)-1 {
+			_, errTailRequests = txTailRequests.Exec(splitSqlTailRequests, argsTailRequests[offsetTailRequests:offsetTailRequests+countTailRequests]...)
+		} else {
+			errTailRequests = txTailRequests.Select(&v0TailRequests, splitSqlTailRequests, argsTailRequests[offsetTailRequests:offsetTailRequests+countTailRequests]...)
+		}
+
+		if errTailRequests != nil {
+			return v0TailRequests, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("TailRequests"), splitSqlTailRequests, errTailRequests)
+		}
+
+		offsetTailRequests += countTailRequests
+	}
+
+	if !__imp.__withTx {
+		if errTailRequests := txTailRequests.Commit(); errTailRequests != nil {
+			return v0TailRequests, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("TailRequests"), errTailRequests)
+		}
+	}
+
+	return v0TailRequests, nil
+}
+
+func (__imp *implPersistence) LatestRequestID() (int64, error) {
+	var (
+		v0LatestRequestID      int64
+		errLatestRequestID     error
+		argListLatestRequestID = make(__rt.Arguments, 0, 8)
+	)
+
+	argListLatestRequestID = __rt.Arguments{}
+
+	queryLatestRequestID := "select coalesce(max(id), 0) from moonshot_requests;\r\n"
+
+	txLatestRequestID, errLatestRequestID := __imp.__core.Beginx()
+	if errLatestRequestID != nil {
+		return v0LatestRequestID, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("LatestRequestID"), errLatestRequestID)
+	}
+	if !__imp.__withTx {
+		defer txLatestRequestID.Rollback()
+	}
+
+	offsetLatestRequestID := 0
+	argsLatestRequestID := __rt.MergeArgs(argListLatestRequestID...)
+
+	sqlSliceLatestRequestID := __rt.Split(queryLatestRequestID, ";")
+	for indexLatestRequestID, splitSqlLatestRequestID := range sqlSliceLatestRequestID {
+		_ = indexLatestRequestID
+
+		countLatestRequestID := __rt.Count(splitSqlLatestRequestID, "?")
+
+		if indexLatestRequestID < len(sqlSliceLatestRequestID)-1 {
+			_, errLatestRequestID = txLatestRequestID.Exec(splitSqlLatestRequestID, argsLatestRequestID[offsetLatestRequestID:offsetLatestRequestID+countLatestRequestID]...)
+		} else {
+			errLatestRequestID = txLatestRequestID.Get(&v0LatestRequestID, splitSqlLatestRequestID, argsLatestRequestID[offsetLatestRequestID:offsetLatestRequestID+countLatestRequestID]...)
+		}
+
+		if errLatestRequestID != nil {
+			return v0LatestRequestID, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("LatestRequestID"), splitSqlLatestRequestID, errLatestRequestID)
+		}
+
+		offsetLatestRequestID += countLatestRequestID
+	}
+
+	if !__imp.__withTx {
+		if errLatestRequestID := txLatestRequestID.Commit(); errLatestRequestID != nil {
+			return v0LatestRequestID, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("LatestRequestID"), errLatestRequestID)
+		}
+	}
+
+	return v0LatestRequestID, nil
+}
+
+func (__imp *implPersistence) ListStats(since string, until string, chatOnly bool, predicate string) ([]*statsRow, error) {
+	var (
+		v0ListStats      []*statsRow
+		errListStats     error
+		argListListStats = make(__rt.Arguments, 0, 8)
+	)
+
+	__ListStatsBindFunc := func(arg any) string {
+		argListListStats = append(argListListStats, arg)
+		return __rt.BindVars(len(__rt.MergeArgs(arg)))
+	}
+	sqlTmplListStats := template.Must(template.New("ListStats").Funcs(template.FuncMap{"bind": __ListStatsBindFunc, "bindvars": __rt.BindVars, "body": referencesBody, "fields": tableFields, "fts": fullTextPart}).Parse("select id, request_path, moonshot_gid, response_status_code, error, response_ttft, latency, moonshot_server_timing, cost, created_at, iif(json_valid(request_body), json_extract(request_body, '$.model'), null) as model, iif( json_valid(response_body), coalesce(json_extract(response_body, '$.usage'), json_extract(response_body, '$.choices[0].usage')), null ) as usage from ( select {{ fields \"request_header\" \"request_body\" \"response_header\" \"response_body\" }}, decrypt(request_header) as request_header, decrypt(response_header) as response_header, decompress(request_body) as request_body, iif( response_content_type = 'text/event-stream' and response_body is not null, merge_cmpl(decompress(response_body)), decompress(response_body) ) as response_body, coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category, coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note, (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags from moonshot_requests where created_at >= {{ bind .since }} {{ if .until }} and created_at < {{ bind .until }} {{ end }} {{ if .chatOnly }} and request_path like '%/chat/completions' {{ end }} order by id limit -1 ) where 1 = 1 {{ if .predicate }} and ({{ .predicate }}) {{ end }} ;\r\n"))
+
+	sqlListStats := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlListStats)
+	defer sqlListStats.Reset()
+
+	if errListStats = sqlTmplListStats.Execute(sqlListStats, map[string]any{
+		"since":     since,
+		"until":     until,
+		"chatOnly":  chatOnly,
+		"predicate": predicate,
+	}); errListStats != nil {
+		return v0ListStats, fmt.Errorf("error executing %s template: %w", strconv.Quote("ListStats"), errListStats)
+	}
+
+	queryListStats := sqlListStats.String()
+
+	txListStats, errListStats := __imp.__core.Beginx()
+	if errListStats != nil {
+		return v0ListStats, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("ListStats"), errListStats)
+	}
+	if !__imp.__withTx {
+		defer txListStats.Rollback()
+	}
+
+	offsetListStats := 0
+	argsListStats := __rt.MergeArgs(argListListStats...)
+
+	sqlSliceListStats := __rt.Split(queryListStats, ";")
+	for indexListStats, splitSqlListStats := range sqlSliceListStats {
+		_ = indexListStats
+
+		countListStats := __rt.Count(splitSqlListStats, "?")
+
+		if indexListStats < len(sqlSliceListStats)-1 {
+			_, errListStats = txListStats.Exec(splitSqlListStats, argsListStats[offsetListStats:offsetListStats+countListStats]...)
+		} else {
+			errListStats = txListStats.Select(&v0ListStats, splitSqlListStats, argsListStats[offsetListStats:offsetListStats+countListStats]...)
+		}
+
+		if errListStats != nil {
+			return v0ListStats, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("ListStats"), splitSqlListStats, errListStats)
+		}
+
+		offsetListStats += countListStats
+	}
+
+	if !__imp.__withTx {
+		if errListStats := txListStats.Commit(); errListStats != nil {
+			return v0ListStats, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("ListStats"), errListStats)
+		}
+	}
+
+	return v0ListStats, nil
+}
+
+func (__imp *implPersistence) SearchRequests(query string, column string, n int64, predicate string) ([]*searchRow, error) {
+	var (
+		v0SearchRequests      []*searchRow
+		errSearchRequests     error
+		argListSearchRequests = make(__rt.Arguments, 0, 8)
+	)
+
+	__SearchRequestsBindFunc := func(arg any) string {
+		argListSearchRequests = append(argListSearchRequests, arg)
+		return __rt.BindVars(len(__rt.MergeArgs(arg)))
+	}
+	sqlTmplSearchRequests := template.Must(template.New("SearchRequests").Funcs(template.FuncMap{"bind": __SearchRequestsBindFunc, "bindvars": __rt.BindVars, "body": referencesBody, "fields": tableFields, "fts": fullTextPart}).Parse("select r.id, r.request_path, r.moonshot_id, r.moonshot_request_id, r.response_status_code, r.created_at, iif(json_valid(r.request_body), json_extract(r.request_body, '$.model'), null) as model, {{ fts \"rank\" }} as rank, {{ fts \"snippet\" }} as snippet from {{ fts \"table\" }} join ( select {{ fields \"request_header\" \"request_body\" \"response_header\" \"response_body\" }}, decrypt(request_header) as request_header, decrypt(response_header) as response_header, decompress(request_body) as request_body, iif( response_content_type = 'text/event-stream' and response_body is not null, merge_cmpl(decompress(response_body)), decompress(response_body) ) as response_body, coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category, coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note, (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags from moonshot_requests ) as r on r.id = {{ fts \"table\" }}.rowid where {{ if .column }}{{ .column }}{{ else }}{{ fts \"table\" }}{{ end }} match {{ bind .query }} {{ if .predicate }} and ({{ .predicate }}) {{ end }} order by rank {{ if .n }} limit {{ bind .n }} {{ end }} ;\r\n"))
+
+	sqlSearchRequests := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlSearchRequests)
+	defer sqlSearchRequests.Reset()
+
+	if errSearchRequests = sqlTmplSearchRequests.Execute(sqlSearchRequests, map[string]any{
+		"query":     query,
+		"column":    column,
+		"n":         n,
+		"predicate": predicate,
+	}); errSearchRequests != nil {
+		return v0SearchRequests, fmt.Errorf("error executing %s template: %w", strconv.Quote("SearchRequests"), errSearchRequests)
+	}
+
+	querySearchRequests := sqlSearchRequests.String()
+
+	txSearchRequests, errSearchRequests := __imp.__core.Beginx()
+	if errSearchRequests != nil {
+		return v0SearchRequests, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("SearchRequests"), errSearchRequests)
+	}
+	if !__imp.__withTx {
+		defer txSearchRequests.Rollback()
+	}
+
+	offsetSearchRequests := 0
+	argsSearchRequests := __rt.MergeArgs(argListSearchRequests...)
+
+	sqlSliceSearchRequests := __rt.Split(querySearchRequests, ";")
+	for indexSearchRequests, splitSqlSearchRequests := range sqlSliceSearchRequests {
+		_ = indexSearchRequests
+
+		countSearchRequests := __rt.Count(splitSqlSearchRequests, "?")
+
+		if indexSearchRequests < len(sqlSliceSearchRequests)-1 {
+			_, errSearchRequests = txSearchRequests.Exec(splitSqlSearchRequests, argsSearchRequests[offsetSearchRequests:offsetSearchRequests+countSearchRequests]...)
+		} else {
+			errSearchRequests = txSearchRequests.Select(&v0SearchRequests, splitSqlSearchRequests, argsSearchRequests[offsetSearchRequests:offsetSearchRequests+countSearchRequests]...)
+		}
+
+		if errSearchRequests != nil {
+			return v0SearchRequests, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("SearchRequests"), splitSqlSearchRequests, errSearchRequests)
+		}
+
+		offsetSearchRequests += countSearchRequests
+	}
+
+	if !__imp.__withTx {
+		if errSearchRequests := txSearchRequests.Commit(); errSearchRequests != nil {
+			return v0SearchRequests, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("SearchRequests"), errSearchRequests)
+		}
+	}
+
+	return v0SearchRequests, nil
+}
+
+func (__imp *implPersistence) GetRequest(id int64, chatcmpl string, requestid string) (*Request, error) {
+	var (
+		v0GetRequest  = new(Request)
+		errGetRequest error
+	)
+
+	sqlGetRequest := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlGetRequest)
+	defer sqlGetRequest.Reset()
+
+	if errGetRequest = sqlTmplGetRequest.Execute(sqlGetRequest, map[string]any{
+		"id":        id,
+		"chatcmpl":  chatcmpl,
+		"requestid": requestid,
+	}); errGetRequest != nil {
+		return v0GetRequest, fmt.Errorf("error executing %s template: %w", strconv.Quote("GetRequest"), errGetRequest)
+	}
+
+	queryGetRequest := sqlGetRequest.String()
+
+	txGetRequest, errGetRequest := __imp.__core.Beginx()
+	if errGetRequest != nil {
+		return v0GetRequest, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("GetRequest"), errGetRequest)
+	}
+	if !__imp.__withTx {
+		defer txGetRequest.Rollback()
+	}
+
+	argsGetRequest := __rt.MergeNamedArgs(map[string]any{
+		"id":        id,
+		"chatcmpl":  chatcmpl,
+		"requestid": requestid,
+	})
+
+	sqlSliceGetRequest := __rt.Split(queryGetRequest, ";")
+	for indexGetRequest, splitSqlGetRequest := range sqlSliceGetRequest {
+		_ = indexGetRequest
+
+		var listArgsGetRequest []interface{}
+
+		splitSqlGetRequest, listArgsGetRequest, errGetRequest = sqlx.Named(splitSqlGetRequest, argsGetRequest)
+		if errGetRequest != nil {
+			return v0GetRequest, fmt.Errorf("error building %s query: %w", strconv.Quote("GetRequest"), errGetRequest)
+		}
+
+		splitSqlGetRequest, listArgsGetRequest, errGetRequest = sqlx.In(splitSqlGetRequest, listArgsGetRequest...)
+		if errGetRequest != nil {
+			return v0GetRequest, fmt.Errorf("error building %s query: %w", strconv.Quote("GetRequest"), errGetRequest)
+		}
+
+		if indexGetRequest < len(sqlSliceGetRequest)-1 {
+			_, errGetRequest = txGetRequest.Exec(splitSqlGetRequest, listArgsGetRequest...)
+		} else {
+			errGetRequest = txGetRequest.Get(v0GetRequest, splitSqlGetRequest, listArgsGetRequest...)
+		}
+
+		if errGetRequest != nil {
+			return v0GetRequest, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("GetRequest"), splitSqlGetRequest, errGetRequest)
+		}
+	}
+
+	if !__imp.__withTx {
+		if errGetRequest := txGetRequest.Commit(); errGetRequest != nil {
+			return v0GetRequest, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("GetRequest"), errGetRequest)
+		}
+	}
+
+	return v0GetRequest, nil
+}
+
+func (__imp *implPersistence) GetRequestByHash(hash string) (*Request, error) {
+	var (
+		v0GetRequestByHash  = new(Request)
+		errGetRequestByHash error
+	)
+
+	queryGetRequestByHash := "select * from moonshot_requests where request_hash = :hash and response_status_code = 200 order by id desc limit 1;\r\n"
+
+	txGetRequestByHash, errGetRequestByHash := __imp.__core.Beginx()
+	if errGetRequestByHash != nil {
+		return v0GetRequestByHash, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("GetRequestByHash"), errGetRequestByHash)
+	}
+	if !__imp.__withTx {
+		defer txGetRequestByHash.Rollback()
+	}
+
+	argsGetRequestByHash := __rt.MergeNamedArgs(map[string]any{
+		"hash": hash,
+	})
+
+	sqlSliceGetRequestByHash := __rt.Split(queryGetRequestByHash, ";")
+	for indexGetRequestByHash, splitSqlGetRequestByHash := range sqlSliceGetRequestByHash {
+		_ = indexGetRequestByHash
+
+		var listArgsGetRequestByHash []interface{}
+
+		splitSqlGetRequestByHash, listArgsGetRequestByHash, errGetRequestByHash = sqlx.Named(splitSqlGetRequestByHash, argsGetRequestByHash)
+		if errGetRequestByHash != nil {
+			return v0GetRequestByHash, fmt.Errorf("error building %s query: %w", strconv.Quote("GetRequestByHash"), errGetRequestByHash)
+		}
+
+		splitSqlGetRequestByHash, listArgsGetRequestByHash, errGetRequestByHash = sqlx.In(splitSqlGetRequestByHash, listArgsGetRequestByHash...)
+		if errGetRequestByHash != nil {
+			return v0GetRequestByHash, fmt.Errorf("error building %s query: %w", strconv.Quote("GetRequestByHash"), errGetRequestByHash)
+		}
+
+		if indexGetRequestByHash < len(sqlSliceGetRequestByHash)-1 {
+			_, errGetRequestByHash = txGetRequestByHash.Exec(splitSqlGetRequestByHash, listArgsGetRequestByHash...)
+		} else {
+			errGetRequestByHash = txGetRequestByHash.Get(v0GetRequestByHash, splitSqlGetRequestByHash, listArgsGetRequestByHash...)
+		}
+
+		if errGetRequestByHash != nil {
+			return v0GetRequestByHash, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("GetRequestByHash"), splitSqlGetRequestByHash, errGetRequestByHash)
+		}
+	}
+
+	if !__imp.__withTx {
+		if errGetRequestByHash := txGetRequestByHash.Commit(); errGetRequestByHash != nil {
+			return v0GetRequestByHash, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("GetRequestByHash"), errGetRequestByHash)
+		}
+	}
+
+	return v0GetRequestByHash, nil
+}
+
+func (__imp *implPersistence) GetRequestByModel(model string) (*Request, error) {
+	var (
+		v0GetRequestByModel  = new(Request)
+		errGetRequestByModel error
+	)
+
+	queryGetRequestByModel := "select * from moonshot_requests where request_path like '%/chat/completions' and response_status_code = 200 and json_valid(decompress(request_body)) and json_extract(decompress(request_body), '$.model') = :model order by id desc limit 1;\r\n"
+
+	txGetRequestByModel, errGetRequestByModel := __imp.__core.Beginx()
+	if errGetRequestByModel != nil {
+		return v0GetRequestByModel, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("GetRequestByModel"), errGetRequestByModel)
+	}
+	if !__imp.__withTx {
+		defer txGetRequestByModel.Rollback()
+	}
+
+	argsGetRequestByModel := __rt.MergeNamedArgs(map[string]any{
+		"model": model,
+	})
+
+	sqlSliceGetRequestByModel := __rt.Split(queryGetRequestByModel, ";")
+	for indexGetRequestByModel, splitSqlGetRequestByModel := range sqlSliceGetRequestByModel {
+		_ = indexGetRequestByModel
+
+		var listArgsGetRequestByModel []interface{}
+
+		splitSqlGetRequestByModel, listArgsGetRequestByModel, errGetRequestByModel = sqlx.Named(splitSqlGetRequestByModel, argsGetRequestByModel)
+		if errGetRequestByModel != nil {
+			return v0GetRequestByModel, fmt.Errorf("error building %s query: %w", strconv.Quote("GetRequestByModel"), errGetRequestByModel)
+		}
+
+		splitSqlGetRequestByModel, listArgsGetRequestByModel, errGetRequestByModel = sqlx.In(splitSqlGetRequestByModel, listArgsGetRequestByModel...)
+		if errGetRequestByModel != nil {
+			return v0GetRequestByModel, fmt.Errorf("error building %s query: %w", strconv.Quote("GetRequestByModel"), errGetRequestByModel)
+		}
+
+		if indexGetRequestByModel < len(sqlSliceGetRequestByModel)-1 {
+			_, errGetRequestByModel = txGetRequestByModel.Exec(splitSqlGetRequestByModel, listArgsGetRequestByModel...)
+		} else {
+			errGetRequestByModel = txGetRequestByModel.Get(v0GetRequestByModel, splitSqlGetRequestByModel, listArgsGetRequestByModel...)
+		}
+
+		if errGetRequestByModel != nil {
+			return v0GetRequestByModel, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("GetRequestByModel"), splitSqlGetRequestByModel, errGetRequestByModel)
+		}
+	}
+
+	if !__imp.__withTx {
+		if errGetRequestByModel := txGetRequestByModel.Commit(); errGetRequestByModel != nil {
+			return v0GetRequestByModel, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("GetRequestByModel"), errGetRequestByModel)
+		}
+	}
+
+	return v0GetRequestByModel, nil
+}
+
+func (__imp *implPersistence) ListUnhashedRequests() ([]*unhashedRequest, error) {
+	var (
+		v0ListUnhashedRequests      []*unhashedRequest
+		errListUnhashedRequests     error
+		argListListUnhashedRequests = make(__rt.Arguments, 0, 8)
+	)
+
+	argListListUnhashedRequests = __rt.Arguments{}
 
-	queryaddEndpointField := sqladdEndpointField.String()
+	queryListUnhashedRequests := "select id, decompress(request_body) as request_body from moonshot_requests where request_hash is null and request_body is not null and request_path like '%/chat/completions';\r\n"
 
-	txaddEndpointField, erraddEndpointField := __imp.__core.Beginx()
-	if erraddEndpointField != nil {
-		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("addEndpointField"), erraddEndpointField)
+	txListUnhashedRequests, errListUnhashedRequests := __imp.__core.Beginx()
+	if errListUnhashedRequests != nil {
+		return v0ListUnhashedRequests, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("ListUnhashedRequests"), errListUnhashedRequests)
 	}
 	if !__imp.__withTx {
-		defer txaddEndpointField.Rollback()
+		defer txListUnhashedRequests.Rollback()
 	}
 
-	offsetaddEndpointField := 0
-	argsaddEndpointField := __rt.MergeArgs(argListaddEndpointField...)
+	offsetListUnhashedRequests := 0
+	argsListUnhashedRequests := __rt.MergeArgs(argListListUnhashedRequests...)
 
-	sqlSliceaddEndpointField := __rt.Split(queryaddEndpointField, ";")
-	for indexaddEndpointField, splitSqladdEndpointField := range sqlSliceaddEndpointField {
-		_ = indexaddEndpointField
+	sqlSliceListUnhashedRequests := __rt.Split(queryListUnhashedRequests, ";")
+	for indexListUnhashedRequests, splitSqlListUnhashedRequests := range sqlSliceListUnhashedRequests {
+		_ = indexListUnhashedRequests
 
-		countaddEndpointField := __rt.Count(splitSqladdEndpointField, "?")
+		countListUnhashedRequests := __rt.Count(splitSqlListUnhashedRequests, "?")
 
-		_, erraddEndpointField = txaddEndpointField.Exec(splitSqladdEndpointField, argsaddEndpointField[offsetaddEndpointField:offsetaddEndpointField+countaddEndpointField]...)
+		if indexListUnhashedRequests < len(sqlSliceListUnhashedRequests)-1 {
+			_, errListUnhashedRequests = txListUnhashedRequests.Exec(splitSqlListUnhashedRequests, argsListUnhashedRequests[offsetListUnhashedRequests:offsetListUnhashedRequests+countListUnhashedRequests]...)
+		} else {
+			errListUnhashedRequests = txListUnhashedRequests.Select(&v0ListUnhashedRequests, splitSqlListUnhashedRequests, argsListUnhashedRequests[offsetListUnhashedRequests:offsetListUnhashedRequests+countListUnhashedRequests]...)
+		}
 
-		if erraddEndpointField != nil {
-			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("addEndpointField"), splitSqladdEndpointField, erraddEndpointField)
+		if errListUnhashedRequests != nil {
+			return v0ListUnhashedRequests, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("ListUnhashedRequests"), splitSqlListUnhashedRequests, errListUnhashedRequests)
 		}
 
-		offsetaddEndpointField += countaddEndpointField
+		offsetListUnhashedRequests += countListUnhashedRequests
 	}
 
 	if !__imp.__withTx {
-		if erraddEndpointField := txaddEndpointField.Commit(); erraddEndpointField != nil {
-			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("addEndpointField"), erraddEndpointField)
+		if errListUnhashedRequests := txListUnhashedRequests.Commit(); errListUnhashedRequests != nil {
+			return v0ListUnhashedRequests, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("ListUnhashedRequests"), errListUnhashedRequests)
 		}
 	}
 
-	return nil
+	return v0ListUnhashedRequests, nil
 }
 
-func (__imp *implPersistence) Cleanup(before string) (sql.Result, error) {
+func (__imp *implPersistence) SetRequestHash(id int64, hash string) error {
 	var (
-		v0Cleanup  sql.Result
-		errCleanup error
+		errSetRequestHash error
 	)
 
-	queryCleanup := "delete from moonshot_requests where created_at < :before;\r\n"
+	querySetRequestHash := "update moonshot_requests set request_hash = :hash where id = :id;\r\n"
 
-	txCleanup, errCleanup := __imp.__core.Beginx()
-	if errCleanup != nil {
-		return v0Cleanup, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("Cleanup"), errCleanup)
+	txSetRequestHash, errSetRequestHash := __imp.__core.Beginx()
+	if errSetRequestHash != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("SetRequestHash"), errSetRequestHash)
 	}
 	if !__imp.__withTx {
-		defer txCleanup.Rollback()
+		defer txSetRequestHash.Rollback()
 	}
 
-	argsCleanup := __rt.MergeNamedArgs(map[string]any{
-		"before": before,
+	argsSetRequestHash := __rt.MergeNamedArgs(map[string]any{
+		"id":   id,
+		"hash": hash,
 	})
 
-	sqlSliceCleanup := __rt.Split(queryCleanup, ";")
-	for indexCleanup, splitSqlCleanup := range sqlSliceCleanup {
-		_ = indexCleanup
+	sqlSliceSetRequestHash := __rt.Split(querySetRequestHash, ";")
+	for indexSetRequestHash, splitSqlSetRequestHash := range sqlSliceSetRequestHash {
+		_ = indexSetRequestHash
 
-		var listArgsCleanup []interface{}
+		var listArgsSetRequestHash []interface{}
 
-		splitSqlCleanup, listArgsCleanup, errCleanup = sqlx.Named(splitSqlCleanup, argsCleanup)
-		if errCleanup != nil {
-			return v0Cleanup, fmt.Errorf("error building %s query: %w", strconv.Quote("Cleanup"), errCleanup)
+		splitSqlSetRequestHash, listArgsSetRequestHash, errSetRequestHash = sqlx.Named(splitSqlSetRequestHash, argsSetRequestHash)
+		if errSetRequestHash != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("SetRequestHash"), errSetRequestHash)
 		}
 
-		splitSqlCleanup, listArgsCleanup, errCleanup = sqlx.In(splitSqlCleanup, listArgsCleanup...)
-		if errCleanup != nil {
-			return v0Cleanup, fmt.Errorf("error building %s query: %w", strconv.Quote("Cleanup"), errCleanup)
+		splitSqlSetRequestHash, listArgsSetRequestHash, errSetRequestHash = sqlx.In(splitSqlSetRequestHash, listArgsSetRequestHash...)
+		if errSetRequestHash != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("SetRequestHash"), errSetRequestHash)
 		}
 
-		v0Cleanup, errCleanup = txCleanup.Exec(splitSqlCleanup, listArgsCleanup...)
+		_, errSetRequestHash = txSetRequestHash.Exec(splitSqlSetRequestHash, listArgsSetRequestHash...)
 
-		if errCleanup != nil {
-			return v0Cleanup, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("Cleanup"), splitSqlCleanup, errCleanup)
+		if errSetRequestHash != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("SetRequestHash"), splitSqlSetRequestHash, errSetRequestHash)
 		}
 	}
 
 	if !__imp.__withTx {
-		if errCleanup := txCleanup.Commit(); errCleanup != nil {
-			return v0Cleanup, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("Cleanup"), errCleanup)
+		if errSetRequestHash := txSetRequestHash.Commit(); errSetRequestHash != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("SetRequestHash"), errSetRequestHash)
 		}
 	}
 
-	return v0Cleanup, nil
+	return nil
 }
 
-func (__imp *implPersistence) Persistence(requestID string, requestContentType string, requestMethod string, requestPath string, requestQuery string, moonshotID string, moonshotGID string, moonshotUID string, moonshotRequestID string, moonshotServerTiming int, responseStatusCode int, responseContentType string, requestHeader string, requestBody string, responseHeader string, responseBody string, programError string, responseTTFT int, responseTPOT int, responseOTPS float64, createdAt string, latency time.Duration, endpoint string) (int64, error) {
+func (__imp *implPersistence) ListUnlinkedRequests(skipAttempts bool) ([]*unlinkedRequest, error) {
 	var (
-		v0Persistence  int64
-		errPersistence error
+		v0ListUnlinkedRequests  []*unlinkedRequest
+		errListUnlinkedRequests error
 	)
 
-	sqlPersistence := __rt.GetBuffer()
-	defer __rt.PutBuffer(sqlPersistence)
-	defer sqlPersistence.Reset()
+	sqlListUnlinkedRequests := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlListUnlinkedRequests)
+	defer sqlListUnlinkedRequests.Reset()
 
-	if errPersistence = sqlTmplPersistence.Execute(sqlPersistence, map[string]any{
-		"requestID":            requestID,
-		"requestContentType":   requestContentType,
-		"requestMethod":        requestMethod,
-		"requestPath":          requestPath,
-		"requestQuery":         requestQuery,
-		"moonshotID":           moonshotID,
-		"moonshotGID":          moonshotGID,
-		"moonshotUID":          moonshotUID,
-		"moonshotRequestID":    moonshotRequestID,
-		"moonshotServerTiming": moonshotServerTiming,
-		"responseStatusCode":   responseStatusCode,
-		"responseContentType":  responseContentType,
-		"requestHeader":        requestHeader,
-		"requestBody":          requestBody,
-		"responseHeader":       responseHeader,
-		"responseBody":         responseBody,
-		"programError":         programError,
-		"responseTTFT":         responseTTFT,
-		"responseTPOT":         responseTPOT,
-		"responseOTPS":         responseOTPS,
-		"createdAt":            createdAt,
-		"latency":              latency,
-		"endpoint":             endpoint,
-	}); errPersistence != nil {
-		return v0Persistence, fmt.Errorf("error executing %s template: %w", strconv.Quote("Persistence"), errPersistence)
+	if errListUnlinkedRequests = sqlTmplListUnlinkedRequests.Execute(sqlListUnlinkedRequests, map[string]any{
+		"skipAttempts": skipAttempts,
+	}); errListUnlinkedRequests != nil {
+		return v0ListUnlinkedRequests, fmt.Errorf("error executing %s template: %w", strconv.Quote("ListUnlinkedRequests"), errListUnlinkedRequests)
 	}
 
-	queryPersistence := sqlPersistence.String()
+	queryListUnlinkedRequests := sqlListUnlinkedRequests.String()
 
-	txPersistence, errPersistence := __imp.__core.Beginx()
-	if errPersistence != nil {
-		return v0Persistence, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("Persistence"), errPersistence)
+	txListUnlinkedRequests, errListUnlinkedRequests := __imp.__core.Beginx()
+	if errListUnlinkedRequests != nil {
+		return v0ListUnlinkedRequests, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("ListUnlinkedRequests"), errListUnlinkedRequests)
 	}
 	if !__imp.__withTx {
-		defer txPersistence.Rollback()
+		defer txListUnlinkedRequests.Rollback()
 	}
 
-	argsPersistence := __rt.MergeNamedArgs(map[string]any{
-		"requestID":            requestID,
-		"requestContentType":   requestContentType,
-		"requestMethod":        requestMethod,
-		"requestPath":          requestPath,
-		"requestQuery":         requestQuery,
-		"moonshotID":           moonshotID,
-		"moonshotGID":          moonshotGID,
-		"moonshotUID":          moonshotUID,
-		"moonshotRequestID":    moonshotRequestID,
-		"moonshotServerTiming": moonshotServerTiming,
-		"responseStatusCode":   responseStatusCode,
-		"responseContentType":  responseContentType,
-		"requestHeader":        requestHeader,
-		"requestBody":          requestBody,
-		"responseHeader":       responseHeader,
-		"responseBody":         responseBody,
-		"programError":         programError,
-		"responseTTFT":         responseTTFT,
-		"responseTPOT":         responseTPOT,
-		"responseOTPS":         responseOTPS,
-		"createdAt":            createdAt,
-		"latency":              latency,
-		"endpoint":             endpoint,
+	argsListUnlinkedRequests := __rt.MergeNamedArgs(map[string]any{
+		"skipAttempts": skipAttempts,
 	})
 
-	sqlSlicePersistence := __rt.Split(queryPersistence, ";")
-	for indexPersistence, splitSqlPersistence := range sqlSlicePersistence {
-		_ = indexPersistence
+	sqlSliceListUnlinkedRequests := __rt.Split(queryListUnlinkedRequests, ";")
+	for indexListUnlinkedRequests, splitSqlListUnlinkedRequests := range sqlSliceListUnlinkedRequests {
+		_ = indexListUnlinkedRequests
 
-		var listArgsPersistence []interface{}
+		var listArgsListUnlinkedRequests []interface{}
 
-		splitSqlPersistence, listArgsPersistence, errPersistence = sqlx.Named(splitSqlPersistence, argsPersistence)
-		if errPersistence != nil {
-			return v0Persistence, fmt.Errorf("error building %s query: %w", strconv.Quote("Persistence"), errPersistence)
+		splitSqlListUnlinkedRequests, listArgsListUnlinkedRequests, errListUnlinkedRequests = sqlx.Named(splitSqlListUnlinkedRequests, argsListUnlinkedRequests)
+		if errListUnlinkedRequests != nil {
+			return v0ListUnlinkedRequests, fmt.Errorf("error building %s query: %w", strconv.Quote("ListUnlinkedRequests"), errListUnlinkedRequests)
 		}
 
-		splitSqlPersistence, listArgsPersistence, errPersistence = sqlx.In(splitSqlPersistence, listArgsPersistence...)
-		if errPersistence != nil {
-			return v0Persistence, fmt.Errorf("error building %s query: %w", strconv.Quote("Persistence"), errPersistence)
+		splitSqlListUnlinkedRequests, listArgsListUnlinkedRequests, errListUnlinkedRequests = sqlx.In(splitSqlListUnlinkedRequests, listArgsListUnlinkedRequests...)
+		if errListUnlinkedRequests != nil {
+			return v0ListUnlinkedRequests, fmt.Errorf("error building %s query: %w", strconv.Quote("ListUnlinkedRequests"), errListUnlinkedRequests)
 		}
 
-		if indexPersistence < len(sqlSlicePersistence)-1 {
-			_, errPersistence = txPersistence.Exec(splitSqlPersistence, listArgsPersistence...)
+		if indexListUnlinkedRequests < len(sqlSliceListUnlinkedRequests)-1 {
+			_, errListUnlinkedRequests = txListUnlinkedRequests.Exec(splitSqlListUnlinkedRequests, listArgsListUnlinkedRequests...)
 		} else {
-			errPersistence = txPersistence.Get(&v0Persistence, splitSqlPersistence, listArgsPersistence...)
+			errListUnlinkedRequests = txListUnlinkedRequests.Select(&v0ListUnlinkedRequests, splitSqlListUnlinkedRequests, listArgsListUnlinkedRequests...)
 		}
 
-		if errPersistence != nil {
-			return v0Persistence, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("Persistence"), splitSqlPersistence, errPersistence)
+		if errListUnlinkedRequests != nil {
+			return v0ListUnlinkedRequests, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("ListUnlinkedRequests"), splitSqlListUnlinkedRequests, errListUnlinkedRequests)
 		}
 	}
 
 	if !__imp.__withTx {
-		if errPersistence := txPersistence.Commit(); errPersistence != nil {
-			return v0Persistence, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("Persistence"), errPersistence)
+		if errListUnlinkedRequests := txListUnlinkedRequests.Commit(); errListUnlinkedRequests != nil {
+			return v0ListUnlinkedRequests, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("ListUnlinkedRequests"), errListUnlinkedRequests)
 		}
 	}
 
-	return v0Persistence, nil
+	return v0ListUnlinkedRequests, nil
 }
 
-func (__imp *implPersistence) ListRequests(n int64, chatOnly bool, predicate string) ([]*Request, error) {
+func (__imp *implPersistence) ListConversationTurns(id int64, replyHashList []string) ([]*conversationTurn, error) {
 	var (
-		v0ListRequests      []*Request
-		errListRequests     error
-		argListListRequests = make(__rt.Arguments, 0, 8)
+		v0ListConversationTurns  []*conversationTurn
+		errListConversationTurns error
 	)
 
-	__ListRequestsBindFunc := func(arg any) string {
-		argListListRequests = append(argListListRequests, arg)
-		return __rt.BindVars(len(__rt.MergeArgs(arg)))
+	queryListConversationTurns := "select id, conversation_id, conversation_turn, reply_hash from moonshot_requests where reply_hash in (:replyHashList) and conversation_id is not null and id != :id;\r\n"
+
+	txListConversationTurns, errListConversationTurns := __imp.__core.Beginx()
+	if errListConversationTurns != nil {
+		return v0ListConversationTurns, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("ListConversationTurns"), errListConversationTurns)
+	}
+	if !__imp.__withTx {
+		defer txListConversationTurns.Rollback()
 	}
-	sqlTmplListRequests := template.Must(template.New("ListRequests").Funcs(template.FuncMap{"bind": __ListRequestsBindFunc, "bindvars": __rt.BindVars, "fields": tableFields}).Parse("select * from ( select {{ fields \"response_body\" }}, iif( response_content_type = 'text/event-stream' and response_body is not null, merge_cmpl(response_body), response_body ) as response_body from moonshot_requests ) where 1 = 1 {{ if .chatOnly }} and request_path like '%/chat/completions' {{ end }} {{ if .predicate }} and ({{ .predicate }}) {{ end }} order by id desc {{ if .n }} limit {{ bind .n }} {{ end }} ;\r\n"))
 
-	sqlListRequests := __rt.GetBuffer()
-	defer __rt.PutBuffer(sqlListRequests)
-	defer sqlListRequests.Reset()
+	argsListConversationTurns := __rt.MergeNamedArgs(map[string]any{
+		"id":            id,
+		"replyHashList": replyHashList,
+	})
 
-	if errListRequests = sqlTmplListRequests.Execute(sqlListRequests, map[string]any{
-		"n":         n,
-		"chatOnly":  chatOnly,
-		"predicate": predicate,
-	}); errListRequests != nil {
-		return v0ListRequests, fmt.Errorf("error executing %s template: %w", strconv.Quote("ListRequests"), errListRequests)
+	sqlSliceListConversationTurns := __rt.Split(queryListConversationTurns, ";")
+	for indexListConversationTurns, splitSqlListConversationTurns := range sqlSliceListConversationTurns {
+		_ = indexListConversationTurns
+
+		var listArgsListConversationTurns []interface{}
+
+		splitSqlListConversationTurns, listArgsListConversationTurns, errListConversationTurns = sqlx.Named(splitSqlListConversationTurns, argsListConversationTurns)
+		if errListConversationTurns != nil {
+			return v0ListConversationTurns, fmt.Errorf("error building %s query: %w", strconv.Quote("ListConversationTurns"), errListConversationTurns)
+		}
+
+		splitSqlListConversationTurns, listArgsListConversationTurns, errListConversationTurns = sqlx.In(splitSqlListConversationTurns, listArgsListConversationTurns...)
+		if errListConversationTurns != nil {
+			return v0ListConversationTurns, fmt.Errorf("error building %s query: %w", strconv.Quote("ListConversationTurns"), errListConversationTurns)
+		}
+
+		if indexListConversationTurns < len(sqlSliceListConversationTurns)-1 {
+			_, errListConversationTurns = txListConversationTurns.Exec(splitSqlListConversationTurns, listArgsListConversationTurns...)
+		} else {
+			errListConversationTurns = txListConversationTurns.Select(&v0ListConversationTurns, splitSqlListConversationTurns, listArgsListConversationTurns...)
+		}
+
+		if errListConversationTurns != nil {
+			return v0ListConversationTurns, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("ListConversationTurns"), splitSqlListConversationTurns, errListConversationTurns)
+		}
 	}
 
-	queryListRequests := sqlListRequests.String()
+	if !__imp.__withTx {
+		if errListConversationTurns := txListConversationTurns.Commit(); errListConversationTurns != nil {
+			return v0ListConversationTurns, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("ListConversationTurns"), errListConversationTurns)
+		}
+	}
 
-	txListRequests, errListRequests := __imp.__core.Beginx()
-	if errListRequests != nil {
-		return v0ListRequests, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("ListRequests"), errListRequests)
+	return v0ListConversationTurns, nil
+}
+
+func (__imp *implPersistence) SetConversation(id int64, conversationID int64, conversationTurn int64, replyHash string) error {
+	var (
+		errSetConversation error
+	)
+
+	querySetConversation := "update moonshot_requests set conversation_id   = :conversationID, conversation_turn = :conversationTurn, reply_hash        = nullif(:replyHash, '') where id = :id;\r\n"
+
+	txSetConversation, errSetConversation := __imp.__core.Beginx()
+	if errSetConversation != nil {
+		return fmt.Errorf("error creating %s transaction: %w", strconv.Quote("SetConversation"), errSetConversation)
 	}
 	if !__imp.__withTx {
-		defer txListRequests.Rollback()
+		defer txSetConversation.Rollback()
 	}
 
-	offsetListRequests := 0
-	argsListRequests := __rt.MergeArgs(argListListRequests...)
+	argsSetConversation := __rt.MergeNamedArgs(map[string]any{
+		"id":               id,
+		"conversationID":   conversationID,
+		"conversationTurn": conversationTurn,
+		"replyHash":        replyHash,
+	})
 
-	sqlSliceListRequests := __rt.Split(queryListRequests, ";")
-	for indexListRequests, splitSqlListRequests := range sqlSliceListRequests {
-		_ = indexListRequests
+	sqlSliceSetConversation := __rt.Split(querySetConversation, ";")
+	for indexSetConversation, splitSqlSetConversation := range sqlSliceSetConversation {
+		_ = indexSetConversation
 
-		countListRequests := __rt.Count(splitSqlListRequests, "?")
+		var listArgsSetConversation []interface{}
 
-		if indexListRequests < len(sqlSliceListRequests)-1 {
-			_, errListRequests = txListRequests.Exec(splitSqlListRequests, argsListRequests[offsetListRequests:offsetListRequests+countListRequests]...)
-		} else {
-			errListRequests = txListRequests.Select(&v0ListRequests, splitSqlListRequests, argsListRequests[offsetListRequests:offsetListRequests+countListRequests]...)
+		splitSqlSetConversation, listArgsSetConversation, errSetConversation = sqlx.Named(splitSqlSetConversation, argsSetConversation)
+		if errSetConversation != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("SetConversation"), errSetConversation)
 		}
 
-		if errListRequests != nil {
-			return v0ListRequests, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("ListRequests"), splitSqlListRequests, errListRequests)
+		splitSqlSetConversation, listArgsSetConversation, errSetConversation = sqlx.In(splitSqlSetConversation, listArgsSetConversation...)
+		if errSetConversation != nil {
+			return fmt.Errorf("error building %s query: %w", strconv.Quote("SetConversation"), errSetConversation)
 		}
 
-		offsetListRequests += countListRequests
+		_, errSetConversation = txSetConversation.Exec(splitSqlSetConversation, listArgsSetConversation...)
+
+		if errSetConversation != nil {
+			return fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("SetConversation"), splitSqlSetConversation, errSetConversation)
+		}
 	}
 
 	if !__imp.__withTx {
-		if errListRequests := txListRequests.Commit(); errListRequests != nil {
-			return v0ListRequests, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("ListRequests"), errListRequests)
+		if errSetConversation := txSetConversation.Commit(); errSetConversation != nil {
+			return fmt.Errorf("error committing %s transaction: %w", strconv.Quote("SetConversation"), errSetConversation)
 		}
 	}
 
-	return v0ListRequests, nil
+	return nil
 }
 
-func (__imp *implPersistence) GetRequest(id int64, chatcmpl string, requestid string) (*Request, error) {
+func (__imp *implPersistence) ListConversation(conversationID int64) ([]*Request, error) {
 	var (
-		v0GetRequest  = new(Request)
-		errGetRequest error
+		v0ListConversation  []*Request
+		errListConversation error
 	)
 
-	sqlGetRequest := __rt.GetBuffer()
-	defer __rt.PutBuffer(sqlGetRequest)
-	defer sqlGetRequest.Reset()
+	sqlListConversation := __rt.GetBuffer()
+	defer __rt.PutBuffer(sqlListConversation)
+	defer sqlListConversation.Reset()
 
-	if errGetRequest = sqlTmplGetRequest.Execute(sqlGetRequest, map[string]any{
-		"id":        id,
-		"chatcmpl":  chatcmpl,
-		"requestid": requestid,
-	}); errGetRequest != nil {
-		return v0GetRequest, fmt.Errorf("error executing %s template: %w", strconv.Quote("GetRequest"), errGetRequest)
+	if errListConversation = sqlTmplListConversation.Execute(sqlListConversation, map[string]any{
+		"conversationID": conversationID,
+	}); errListConversation != nil {
+		return v0ListConversation, fmt.Errorf("error executing %s template: %w", strconv.Quote("ListConversation"), errListConversation)
 	}
 
-	queryGetRequest := sqlGetRequest.String()
+	queryListConversation := sqlListConversation.String()
 
-	txGetRequest, errGetRequest := __imp.__core.Beginx()
-	if errGetRequest != nil {
-		return v0GetRequest, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("GetRequest"), errGetRequest)
+	txListConversation, errListConversation := __imp.__core.Beginx()
+	if errListConversation != nil {
+		return v0ListConversation, fmt.Errorf("error creating %s transaction: %w", strconv.Quote("ListConversation"), errListConversation)
 	}
 	if !__imp.__withTx {
-		defer txGetRequest.Rollback()
+		defer txListConversation.Rollback()
 	}
 
-	argsGetRequest := __rt.MergeNamedArgs(map[string]any{
-		"id":        id,
-		"chatcmpl":  chatcmpl,
-		"requestid": requestid,
+	argsListConversation := __rt.MergeNamedArgs(map[string]any{
+		"conversationID": conversationID,
 	})
 
-	sqlSliceGetRequest := __rt.Split(queryGetRequest, ";")
-	for indexGetRequest, splitSqlGetRequest := range sqlSliceGetRequest {
-		_ = indexGetRequest
+	sqlSliceListConversation := __rt.Split(queryListConversation, ";")
+	for indexListConversation, splitSqlListConversation := range sqlSliceListConversation {
+		_ = indexListConversation
 
-		var listArgsGetRequest []interface{}
+		var listArgsListConversation []interface{}
 
-		splitSqlGetRequest, listArgsGetRequest, errGetRequest = sqlx.Named(splitSqlGetRequest, argsGetRequest)
-		if errGetRequest != nil {
-			return v0GetRequest, fmt.Errorf("error building %s query: %w", strconv.Quote("GetRequest"), errGetRequest)
+		splitSqlListConversation, listArgsListConversation, errListConversation = sqlx.Named(splitSqlListConversation, argsListConversation)
+		if errListConversation != nil {
+			return v0ListConversation, fmt.Errorf("error building %s query: %w", strconv.Quote("ListConversation"), errListConversation)
 		}
 
-		splitSqlGetRequest, listArgsGetRequest, errGetRequest = sqlx.In(splitSqlGetRequest, listArgsGetRequest...)
-		if errGetRequest != nil {
-			return v0GetRequest, fmt.Errorf("error building %s query: %w", strconv.Quote("GetRequest"), errGetRequest)
+		splitSqlListConversation, listArgsListConversation, errListConversation = sqlx.In(splitSqlListConversation, listArgsListConversation...)
+		if errListConversation != nil {
+			return v0ListConversation, fmt.Errorf("error building %s query: %w", strconv.Quote("ListConversation"), errListConversation)
 		}
 
-		if indexGetRequest < len(sqlSliceGetRequest)-1 {
-			_, errGetRequest = txGetRequest.Exec(splitSqlGetRequest, listArgsGetRequest...)
+		if indexListConversation < len(sqlSliceListConversation)-1 {
+			_, errListConversation = txListConversation.Exec(splitSqlListConversation, listArgsListConversation...)
 		} else {
-			errGetRequest = txGetRequest.Get(v0GetRequest, splitSqlGetRequest, listArgsGetRequest...)
+			errListConversation = txListConversation.Select(&v0ListConversation, splitSqlListConversation, listArgsListConversation...)
 		}
 
-		if errGetRequest != nil {
-			return v0GetRequest, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("GetRequest"), splitSqlGetRequest, errGetRequest)
+		if errListConversation != nil {
+			return v0ListConversation, fmt.Errorf("error executing %s sql: \n\n%s\n\n%w", strconv.Quote("ListConversation"), splitSqlListConversation, errListConversation)
 		}
 	}
 
 	if !__imp.__withTx {
-		if errGetRequest := txGetRequest.Commit(); errGetRequest != nil {
-			return v0GetRequest, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("GetRequest"), errGetRequest)
+		if errListConversation := txListConversation.Commit(); errListConversation != nil {
+			return v0ListConversation, fmt.Errorf("error committing %s transaction: %w", strconv.Quote("ListConversation"), errListConversation)
 		}
 	}
 
-	return v0GetRequest, nil
+	return v0ListConversation, nil
 }
 
 func (__imp *implPersistence) SetCache(ctx context.Context, cacheID string, hash string, nBytes int, kIdent string, createdAt string) error {
@@ -954,6 +3857,55 @@ func (__imp *implPersistence) RemoveInactiveCaches(kIdent string, before string)
 	return v0RemoveInactiveCaches, nil
 }
 
+func NewPersistenceFromTx(core *sqlx.Tx) Persistence {
+	tx := &txPersistence{
+		Tx: core,
+	}
+	return &implPersistence{
+		__withTx: true,
+		__core:   tx,
+	}
+}
+
+type txPersistence struct {
+	*sqlx.Tx
+}
+
+func (tx *txPersistence) Beginx() (*sqlx.Tx, error) {
+	return tx.Tx, nil
+}
+
+func (tx *txPersistence) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	return tx.Tx, nil
+}
+
+func (__imp *implPersistence) WithTx(ctx context.Context, f func(Persistence) error) error {
+	inner, err := __imp.__core.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error creating transaction in %s: %w", strconv.Quote("WithTx"), err)
+	}
+
+	defer inner.Rollback()
+
+	core := &txPersistence{
+		Tx: inner,
+	}
+
+	tx := __imp.Clone()
+	tx.(interface{ SetWithTx(withTx bool) }).SetWithTx(true)
+	tx.(interface{ SetCore(core any) }).SetCore(core)
+
+	if err = f(tx); err != nil {
+		return err
+	}
+
+	if err = inner.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction in %s: %w", strconv.Quote("WithTx"), err)
+	}
+
+	return nil
+}
+
 type PersistenceCoreInterface interface {
 	Beginx() (*sqlx.Tx, error)
 	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
@@ -32,9 +32,34 @@ func init() {
 			if err := conn.RegisterFunc("merge_cmpl", mergeCompletion, true); err != nil {
 				return err
 			}
+			if err := conn.RegisterFunc("compress", sqliteCompress, true); err != nil {
+				return err
+			}
+			if err := conn.RegisterFunc("decompress", sqliteDecompress, true); err != nil {
+				return err
+			}
+			// encrypt is not deterministic, since a random nonce is used.
+			if err := conn.RegisterFunc("encrypt", sqliteEncrypt, false); err != nil {
+				return err
+			}
+			if err := conn.RegisterFunc("decrypt", sqliteDecrypt, true); err != nil {
+				return err
+			}
+			if err := conn.RegisterFunc("encrypted", sqliteEncrypted, true); err != nil {
+				return err
+			}
 			if err := conn.RegisterFunc("regexp", sqliteRegexp, true); err != nil {
 				return err
 			}
+			if err := conn.RegisterFunc("fts_messages", fullTextMessages, true); err != nil {
+				return err
+			}
+			if err := conn.RegisterFunc("fts_output", fullTextOutput, true); err != nil {
+				return err
+			}
+			if err := conn.RegisterFunc("fts_rank", fullTextRank, true); err != nil {
+				return err
+			}
 			return nil
 		},
 	})
@@ -42,72 +67,31 @@ func init() {
 		sqlDriver,
 		"file:"+getPalaceSqlite(),
 	)
-	var err error
-	if err = persistence.createTable(); err != nil {
-		logFatal(err)
-	}
-	tableInfos, err = persistence.inspectTable()
-	if err != nil {
-		logFatal(err)
-	}
-	for _, alter := range alterFuncs {
-		if err = alter(tableInfos); err != nil {
-			logFatal(err)
-		}
-	}
+	parser.FullTextTable = fullTextTable
 }
 
-var alterFuncs = []func([]*tableInfo) error{
-	addTTFTField,
-	addTPOTField,
-	addOTPSField,
-	addLatencyField,
-	addEndpointField,
-}
-
-func addTTFTField(tableInfos []*tableInfo) error {
-	for _, info := range tableInfos {
-		if info.Name == "response_ttft" {
-			return nil
-		}
-	}
-	return persistence.addTTFTField()
-}
-
-func addTPOTField(tableInfos []*tableInfo) error {
-	for _, info := range tableInfos {
-		if info.Name == "response_tpot" {
-			return nil
-		}
+// preparePersistence brings the database up to date before it is used by a
+// command.
+func preparePersistence() error {
+	// An invalid encryption key is reported before any request is captured.
+	if _, err := getFieldCipher(); err != nil {
+		return err
 	}
-	return persistence.addTPOTField()
-}
-
-func addOTPSField(tableInfos []*tableInfo) error {
-	for _, info := range tableInfos {
-		if info.Name == "response_otps" {
-			return nil
-		}
+	if _, err := migrate(); err != nil {
+		return err
 	}
-	return persistence.addOTPSField()
-}
-
-func addLatencyField(tableInfos []*tableInfo) error {
-	for _, info := range tableInfos {
-		if info.Name == "latency" {
-			return nil
-		}
+	var err error
+	if tableInfos, err = persistence.inspectTable(); err != nil {
+		return err
 	}
-	return persistence.addLatencyField()
-}
-
-func addEndpointField(tableInfos []*tableInfo) error {
-	for _, info := range tableInfos {
-		if info.Name == "endpoint" {
-			return nil
-		}
+	// The full-text table depends on the module which the binary is built with,
+	// it is not created by migrations so that binaries built with different
+	// modules can share the database.
+	if err = persistence.createFullTextTable(); err != nil {
+		return err
 	}
-	return persistence.addEndpointField()
+	// Rows inserted by binaries with another full-text module are indexed here.
+	return persistence.indexNewRequests()
 }
 
 type tableInfo struct {
@@ -138,7 +122,7 @@ func tableFields(exclude ...string) (fields string) {
 }
 
 //go:generate python3 updateln.py
-//go:generate defc generate --features sqlx/future --func fields=tableFields
+//go:generate defc generate --features sqlx/future --func fields=tableFields --func fts=fullTextPart --func body=referencesBody
 type Persistence interface {
 	// createTable exec const
 	/*
@@ -169,6 +153,14 @@ type Persistence interface {
 	       response_otps          real,
 	       latency                integer,
 	       endpoint               text,
+	       request_hash           text,
+	       response_timing        text,
+	       retry_of               integer,
+	       k_ident                text,
+	       cost                   real,
+	       conversation_id        integer,
+	       conversation_turn      integer,
+	       reply_hash             text,
 	       created_at             text    default (datetime('now', 'localtime')) not null
 	   );
 	   create table if not exists moonshot_caches
@@ -190,6 +182,27 @@ type Persistence interface {
 	// pragma table_info(moonshot_requests);
 	inspectTable() ([]*tableInfo, error)
 
+	// createMigrationTable exec const
+	/*
+	   create table if not exists schema_migrations
+	   (
+	       version                integer not null
+	           constraint schema_migrations_pk
+	               primary key,
+	       name                   text    not null,
+	       applied_at             text    default (datetime('now', 'localtime')) not null
+	   );
+	*/
+	createMigrationTable() error
+
+	// ListMigrations query many const
+	// select version, name, applied_at from schema_migrations order by version;
+	ListMigrations() ([]*schemaMigration, error)
+
+	// addMigration exec named const
+	// insert into schema_migrations (version, name) values (:version, :name);
+	addMigration(version int64, name string) error
+
 	// addTTFTField exec
 	// alter table moonshot_requests add response_ttft integer;
 	addTTFTField() error
@@ -210,10 +223,342 @@ type Persistence interface {
 	// alter table moonshot_requests add endpoint text;
 	addEndpointField() error
 
+	// addRequestHashField exec
+	// alter table moonshot_requests add request_hash text;
+	addRequestHashField() error
+
+	// addResponseTimingField exec
+	// alter table moonshot_requests add response_timing text;
+	addResponseTimingField() error
+
+	// addRetryOfField exec
+	// alter table moonshot_requests add retry_of integer;
+	addRetryOfField() error
+
+	// addKIdentField exec
+	// alter table moonshot_requests add k_ident text;
+	addKIdentField() error
+
+	// addCostField exec
+	// alter table moonshot_requests add cost real;
+	addCostField() error
+
+	// addConversationIDField exec
+	// alter table moonshot_requests add conversation_id integer;
+	addConversationIDField() error
+
+	// addConversationTurnField exec
+	// alter table moonshot_requests add conversation_turn integer;
+	addConversationTurnField() error
+
+	// addReplyHashField exec
+	// alter table moonshot_requests add reply_hash text;
+	addReplyHashField() error
+
+	// addImportedIDField exec
+	// alter table moonshot_requests add imported_id integer;
+	addImportedIDField() error
+
+	// addAttemptField exec
+	// alter table moonshot_requests add attempt integer;
+	addAttemptField() error
+
+	// addMoonshotIDIndex exec
+	// create index if not exists moonshot_requests_moonshot_id_index on moonshot_requests (moonshot_id);
+	addMoonshotIDIndex() error
+
+	// addMoonshotRequestIDIndex exec
+	// create index if not exists moonshot_requests_moonshot_request_id_index on moonshot_requests (moonshot_request_id);
+	addMoonshotRequestIDIndex() error
+
+	// addCreatedAtIndex exec
+	// create index if not exists moonshot_requests_created_at_index on moonshot_requests (created_at);
+	addCreatedAtIndex() error
+
+	// addRequestHashIndex exec
+	// create index if not exists moonshot_requests_request_hash_index on moonshot_requests (request_hash);
+	addRequestHashIndex() error
+
+	// addConversationIDIndex exec
+	// create index if not exists moonshot_requests_conversation_id_index on moonshot_requests (conversation_id);
+	addConversationIDIndex() error
+
+	// addReplyHashIndex exec
+	// create index if not exists moonshot_requests_reply_hash_index on moonshot_requests (reply_hash);
+	addReplyHashIndex() error
+
+	// addRequestIDIndex exec
+	// create index if not exists moonshot_requests_request_id_index on moonshot_requests (request_id, attempt) where attempt is not null;
+	addRequestIDIndex() error
+
+	// createAnnotationTables exec
+	/*
+	   create table if not exists moonshot_annotations
+	   (
+	       request_id             integer not null
+	           constraint moonshot_annotations_pk
+	               primary key,
+	       category               text,
+	       note                   text,
+	       created_at             text    default (datetime('now', 'localtime')) not null,
+	       updated_at             text
+	   );
+	   create table if not exists moonshot_tags
+	   (
+	       request_id             integer not null,
+	       tag                    text    not null,
+	       created_at             text    default (datetime('now', 'localtime')) not null,
+	       constraint moonshot_tags_pk
+	           primary key (request_id, tag)
+	   );
+	   create index if not exists moonshot_tags_tag_index on moonshot_tags (tag);
+	*/
+	createAnnotationTables() error
+
 	// Cleanup exec named const
 	// delete from moonshot_requests where created_at < :before;
 	Cleanup(before string) (sql.Result, error)
 
+	// SetImportedID exec named const
+	// update moonshot_requests set imported_id = :importedID where id = :id;
+	SetImportedID(id int64, importedID int64) error
+
+	// FindImportedRequest query one named const
+	/*
+	   select id
+	   from moonshot_requests
+	   where imported_id = :importedID
+	     and created_at = :createdAt
+	     and request_method = :requestMethod
+	     and request_path = :requestPath
+	   order by id
+	   limit 1;
+	*/
+	FindImportedRequest(importedID int64, createdAt string, requestMethod string, requestPath string) (int64, error)
+
+	// WithTx runs the queries of fn in one transaction, which is rolled back if
+	// fn returns an error.
+	WithTx(ctx context.Context, fn func(Persistence) error) error
+
+	// SetCategory exec named const
+	/*
+	   insert into moonshot_annotations (request_id, category)
+	   values (:id, nullif(:category, ''))
+	   on conflict (request_id) do update
+	   set category   = excluded.category,
+	       updated_at = datetime('now', 'localtime');
+	*/
+	SetCategory(id int64, category string) error
+
+	// SetNote exec named const
+	/*
+	   insert into moonshot_annotations (request_id, note)
+	   values (:id, nullif(:note, ''))
+	   on conflict (request_id) do update
+	   set note       = excluded.note,
+	       updated_at = datetime('now', 'localtime');
+	*/
+	SetNote(id int64, note string) error
+
+	// AddTag exec named const
+	// insert or ignore into moonshot_tags (request_id, tag) values (:id, :tag);
+	AddTag(id int64, tag string) error
+
+	// RemoveTag exec named const
+	// delete from moonshot_tags where request_id = :id and tag = :tag;
+	RemoveTag(id int64, tag string) error
+
+	// ClearAnnotations exec named const
+	/*
+	   delete from moonshot_annotations where request_id = :id;
+	   delete from moonshot_tags where request_id = :id;
+	*/
+	ClearAnnotations(id int64) error
+
+	// CleanupAnnotations exec const
+	/*
+	   delete from moonshot_annotations where request_id not in (select id from moonshot_requests);
+	   delete from moonshot_tags where request_id not in (select id from moonshot_requests);
+	*/
+	CleanupAnnotations() error
+
+	// DeleteRequests exec bind
+	/*
+	   delete from moonshot_requests
+	   where id in (
+	       select id
+	       from (
+	           select
+	               {{ fields "request_header" "request_body" "response_header" "response_body" }},
+	               decrypt(request_header) as request_header,
+	               decrypt(response_header) as response_header,
+	               decompress(request_body) as request_body,
+	               iif(
+	                   response_content_type = 'text/event-stream' and response_body is not null,
+	                   merge_cmpl(decompress(response_body)),
+	                   decompress(response_body)
+	               ) as response_body,
+	           coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category,
+	           coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note,
+	           (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags
+	           from moonshot_requests
+	           where 1 = 1
+	             {{ if .before }}
+	             and created_at < {{ bind .before }}
+	             {{ end }}
+	             {{ if .beforeID }}
+	             and id < {{ bind .beforeID }}
+	             {{ end }}
+	           order by id
+	           {{ if body .predicate }}
+	           limit -1
+	           {{ end }}
+	       )
+	       where 1 = 1
+	         {{ if .predicate }}
+	         and ({{ .predicate }})
+	         {{ end }}
+	       {{ if .n }}
+	       limit {{ bind .n }}
+	       {{ end }}
+	   );
+	*/
+	DeleteRequests(before string, beforeID int64, predicate string, n int64) (sql.Result, error)
+
+	// DropBodies exec bind
+	/*
+	   update moonshot_requests
+	   set request_body  = null,
+	       response_body = null
+	   where id in (
+	       select id
+	       from (
+	           select
+	               {{ fields "request_header" "request_body" "response_header" "response_body" }},
+	               decrypt(request_header) as request_header,
+	               decrypt(response_header) as response_header,
+	               decompress(request_body) as request_body,
+	               iif(
+	                   response_content_type = 'text/event-stream' and response_body is not null,
+	                   merge_cmpl(decompress(response_body)),
+	                   decompress(response_body)
+	               ) as response_body,
+	           coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category,
+	           coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note,
+	           (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags
+	           from moonshot_requests
+	           where created_at < {{ bind .before }}
+	             and (request_body is not null or response_body is not null)
+	           {{ if body .predicate }}
+	           limit -1
+	           {{ end }}
+	       )
+	       where 1 = 1
+	         {{ if .predicate }}
+	         and ({{ .predicate }})
+	         {{ end }}
+	       {{ if .n }}
+	       limit {{ bind .n }}
+	       {{ end }}
+	   );
+	*/
+	DropBodies(before string, predicate string, n int64) (sql.Result, error)
+
+	// NthLatestRequestID query one named const
+	// select id from moonshot_requests order by id desc limit 1 offset :offset;
+	NthLatestRequestID(offset int64) (int64, error)
+
+	// CountRequests query one const
+	// select count(*) from moonshot_requests;
+	CountRequests() (int64, error)
+
+	// databaseUsage query one const
+	/*
+	   select (page_count - freelist_count) * page_size
+	   from pragma_page_count(), pragma_freelist_count(), pragma_page_size();
+	*/
+	databaseUsage() (int64, error)
+
+	// CompactRequests exec const
+	/*
+	   update moonshot_requests
+	   set request_body  = iif(typeof(request_body) = 'text', compress(request_body), request_body),
+	       response_body = iif(typeof(response_body) = 'text', compress(response_body), response_body)
+	   where typeof(request_body) = 'text'
+	      or typeof(response_body) = 'text';
+	*/
+	CompactRequests() (sql.Result, error)
+
+	// EncryptRequests exec const
+	/*
+	   update moonshot_requests
+	   set request_header  = encrypt(request_header),
+	       request_body    = encrypt(iif(typeof(request_body) = 'text', compress(request_body), request_body)),
+	       response_header = encrypt(response_header),
+	       response_body   = encrypt(iif(typeof(response_body) = 'text', compress(response_body), response_body))
+	   where (request_header is not null and not encrypted(request_header))
+	      or (request_body is not null and not encrypted(request_body))
+	      or (response_header is not null and not encrypted(response_header))
+	      or (response_body is not null and not encrypted(response_body));
+	*/
+	EncryptRequests() (sql.Result, error)
+
+	// createFullTextTable exec
+	// create virtual table if not exists {{ fts "table" }} using {{ fts "module" }};
+	createFullTextTable() error
+
+	// IndexRequest exec bind
+	/*
+	   insert into {{ fts "table" }} (rowid, messages, output)
+	   select
+	       id,
+	       iif(encrypted(request_body), '', fts_messages(coalesce(decompress(request_body), ''))),
+	       iif(
+	           encrypted(response_body),
+	           '',
+	           fts_output(coalesce(decompress(response_body), ''), coalesce(response_content_type, ''))
+	       )
+	   from moonshot_requests
+	   where id = {{ bind .id }}
+	     and request_path like '%/chat/completions'
+	   ;
+	*/
+	IndexRequest(id int64) error
+
+	// indexNewRequests exec
+	/*
+	   insert into {{ fts "table" }} (rowid, messages, output)
+	   select
+	       id,
+	       iif(encrypted(request_body), '', fts_messages(coalesce(decompress(request_body), ''))),
+	       iif(
+	           encrypted(response_body),
+	           '',
+	           fts_output(coalesce(decompress(response_body), ''), coalesce(response_content_type, ''))
+	       )
+	   from moonshot_requests
+	   where id > (select coalesce(max(rowid), 0) from {{ fts "table" }})
+	     and request_path like '%/chat/completions'
+	   ;
+	*/
+	indexNewRequests() error
+
+	// ClearFullTextIndex exec
+	// delete from {{ fts "table" }};
+	ClearFullTextIndex() error
+
+	// CleanupFullTextIndex exec
+	/*
+	   delete from {{ fts "table" }}
+	   where rowid not in (
+	       select id
+	       from moonshot_requests
+	       where request_body is not null
+	          or response_body is not null
+	   );
+	*/
+	CleanupFullTextIndex() error
+
 	// Persistence query one named
 	/*
 	   insert into moonshot_requests (
@@ -240,6 +585,12 @@ type Persistence interface {
 	       {{ if .responseOTPS }},response_otps{{ end }}
 	       {{ if .latency }},latency{{ end }}
 	       {{ if .endpoint }},endpoint{{ end }}
+	       {{ if .requestHash }},request_hash{{ end }}
+	       {{ if .responseTiming }},response_timing{{ end }}
+	       {{ if .attempt }},attempt{{ end }}
+	       {{ if gt .attempt 1 }},retry_of{{ end }}
+	       {{ if .kIdent }},k_ident{{ end }}
+	       {{ if .costKnown }},cost{{ end }}
 	   ) values (
 	       :requestMethod,
 	       :requestPath,
@@ -264,6 +615,19 @@ type Persistence interface {
 	       {{ if .responseOTPS }},:responseOTPS{{ end }}
 	       {{ if .latency }},:latency{{ end }}
 	       {{ if .endpoint }},:endpoint{{ end }}
+	       {{ if .requestHash }},:requestHash{{ end }}
+	       {{ if .responseTiming }},:responseTiming{{ end }}
+	       {{ if .attempt }},:attempt{{ end }}
+	       {{ if gt .attempt 1 }}
+	       ,(
+	           select max(id)
+	           from moonshot_requests
+	           where request_id = :requestID
+	             and attempt = :attempt - 1
+	       )
+	       {{ end }}
+	       {{ if .kIdent }},:kIdent{{ end }}
+	       {{ if .costKnown }},:cost{{ end }}
 	   );
 	*/
 	// select last_insert_rowid();
@@ -280,10 +644,10 @@ type Persistence interface {
 		moonshotServerTiming int,
 		responseStatusCode int,
 		responseContentType string,
-		requestHeader string,
-		requestBody string,
-		responseHeader string,
-		responseBody string,
+		requestHeader []byte,
+		requestBody []byte,
+		responseHeader []byte,
+		responseBody []byte,
 		programError string,
 		responseTTFT int,
 		responseTPOT int,
@@ -291,6 +655,12 @@ type Persistence interface {
 		createdAt string,
 		latency time.Duration,
 		endpoint string,
+		requestHash string,
+		responseTiming string,
+		attempt int,
+		kIdent string,
+		cost float64,
+		costKnown bool,
 	) (pid int64, err error)
 
 	// ListRequests query many bind
@@ -298,13 +668,58 @@ type Persistence interface {
 	   select *
 	   from (
 	       select
-	           {{ fields "response_body" }},
+	           {{ fields "request_header" "request_body" "response_header" "response_body" }},
+	           decrypt(request_header) as request_header,
+	           decrypt(response_header) as response_header,
+	           decompress(request_body) as request_body,
+	           iif(
+	               response_content_type = 'text/event-stream' and response_body is not null,
+	               merge_cmpl(decompress(response_body)),
+	               decompress(response_body)
+	           ) as response_body,
+	       coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category,
+	       coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note,
+	       (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags
+	       from moonshot_requests
+	       where 1 = 1
+	         {{ if .chatOnly }}
+	         and request_path like '%/chat/completions'
+	         {{ end }}
+	       order by id desc
+	       {{ if body .predicate }}
+	       limit -1
+	       {{ end }}
+	   )
+	   where 1 = 1
+	     {{ if .predicate }}
+	     and ({{ .predicate }})
+	     {{ end }}
+	   {{ if .n }}
+	   limit {{ bind .n }}
+	   {{ end }}
+	   ;
+	*/
+	ListRequests(n int64, chatOnly bool, predicate string) ([]*Request, error)
+
+	// TailRequests query many bind
+	/*
+	   select *
+	   from (
+	       select
+	           {{ fields "request_header" "request_body" "response_header" "response_body" }},
+	           decrypt(request_header) as request_header,
+	           decrypt(response_header) as response_header,
+	           decompress(request_body) as request_body,
 	           iif(
 	               response_content_type = 'text/event-stream' and response_body is not null,
-	               merge_cmpl(response_body),
-	               response_body
-	           ) as response_body
+	               merge_cmpl(decompress(response_body)),
+	               decompress(response_body)
+	           ) as response_body,
+	       coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category,
+	       coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note,
+	       (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags
 	       from moonshot_requests
+	       where id > {{ bind .after }}
 	   )
 	   where 1 = 1
 	     {{ if .chatOnly }}
@@ -313,17 +728,115 @@ type Persistence interface {
 	     {{ if .predicate }}
 	     and ({{ .predicate }})
 	     {{ end }}
-	   order by id desc
+	   order by id
+	   ;
+	*/
+	TailRequests(after int64, chatOnly bool, predicate string) ([]*Request, error)
+
+	// LatestRequestID query one const
+	// select coalesce(max(id), 0) from moonshot_requests;
+	LatestRequestID() (int64, error)
+
+	// ListStats query many bind
+	/*
+	   select
+	       id,
+	       request_path,
+	       moonshot_gid,
+	       response_status_code,
+	       error,
+	       response_ttft,
+	       latency,
+	       moonshot_server_timing,
+	       cost,
+	       created_at,
+	       iif(json_valid(request_body), json_extract(request_body, '$.model'), null) as model,
+	       iif(
+	           json_valid(response_body),
+	           coalesce(json_extract(response_body, '$.usage'), json_extract(response_body, '$.choices[0].usage')),
+	           null
+	       ) as usage
+	   from (
+	       select
+	           {{ fields "request_header" "request_body" "response_header" "response_body" }},
+	           decrypt(request_header) as request_header,
+	           decrypt(response_header) as response_header,
+	           decompress(request_body) as request_body,
+	           iif(
+	               response_content_type = 'text/event-stream' and response_body is not null,
+	               merge_cmpl(decompress(response_body)),
+	               decompress(response_body)
+	           ) as response_body,
+	       coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category,
+	       coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note,
+	       (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags
+	       from moonshot_requests
+	       where created_at >= {{ bind .since }}
+	         {{ if .until }}
+	         and created_at < {{ bind .until }}
+	         {{ end }}
+	         {{ if .chatOnly }}
+	         and request_path like '%/chat/completions'
+	         {{ end }}
+	       order by id
+	       limit -1
+	   )
+	   where 1 = 1
+	     {{ if .predicate }}
+	     and ({{ .predicate }})
+	     {{ end }}
+	   ;
+	*/
+	ListStats(since string, until string, chatOnly bool, predicate string) ([]*statsRow, error)
+
+	// SearchRequests query many bind
+	/*
+	   select
+	       r.id,
+	       r.request_path,
+	       r.moonshot_id,
+	       r.moonshot_request_id,
+	       r.response_status_code,
+	       r.created_at,
+	       iif(json_valid(r.request_body), json_extract(r.request_body, '$.model'), null) as model,
+	       {{ fts "rank" }} as rank,
+	       {{ fts "snippet" }} as snippet
+	   from {{ fts "table" }}
+	   join (
+	       select
+	           {{ fields "request_header" "request_body" "response_header" "response_body" }},
+	           decrypt(request_header) as request_header,
+	           decrypt(response_header) as response_header,
+	           decompress(request_body) as request_body,
+	           iif(
+	               response_content_type = 'text/event-stream' and response_body is not null,
+	               merge_cmpl(decompress(response_body)),
+	               decompress(response_body)
+	           ) as response_body,
+	       coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category,
+	       coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note,
+	       (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags
+	       from moonshot_requests
+	   ) as r on r.id = {{ fts "table" }}.rowid
+	   where {{ if .column }}{{ .column }}{{ else }}{{ fts "table" }}{{ end }} match {{ bind .query }}
+	     {{ if .predicate }}
+	     and ({{ .predicate }})
+	     {{ end }}
+	   order by rank
 	   {{ if .n }}
 	   limit {{ bind .n }}
 	   {{ end }}
 	   ;
 	*/
-	ListRequests(n int64, chatOnly bool, predicate string) ([]*Request, error)
+	SearchRequests(query string, column string, n int64, predicate string) ([]*searchRow, error)
 
 	// GetRequest query one named
 	/*
-	   select *
+	   select
+	       *,
+	       coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category,
+	       coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note,
+	       (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags
 	   from moonshot_requests
 	   where 1 = 1
 	     {{ if .id }}
@@ -343,6 +856,114 @@ type Persistence interface {
 		requestid string,
 	) (*Request, error)
 
+	// GetRequestByHash query one named const
+	/*
+	   select *
+	   from moonshot_requests
+	   where request_hash = :hash
+	     and response_status_code = 200
+	   order by id desc
+	   limit 1;
+	*/
+	GetRequestByHash(hash string) (*Request, error)
+
+	// GetRequestByModel query one named const
+	/*
+	   select *
+	   from moonshot_requests
+	   where request_path like '%/chat/completions'
+	     and response_status_code = 200
+	     and json_valid(decompress(request_body))
+	     and json_extract(decompress(request_body), '$.model') = :model
+	   order by id desc
+	   limit 1;
+	*/
+	GetRequestByModel(model string) (*Request, error)
+
+	// ListUnhashedRequests query many const
+	/*
+	   select id, decompress(request_body) as request_body
+	   from moonshot_requests
+	   where request_hash is null
+	     and request_body is not null
+	     and request_path like '%/chat/completions';
+	*/
+	ListUnhashedRequests() ([]*unhashedRequest, error)
+
+	// SetRequestHash exec named const
+	// update moonshot_requests set request_hash = :hash where id = :id;
+	SetRequestHash(id int64, hash string) error
+
+	// ListUnlinkedRequests query many named
+	/*
+	   select
+	       id,
+	       decompress(request_body) as request_body,
+	       iif(
+	           response_content_type = 'text/event-stream' and response_body is not null,
+	           merge_cmpl(decompress(response_body)),
+	           decompress(response_body)
+	       ) as response_body
+	   from moonshot_requests
+	   where conversation_id is null
+	     and request_body is not null
+	     and request_path like '%/chat/completions'
+	     {{ if .skipAttempts }}
+	     and not exists (
+	         select 1
+	         from moonshot_requests as next_attempt
+	         where next_attempt.request_id = moonshot_requests.request_id
+	           and next_attempt.attempt = moonshot_requests.attempt + 1
+	     )
+	     {{ end }}
+	   order by id;
+	*/
+	ListUnlinkedRequests(skipAttempts bool) ([]*unlinkedRequest, error)
+
+	// ListConversationTurns query many named const
+	/*
+	   select id, conversation_id, conversation_turn, reply_hash
+	   from moonshot_requests
+	   where reply_hash in (:replyHashList)
+	     and conversation_id is not null
+	     and id != :id;
+	*/
+	ListConversationTurns(id int64, replyHashList []string) ([]*conversationTurn, error)
+
+	// SetConversation exec named const
+	/*
+	   update moonshot_requests
+	   set conversation_id   = :conversationID,
+	       conversation_turn = :conversationTurn,
+	       reply_hash        = nullif(:replyHash, '')
+	   where id = :id;
+	*/
+	SetConversation(id int64, conversationID int64, conversationTurn int64, replyHash string) error
+
+	// ListConversation query many named
+	/*
+	   select *
+	   from (
+	       select
+	           {{ fields "request_header" "request_body" "response_header" "response_body" }},
+	           decrypt(request_header) as request_header,
+	           decrypt(response_header) as response_header,
+	           decompress(request_body) as request_body,
+	           iif(
+	               response_content_type = 'text/event-stream' and response_body is not null,
+	               merge_cmpl(decompress(response_body)),
+	               decompress(response_body)
+	           ) as response_body,
+	       coalesce((select category from moonshot_annotations where request_id = moonshot_requests.id), '') as category,
+	       coalesce((select note from moonshot_annotations where request_id = moonshot_requests.id), '') as note,
+	       (select json_group_array(tag) from moonshot_tags where request_id = moonshot_requests.id) as tags
+	       from moonshot_requests
+	       where conversation_id = :conversationID
+	   )
+	   order by id;
+	*/
+	ListConversation(conversationID int64) ([]*Request, error)
+
 	// SetCache exec named const
 	/*
 	   insert into moonshot_caches (
@@ -407,10 +1028,10 @@ type Request struct {
 	MoonshotServerTiming sql.NullInt64   `db:"moonshot_server_timing"`
 	ResponseStatusCode   sql.NullInt64   `db:"response_status_code"`
 	ResponseContentType  sql.NullString  `db:"response_content_type"`
-	RequestHeader        sql.NullString  `db:"request_header"`
-	RequestBody          sql.NullString  `db:"request_body"`
-	ResponseHeader       sql.NullString  `db:"response_header"`
-	ResponseBody         sql.NullString  `db:"response_body"`
+	RequestHeader        Header          `db:"request_header"`
+	RequestBody          Body            `db:"request_body"`
+	ResponseHeader       Header          `db:"response_header"`
+	ResponseBody         Body            `db:"response_body"`
 	ResponseTTFT         sql.NullInt64   `db:"response_ttft"`
 	ResponseTPOT         sql.NullInt64   `db:"response_tpot"`
 	ResponseOTPS         sql.NullFloat64 `db:"response_otps"`
@@ -418,15 +1039,27 @@ type Request struct {
 	CreatedAt            SqliteTime      `db:"created_at"`
 	Latency              sql.NullInt64   `db:"latency"`
 	Endpoint             sql.NullString  `db:"endpoint"`
+	RequestHash          sql.NullString  `db:"request_hash"`
+	ResponseTiming       sql.NullString  `db:"response_timing"`
+	RetryOf              sql.NullInt64   `db:"retry_of"`
+	Attempt              sql.NullInt64   `db:"attempt"`
+	KIdent               sql.NullString  `db:"k_ident"`
+	Cost                 sql.NullFloat64 `db:"cost"`
+	ConversationID       sql.NullInt64   `db:"conversation_id"`
+	ConversationTurn     sql.NullInt64   `db:"conversation_turn"`
+	ReplyHash            sql.NullString  `db:"reply_hash"`
+	ImportedID           sql.NullInt64   `db:"imported_id"`
 
-	// Extra Fields
+	// Annotations
 
-	Category string   `db:"-"`
-	Tags     []string `db:"-"`
+	Category string `db:"category"`
+	Note     string `db:"note"`
+	Tags     Tags   `db:"tags"`
 }
 
 func (r *Request) MarshalJSON() ([]byte, error) {
 	type RequestMarshaler struct {
+		Method string `json:"method"`
 		Url    string `json:"url"`
 		Header string `json:"header"`
 		Body   any    `json:"body"`
@@ -443,10 +1076,12 @@ func (r *Request) MarshalJSON() ([]byte, error) {
 		Error    string             `json:"error,omitempty"`
 		Category string             `json:"category,omitempty"`
 		Tags     []string           `json:"tags,omitempty"`
+		Note     string             `json:"note,omitempty"`
 	}
 	return json.Marshal(&Marshaler{
 		Metadata: r.Metadata(),
 		Request: &RequestMarshaler{
+			Method: r.RequestMethod,
 			Url:    r.Url(),
 			Header: r.RequestHeader.String,
 			Body:   marshalBody(r.RequestBody.String),
@@ -459,6 +1094,7 @@ func (r *Request) MarshalJSON() ([]byte, error) {
 		Error:    r.Error.String,
 		Category: r.Category,
 		Tags:     r.Tags,
+		Note:     r.Note,
 	})
 }
 
@@ -551,6 +1187,25 @@ func (r *Request) Metadata() (metadata map[string]string) {
 	if r.Endpoint.Valid {
 		metadata["endpoint"] = r.Endpoint.String
 	}
+	if r.RetryOf.Valid {
+		metadata["retry_of"] = strconv.FormatInt(r.RetryOf.Int64, 10)
+	}
+	if r.Attempt.Valid {
+		metadata["attempt"] = strconv.FormatInt(r.Attempt.Int64, 10)
+	}
+	if r.KIdent.Valid {
+		metadata["k_ident"] = r.KIdent.String
+	}
+	if r.Cost.Valid {
+		metadata["cost"] = formatCost(r.Cost.Float64)
+	}
+	if r.ConversationID.Valid {
+		metadata["conversation_id"] = strconv.FormatInt(r.ConversationID.Int64, 10)
+		metadata["conversation_turn"] = strconv.FormatInt(r.ConversationTurn.Int64, 10)
+	}
+	if r.ImportedID.Valid {
+		metadata["imported_id"] = strconv.FormatInt(r.ImportedID.Int64, 10)
+	}
 	return metadata
 }
 
@@ -642,6 +1297,49 @@ func (t *SqliteTime) Scan(src any) (err error) {
 	return nil
 }
 
+// Body is a column of bodies, which are decompressed when they are scanned.
+type Body struct {
+	sql.NullString
+}
+
+func (b *Body) Scan(src any) error {
+	if data, ok := src.([]byte); ok {
+		body, err := decompressBody(data)
+		if err != nil {
+			return err
+		}
+		src = string(body)
+	}
+	return b.NullString.Scan(src)
+}
+
+// Tags is a column of tags aggregated by json_group_array.
+type Tags []string
+
+func (t *Tags) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot convert type %T to tags", src)
+	}
+	var tags []string
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		tags = nil
+	}
+	*t = tags
+	return nil
+}
+
 func mergeCompletion(data string) string {
 	completion := completionPool.Get().(map[string]any)
 	defer putCompletion(completion)
@@ -702,6 +1400,16 @@ func (p Predicates) Parse() (string, error) {
 	return sqlBuilder.String(), nil
 }
 
+// referencesBody reports whether the parsed predicate refers to request_body or
+// response_body. SQLite flattens the subquery of ListRequests, and then bodies
+// are decompressed and merged for each reference in the predicate, so the
+// subquery is kept from being flattened by a limit when the predicate refers to
+// bodies, and bodies are decompressed and merged once for each row. Otherwise,
+// only the bodies of the returned rows are decompressed and merged.
+func referencesBody(predicate string) bool {
+	return strings.Contains(predicate, "request_body") || strings.Contains(predicate, "response_body")
+}
+
 func sqliteRegexp(pat string, val string) bool {
 	match, _ := regexp.MatchString(pat, val)
 	return match
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/x5iu/defc/sqlx"
+
+	"github.com/MoonshotAI/moonpalace/storage"
+)
+
+// benchmarkRows is the number of synthetic requests in the benchmark database,
+// half of them are event streams and one in every fifty of them failed.
+const benchmarkRows = 1000000
+
+var (
+	benchmarkDir  string
+	benchmarkOnce sync.Once
+	benchmarkErr  error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if benchmarkDir != "" {
+		os.RemoveAll(benchmarkDir)
+	}
+	os.Exit(code)
+}
+
+// usePersistenceForTest replaces persistence with an empty database which is
+// removed after the test.
+func usePersistenceForTest(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db := openPersistenceForTest(t)
+	if err := preparePersistence(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// openPersistenceForTest is like usePersistenceForTest, but leaves the database
+// without any tables.
+func openPersistenceForTest(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Open(sqlDriver, "file:"+filepath.Join(t.TempDir(), "moonpalace.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, previousTableInfos := persistence, tableInfos
+	t.Cleanup(func() {
+		db.Close()
+		persistence, tableInfos = previous, previousTableInfos
+	})
+	persistence = NewPersistenceFromDB(db)
+	return db
+}
+
+// storeTestRequest stores a chat completions request which succeeded with the
+// response body, event streams are told apart by the "data:" prefix.
+func storeTestRequest(t *testing.T, requestBody string, responseBody string) int64 {
+	t.Helper()
+	contentType := "application/json"
+	if strings.HasPrefix(responseBody, "data:") {
+		contentType = "text/event-stream"
+	}
+	id, err := (sqliteStorage{}).Store(&storage.Record{
+		RequestMethod:       "POST",
+		RequestPath:         "/v1/chat/completions",
+		RequestContentType:  "application/json",
+		RequestBody:         []byte(requestBody),
+		ResponseStatusCode:  200,
+		ResponseContentType: contentType,
+		ResponseBody:        []byte(responseBody),
+		RequestHash:         hashRequest([]byte(requestBody)),
+		CreatedAt:           time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// usePersistenceForBenchmark replaces persistence with the benchmark database,
+// which is created once and shared by all benchmarks.
+func usePersistenceForBenchmark(b *testing.B) {
+	b.Helper()
+	benchmarkOnce.Do(func() {
+		if benchmarkDir, benchmarkErr = os.MkdirTemp("", "moonpalace-benchmark-"); benchmarkErr != nil {
+			return
+		}
+		var db *sqlx.DB
+		db, benchmarkErr = sqlx.Open(sqlDriver, "file:"+filepath.Join(benchmarkDir, "moonpalace.sqlite"))
+		if benchmarkErr != nil {
+			return
+		}
+		persistence = NewPersistenceFromDB(db)
+		if _, benchmarkErr = migrate(); benchmarkErr != nil {
+			return
+		}
+		if tableInfos, benchmarkErr = persistence.inspectTable(); benchmarkErr != nil {
+			return
+		}
+		_, benchmarkErr = db.Exec(`
+with recursive c(i) as (select 1 union all select i + 1 from c where i < ?)
+insert into moonshot_requests (
+    request_method,
+    request_path,
+    request_query,
+    moonshot_id,
+    moonshot_request_id,
+    response_status_code,
+    response_content_type,
+    request_body,
+    response_body,
+    created_at
+)
+select
+    'POST',
+    '/v1/chat/completions',
+    '',
+    'chatcmpl-' || i,
+    'request-' || i,
+    iif(i % 50 = 0, 500, 200),
+    iif(i % 2 = 0, 'text/event-stream', 'application/json'),
+    '{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hello ' || i || '"}]}',
+    iif(
+        i % 2 = 0,
+        'data: {"id":"chatcmpl-' || i || '","choices":[{"index":0,"delta":{"role":"assistant","content":"hi"}}]}' ||
+            char(10) || char(10) ||
+            'data: {"id":"chatcmpl-' || i || '","choices":[{"index":0,"delta":{"content":" there"},"finish_reason":"stop"}]}' ||
+            char(10) || char(10) ||
+            'data: [DONE]',
+        '{"id":"chatcmpl-' || i || '","choices":[{"index":0,"message":{"role":"assistant","content":"hi there"},"finish_reason":"stop"}]}'
+    ),
+    datetime('2024-01-01', '+' || (i * 10) || ' seconds')
+from c;
+`, benchmarkRows)
+	})
+	if benchmarkErr != nil {
+		b.Fatal(benchmarkErr)
+	}
+}
+
+func BenchmarkListRequests(b *testing.B) {
+	usePersistenceForBenchmark(b)
+	benchmarks := []struct {
+		name       string
+		n          int64
+		chatOnly   bool
+		predicates Predicates
+	}{
+		{"Latest", 10, false, nil},
+		{"ChatOnly", 10, true, nil},
+		{"Status", 10, false, Predicates{"response_status_code == 500"}},
+		{"RequestBody", 10, false, Predicates{"request_body.model == 'moonshot-v1-8k'"}},
+		{"ResponseBody", 10, false, Predicates{"response_body.choices.0.finish_reason == 'stop'"}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			predicate, err := bm.predicates.Parse()
+			if err != nil {
+				b.Fatal(err)
+			}
+			for i := 0; i < b.N; i++ {
+				requests, err := persistence.ListRequests(bm.n, bm.chatOnly, predicate)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if int64(len(requests)) != bm.n {
+					b.Fatalf("expected %d requests, got %d", bm.n, len(requests))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetRequest(b *testing.B) {
+	usePersistenceForBenchmark(b)
+	id := strconv.Itoa(benchmarkRows / 2)
+	b.Run("ChatCmpl", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := persistence.GetRequest(0, "chatcmpl-"+id, ""); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("RequestID", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := persistence.GetRequest(0, "", "request-"+id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkCleanup(b *testing.B) {
+	usePersistenceForBenchmark(b)
+	for i := 0; i < b.N; i++ {
+		// Nothing is deleted, so that the rows are kept for other benchmarks.
+		if _, err := persistence.Cleanup("2024-01-01"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStoreCost(t *testing.T) {
+	usePersistenceForTest(t)
+	var (
+		free  = 0.0
+		price = 0.012
+	)
+	var testcases = []struct {
+		name string
+		cost *float64
+		want sql.NullFloat64
+	}{
+		{name: "unknown", cost: nil, want: sql.NullFloat64{}},
+		{name: "free", cost: &free, want: sql.NullFloat64{Float64: 0, Valid: true}},
+		{name: "priced", cost: &price, want: sql.NullFloat64{Float64: 0.012, Valid: true}},
+	}
+	for _, testcase := range testcases {
+		id, err := (sqliteStorage{}).Store(&storage.Record{
+			RequestMethod: "GET",
+			RequestPath:   "/v1/models",
+			Cost:          testcase.cost,
+			CreatedAt:     time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		request, err := persistence.GetRequest(id, "", "")
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		if request.Cost != testcase.want {
+			t.Errorf("%s: want cost %v, got %v", testcase.name, testcase.want, request.Cost)
+		}
+	}
+}
+
+func TestStoreAttempts(t *testing.T) {
+	usePersistenceForTest(t)
+	store := func(requestID string, attempt int) int64 {
+		id, err := (sqliteStorage{}).Store(&storage.Record{
+			RequestID:          requestID,
+			RequestMethod:      "POST",
+			RequestPath:        "/v1/chat/completions",
+			ResponseStatusCode: 429,
+			Attempt:            attempt,
+			CreatedAt:          time.Now(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	var (
+		first  = store("moonpalace-1", 1)
+		other  = store("moonpalace-2", 1)
+		second = store("moonpalace-1", 2)
+		last   = store("moonpalace-1", 3)
+		single = store("moonpalace-3", 0)
+		orphan = store("moonpalace-4", 2)
+	)
+	var testcases = []struct {
+		name    string
+		id      int64
+		attempt int64
+		retryOf int64
+	}{
+		{name: "first attempt", id: first, attempt: 1},
+		{name: "attempt of another request", id: other, attempt: 1},
+		{name: "second attempt", id: second, attempt: 2, retryOf: first},
+		{name: "last attempt", id: last, attempt: 3, retryOf: second},
+		{name: "not retried", id: single},
+		{name: "previous attempt not stored", id: orphan, attempt: 2},
+	}
+	for _, testcase := range testcases {
+		request, err := persistence.GetRequest(testcase.id, "", "")
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		if request.Attempt.Int64 != testcase.attempt || request.RetryOf.Int64 != testcase.retryOf {
+			t.Errorf("%s: want attempt %d retry_of %d, got attempt %v retry_of %v",
+				testcase.name, testcase.attempt, testcase.retryOf, request.Attempt, request.RetryOf)
+		}
+	}
+}
@@ -54,7 +54,9 @@ func (t *Tree) String() string {
 							panic("unreachable")
 						}
 					}
+					fullTextHack(itemExpr)
 					likeHack(itemExpr)
+					tagHack(itemExpr)
 					matchHack(itemExpr)
 					lit, isNull := itemExpr.Right.(*LiteralExpr)
 					pushExpr(itemExpr.Left)
@@ -238,6 +240,114 @@ func likeHack(expr *BinaryExpr) {
 	}
 }
 
+// FullTextTable is the full-text index searched by the ~~ operator. Its
+// messages and output columns can be searched separately, content searches
+// both of them.
+var FullTextTable = "moonshot_requests_fts"
+
+func fullTextHack(expr *BinaryExpr) {
+	var (
+		likes   int
+		negated bool
+	)
+	for _, op := range expr.Op {
+		switch op.Type {
+		case LIKE:
+			likes++
+		case NOT:
+			negated = true
+		}
+	}
+	if likes == 2 {
+		fld, fldOk := expr.Left.(*FieldsExpr)
+		lit, litOk := expr.Right.(*LiteralExpr)
+		if fldOk && litOk && lit.Type == String && len(fld.Fields) == 1 {
+			column := makeLHS(fld)
+			if column == "content" {
+				column = FullTextTable
+			}
+			in := "in"
+			if negated {
+				in = "not in"
+			}
+			// The same hack as matchHack, the subquery is closed along with the
+			// literal.
+			expr.Left = &Ident{Name: fmt.Sprintf("id %s (select rowid from %s where %s", in, FullTextTable, column)}
+			expr.Op = []*OperatorType{Like, Like}
+			lit.Type = Boolean
+			lit.Value = fmt.Sprintf("'%s')", lit.Value)
+		}
+	}
+}
+
+// TagTable stores the tags of requests, one row for each tag. A request has a
+// tag if any of its tags matches the tag predicate.
+var TagTable = "moonshot_tags"
+
+func tagHack(expr *BinaryExpr) {
+	fld, fldOk := expr.Left.(*FieldsExpr)
+	if !fldOk || len(fld.Fields) != 1 || makeLHS(fld) != "tag" {
+		return
+	}
+	var (
+		op      *OperatorType
+		negated bool
+	)
+	for _, o := range expr.Op {
+		switch o.Type {
+		case NOT:
+			negated = true
+		case EQUAL, LIKE, MATCH, IN:
+			op = o
+		}
+	}
+	var ops []*OperatorType
+	switch op {
+	case Equal:
+		ops = []*OperatorType{Equal, Equal}
+	case Like, Match, In:
+		ops = []*OperatorType{op}
+	default:
+		return
+	}
+	// The same hack as fullTextHack, the subquery is closed along with the last
+	// literal. Tags are strings, so only string literals are accepted.
+	var lits []*LiteralExpr
+	switch right := expr.Right.(type) {
+	case *LiteralExpr:
+		if op != In {
+			lits = []*LiteralExpr{right}
+		}
+	case *LiteralListExpr:
+		if op == In {
+			lits = right.List
+		}
+	}
+	if len(lits) == 0 {
+		return
+	}
+	for _, lit := range lits {
+		if lit.Type != String {
+			return
+		}
+	}
+	for _, lit := range lits {
+		lit.Type = Boolean
+		if op == Match {
+			lit.Value = fmt.Sprintf("cast('%s' as text)", lit.Value)
+		} else {
+			lit.Value = fmt.Sprintf("'%s'", lit.Value)
+		}
+	}
+	lits[len(lits)-1].Value += ")"
+	in := "in"
+	if negated {
+		in = "not in"
+	}
+	expr.Left = &Ident{Name: fmt.Sprintf("id %s (select request_id from %s where tag", in, TagTable)}
+	expr.Op = ops
+}
+
 func matchHack(expr *BinaryExpr) {
 	var isMatch bool
 	for _, op := range expr.Op {
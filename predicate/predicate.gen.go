@@ -79,7 +79,7 @@ const predicateEofCode = 1
 const predicateErrCode = 2
 const predicateInitialStackSize = 16
 
-//line predicate.y:217
+//line predicate.y:233
 
 //line yacctab:1
 var predicateExca = [...]int8{
@@ -90,65 +90,65 @@ var predicateExca = [...]int8{
 
 const predicatePrivate = 57344
 
-const predicateLast = 66
+const predicateLast = 70
 
 var predicateAct = [...]int8{
-	54, 53, 30, 49, 48, 61, 26, 27, 31, 43,
-	57, 55, 40, 25, 46, 42, 18, 51, 50, 38,
-	37, 24, 19, 20, 13, 14, 15, 16, 17, 4,
-	7, 29, 23, 9, 10, 22, 56, 45, 44, 9,
-	10, 32, 52, 33, 6, 34, 35, 36, 60, 3,
-	41, 60, 1, 62, 58, 47, 59, 39, 21, 2,
-	8, 63, 12, 28, 11, 5,
+	57, 56, 30, 50, 49, 65, 26, 27, 31, 44,
+	60, 58, 41, 25, 47, 43, 18, 61, 55, 53,
+	39, 23, 19, 20, 13, 14, 15, 16, 17, 52,
+	38, 24, 4, 29, 46, 22, 51, 37, 33, 7,
+	34, 35, 36, 9, 10, 45, 32, 6, 9, 10,
+	64, 3, 42, 64, 1, 66, 62, 59, 63, 54,
+	21, 40, 48, 2, 8, 67, 12, 28, 11, 5,
 }
 
 var predicatePact = [...]int16{
-	23, -1000, 20, -1000, 23, 11, -1000, -1000, 23, 16,
-	12, 14, -16, 28, 30, -2, -3, 49, -9, 25,
-	24, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
-	-10, 50, -21, -22, -4, -5, 34, -1000, -1000, -16,
-	-1000, -1000, -1000, -13, -1000, -1000, 31, -14, -1000, -1000,
-	-1000, -1000, -16, 47, -1000, -1000, -19, -1000, 44, -1000,
-	-16, -1000, -1000, -1000,
+	26, -1000, 29, -1000, 26, 11, -1000, -1000, 26, 16,
+	1, 24, -16, 33, 25, 15, -2, 53, -9, 32,
+	21, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-10, 57, -21, -22, 14, -3, 51, -1000, -4, -1000,
+	-16, -1000, -1000, -1000, -13, -1000, -1000, 52, -14, -1000,
+	-1000, -1000, -5, -1000, -16, -1000, 49, -1000, -1000, -19,
+	-1000, -1000, 46, -1000, -16, -1000, -1000, -1000,
 }
 
 var predicatePgo = [...]int8{
-	0, 65, 0, 31, 63, 1, 62, 60, 49, 59,
-	52,
+	0, 69, 0, 33, 67, 1, 66, 64, 51, 63,
+	54,
 }
 
 var predicateR1 = [...]int8{
 	0, 10, 9, 9, 8, 8, 8, 8, 8, 8,
-	8, 8, 8, 8, 6, 6, 6, 6, 6, 6,
-	7, 7, 5, 5, 2, 2, 2, 3, 3, 4,
-	4, 4, 1, 1, 1,
+	8, 8, 8, 8, 8, 8, 6, 6, 6, 6,
+	6, 6, 7, 7, 5, 5, 2, 2, 2, 3,
+	3, 4, 4, 4, 1, 1, 1,
 }
 
 var predicateR2 = [...]int8{
 	0, 2, 1, 3, 3, 3, 4, 4, 3, 4,
-	3, 4, 5, 6, 1, 1, 2, 2, 2, 2,
-	2, 2, 3, 1, 1, 1, 1, 1, 2, 1,
-	4, 3, 3, 3, 1,
+	4, 5, 3, 4, 5, 6, 1, 1, 2, 2,
+	2, 2, 2, 2, 3, 1, 1, 1, 1, 1,
+	2, 1, 4, 3, 3, 3, 1,
 }
 
 var predicateChk = [...]int16{
 	-1000, -10, -9, -8, 6, -1, 21, 10, -7, 19,
 	20, -9, -6, 13, 14, 15, 16, 17, 5, 11,
 	12, -8, 19, 20, 7, -2, 22, 23, -4, -3,
-	18, 24, 13, 13, 15, 16, 17, 22, 22, 8,
-	21, -3, 24, 18, 13, 13, 24, 5, 25, 25,
-	22, 22, 8, -5, -2, 24, 5, 24, -5, 9,
-	4, 24, 9, -2,
+	18, 24, 13, 13, 15, 16, 17, 22, 15, 22,
+	8, 21, -3, 24, 18, 13, 13, 24, 5, 25,
+	25, 22, 15, 22, 8, 22, -5, -2, 24, 5,
+	24, 22, -5, 9, 4, 24, 9, -2,
 }
 
 var predicateDef = [...]int8{
-	0, -2, 0, 2, 0, 0, 34, 1, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 0, 14,
-	15, 3, 20, 21, 4, 5, 24, 25, 26, 29,
-	0, 27, 18, 19, 0, 0, 0, 8, 10, 0,
-	32, 33, 27, 0, 16, 17, 28, 0, 6, 7,
-	9, 11, 0, 0, 23, 28, 0, 31, 0, 12,
-	0, 30, 13, 22,
+	0, -2, 0, 2, 0, 0, 36, 1, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 16,
+	17, 3, 22, 23, 4, 5, 26, 27, 28, 31,
+	0, 29, 20, 21, 0, 0, 0, 8, 0, 12,
+	0, 34, 35, 29, 0, 18, 19, 30, 0, 6,
+	7, 9, 0, 13, 0, 10, 0, 25, 30, 0,
+	33, 11, 0, 14, 0, 32, 15, 24,
 }
 
 var predicateTok1 = [...]int8{
@@ -580,8 +580,28 @@ predicatedefault:
 			}
 		}
 	case 10:
-		predicateDollar = predicateS[predicatept-3 : predicatept+1]
+		predicateDollar = predicateS[predicatept-4 : predicatept+1]
 //line predicate.y:99
+		{
+			predicateVAL.expr = &BinaryExpr{
+				Op:    []*OperatorType{predicateDollar[2].operator, predicateDollar[3].operator},
+				Left:  predicateDollar[1].fields,
+				Right: predicateDollar[4].lit,
+			}
+		}
+	case 11:
+		predicateDollar = predicateS[predicatept-5 : predicatept+1]
+//line predicate.y:107
+		{
+			predicateVAL.expr = &BinaryExpr{
+				Op:    []*OperatorType{predicateDollar[2].operator, predicateDollar[3].operator, predicateDollar[4].operator},
+				Left:  predicateDollar[1].fields,
+				Right: predicateDollar[5].lit,
+			}
+		}
+	case 12:
+		predicateDollar = predicateS[predicatept-3 : predicatept+1]
+//line predicate.y:115
 		{
 			predicateVAL.expr = &BinaryExpr{
 				Op:    []*OperatorType{predicateDollar[2].operator},
@@ -589,9 +609,9 @@ predicatedefault:
 				Right: predicateDollar[3].lit,
 			}
 		}
-	case 11:
+	case 13:
 		predicateDollar = predicateS[predicatept-4 : predicatept+1]
-//line predicate.y:107
+//line predicate.y:123
 		{
 			predicateVAL.expr = &BinaryExpr{
 				Op:    []*OperatorType{predicateDollar[2].operator, predicateDollar[3].operator},
@@ -599,9 +619,9 @@ predicatedefault:
 				Right: predicateDollar[4].lit,
 			}
 		}
-	case 12:
+	case 14:
 		predicateDollar = predicateS[predicatept-5 : predicatept+1]
-//line predicate.y:115
+//line predicate.y:131
 		{
 			predicateVAL.expr = &BinaryExpr{
 				Op:    []*OperatorType{predicateDollar[2].operator},
@@ -609,9 +629,9 @@ predicatedefault:
 				Right: predicateDollar[4].lits,
 			}
 		}
-	case 13:
+	case 15:
 		predicateDollar = predicateS[predicatept-6 : predicatept+1]
-//line predicate.y:123
+//line predicate.y:139
 		{
 			predicateVAL.expr = &BinaryExpr{
 				Op:    []*OperatorType{predicateDollar[2].operator, predicateDollar[3].operator},
@@ -619,102 +639,102 @@ predicatedefault:
 				Right: predicateDollar[5].lits,
 			}
 		}
-	case 14:
+	case 16:
 		predicateDollar = predicateS[predicatept-1 : predicatept+1]
-//line predicate.y:133
+//line predicate.y:149
 		{
 			predicateVAL.operators = []*OperatorType{predicateDollar[1].operator}
 		}
-	case 15:
+	case 17:
 		predicateDollar = predicateS[predicatept-1 : predicatept+1]
-//line predicate.y:137
+//line predicate.y:153
 		{
 			predicateVAL.operators = []*OperatorType{predicateDollar[1].operator}
 		}
-	case 16:
+	case 18:
 		predicateDollar = predicateS[predicatept-2 : predicatept+1]
-//line predicate.y:141
+//line predicate.y:157
 		{
 			predicateVAL.operators = []*OperatorType{predicateDollar[1].operator, predicateDollar[2].operator}
 		}
-	case 17:
+	case 19:
 		predicateDollar = predicateS[predicatept-2 : predicatept+1]
-//line predicate.y:145
+//line predicate.y:161
 		{
 			predicateVAL.operators = []*OperatorType{predicateDollar[1].operator, predicateDollar[2].operator}
 		}
-	case 18:
+	case 20:
 		predicateDollar = predicateS[predicatept-2 : predicatept+1]
-//line predicate.y:149
+//line predicate.y:165
 		{
 			predicateVAL.operators = []*OperatorType{predicateDollar[1].operator, predicateDollar[2].operator}
 		}
-	case 19:
+	case 21:
 		predicateDollar = predicateS[predicatept-2 : predicatept+1]
-//line predicate.y:153
+//line predicate.y:169
 		{
 			predicateVAL.operators = []*OperatorType{predicateDollar[1].operator, predicateDollar[2].operator}
 		}
-	case 20:
+	case 22:
 		predicateDollar = predicateS[predicatept-2 : predicatept+1]
-//line predicate.y:159
+//line predicate.y:175
 		{
 			predicateVAL.operators = []*OperatorType{predicateDollar[1].operator, predicateDollar[2].operator}
 		}
-	case 21:
+	case 23:
 		predicateDollar = predicateS[predicatept-2 : predicatept+1]
-//line predicate.y:163
+//line predicate.y:179
 		{
 			predicateVAL.operators = []*OperatorType{predicateDollar[1].operator, predicateDollar[2].operator}
 		}
-	case 22:
+	case 24:
 		predicateDollar = predicateS[predicatept-3 : predicatept+1]
-//line predicate.y:169
+//line predicate.y:185
 		{
 			predicateVAL.lits.List = append(predicateDollar[1].lits.List, predicateDollar[3].lit)
 		}
-	case 23:
+	case 25:
 		predicateDollar = predicateS[predicatept-1 : predicatept+1]
-//line predicate.y:173
+//line predicate.y:189
 		{
 			predicateVAL.lits.List = []*LiteralExpr{predicateDollar[1].lit}
 		}
-	case 28:
+	case 30:
 		predicateDollar = predicateS[predicatept-2 : predicatept+1]
-//line predicate.y:185
+//line predicate.y:201
 		{
 			predicateDollar[2].lit.Value = "-" + predicateDollar[2].lit.Value
 			predicateVAL.lit = predicateDollar[2].lit
 		}
-	case 30:
+	case 32:
 		predicateDollar = predicateS[predicatept-4 : predicatept+1]
-//line predicate.y:193
+//line predicate.y:209
 		{
 			predicateDollar[2].lit.Value = "-" + predicateDollar[2].lit.Value + "." + predicateDollar[4].lit.Value
 			predicateVAL.lit = predicateDollar[2].lit
 		}
-	case 31:
+	case 33:
 		predicateDollar = predicateS[predicatept-3 : predicatept+1]
-//line predicate.y:198
+//line predicate.y:214
 		{
 			predicateDollar[1].lit.Value = predicateDollar[1].lit.Value + "." + predicateDollar[3].lit.Value
 			predicateVAL.lit = predicateDollar[1].lit
 		}
-	case 32:
+	case 34:
 		predicateDollar = predicateS[predicatept-3 : predicatept+1]
-//line predicate.y:205
+//line predicate.y:221
 		{
 			predicateVAL.fields.Fields = append(predicateDollar[1].fields.Fields, predicateDollar[3].ident)
 		}
-	case 33:
+	case 35:
 		predicateDollar = predicateS[predicatept-3 : predicatept+1]
-//line predicate.y:209
+//line predicate.y:225
 		{
 			predicateVAL.fields.Fields = append(predicateDollar[1].fields.Fields, predicateDollar[3].lit)
 		}
-	case 34:
+	case 36:
 		predicateDollar = predicateS[predicatept-1 : predicatept+1]
-//line predicate.y:213
+//line predicate.y:229
 		{
 			predicateVAL.fields.Fields = append(predicateVAL.fields.Fields, predicateDollar[1].ident)
 		}
@@ -330,6 +330,11 @@ func toOperator(operators []*OperatorType, isNull bool) string {
 				}
 				return "="
 			}
+		case Like:
+			switch op2 {
+			case Like:
+				return "match"
+			}
 		case Not:
 			switch op2 {
 			case Equal:
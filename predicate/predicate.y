@@ -95,6 +95,22 @@ expr:
             Right: $4,
         }
     }
+|   fields LIKE LIKE STRING
+    {
+        $$ = &BinaryExpr{
+            Op:    []*OperatorType{$2, $3},
+            Left:  $1,
+            Right: $4,
+        }
+    }
+|   fields NOT LIKE LIKE STRING
+    {
+        $$ = &BinaryExpr{
+            Op:    []*OperatorType{$2, $3, $4},
+            Left:  $1,
+            Right: $5,
+        }
+    }
 |   fields MATCH STRING
     {
         $$ = &BinaryExpr{
@@ -79,6 +79,38 @@ func TestParse(t *testing.T) {
 				predicate: "response_body !% '^data.*$'",
 				want:      "response_body is not null and response_body not regexp cast('^data.*$' as text)",
 			},
+			{
+				predicate: "messages ~~ 'timeout'",
+				want:      "id in (select rowid from moonshot_requests_fts where messages match 'timeout')",
+			},
+			{
+				predicate: "content ~~ 'connection NEAR timeout'",
+				want:      "id in (select rowid from moonshot_requests_fts where moonshot_requests_fts match 'connection NEAR timeout')",
+			},
+			{
+				predicate: "output !~~ 'sorry' && response_status_code == 200",
+				want:      "id not in (select rowid from moonshot_requests_fts where output match 'sorry') and response_status_code = 200",
+			},
+			{
+				predicate: "tag == 'python'",
+				want:      "id in (select request_id from moonshot_tags where tag = 'python')",
+			},
+			{
+				predicate: "tag !~ 'py*' && category == 'badcase'",
+				want:      "id not in (select request_id from moonshot_tags where tag like 'py%') and category = 'badcase'",
+			},
+			{
+				predicate: "tag @ ['python', 'go']",
+				want:      "id in (select request_id from moonshot_tags where tag in ('python', 'go'))",
+			},
+			{
+				predicate: "tag !@ ['python']",
+				want:      "id not in (select request_id from moonshot_tags where tag in ('python'))",
+			},
+			{
+				predicate: "tag % '^py'",
+				want:      "id in (select request_id from moonshot_tags where tag regexp cast('^py' as text))",
+			},
 			{
 				predicate: "response_status_code @ [400, 401, '403', 404, false]",
 				want:      "response_status_code in (400, 401, '403', 404, false)",
@@ -129,6 +161,8 @@ func TestParse(t *testing.T) {
 			"response_status_code @ (400, 401)",
 			"response_status_code @ [401, '403', null, false]",
 			"response_header ~ 'pytest''",
+			"messages ~~ 200",
+			"messages ~~~ 'timeout'",
 		}
 		for i, predicate := range predicates {
 			t.Run(strconv.Itoa(i+1), func(t *testing.T) {
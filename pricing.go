@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+)
+
+// PriceConfig is the price of a model per million tokens, cached tokens are
+// charged at the input price unless Cached is set.
+type PriceConfig struct {
+	Model  string   `yaml:"model"`
+	Input  float64  `yaml:"input"`
+	Output float64  `yaml:"output"`
+	Cached *float64 `yaml:"cached"`
+}
+
+func validatePricing(pricing []*PriceConfig) error {
+	for i, price := range pricing {
+		if price == nil {
+			continue
+		}
+		if price.Model == "" {
+			return fmt.Errorf("pricing[%d]: model is required", i)
+		}
+		if _, err := path.Match(price.Model, ""); err != nil {
+			return fmt.Errorf("pricing[%d]: invalid model pattern %q: %w", i, price.Model, err)
+		}
+	}
+	return nil
+}
+
+// computeCost returns the cost of the usage with the price of the first entry
+// matching the model, it returns false if no entry matches.
+func computeCost(pricing []*PriceConfig, model string, usage *MoonshotUsage) (float64, bool) {
+	if model == "" || usage == nil {
+		return 0, false
+	}
+	for _, price := range pricing {
+		if price == nil {
+			continue
+		}
+		if matched, _ := path.Match(price.Model, model); matched {
+			cachedPrice := price.Input
+			if price.Cached != nil {
+				cachedPrice = *price.Cached
+			}
+			// Cached tokens are counted in prompt tokens as well.
+			cost := float64(usage.PromptTokens-usage.CachedTokens)*price.Input +
+				float64(usage.CachedTokens)*cachedPrice +
+				float64(usage.CompletionTokens)*price.Output
+			return cost / 1e6, true
+		}
+	}
+	return 0, false
+}
+
+func formatCost(cost float64) string {
+	return fmt.Sprintf("%.6f", cost)
+}
+
+func formatCostCell(cost sql.NullFloat64) string {
+	if !cost.Valid {
+		return ""
+	}
+	return formatCost(cost.Float64)
+}
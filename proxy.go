@@ -25,15 +25,25 @@ import (
 	"github.com/tidwall/sjson"
 
 	"github.com/MoonshotAI/moonpalace/detector/repeat"
+	"github.com/MoonshotAI/moonpalace/keypool"
 	"github.com/MoonshotAI/moonpalace/merge"
+	"github.com/MoonshotAI/moonpalace/ratelimit"
+	"github.com/MoonshotAI/moonpalace/retry"
+	"github.com/MoonshotAI/moonpalace/storage"
 )
 
 type StartConfig struct {
 	Port         int16               `yaml:"port"`
 	Key          string              `yaml:"key"`
+	Keys         []*KeyConfig        `yaml:"keys"`
+	KeyStrategy  string              `yaml:"key-strategy"`
+	KeyCooldown  int                 `yaml:"key-cooldown"`
 	DetectRepeat *DetectRepeatConfig `yaml:"detect-repeat"`
 	ForceStream  bool                `yaml:"force-stream"`
 	AutoCache    *AutoCacheConfig    `yaml:"auto-cache"`
+	Mock         *MockConfig         `yaml:"mock"`
+	Retry        *RetryConfig        `yaml:"retry"`
+	Limit        *LimitConfig        `yaml:"limit"`
 }
 
 type DetectRepeatConfig struct {
@@ -66,6 +76,15 @@ var (
 		TTL:      defaultCacheTTL,
 		Cleanup:  defaultCacheCleanup,
 	}
+	// defaultRetryConfig is a sentinel variable used to detect whether the user
+	// has manually set the --retry option.
+	defaultRetryConfig = &RetryConfig{
+		Max:         &defaultRetryMaxValue,
+		On:          defaultRetryOn,
+		Backoff:     defaultRetryBackoff,
+		Interval:    defaultRetryInterval,
+		MaxInterval: defaultRetryMaxInterval,
+	}
 )
 
 func startCommand() *cobra.Command {
@@ -78,6 +97,15 @@ func startCommand() *cobra.Command {
 	if cfg.Port == 0 {
 		cfg.Port = defaultPort
 	}
+	if cfg.KeyStrategy == "" {
+		cfg.KeyStrategy = defaultKeyStrategy
+	}
+	if cfg.KeyCooldown == 0 {
+		cfg.KeyCooldown = defaultKeyCooldown
+	}
+	if cfg.Limit == nil {
+		cfg.Limit = &LimitConfig{}
+	}
 	if cfg.DetectRepeat == nil {
 		cfg.DetectRepeat = &DetectRepeatConfig{
 			Threshold: defaultRepeatThreshold,
@@ -104,18 +132,56 @@ func startCommand() *cobra.Command {
 			cfg.AutoCache.Cleanup = defaultCacheCleanup
 		}
 	}
+	if cfg.Retry == nil {
+		cfg.Retry = defaultRetryConfig
+	} else {
+		if cfg.Retry.Max == nil {
+			cfg.Retry.Max = &defaultRetryMaxValue
+		}
+		if len(cfg.Retry.On) == 0 {
+			cfg.Retry.On = defaultRetryOn
+		}
+		if cfg.Retry.Backoff == "" {
+			cfg.Retry.Backoff = defaultRetryBackoff
+		}
+		if cfg.Retry.Interval == 0 {
+			cfg.Retry.Interval = defaultRetryInterval
+		}
+		if cfg.Retry.MaxInterval == 0 {
+			cfg.Retry.MaxInterval = defaultRetryMaxInterval
+		}
+	}
 	var (
-		port            = cfg.Port
-		key             = cfg.Key
-		detectRepeat    = cfg.DetectRepeat != nil
-		repeatThreshold = cfg.DetectRepeat.Threshold
-		repeatMinLength = cfg.DetectRepeat.MinLength
-		forceStream     = cfg.ForceStream
-		autoCache       = cfg.AutoCache != defaultAutoCacheConfig
-		cacheMinBytes   = cfg.AutoCache.MinBytes
-		cacheTTL        = cfg.AutoCache.TTL
-		cacheCleanup    = cfg.AutoCache.Cleanup
+		port             = cfg.Port
+		key              = cfg.Key
+		keyStrategy      = cfg.KeyStrategy
+		keyCooldown      = cfg.KeyCooldown
+		detectRepeat     = cfg.DetectRepeat != nil
+		repeatThreshold  = cfg.DetectRepeat.Threshold
+		repeatMinLength  = cfg.DetectRepeat.MinLength
+		forceStream      = cfg.ForceStream
+		autoCache        = cfg.AutoCache != defaultAutoCacheConfig
+		cacheMinBytes    = cfg.AutoCache.MinBytes
+		cacheTTL         = cfg.AutoCache.TTL
+		cacheCleanup     = cfg.AutoCache.Cleanup
+		mock             bool
+		mockFixtures     string
+		mockPredicates   []string
+		enableRetry      = cfg.Retry != defaultRetryConfig
+		retryMax         = *cfg.Retry.Max
+		retryOn          = cfg.Retry.On
+		retryBackoff     = cfg.Retry.Backoff
+		retryInterval    = cfg.Retry.Interval
+		retryMaxInterval = cfg.Retry.MaxInterval
+		limitRPM         = cfg.Limit.RPM
+		limitTPM         = cfg.Limit.TPM
+		limitConcurrency = cfg.Limit.Concurrency
+		limitWait        = cfg.Limit.Wait
 	)
+	if cfg.Mock != nil {
+		mockFixtures = cfg.Mock.Fixtures
+		mockPredicates = cfg.Mock.Predicate
+	}
 	cmd := &cobra.Command{
 		Use:   "start",
 		Short: "Start the MoonPalace proxy server",
@@ -124,8 +190,57 @@ func startCommand() *cobra.Command {
 				syscall.SIGINT,
 				syscall.SIGTERM)
 			defer stop()
-			httpServer.Handler = http.HandlerFunc(buildProxy(
+			mock = mockEnabled(cfg.Mock, cmd)
+			prepareCapture()
+			defer closeStorages(storages)
+			upstream := endpoint
+			routes, err := normalizeRoutes(MoonConfig.Routes)
+			if err != nil {
+				logFatal(err)
+			}
+			retentionRules, err := newRetention(MoonConfig.Retention)
+			if err != nil {
+				logFatal(err)
+			}
+			// A key given on the command line takes precedence over the key pool.
+			var keyPool *keypool.Pool
+			if len(cfg.Keys) > 0 && !cmd.Flags().Changed("key") {
+				if keyPool, err = newKeyPool(cfg.Keys, keyStrategy, keyCooldown); err != nil {
+					logFatal(err)
+				}
+			}
+			limiter, err := newLimiter(&LimitConfig{
+				RPM:         limitRPM,
+				TPM:         limitTPM,
+				Concurrency: limitConcurrency,
+				Wait:        limitWait,
+			})
+			if err != nil {
+				logFatal(fmt.Errorf("limit: %w", err))
+			}
+			var retryPolicy *retry.Policy
+			if enableRetry {
+				if retryPolicy, err = newRetryPolicy(retryMax, retryOn, retryBackoff, retryInterval, retryMaxInterval); err != nil {
+					logFatal(err)
+				}
+			}
+			if mock {
+				fixtures, messages, err := loadMockFixtures(mockFixtures, mockPredicates)
+				if err != nil {
+					logFatal(err)
+				}
+				httpClient.Transport = newMockTransport(fixtures, messages)
+				upstream = mockEndpoint
+				routes = nil
+				// Caches are created on the real upstream, which is never reached in mock mode.
+				autoCache = false
+			}
+			httpServer.Handler = buildMux(http.HandlerFunc(buildProxy(
+				upstream,
+				routes,
 				key,
+				keyPool,
+				limiter,
 				detectRepeat,
 				repeatThreshold,
 				repeatMinLength,
@@ -134,7 +249,8 @@ func startCommand() *cobra.Command {
 				cacheMinBytes,
 				cacheTTL,
 				cacheCleanup,
-			))
+				retryPolicy,
+			)))
 			httpServer.Addr = "127.0.0.1:" + strconv.Itoa(int(port))
 			go func() {
 				if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -142,6 +258,9 @@ func startCommand() *cobra.Command {
 				}
 			}()
 			logServerStarts("http://" + httpServer.Addr + "/v1")
+			if retentionRules != nil {
+				go runRetention(ctx, retentionRules)
+			}
 			<-ctx.Done()
 			stop()
 			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -154,6 +273,8 @@ func startCommand() *cobra.Command {
 	flags := cmd.PersistentFlags()
 	flags.Int16VarP(&port, "port", "p", port, "port to listen on")
 	flags.StringVarP(&key, "key", "k", key, "API key by default")
+	flags.StringVar(&keyStrategy, "key-strategy", keyStrategy, "strategy to pick keys from the key pool, one of round-robin and least-loaded")
+	flags.IntVar(&keyCooldown, "key-cooldown", keyCooldown, "time in seconds to skip a key of the key pool after it gets a 429 response")
 	flags.BoolVar(&detectRepeat, "detect-repeat", detectRepeat, "detect and prevent repeating tokens in streaming output")
 	flags.Float64Var(&repeatThreshold, "repeat-threshold", repeatThreshold, "repeat threshold, a float between [0, 1]")
 	flags.Int32Var(&repeatMinLength, "repeat-min-length", repeatMinLength, "repeat min length, minimum string length to detect repeat")
@@ -162,9 +283,33 @@ func startCommand() *cobra.Command {
 	flags.IntVar(&cacheMinBytes, "cache-min-bytes", cacheMinBytes, "minimum size of bytes to cache")
 	flags.IntVar(&cacheTTL, "cache-ttl", cacheTTL, "time to live in seconds for cached requests")
 	flags.IntVar(&cacheCleanup, "cache-cleanup", cacheCleanup, "time in seconds to cleanup expired caches")
+	flags.BoolVar(&mock, "mock", mock, "answer chat completions requests from fixtures instead of the upstream")
+	flags.StringVar(&mockFixtures, "mock-fixtures", mockFixtures, "file or directory of exported requests used as mock fixtures, captured requests are used by default")
+	flags.StringArrayVar(&mockPredicates, "mock-predicate", mockPredicates, "predicate is used to select captured requests as mock fixtures")
+	flags.BoolVar(&enableRetry, "retry", enableRetry, "retry upstream requests failed with connection errors or retryable status codes")
+	flags.IntVar(&retryMax, "retry-max", retryMax, "maximum number of retries for each request")
+	flags.IntSliceVar(&retryOn, "retry-on", retryOn, "status codes to retry on")
+	flags.StringVar(&retryBackoff, "retry-backoff", retryBackoff, "backoff strategy between retries, one of constant, linear and exponential")
+	flags.IntVar(&retryInterval, "retry-interval", retryInterval, "base interval in milliseconds between retries")
+	flags.IntVar(&retryMaxInterval, "retry-max-interval", retryMaxInterval, "maximum interval in milliseconds between retries, Retry-After is capped as well")
+	flags.IntVar(&limitRPM, "limit-rpm", limitRPM, "maximum number of requests per minute sent to the upstream")
+	flags.IntVar(&limitTPM, "limit-tpm", limitTPM, "maximum number of tokens per minute sent to the upstream")
+	flags.IntVar(&limitConcurrency, "limit-concurrency", limitConcurrency, "maximum number of concurrent requests sent to the upstream")
+	flags.IntVar(&limitWait, "limit-wait", limitWait, "time in seconds requests over the limits may queue before they get a 429 response")
+	cmd.MarkPersistentFlagFilename("mock-fixtures")
 	return cmd
 }
 
+// buildMux serves metrics and the dashboard on the proxy's own mux, all other
+// requests are passed to the proxy.
+func buildMux(proxy http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metricsRegistry)
+	registerDashboard(mux)
+	mux.Handle("/", proxy)
+	return mux
+}
+
 var (
 	httpServer = &http.Server{
 		ReadHeaderTimeout: 1 * time.Minute,
@@ -252,7 +397,11 @@ func mergeIn(completion map[string]any, value []byte) {
 }
 
 func buildProxy(
+	upstream string,
+	routes []*RouteConfig,
 	key string,
+	keyPool *keypool.Pool,
+	limiter *ratelimit.Limiter,
 	detectRepeat bool,
 	repeatThreshold float64,
 	repeatMinLength int32,
@@ -261,6 +410,7 @@ func buildProxy(
 	cacheMinBytes int,
 	cacheTTL int,
 	cacheCleanup int,
+	retryPolicy *retry.Policy,
 ) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var (
@@ -273,6 +423,14 @@ func buildProxy(
 			requestUseStream          bool
 			requestBody               []byte
 			responseBody              []byte
+			responseTiming            []int
+			requestEndpoint           = upstream
+			requestKey                = key
+			requestAttempt            int
+			keyLease                  *keypool.Lease
+			limitReservations         []*ratelimit.Reservation
+			repeatDetected            bool
+			lengthWarned              bool
 			requestID                 = r.Header.Get("X-Request-Id")
 			requestContentType        = filterHeaderFlags(r.Header.Get("Content-Type"))
 			requestMethod             = r.Method
@@ -293,13 +451,23 @@ func buildProxy(
 			latency                   time.Duration
 			tokenFinishLatency        time.Duration
 		)
+		proxyActivity.begin()
 		defer func() {
 			go func() {
+				defer proxyActivity.end()
 				loggingMutex.Lock()
 				defer loggingMutex.Unlock()
 				if latency == 0 {
 					latency = time.Since(createdAt)
 				}
+				totalTokens := -1
+				if moonshot != nil && moonshot.Usage != nil {
+					totalTokens = moonshot.Usage.TotalTokens
+				}
+				releaseLimits(limitReservations, totalTokens)
+				if keyLease != nil {
+					keyLease.Release(responseStatusCode, max(totalTokens, 0))
+				}
 				var (
 					responseTPOT int
 					responseOTPS float64
@@ -329,6 +497,24 @@ func buildProxy(
 				} else {
 					responseHeader = make(http.Header)
 				}
+				var model string
+				if strings.HasSuffix(requestPath, "/chat/completions") {
+					model = gjson.GetBytes(requestBody, "model").String()
+				}
+				var (
+					cost      float64
+					costKnown bool
+					knownCost *float64
+				)
+				// Mocked responses cost nothing, which is known without pricing.
+				if requestEndpoint == mockEndpoint {
+					costKnown = true
+				} else if moonshot != nil {
+					cost, costKnown = computeCost(MoonConfig.Pricing, model, moonshot.Usage)
+				}
+				if costKnown {
+					knownCost = &cost
+				}
 				logRequest(
 					requestMethod,
 					requestPath,
@@ -350,37 +536,86 @@ func buildProxy(
 					warnings,
 					requestHeader,
 					responseHeader,
+					cost,
+					costKnown,
 				)
-				var lastInsertID int64
-				lastInsertID, err = persistence.Persistence(
-					requestID,
-					requestContentType,
+				recordMetrics(
 					requestMethod,
 					requestPath,
-					requestQuery,
-					moonshotID,
-					moonshotGID,
-					moonshotUID,
-					moonshotRequestID,
-					moonshotServerTiming,
 					responseStatusCode,
-					responseContentType,
-					formatHeader(newRequest),
-					string(requestBody),
-					formatHeader(newResponse),
-					string(responseBody),
-					toErrMsg(err),
+					model,
+					moonshot,
 					responseTTFT,
-					responseTPOT,
-					responseOTPS,
-					createdAt.Format(time.DateTime),
+					moonshotServerTiming,
 					latency,
-					endpoint,
+					repeatDetected,
+					lengthWarned,
+				)
+				var (
+					requestHash       string
+					responseTimingStr string
 				)
+				if strings.HasSuffix(requestPath, "/chat/completions") {
+					requestHash = hashRequest(requestBody)
+				}
+				if len(responseTiming) > 0 {
+					timingJSON, _ := json.Marshal(responseTiming)
+					responseTimingStr = string(timingJSON)
+				}
+				persistedRequestHeader, persistedRequestBody, persistedResponseHeader, persistedResponseBody :=
+					redactCapture(newRequest, requestBody, newResponse, responseBody)
+				var lastInsertID int64
+				lastInsertID, err = storeRecord(&storage.Record{
+					Source:               recordSource,
+					RequestID:            requestID,
+					RequestContentType:   requestContentType,
+					RequestMethod:        requestMethod,
+					RequestPath:          requestPath,
+					RequestQuery:         requestQuery,
+					MoonshotID:           moonshotID,
+					MoonshotGID:          moonshotGID,
+					MoonshotUID:          moonshotUID,
+					MoonshotRequestID:    moonshotRequestID,
+					MoonshotServerTiming: moonshotServerTiming,
+					ResponseStatusCode:   responseStatusCode,
+					ResponseContentType:  responseContentType,
+					RequestHeader:        persistedRequestHeader,
+					RequestBody:          persistedRequestBody,
+					ResponseHeader:       persistedResponseHeader,
+					ResponseBody:         persistedResponseBody,
+					Error:                toErrMsg(err),
+					ResponseTTFT:         responseTTFT,
+					ResponseTPOT:         responseTPOT,
+					ResponseOTPS:         responseOTPS,
+					Latency:              latency,
+					Endpoint:             requestEndpoint,
+					RequestHash:          requestHash,
+					ResponseTiming:       responseTimingStr,
+					Attempt:              requestAttempt,
+					KIdent:               kIdentOf(requestKey),
+					Cost:                 knownCost,
+					CreatedAt:            createdAt,
+				})
+				// The proxy keeps serving when the request can not be stored, such as
+				// when the database stays locked by retention.
 				if err != nil {
-					logFatal(err)
+					logStorageError(storage.TypeSQLite, err)
+				}
+				// Requests are only linked into conversations in the local SQLite
+				// database.
+				if lastInsertID != 0 {
+					if strings.HasSuffix(requestPath, "/chat/completions") {
+						linkedResponseBody := string(responseBody)
+						if responseContentType == "text/event-stream" {
+							linkedResponseBody = mergeCompletion(linkedResponseBody)
+						}
+						if err = linkConversation(lastInsertID, string(requestBody), linkedResponseBody); err != nil {
+							logStorageError(storage.TypeSQLite, err)
+						}
+					}
+					logNewRow(lastInsertID)
 				}
-				logNewRow(lastInsertID)
+				newRows.notify()
 			}()
 		}()
 		requestBody, err = io.ReadAll(r.Body)
@@ -404,10 +639,64 @@ func buildProxy(
 				requestBody = forceUseStream(requestBody, streamRequest.Stream != nil)
 			}
 		}
+		route := matchRoute(routes, gjson.GetBytes(requestBody, "model").String())
+		if route != nil {
+			requestEndpoint = route.Endpoint
+		}
+		var (
+			routeLimiter    *ratelimit.Limiter
+			estimatedTokens int
+		)
+		if route != nil {
+			routeLimiter = route.limiter
+		}
+		if strings.HasSuffix(requestPath, "/chat/completions") {
+			estimatedTokens = estimateTokens(requestBody)
+		}
+		limitReservations, err = acquireLimits(r.Context(), estimatedTokens, limiter, routeLimiter)
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			var limited *ratelimit.LimitedError
+			if errors.As(err, &limited) {
+				statusCode = http.StatusTooManyRequests
+				w.Header().Set("Retry-After", retryAfterSeconds(limited.RetryAfter))
+			}
+			writeProxyErrorCode(
+				encoder,
+				w.Header(),
+				w.WriteHeader,
+				statusCode,
+				stepRateLimit,
+				err,
+			)
+			return
+		}
+		switch {
+		case route != nil && route.Key != "":
+			requestKey = route.Key
+		case keyPool != nil:
+			keyLease, err = keyPool.Acquire()
+			if err != nil {
+				var unavailable *keypool.UnavailableError
+				if errors.As(err, &unavailable) {
+					w.Header().Set("Retry-After", retryAfterSeconds(unavailable.RetryAfter))
+				}
+				writeProxyErrorCode(
+					encoder,
+					w.Header(),
+					w.WriteHeader,
+					http.StatusTooManyRequests,
+					stepAcquireKey,
+					err,
+				)
+				return
+			}
+			requestKey = keyLease.Key()
+		}
 		newRequest, err = http.NewRequestWithContext(
 			r.Context(),
 			r.Method,
-			endpoint+requestPath,
+			requestEndpoint+requestPath,
 			bytes.NewReader(requestBody),
 		)
 		if err != nil {
@@ -437,16 +726,18 @@ func buildProxy(
 				newRequest.Header.Add(header, value)
 			}
 		}
-		if key != "" {
-			newRequest.Header.Set("Authorization", "Bearer "+key)
+		if requestKey != "" {
+			newRequest.Header.Set("Authorization", "Bearer "+requestKey)
 		}
 		if requestAcceptEncodingGzip {
 			newRequest.Header.Set("Accept-Encoding", "gzip")
 		} else {
 			newRequest.Header.Del("Accept-Encoding")
 		}
-		if strings.HasSuffix(requestPath, "/chat/completions") && autoCache {
-			cKey := key
+		// Caches are managed through the default endpoint, requests routed to other
+		// upstreams are left untouched.
+		if strings.HasSuffix(requestPath, "/chat/completions") && autoCache && requestEndpoint == endpoint {
+			cKey := requestKey
 			if cKey == "" {
 				cKey = strings.TrimSpace(
 					strings.TrimPrefix(
@@ -513,6 +804,106 @@ func buildProxy(
 		}
 		createdAt = time.Now()
 		newResponse, err = httpClient.Do(newRequest)
+		// Retries happen before anything is written to the client, each failed attempt
+		// is persisted as its own row and linked to by the next attempt.
+		for attempt := 1; shouldRetry(r.Context(), retryPolicy, attempt, newResponse, err); attempt++ {
+			var retryAfter string
+			if newResponse != nil {
+				retryAfter = newResponse.Header.Get("Retry-After")
+			}
+			delay := retryPolicy.Delay(attempt, retryAfter, time.Now())
+			if keyLease != nil {
+				var statusCode int
+				if newResponse != nil {
+					statusCode = newResponse.StatusCode
+				}
+				keyLease.Release(statusCode, 0)
+			}
+			// Attempts are linked by the request id, which is generated for requests
+			// without X-Request-Id.
+			if requestID == "" {
+				requestID = "moonpalace-" + randomHex(16)
+			}
+			attemptID, storeErr := persistAttempt(
+				requestID,
+				requestContentType,
+				requestMethod,
+				requestPath,
+				requestQuery,
+				newRequest,
+				requestBody,
+				newResponse,
+				err,
+				createdAt,
+				requestEndpoint,
+				attempt,
+				kIdentOf(requestKey),
+			)
+			if storeErr != nil {
+				logStorageError(storage.TypeSQLite, storeErr)
+			}
+			requestAttempt = attempt + 1
+			logRetry(requestMethod, requestPath, attemptID, attempt, retryPolicy.Max, delay)
+			newResponse = nil
+			if err = waitRetry(r.Context(), delay); err != nil {
+				break
+			}
+			newRequest = newRequest.Clone(r.Context())
+			if newRequest.Body, err = newRequest.GetBody(); err != nil {
+				break
+			}
+			// Each attempt is accounted against the limiters, the estimated tokens of
+			// the failed attempt are kept since its usage is unknown.
+			releaseLimits(limitReservations, -1)
+			if limitReservations, err = acquireLimits(r.Context(), estimatedTokens, limiter, routeLimiter); err != nil {
+				break
+			}
+			// The previous key has been released and may be cooling down now, each
+			// retry leases a key from the pool again, so that it is counted by the
+			// limits of the pool. The retry fails if no key is available.
+			if keyLease != nil {
+				if keyLease, err = keyPool.Acquire(); err != nil {
+					break
+				}
+				if nextKey := keyLease.Key(); nextKey != requestKey {
+					requestKey = nextKey
+					newRequest.Header.Set("Authorization", "Bearer "+requestKey)
+					// Caches belong to the account of the previous key.
+					newRequest.Header.Del("X-Msh-Context-Cache")
+					newRequest.Header.Del("X-Msh-Context-Cache-Reset-TTL")
+				}
+			}
+			createdAt = time.Now()
+			newResponse, err = httpClient.Do(newRequest)
+		}
+		// Retries fail with 429 as well when the limits are reached or no key is
+		// available for them.
+		var limited *ratelimit.LimitedError
+		if errors.As(err, &limited) {
+			w.Header().Set("Retry-After", retryAfterSeconds(limited.RetryAfter))
+			writeProxyErrorCode(
+				encoder,
+				w.Header(),
+				w.WriteHeader,
+				http.StatusTooManyRequests,
+				stepRateLimit,
+				err,
+			)
+			return
+		}
+		var unavailable *keypool.UnavailableError
+		if errors.As(err, &unavailable) {
+			w.Header().Set("Retry-After", retryAfterSeconds(unavailable.RetryAfter))
+			writeProxyErrorCode(
+				encoder,
+				w.Header(),
+				w.WriteHeader,
+				http.StatusTooManyRequests,
+				stepAcquireKey,
+				err,
+			)
+			return
+		}
 		if err != nil {
 			writeProxyError(
 				encoder,
@@ -585,6 +976,7 @@ func buildProxy(
 				}
 				responseBody = append(responseBody, line...)
 				responseBody = append(responseBody, "\n\n"...)
+				responseTiming = append(responseTiming, int(time.Since(createdAt)/time.Millisecond))
 				if field, value, ok := bytes.Cut(line, []byte{':'}); ok {
 					field, value = bytes.TrimSpace(field), bytes.TrimSpace(value)
 					if bytes.Equal(field, []byte("data")) && !bytes.Equal(value, []byte("[DONE]")) {
@@ -618,6 +1010,7 @@ func buildProxy(
 									}
 									if choice.FinishReason != nil && *choice.FinishReason == "length" {
 										warnings = append(warnings, errors.New("it seems that your max_tokens value is too small, please set a larger value"))
+										lengthWarned = true
 									}
 									if detectRepeat {
 										var detector *RepeatDetector
@@ -633,6 +1026,7 @@ func buildProxy(
 										detector.Automaton.AddString(choice.Delta.Content)
 										if detector.Automaton.Length() > repeatMinLength && detector.Automaton.GetRepeatness() < repeatThreshold {
 											warnings = append(warnings, errors.New("it appears that there is an issue with content repeating in the current response"))
+											repeatDetected = true
 											for index, snapshot := range detectors {
 												if snapshot.FinishReason == "" {
 													finishChunk := []byte(fmt.Sprintf(
@@ -673,18 +1067,7 @@ func buildProxy(
 			if forceStream && !requestUseStream {
 				w.Header().Set("Content-Type", "application/json; charset=utf-8")
 				w.WriteHeader(newResponse.StatusCode)
-				if choicesValue, exists := completion["choices"]; exists {
-					if choices, isArr := choicesValue.([]any); isArr {
-						for _, choiceValue := range choices {
-							if choice, isObj := choiceValue.(map[string]any); isObj {
-								if delta, exists := choice["delta"]; exists {
-									choice["message"] = delta
-									delete(choice, "delta")
-								}
-							}
-						}
-					}
-				}
+				deltaToMessage(completion)
 				json.NewEncoder(responseWriter).Encode(completion)
 			}
 		} else {
@@ -735,6 +1118,7 @@ func buildProxy(
 								warnings = append(warnings,
 									fmt.Errorf("it seems that your max_tokens value is too small, please set a value greater than %d",
 										completion.Usage.CompletionTokens))
+								lengthWarned = true
 							}
 						}
 					}
@@ -749,16 +1133,7 @@ func buildProxy(
 		moonshotGID = newResponse.Header.Get("Msh-Gid")
 		moonshotUID = newResponse.Header.Get("Msh-Uid")
 		moonshotRequestID = newResponse.Header.Get("Msh-Request-Id")
-		if serverTiming := newResponse.Header.Get("Server-Timing"); serverTiming != "" {
-			parts := strings.Split(serverTiming, ";")
-			for _, part := range parts {
-				if part = strings.TrimSpace(part); strings.HasPrefix(part, "dur=") {
-					timing := strings.TrimPrefix(part, "dur=")
-					moonshotServerTiming, _ = strconv.Atoi(timing)
-					break
-				}
-			}
-		}
+		moonshotServerTiming = parseServerTiming(newResponse.Header.Get("Server-Timing"))
 		moonshotContextCacheID = newResponse.Header.Get("Msh-Context-Cache-Id")
 		responseStatus = newResponse.Status
 		responseStatusCode = newResponse.StatusCode
@@ -857,6 +1232,10 @@ func formatHeader[R *http.Request | *http.Response](r R) string {
 	case *http.Response:
 		header = any(r).(*http.Response).Header
 	}
+	return writeHeader(header)
+}
+
+func writeHeader(header http.Header) string {
 	if header == nil {
 		return ""
 	}
@@ -873,6 +1252,9 @@ const (
 	stepMakeNewRequest   = "make_new_request"
 	stepSendNewRequest   = "send_new_request"
 	stepReadResponseBody = "read_response_body"
+	stepReplayRequest    = "replay_request"
+	stepAcquireKey       = "acquire_key"
+	stepRateLimit        = "rate_limit"
 )
 
 func writeProxyError(
@@ -881,9 +1263,20 @@ func writeProxyError(
 	status func(int),
 	typ string,
 	err error,
+) {
+	writeProxyErrorCode(encoder, header, status, http.StatusInternalServerError, typ, err)
+}
+
+func writeProxyErrorCode(
+	encoder *json.Encoder,
+	header http.Header,
+	status func(int),
+	statusCode int,
+	typ string,
+	err error,
 ) {
 	header.Set("Content-Type", "application/json; charset=utf-8")
-	status(http.StatusInternalServerError)
+	status(statusCode)
 	encoder.Encode(object{
 		"error": object{
 			"code":    "proxy_server_error",
@@ -0,0 +1,182 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// window is the period RPM and TPM limits are measured in, buckets are refilled
+// continuously at the rate of their limit per window.
+const window = time.Minute
+
+type Limits struct {
+	RPM         int
+	TPM         int
+	Concurrency int
+	// Wait is how long a request may queue for the limiter before it is rejected,
+	// requests are rejected at once if Wait is 0.
+	Wait time.Duration
+}
+
+// LimitedError is returned by Acquire when a request can not be admitted before
+// the deadline of the limiter.
+type LimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LimitedError) Error() string {
+	return "request exceeds the local rate limit"
+}
+
+type Limiter struct {
+	mu       sync.Mutex
+	limits   Limits
+	requests *bucket
+	tokens   *bucket
+	inflight int
+	notify   chan struct{}
+	now      func() time.Time
+}
+
+type bucket struct {
+	capacity float64
+	level    float64
+	updated  time.Time
+}
+
+func newBucket(capacity int, now time.Time) *bucket {
+	if capacity <= 0 {
+		return nil
+	}
+	return &bucket{
+		capacity: float64(capacity),
+		level:    float64(capacity),
+		updated:  now,
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.level += b.capacity * float64(elapsed) / float64(window)
+		if b.level > b.capacity {
+			b.level = b.capacity
+		}
+		b.updated = now
+	}
+}
+
+// wait returns how long it takes until the bucket holds n, n is capped by the
+// capacity of the bucket, otherwise it would never be satisfied.
+func (b *bucket) wait(n float64) time.Duration {
+	if n > b.capacity {
+		n = b.capacity
+	}
+	if b.level >= n {
+		return 0
+	}
+	return time.Duration((n - b.level) / b.capacity * float64(window))
+}
+
+func New(limits Limits) *Limiter {
+	now := time.Now()
+	return &Limiter{
+		limits:   limits,
+		requests: newBucket(limits.RPM, now),
+		tokens:   newBucket(limits.TPM, now),
+		notify:   make(chan struct{}),
+		now:      time.Now,
+	}
+}
+
+// Acquire admits a request estimated to consume tokens, it queues until the
+// request fits into the limits, the Wait of the limiter elapses or ctx is done.
+// The returned Reservation must be released once the request finishes.
+func (l *Limiter) Acquire(ctx context.Context, tokens int) (*Reservation, error) {
+	deadline := l.now().Add(l.limits.Wait)
+	for {
+		l.mu.Lock()
+		now := l.now()
+		wait, blocked := l.check(now, tokens)
+		if wait == 0 && !blocked {
+			l.take(tokens)
+			l.mu.Unlock()
+			return &Reservation{limiter: l, estimated: tokens}, nil
+		}
+		notify := l.notify
+		l.mu.Unlock()
+		remaining := deadline.Sub(now)
+		if wait > remaining || (wait == 0 && remaining <= 0) {
+			if wait == 0 {
+				wait = time.Second
+			}
+			return nil, &LimitedError{RetryAfter: wait}
+		}
+		if wait == 0 {
+			wait = remaining
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-notify:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// check returns how long it takes until the buckets can admit the request, and
+// whether the request is blocked by the concurrency limit.
+func (l *Limiter) check(now time.Time, tokens int) (wait time.Duration, blocked bool) {
+	if l.requests != nil {
+		l.requests.refill(now)
+		wait = max(wait, l.requests.wait(1))
+	}
+	if l.tokens != nil {
+		l.tokens.refill(now)
+		wait = max(wait, l.tokens.wait(float64(tokens)))
+	}
+	blocked = l.limits.Concurrency > 0 && l.inflight >= l.limits.Concurrency
+	return wait, blocked
+}
+
+func (l *Limiter) take(tokens int) {
+	if l.requests != nil {
+		l.requests.level--
+	}
+	if l.tokens != nil {
+		l.tokens.level -= float64(tokens)
+	}
+	l.inflight++
+}
+
+type Reservation struct {
+	limiter   *Limiter
+	estimated int
+	once      sync.Once
+}
+
+// Release returns the reservation to the limiter. The estimated tokens are
+// reconciled with tokens, the number of tokens the request actually consumed,
+// unless tokens is negative, which means the actual number is unknown.
+func (r *Reservation) Release(tokens int) {
+	r.once.Do(func() {
+		l := r.limiter
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.tokens != nil && tokens >= 0 {
+			l.tokens.refill(l.now())
+			// The level may go below zero if the estimation was too small, later
+			// requests will wait until the debt is paid.
+			l.tokens.level -= float64(tokens - r.estimated)
+			if l.tokens.level > l.tokens.capacity {
+				l.tokens.level = l.tokens.capacity
+			}
+		}
+		l.inflight--
+		close(l.notify)
+		l.notify = make(chan struct{})
+	})
+}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRejectWithoutWait(t *testing.T) {
+	limiter := New(Limits{RPM: 2})
+	for i := 0; i < 2; i++ {
+		if _, err := limiter.Acquire(context.Background(), 0); err != nil {
+			t.Fatalf("Acquire: %s", err)
+		}
+	}
+	_, err := limiter.Acquire(context.Background(), 0)
+	var limited *LimitedError
+	if !errors.As(err, &limited) {
+		t.Fatalf("want LimitedError, got %v", err)
+	}
+	if limited.RetryAfter <= 0 || limited.RetryAfter > 30*time.Second {
+		t.Errorf("want retry after about 30s, got %s", limited.RetryAfter)
+	}
+}
+
+func TestQueueUntilRefilled(t *testing.T) {
+	// 1200 RPM refills one request every 50ms.
+	limiter := New(Limits{RPM: 1200, Wait: time.Second})
+	limiter.requests.level = 0
+	start := time.Now()
+	if _, err := limiter.Acquire(context.Background(), 0); err != nil {
+		t.Fatalf("Acquire: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("want request to queue for about 50ms, got %s", elapsed)
+	}
+}
+
+func TestQueueBeyondDeadline(t *testing.T) {
+	limiter := New(Limits{RPM: 60, Wait: 100 * time.Millisecond})
+	limiter.requests.level = 0
+	start := time.Now()
+	_, err := limiter.Acquire(context.Background(), 0)
+	if !errors.As(err, new(*LimitedError)) {
+		t.Fatalf("want LimitedError, got %v", err)
+	}
+	// The wait is known to exceed the deadline, so the request is rejected at once.
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("want request to be rejected at once, got %s", elapsed)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	limiter := New(Limits{Concurrency: 1, Wait: time.Second})
+	reservation, err := limiter.Acquire(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Acquire: %s", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		reservation.Release(-1)
+	}()
+	start := time.Now()
+	if _, err = limiter.Acquire(context.Background(), 0); err != nil {
+		t.Fatalf("Acquire: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("want request to wait for the release, got %s", elapsed)
+	}
+}
+
+func TestConcurrencyDeadline(t *testing.T) {
+	limiter := New(Limits{Concurrency: 1, Wait: 50 * time.Millisecond})
+	if _, err := limiter.Acquire(context.Background(), 0); err != nil {
+		t.Fatalf("Acquire: %s", err)
+	}
+	if _, err := limiter.Acquire(context.Background(), 0); !errors.As(err, new(*LimitedError)) {
+		t.Fatalf("want LimitedError, got %v", err)
+	}
+}
+
+func TestContextDone(t *testing.T) {
+	limiter := New(Limits{Concurrency: 1, Wait: time.Minute})
+	if _, err := limiter.Acquire(context.Background(), 0); err != nil {
+		t.Fatalf("Acquire: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestReconcileTokens(t *testing.T) {
+	limiter := New(Limits{TPM: 1000})
+	reservation, err := limiter.Acquire(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("Acquire: %s", err)
+	}
+	reservation.Release(1500)
+	if level := limiter.tokens.level; level > -499 || level < -501 {
+		t.Errorf("want level about -500 after reconciling, got %f", level)
+	}
+	if _, err = limiter.Acquire(context.Background(), 1); !errors.As(err, new(*LimitedError)) {
+		t.Fatalf("want LimitedError while in debt, got %v", err)
+	}
+}
+
+func TestReconcileUnknownTokens(t *testing.T) {
+	limiter := New(Limits{TPM: 1000})
+	reservation, err := limiter.Acquire(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("Acquire: %s", err)
+	}
+	reservation.Release(-1)
+	reservation.Release(5000)
+	if level := limiter.tokens.level; level > 901 || level < 899 {
+		t.Errorf("want level about 900 keeping the estimation, got %f", level)
+	}
+	if limiter.inflight != 0 {
+		t.Errorf("want 0 in-flight requests, got %d", limiter.inflight)
+	}
+}
+
+func TestOversizedRequest(t *testing.T) {
+	limiter := New(Limits{TPM: 1000})
+	// Requests larger than the capacity are admitted once the bucket is full.
+	if _, err := limiter.Acquire(context.Background(), 5000); err != nil {
+		t.Fatalf("Acquire: %s", err)
+	}
+}
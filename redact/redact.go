@@ -0,0 +1,644 @@
+package redact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	ModeMask = "mask"
+	ModeHash = "hash"
+	ModeDrop = "drop"
+)
+
+// Parts of a captured request which rules apply to.
+const (
+	RequestHeader  = "request_header"
+	RequestBody    = "request_body"
+	ResponseHeader = "response_header"
+	ResponseBody   = "response_body"
+)
+
+// Masked replaces values redacted in ModeMask.
+const Masked = "[REDACTED]"
+
+// Rule redacts matches of a regular expression, values at a JSON path or values
+// of a header, exactly one of Regex, JSONPath and Header should be set.
+type Rule struct {
+	Name     string
+	Regex    string
+	JSONPath string
+	Header   string
+	// In is the parts the rule applies to, regular expressions apply to bodies
+	// and JSON paths apply to request bodies by default, headers apply to both
+	// request and response headers regardless of In. Regular expressions apply
+	// to the decoded values of JSON bodies, and to the completion merged from
+	// the events of event streams as well.
+	In   []string
+	Mode string
+}
+
+// Record is what is persisted for a request, it is redacted in place.
+type Record struct {
+	RequestHeader  http.Header
+	RequestBody    []byte
+	ResponseHeader http.Header
+	ResponseBody   []byte
+}
+
+// Redaction is a value redacted by a rule, Replacement is empty for values
+// redacted in ModeDrop.
+type Redaction struct {
+	Rule        string
+	In          string
+	Path        string
+	Value       string
+	Replacement string
+}
+
+type Redactor struct {
+	rules []*rule
+}
+
+type rule struct {
+	*Rule
+	regex  *regexp.Regexp
+	secret []byte
+}
+
+// ErrNoSecret is returned by New if a rule hashes values without a secret, since
+// values with few possibilities, such as phone numbers, are easily recovered
+// from unkeyed hashes.
+var ErrNoSecret = errors.New("mode hash requires a secret")
+
+// New compiles the rules, secret is the key of the hashes of values redacted in
+// ModeHash, it is only required if there are such rules.
+func New(rules []*Rule, secret []byte) (*Redactor, error) {
+	redactor := &Redactor{rules: make([]*rule, 0, len(rules))}
+	for i, r := range rules {
+		compiled, err := compile(r)
+		if err == nil && compiled.Mode == ModeHash {
+			if len(secret) == 0 {
+				err = ErrNoSecret
+			}
+			compiled.secret = secret
+		}
+		if err != nil {
+			name := r.Name
+			if name == "" {
+				name = "#" + strconv.Itoa(i)
+			}
+			return nil, fmt.Errorf("redact rule %s: %w", name, err)
+		}
+		redactor.rules = append(redactor.rules, compiled)
+	}
+	return redactor, nil
+}
+
+func compile(r *Rule) (*rule, error) {
+	compiled := &rule{Rule: &Rule{
+		Name:     r.Name,
+		Regex:    r.Regex,
+		JSONPath: r.JSONPath,
+		Header:   r.Header,
+		In:       r.In,
+		Mode:     strings.ToLower(r.Mode),
+	}}
+	var kinds int
+	for _, value := range []string{r.Regex, r.JSONPath, r.Header} {
+		if value != "" {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return nil, errors.New("exactly one of regex, json-path and header should be set")
+	}
+	switch compiled.Mode {
+	case ModeMask, ModeHash, ModeDrop:
+	case "":
+		compiled.Mode = ModeMask
+	default:
+		return nil, fmt.Errorf("unknown mode %q, expected one of mask, hash and drop", r.Mode)
+	}
+	for _, in := range r.In {
+		switch in {
+		case RequestBody, ResponseBody:
+		case RequestHeader, ResponseHeader:
+			if r.JSONPath != "" {
+				return nil, fmt.Errorf("json-path can not apply to %s", in)
+			}
+		default:
+			return nil, fmt.Errorf("unknown part %q, expected one of request_header, request_body, response_header and response_body", in)
+		}
+	}
+	switch {
+	case r.Regex != "":
+		regex, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return nil, err
+		}
+		compiled.regex = regex
+		if len(r.In) == 0 {
+			compiled.In = []string{RequestBody, ResponseBody}
+		}
+	case r.JSONPath != "":
+		if err := checkPath(r.JSONPath); err != nil {
+			return nil, err
+		}
+		if len(r.In) == 0 {
+			compiled.In = []string{RequestBody}
+		}
+	case r.Header != "":
+		compiled.Header = http.CanonicalHeaderKey(r.Header)
+		compiled.In = []string{RequestHeader, ResponseHeader}
+	}
+	if compiled.Name == "" {
+		compiled.Name = r.Regex + r.JSONPath + r.Header
+	}
+	return compiled, nil
+}
+
+// Redact applies rules to the record in order and returns the redacted values.
+func (r *Redactor) Redact(record *Record) []*Redaction {
+	if r == nil {
+		return nil
+	}
+	var redactions []*Redaction
+	for _, rule := range r.rules {
+		for _, in := range rule.In {
+			switch in {
+			case RequestHeader:
+				rule.redactHeader(record.RequestHeader, in, &redactions)
+			case RequestBody:
+				record.RequestBody = rule.redactBody(record.RequestBody, in, &redactions)
+			case ResponseHeader:
+				rule.redactHeader(record.ResponseHeader, in, &redactions)
+			case ResponseBody:
+				record.ResponseBody = rule.redactBody(record.ResponseBody, in, &redactions)
+			}
+		}
+	}
+	return redactions
+}
+
+// Empty reports whether there are no rules at all.
+func (r *Redactor) Empty() bool {
+	return r == nil || len(r.rules) == 0
+}
+
+func (r *rule) replace(value string) string {
+	switch r.Mode {
+	case ModeHash:
+		return Hash(r.secret, value)
+	case ModeDrop:
+		return ""
+	default:
+		return Masked
+	}
+}
+
+// redacted reports whether the value has already been redacted by the rule, so
+// that rules applied again on export leave values redacted on capture intact.
+func (r *rule) redacted(value string) bool {
+	switch r.Mode {
+	case ModeHash:
+		return len(value) == len(hashPrefix)+2*hashSize && strings.HasPrefix(value, hashPrefix)
+	case ModeMask:
+		return value == Masked
+	default:
+		return false
+	}
+}
+
+const (
+	hashPrefix = "hmac-sha256:"
+	hashSize   = 16
+)
+
+// Hash replaces values redacted in ModeHash, equal values have equal hashes
+// under the same secret, so that they can still be correlated.
+func Hash(secret []byte, value string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(value))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil)[:hashSize])
+}
+
+func (r *rule) redactHeader(header http.Header, in string, redactions *[]*Redaction) {
+	if header == nil {
+		return
+	}
+	if r.regex != nil {
+		for key, values := range header {
+			for i, value := range values {
+				values[i] = r.redactText(value, in, key, redactions)
+			}
+		}
+		return
+	}
+	if r.Header == "" {
+		return
+	}
+	values, ok := header[r.Header]
+	if !ok {
+		return
+	}
+	for i, value := range values {
+		if r.redacted(value) {
+			continue
+		}
+		replacement := r.replace(value)
+		*redactions = append(*redactions, &Redaction{
+			Rule:        r.Name,
+			In:          in,
+			Path:        r.Header,
+			Value:       value,
+			Replacement: replacement,
+		})
+		values[i] = replacement
+	}
+	if r.Mode == ModeDrop {
+		header.Del(r.Header)
+	}
+}
+
+func (r *rule) redactBody(body []byte, in string, redactions *[]*Redaction) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	if r.regex == nil && r.JSONPath == "" {
+		return body
+	}
+	if gjson.ValidBytes(body) {
+		if r.regex != nil {
+			return r.redactValues(body, in, redactions)
+		}
+		return r.redactJSON(body, in, redactions)
+	}
+	lines := bytes.Split(body, []byte("\n"))
+	if !isEventStream(lines) {
+		if r.regex != nil {
+			return []byte(r.redactText(string(body), in, "", redactions))
+		}
+		return body
+	}
+	// Event streams are redacted event by event, and regular expressions are
+	// applied to the completion merged from the events first, since a match may
+	// be split across deltas.
+	if r.regex != nil {
+		r.redactStream(lines, in, redactions)
+	}
+	for i, line := range lines {
+		data, ok := bytes.CutPrefix(line, []byte("data: "))
+		switch {
+		case ok && gjson.ValidBytes(data) && r.regex != nil:
+			lines[i] = append([]byte("data: "), r.redactValues(data, in, redactions)...)
+		case ok && gjson.ValidBytes(data):
+			lines[i] = append([]byte("data: "), r.redactJSON(data, in, redactions)...)
+		case r.regex != nil:
+			lines[i] = []byte(r.redactText(string(line), in, "", redactions))
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+func isEventStream(lines [][]byte) bool {
+	for _, line := range lines {
+		if data, ok := bytes.CutPrefix(line, []byte("data: ")); ok && gjson.ValidBytes(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValues applies the regular expression to the decoded string values and
+// numbers of the document instead of its text, so that escaped characters such
+// as \u0040 are matched as well. Keys are left intact.
+func (r *rule) redactValues(document []byte, in string, redactions *[]*Redaction) []byte {
+	type edit struct {
+		start int
+		end   int
+		raw   []byte
+	}
+	var (
+		edits []*edit
+		walk  func(value gjson.Result, path string)
+	)
+	walk = func(value gjson.Result, path string) {
+		switch {
+		case value.IsObject(), value.IsArray():
+			var i int
+			value.ForEach(func(key, element gjson.Result) bool {
+				segment := key.String()
+				if value.IsArray() {
+					segment = strconv.Itoa(i)
+				}
+				i++
+				walk(element, joinPath(path, segment))
+				return true
+			})
+		case value.Type == gjson.String, value.Type == gjson.Number:
+			text := value.String()
+			if value.Type == gjson.Number {
+				text = value.Raw
+			}
+			if redacted := r.redactText(text, in, path, redactions); redacted != text {
+				edits = append(edits, &edit{
+					start: value.Index,
+					end:   value.Index + len(value.Raw),
+					raw:   encodeString(redacted),
+				})
+			}
+		}
+	}
+	walk(gjson.ParseBytes(document), "")
+	if len(edits) == 0 {
+		return document
+	}
+	// Values are replaced from the end, so that the offsets of the values in
+	// front of them stay the same.
+	document = slices.Clone(document)
+	for i := len(edits) - 1; i >= 0; i-- {
+		document = slices.Replace(document, edits[i].start, edits[i].end, edits[i].raw...)
+	}
+	return document
+}
+
+func encodeString(value string) []byte {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		// Strings are always encoded.
+		panic(err)
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))
+}
+
+// streamSegment is a string value of an event which is merged with the values
+// of other events into the completion, such as the content of deltas.
+type streamSegment struct {
+	line int
+	path string
+	text string
+}
+
+// streamSegments groups the merged values of the events by the field of the
+// completion they are merged into, in the order of the events. Choices and tool
+// calls are identified by their index fields rather than positions in arrays.
+func streamSegments(lines [][]byte) (keys []string, segments map[string][]*streamSegment) {
+	segments = make(map[string][]*streamSegment)
+	add := func(key string, line int, path string, value gjson.Result) {
+		if value.Type != gjson.String {
+			return
+		}
+		if _, exists := segments[key]; !exists {
+			keys = append(keys, key)
+		}
+		segments[key] = append(segments[key], &streamSegment{line: line, path: path, text: value.String()})
+	}
+	for line, text := range lines {
+		data, ok := bytes.CutPrefix(text, []byte("data: "))
+		if !ok || !gjson.ValidBytes(data) {
+			continue
+		}
+		var i int
+		gjson.GetBytes(data, "choices").ForEach(func(_, choice gjson.Result) bool {
+			choicePath := "choices." + strconv.Itoa(i)
+			choiceKey := "choices." + choice.Get("index").String()
+			add(choiceKey+".content", line, choicePath+".delta.content", choice.Get("delta.content"))
+			add(choiceKey+".reasoning_content", line, choicePath+".delta.reasoning_content", choice.Get("delta.reasoning_content"))
+			var j int
+			choice.Get("delta.tool_calls").ForEach(func(_, call gjson.Result) bool {
+				add(
+					choiceKey+".tool_calls."+call.Get("index").String()+".arguments",
+					line,
+					choicePath+".delta.tool_calls."+strconv.Itoa(j)+".function.arguments",
+					call.Get("function.arguments"),
+				)
+				j++
+				return true
+			})
+			i++
+			return true
+		})
+	}
+	return keys, segments
+}
+
+// redactStream applies the regular expression to the contents and arguments
+// merged from the events, the part of a match in each event it spans is removed
+// and the replacement is put in the event where the match starts.
+func (r *rule) redactStream(lines [][]byte, in string, redactions *[]*Redaction) {
+	keys, segments := streamSegments(lines)
+	for _, key := range keys {
+		var (
+			merged  strings.Builder
+			offsets []int
+		)
+		for _, segment := range segments[key] {
+			offsets = append(offsets, merged.Len())
+			merged.WriteString(segment.text)
+		}
+		text := merged.String()
+		var matches [][]int
+		for _, match := range r.regex.FindAllStringIndex(text, -1) {
+			if match[0] < match[1] && !r.redacted(text[match[0]:match[1]]) {
+				matches = append(matches, match)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		replacements := make([]string, len(matches))
+		for i, match := range matches {
+			value := text[match[0]:match[1]]
+			replacements[i] = r.replace(value)
+			first := sort.SearchInts(offsets, match[0]+1) - 1
+			*redactions = append(*redactions, &Redaction{
+				Rule:        r.Name,
+				In:          in,
+				Path:        segments[key][first].path,
+				Value:       value,
+				Replacement: replacements[i],
+			})
+		}
+		for i, segment := range segments[key] {
+			var (
+				start    = offsets[i]
+				end      = start + len(segment.text)
+				position = start
+				redacted strings.Builder
+			)
+			for j, match := range matches {
+				if match[1] <= start || match[0] >= end {
+					continue
+				}
+				if match[0] >= start {
+					redacted.WriteString(text[position:match[0]])
+					redacted.WriteString(replacements[j])
+				}
+				position = min(match[1], end)
+			}
+			if position == start && redacted.Len() == 0 {
+				continue
+			}
+			redacted.WriteString(text[position:end])
+			data, _ := bytes.CutPrefix(lines[segment.line], []byte("data: "))
+			data, err := sjson.SetBytes(data, segment.path, redacted.String())
+			if err != nil {
+				// The path comes from the event itself, so this never happens.
+				panic(err)
+			}
+			lines[segment.line] = append([]byte("data: "), data...)
+		}
+	}
+}
+
+func (r *rule) redactText(text string, in string, path string, redactions *[]*Redaction) string {
+	return r.regex.ReplaceAllStringFunc(text, func(match string) string {
+		if r.redacted(match) {
+			return match
+		}
+		replacement := r.replace(match)
+		*redactions = append(*redactions, &Redaction{
+			Rule:        r.Name,
+			In:          in,
+			Path:        path,
+			Value:       match,
+			Replacement: replacement,
+		})
+		return replacement
+	})
+}
+
+func (r *rule) redactJSON(document []byte, in string, redactions *[]*Redaction) []byte {
+	paths := expandPath(document, r.JSONPath)
+	// Elements are deleted from the end, so that the indexes of the elements in
+	// front of them stay the same.
+	if r.Mode == ModeDrop {
+		slices.Reverse(paths)
+	}
+	for _, path := range paths {
+		value := gjson.GetBytes(document, path)
+		if !value.Exists() || r.redacted(value.String()) {
+			continue
+		}
+		replacement := r.replace(value.String())
+		*redactions = append(*redactions, &Redaction{
+			Rule:        r.Name,
+			In:          in,
+			Path:        path,
+			Value:       value.String(),
+			Replacement: replacement,
+		})
+		var err error
+		if r.Mode == ModeDrop {
+			document, err = sjson.DeleteBytes(document, path)
+		} else {
+			document, err = sjson.SetBytes(document, path, replacement)
+		}
+		if err != nil {
+			// The path comes from the document itself, so this never happens.
+			panic(err)
+		}
+	}
+	return document
+}
+
+// expandPath expands each # in the path to the indexes of the elements of the
+// array, paths are separated by dots, and dots in keys are escaped by \.
+func expandPath(document []byte, path string) []string {
+	paths := []string{""}
+	for _, segment := range splitPath(path) {
+		next := make([]string, 0, len(paths))
+		for _, prefix := range paths {
+			if segment != "#" {
+				next = append(next, joinPath(prefix, segment))
+				continue
+			}
+			array := gjson.GetBytes(document, prefix)
+			if prefix == "" {
+				array = gjson.ParseBytes(document)
+			}
+			if !array.IsArray() {
+				continue
+			}
+			for i := range array.Array() {
+				next = append(next, joinPath(prefix, strconv.Itoa(i)))
+			}
+		}
+		paths = next
+	}
+	return paths
+}
+
+// checkPath rejects the syntax of gjson paths which expandPath does not expand,
+// such as wildcards, queries and modifiers, since only the first value matched by
+// them would be redacted.
+func checkPath(path string) error {
+	for _, segment := range splitPath(path) {
+		if segment == "" {
+			return fmt.Errorf("invalid json-path %q: empty key", path)
+		}
+		if segment == "#" {
+			continue
+		}
+		for i := 0; i < len(segment); i++ {
+			switch segment[i] {
+			case '\\':
+				i++
+			case '*', '?':
+				return fmt.Errorf("invalid json-path %q: wildcards are not supported, use # to match every element of arrays", path)
+			case '|':
+				return fmt.Errorf("invalid json-path %q: pipes are not supported", path)
+			case '#', '@', '!':
+				if i == 0 {
+					return fmt.Errorf("invalid json-path %q: queries and modifiers are not supported, use # to match every element of arrays", path)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func splitPath(path string) []string {
+	var (
+		segments []string
+		segment  strings.Builder
+	)
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path):
+			segment.WriteByte(path[i])
+			segment.WriteByte(path[i+1])
+			i++
+		case path[i] == '.':
+			segments = append(segments, segment.String())
+			segment.Reset()
+		default:
+			segment.WriteByte(path[i])
+		}
+	}
+	return append(segments, segment.String())
+}
+
+func joinPath(prefix string, segment string) string {
+	if prefix == "" {
+		return segment
+	}
+	return prefix + "." + segment
+}
@@ -0,0 +1,285 @@
+package redact
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+var testSecret = []byte("moonpalace")
+
+func TestRegexMask(t *testing.T) {
+	redactor, err := New([]*Rule{{Name: "email", Regex: `[\w.+-]+@[\w-]+\.[\w.]+`}}, nil)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	record := &Record{
+		RequestBody:  []byte(`{"messages":[{"role":"user","content":"mail alice@example.com"}]}`),
+		ResponseBody: []byte(`{"choices":[{"message":{"content":"sent to alice@example.com"}}]}`),
+	}
+	redactions := redactor.Redact(record)
+	if len(redactions) != 2 {
+		t.Fatalf("want 2 redactions, got %d", len(redactions))
+	}
+	if want := `{"messages":[{"role":"user","content":"mail [REDACTED]"}]}`; string(record.RequestBody) != want {
+		t.Errorf("want %s, got %s", want, record.RequestBody)
+	}
+	if strings.Contains(string(record.ResponseBody), "alice") {
+		t.Errorf("response body is not redacted: %s", record.ResponseBody)
+	}
+	if redactions[0].Value != "alice@example.com" || redactions[0].In != RequestBody {
+		t.Errorf("unexpected redaction %+v", redactions[0])
+	}
+}
+
+func TestJSONPathHash(t *testing.T) {
+	redactor, err := New([]*Rule{{JSONPath: "messages.#.name", Mode: ModeHash}}, testSecret)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	record := &Record{
+		RequestBody: []byte(`{"messages":[{"role":"user","name":"u-1"},{"role":"assistant"},{"role":"user","name":"u-1"}]}`),
+	}
+	redactions := redactor.Redact(record)
+	if len(redactions) != 2 {
+		t.Fatalf("want 2 redactions, got %d", len(redactions))
+	}
+	hash := Hash(testSecret, "u-1")
+	if want := `{"messages":[{"role":"user","name":"` + hash + `"},{"role":"assistant"},{"role":"user","name":"` + hash + `"}]}`; string(record.RequestBody) != want {
+		t.Errorf("want %s, got %s", want, record.RequestBody)
+	}
+	if redactions[1].Path != "messages.2.name" {
+		t.Errorf("want path messages.2.name, got %s", redactions[1].Path)
+	}
+}
+
+func TestJSONPathDropInEventStream(t *testing.T) {
+	redactor, err := New([]*Rule{{JSONPath: "choices.#.delta.content", In: []string{ResponseBody}, Mode: ModeDrop}}, nil)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	record := &Record{
+		ResponseBody: []byte("data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n"),
+	}
+	redactions := redactor.Redact(record)
+	if len(redactions) != 1 || redactions[0].Replacement != "" {
+		t.Fatalf("want 1 dropped value, got %+v", redactions)
+	}
+	if want := "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\ndata: [DONE]\n\n"; string(record.ResponseBody) != want {
+		t.Errorf("want %q, got %q", want, record.ResponseBody)
+	}
+}
+
+func TestJSONPathDropElements(t *testing.T) {
+	redactor, err := New([]*Rule{{JSONPath: "ids.#", Mode: ModeDrop}}, nil)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	record := &Record{RequestBody: []byte(`{"ids":[1,2,3],"keep":true}`)}
+	if redactions := redactor.Redact(record); len(redactions) != 3 {
+		t.Fatalf("want 3 redactions, got %d", len(redactions))
+	}
+	if want := `{"ids":[],"keep":true}`; string(record.RequestBody) != want {
+		t.Errorf("want %s, got %s", want, record.RequestBody)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	redactor, err := New([]*Rule{
+		{Header: "x-customer-token", Mode: ModeDrop},
+		{Header: "X-Customer-Id", Mode: ModeMask},
+	}, nil)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	record := &Record{
+		RequestHeader: http.Header{
+			"X-Customer-Token": {"secret"},
+			"X-Customer-Id":    {"42"},
+		},
+		ResponseHeader: http.Header{"Content-Type": {"application/json"}},
+	}
+	if redactions := redactor.Redact(record); len(redactions) != 2 {
+		t.Fatalf("want 2 redactions, got %d", len(redactions))
+	}
+	if _, ok := record.RequestHeader["X-Customer-Token"]; ok {
+		t.Error("X-Customer-Token is not dropped")
+	}
+	if got := record.RequestHeader.Get("X-Customer-Id"); got != Masked {
+		t.Errorf("want X-Customer-Id masked, got %s", got)
+	}
+	if got := record.ResponseHeader.Get("Content-Type"); got != "application/json" {
+		t.Errorf("want Content-Type intact, got %s", got)
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	rules := []*Rule{
+		{},
+		{Regex: "a", Header: "b"},
+		{Regex: "("},
+		{Regex: "a", Mode: "encrypt"},
+		{JSONPath: "a", In: []string{RequestHeader}},
+		{Regex: "a", In: []string{"error"}},
+		{Regex: "a", Mode: ModeHash},
+	}
+	for _, rule := range rules {
+		if _, err := New([]*Rule{rule}, nil); err == nil {
+			t.Errorf("want error for rule %+v", rule)
+		}
+	}
+}
+
+func TestNilRedactor(t *testing.T) {
+	var redactor *Redactor
+	record := &Record{RequestBody: []byte("alice@example.com")}
+	if redactions := redactor.Redact(record); redactions != nil || !redactor.Empty() {
+		t.Errorf("want nil redactor to redact nothing, got %+v", redactions)
+	}
+}
+
+func TestRedactTwice(t *testing.T) {
+	redactor, err := New([]*Rule{
+		{JSONPath: "user", Mode: ModeHash},
+		{Header: "X-Customer-Id"},
+	}, testSecret)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	record := &Record{
+		RequestHeader: http.Header{"X-Customer-Id": {"42"}},
+		RequestBody:   []byte(`{"user":"u-1"}`),
+	}
+	if redactions := redactor.Redact(record); len(redactions) != 2 {
+		t.Fatalf("want 2 redactions, got %d", len(redactions))
+	}
+	if redactions := redactor.Redact(record); len(redactions) != 0 {
+		t.Fatalf("want redacted values intact, got %+v", redactions)
+	}
+	if want := `{"user":"` + Hash(testSecret, "u-1") + `"}`; string(record.RequestBody) != want {
+		t.Errorf("want %s, got %s", want, record.RequestBody)
+	}
+}
+
+func TestHash(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		secret []byte
+		value  string
+		same   bool
+	}{
+		{name: "same value", secret: testSecret, value: "u-1", same: true},
+		{name: "other value", secret: testSecret, value: "u-2"},
+		{name: "other secret", secret: []byte("moonshot"), value: "u-1"},
+	}
+	want := Hash(testSecret, "u-1")
+	if !strings.HasPrefix(want, hashPrefix) || len(want) != len(hashPrefix)+2*hashSize {
+		t.Fatalf("Hash: unexpected hash %q", want)
+	}
+	for _, testcase := range testcases {
+		if got := Hash(testcase.secret, testcase.value); (got == want) != testcase.same {
+			t.Errorf("%s: want same hash %v, got %q and %q", testcase.name, testcase.same, want, got)
+		}
+	}
+}
+
+func TestJSONPathSyntax(t *testing.T) {
+	var testcases = []struct {
+		path  string
+		valid bool
+	}{
+		{path: "user", valid: true},
+		{path: "messages.#.content", valid: true},
+		{path: "messages.0.content", valid: true},
+		{path: `metadata.a\.b`, valid: true},
+		{path: `metadata.a\*b`, valid: true},
+		{path: "metadata.a#b", valid: true},
+		{path: "user.*"},
+		{path: "us?r"},
+		{path: `messages.#(role=="user").content`},
+		{path: `messages.#(role=="user")#.content`},
+		{path: "messages.@reverse.0"},
+		{path: "messages|0"},
+		{path: "messages..content"},
+	}
+	for _, testcase := range testcases {
+		_, err := New([]*Rule{{JSONPath: testcase.path}}, nil)
+		if (err == nil) != testcase.valid {
+			t.Errorf("%s: want valid %v, got %v", testcase.path, testcase.valid, err)
+		}
+	}
+}
+
+func TestRegexEscapedJSON(t *testing.T) {
+	redactor, err := New([]*Rule{{Name: "email", Regex: `[\w.+-]+@[\w-]+\.[\w.]+`}}, nil)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	record := &Record{
+		RequestBody: []byte(`{"messages":[{"role":"user","content":"mail alice\u0040example.com \u003cnow\u003e"}]}`),
+	}
+	redactions := redactor.Redact(record)
+	if len(redactions) != 1 || redactions[0].Value != "alice@example.com" || redactions[0].Path != "messages.0.content" {
+		t.Fatalf("want alice@example.com redacted at messages.0.content, got %+v", redactions)
+	}
+	if want := `{"messages":[{"role":"user","content":"mail [REDACTED] <now>"}]}`; string(record.RequestBody) != want {
+		t.Errorf("want %s, got %s", want, record.RequestBody)
+	}
+}
+
+func TestRegexInEventStream(t *testing.T) {
+	event := func(delta string) string {
+		return `data: {"choices":[{"index":0,"delta":` + delta + `}]}` + "\n\n"
+	}
+	var testcases = []struct {
+		name   string
+		mode   string
+		deltas []string
+		want   []string
+		value  string
+	}{
+		{
+			name:   "match spanning two deltas",
+			deltas: []string{`{"content":"key sk-abc"}`, `{"content":"def123 ok"}`},
+			want:   []string{`{"content":"key [REDACTED]"}`, `{"content":" ok"}`},
+			value:  "sk-abcdef123",
+		},
+		{
+			name:   "match spanning three deltas",
+			deltas: []string{`{"content":"sk-"}`, `{"content":"abc"}`, `{"content":"def, "}`},
+			want:   []string{`{"content":"[REDACTED]"}`, `{"content":""}`, `{"content":", "}`},
+			value:  "sk-abcdef",
+		},
+		{
+			name:   "match in tool call arguments",
+			mode:   ModeHash,
+			deltas: []string{`{"tool_calls":[{"index":0,"function":{"arguments":"{\"key\":\"sk-ab"}}]}`, `{"tool_calls":[{"index":0,"function":{"arguments":"cd\"}"}}]}`},
+			want: []string{
+				`{"tool_calls":[{"index":0,"function":{"arguments":"{\"key\":\"` + Hash(testSecret, "sk-abcd") + `"}}]}`,
+				`{"tool_calls":[{"index":0,"function":{"arguments":"\"}"}}]}`,
+			},
+			value: "sk-abcd",
+		},
+	}
+	for _, testcase := range testcases {
+		redactor, err := New([]*Rule{{Regex: `sk-[A-Za-z0-9]+`, Mode: testcase.mode}}, testSecret)
+		if err != nil {
+			t.Fatalf("%s: New: %s", testcase.name, err)
+		}
+		var body, want strings.Builder
+		for i := range testcase.deltas {
+			body.WriteString(event(testcase.deltas[i]))
+			want.WriteString(event(testcase.want[i]))
+		}
+		body.WriteString("data: [DONE]\n\n")
+		want.WriteString("data: [DONE]\n\n")
+		record := &Record{ResponseBody: []byte(body.String())}
+		redactions := redactor.Redact(record)
+		if len(redactions) != 1 || redactions[0].Value != testcase.value {
+			t.Errorf("%s: want %s redacted once, got %+v", testcase.name, testcase.value, redactions)
+		}
+		if string(record.ResponseBody) != want.String() {
+			t.Errorf("%s: want %q, got %q", testcase.name, want.String(), record.ResponseBody)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/MoonshotAI/moonpalace/redact"
+)
+
+// RedactConfig is a rule to redact sensitive data before requests are
+// persisted or exported, see redact.Rule.
+type RedactConfig struct {
+	Name     string   `yaml:"name"`
+	Regex    string   `yaml:"regex"`
+	JSONPath string   `yaml:"json-path"`
+	Header   string   `yaml:"header"`
+	In       []string `yaml:"in"`
+	Mode     string   `yaml:"mode"`
+}
+
+const envRedactSecret = "MOONPALACE_REDACT_SECRET"
+
+// redactor is nil if no rules are configured, which redacts nothing.
+var redactor *redact.Redactor
+
+// loadRedactor loads the rules in the config file into redactor.
+func loadRedactor() {
+	secret := os.Getenv(envRedactSecret)
+	if secret == "" {
+		secret = MoonConfig.RedactSecret
+	}
+	var err error
+	if redactor, err = newRedactor(MoonConfig.Redact, secret); err != nil {
+		if errors.Is(err, redact.ErrNoSecret) {
+			err = fmt.Errorf("%w, set redact-secret in config.yaml or %s", err, envRedactSecret)
+		}
+		logFatal(err)
+	}
+}
+
+func newRedactor(rules []*RedactConfig, secret string) (*redact.Redactor, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	redactRules := make([]*redact.Rule, 0, len(rules))
+	for _, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		redactRules = append(redactRules, &redact.Rule{
+			Name:     rule.Name,
+			Regex:    rule.Regex,
+			JSONPath: rule.JSONPath,
+			Header:   rule.Header,
+			In:       rule.In,
+			Mode:     rule.Mode,
+		})
+	}
+	return redact.New(redactRules, []byte(secret))
+}
+
+// redactCapture applies the rules to a captured request before it is persisted
+// and returns the headers formatted in the same way as formatHeader. Headers are
+// cloned, so that the request and response are left intact.
+func redactCapture(
+	request *http.Request,
+	requestBody []byte,
+	response *http.Response,
+	responseBody []byte,
+) (string, []byte, string, []byte) {
+	record := &redact.Record{
+		RequestBody:  requestBody,
+		ResponseBody: responseBody,
+	}
+	if request != nil {
+		record.RequestHeader = request.Header.Clone()
+	}
+	if response != nil {
+		record.ResponseHeader = response.Header.Clone()
+	}
+	redactor.Redact(record)
+	return writeHeader(record.RequestHeader),
+		record.RequestBody,
+		writeHeader(record.ResponseHeader),
+		record.ResponseBody
+}
+
+// redactRequest applies the rules to a persisted request, which may have been
+// captured before the rules were configured.
+func redactRequest(request *Request) []*redact.Redaction {
+	if redactor.Empty() {
+		return nil
+	}
+	record := &redact.Record{
+		RequestBody:  []byte(request.RequestBody.String),
+		ResponseBody: []byte(request.ResponseBody.String),
+	}
+	if request.RequestHeader.Valid {
+		record.RequestHeader = parseHeader(request.RequestHeader.String)
+	}
+	if request.ResponseHeader.Valid {
+		record.ResponseHeader = parseHeader(request.ResponseHeader.String)
+	}
+	redactions := redactor.Redact(record)
+	if len(redactions) == 0 {
+		return nil
+	}
+	if request.RequestHeader.Valid {
+		request.RequestHeader.String = writeHeader(record.RequestHeader)
+	}
+	if request.ResponseHeader.Valid {
+		request.ResponseHeader.String = writeHeader(record.ResponseHeader)
+	}
+	request.RequestBody = Body{sql.NullString{String: string(record.RequestBody), Valid: request.RequestBody.Valid}}
+	request.ResponseBody = Body{sql.NullString{String: string(record.ResponseBody), Valid: request.ResponseBody.Valid}}
+	return redactions
+}
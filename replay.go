@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tidwall/pretty"
+)
+
+type ReplayConfig struct {
+	Port int16  `yaml:"port"`
+	Key  string `yaml:"key"`
+	// Strict is deprecated, requests that match no captured request fail by
+	// default.
+	Strict      bool `yaml:"strict"`
+	Fallback    bool `yaml:"fallback"`
+	Passthrough bool `yaml:"passthrough"`
+}
+
+type unhashedRequest struct {
+	ID          int64 `db:"id"`
+	RequestBody Body  `db:"request_body"`
+}
+
+func replayCommand() *cobra.Command {
+	var cfg *ReplayConfig
+	if MoonConfig.Replay != nil {
+		cfg = MoonConfig.Replay
+	} else {
+		cfg = &ReplayConfig{}
+	}
+	if cfg.Port == 0 {
+		cfg.Port = defaultPort
+	}
+	var (
+		port        = cfg.Port
+		key         = cfg.Key
+		strict      = cfg.Strict
+		fallback    = cfg.Fallback
+		passthrough = cfg.Passthrough
+	)
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Start a server replaying captured responses for matching requests",
+		Run: func(cmd *cobra.Command, args []string) {
+			if fallback && passthrough {
+				logFatal(errors.New("--fallback and --passthrough can not be used together"))
+			}
+			if err := hashRequests(); err != nil {
+				logFatal(err)
+			}
+			ctx, stop := signal.NotifyContext(context.Background(),
+				syscall.SIGINT,
+				syscall.SIGTERM)
+			defer stop()
+			var proxy http.HandlerFunc
+			if passthrough {
+				// Passthrough requests are captured in the same way as by start.
+				prepareCapture()
+				defer closeStorages(storages)
+				routes, err := normalizeRoutes(MoonConfig.Routes)
+				if err != nil {
+					logFatal(err)
+				}
+				proxy = buildProxy(
+					endpoint,
+					routes,
+					key,
+					nil,
+					nil,
+					false,
+					defaultRepeatThreshold,
+					defaultRepeatMinLength,
+					false,
+					false,
+					defaultCacheMinBytes,
+					defaultCacheTTL,
+					defaultCacheCleanup,
+					nil,
+				)
+			}
+			httpServer.Handler = buildReplay(fallback, proxy)
+			httpServer.Addr = "127.0.0.1:" + strconv.Itoa(int(port))
+			go func() {
+				if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					logFatal(err)
+				}
+			}()
+			logServerStarts("http://" + httpServer.Addr + "/v1")
+			<-ctx.Done()
+			stop()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := httpServer.Shutdown(shutdownCtx); err != nil {
+				logFatal(err)
+			}
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.Int16VarP(&port, "port", "p", port, "port to listen on")
+	flags.StringVarP(&key, "key", "k", key, "API key by default, used by passthrough requests")
+	flags.BoolVar(&strict, "strict", strict, "fail requests that match no captured request")
+	flags.BoolVar(&fallback, "fallback", fallback, "replay the latest response of the same model for requests that match no captured request")
+	flags.BoolVar(&passthrough, "passthrough", passthrough, "forward requests that match no captured request to the upstream and capture them")
+	flags.MarkDeprecated("strict", "requests that match no captured request fail by default")
+	cmd.MarkFlagsMutuallyExclusive("fallback", "passthrough")
+	return cmd
+}
+
+// hashRequests computes request_hash for requests captured before the column
+// was introduced, so that they can be replayed as well.
+func hashRequests() error {
+	requests, err := persistence.ListUnhashedRequests()
+	if err != nil {
+		return err
+	}
+	for _, request := range requests {
+		if requestHash := hashRequest([]byte(request.RequestBody.String)); requestHash != "" {
+			if err = persistence.SetRequestHash(request.ID, requestHash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hashRequest hashes the fields of a chat completions request that determine
+// its response, so that two requests only differing in formatting, stream or
+// other options share the same hash.
+func hashRequest(requestBody []byte) string {
+	var requestObject struct {
+		Model       string          `json:"model"`
+		Messages    json.RawMessage `json:"messages"`
+		Tools       json.RawMessage `json:"tools"`
+		Temperature *float64        `json:"temperature"`
+	}
+	if err := json.Unmarshal(requestBody, &requestObject); err != nil || len(requestObject.Messages) == 0 {
+		return ""
+	}
+	hasher := hasherPool.Get().(hash.Hash)
+	defer putHasher(hasher)
+	hasher.Write([]byte(requestObject.Model))
+	hasher.Write([]byte{0})
+	hasher.Write(pretty.Ugly(requestObject.Messages))
+	hasher.Write([]byte{0})
+	hasher.Write(pretty.Ugly(requestObject.Tools))
+	hasher.Write([]byte{0})
+	if requestObject.Temperature != nil {
+		hasher.Write([]byte(strconv.FormatFloat(*requestObject.Temperature, 'g', -1, 64)))
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// buildReplay replays the captured response of the request with the same hash.
+// Requests that match no captured request fail, unless fallback is given, which
+// replays the latest response of the same model, or proxy is given, which
+// forwards them to the upstream.
+func buildReplay(fallback bool, proxy http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			encoder   = json.NewEncoder(w)
+			createdAt = time.Now()
+			request   *Request
+			matched   bool
+		)
+		requestBody, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeProxyError(encoder, w.Header(), w.WriteHeader, stepReadRequestBody, err)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/chat/completions") {
+			if requestHash := hashRequest(requestBody); requestHash != "" {
+				request, err = persistence.GetRequestByHash(requestHash)
+				matched = err == nil
+			}
+			if !matched && fallback && proxy == nil {
+				var requestObject struct {
+					Model string `json:"model"`
+				}
+				json.Unmarshal(requestBody, &requestObject)
+				request, err = persistence.GetRequestByModel(requestObject.Model)
+			}
+		} else {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			if proxy != nil && errors.Is(err, sql.ErrNoRows) {
+				r.Body = io.NopCloser(bytes.NewReader(requestBody))
+				proxy(w, r)
+				return
+			}
+			if errors.Is(err, sql.ErrNoRows) {
+				err = errors.New("no captured request matches " + r.Method + " " + r.URL.Path)
+			}
+			writeProxyError(encoder, w.Header(), w.WriteHeader, stepReplayRequest, err)
+			logReplay(r.Method, r.URL.Path, "500 "+http.StatusText(http.StatusInternalServerError), "", time.Since(createdAt), err)
+			return
+		}
+		var requestObject MoonshotStreamRequest
+		json.Unmarshal(requestBody, &requestObject)
+		writeReplay(w, r, request, requestObject.Stream != nil && *requestObject.Stream, createdAt)
+		var warning error
+		if !matched {
+			warning = errors.New("no captured request matches, replayed the latest response of the same model")
+		}
+		logReplay(r.Method, r.URL.Path, request.Status(), request.Ident(), time.Since(createdAt), warning)
+	}
+}
+
+func writeReplay(w http.ResponseWriter, r *http.Request, request *Request, stream bool, createdAt time.Time) {
+	if request.ResponseHeader.Valid {
+		mimeHeader, _ := textproto.
+			NewReader(bufio.NewReader(strings.NewReader(request.ResponseHeader.String + "\r\n\r\n"))).
+			ReadMIMEHeader()
+		for header, values := range mimeHeader {
+			for _, value := range values {
+				w.Header().Add(header, value)
+			}
+		}
+	}
+	// Captured bodies are stored decoded, the original framing no longer applies.
+	w.Header().Del("Content-Length")
+	w.Header().Del("Content-Encoding")
+	w.Header().Del("Transfer-Encoding")
+	isStream := request.ResponseContentType.String == "text/event-stream"
+	switch {
+	case isStream && stream:
+		w.WriteHeader(int(request.ResponseStatusCode.Int64))
+		replayEventStream(r.Context(), w, request, createdAt)
+	case isStream && !stream:
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(int(request.ResponseStatusCode.Int64))
+		if completion, err := decodeCompletion(mergeCompletion(request.ResponseBody.String)); err == nil {
+			completion["object"] = "chat.completion"
+			json.NewEncoder(w).Encode(completion)
+		}
+	case !isStream && stream:
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(int(request.ResponseStatusCode.Int64))
+		if completion, err := decodeCompletion(request.ResponseBody.String); err == nil {
+			w.Write(mockEventStream(completion))
+		}
+	default:
+		w.WriteHeader(int(request.ResponseStatusCode.Int64))
+		w.Write([]byte(request.ResponseBody.String))
+	}
+}
+
+// replayEventStream writes the captured event stream chunk by chunk, keeping
+// the original offset of each chunk relative to the start of the request. For
+// requests captured without response_timing, the chunks are spread between
+// ttft and latency. It stops as soon as ctx is done, which is when the client
+// disconnects.
+func replayEventStream(ctx context.Context, w http.ResponseWriter, request *Request, createdAt time.Time) {
+	var chunks [][]byte
+	scanner := bufio.NewScanner(strings.NewReader(request.ResponseBody.String))
+	scanner.Buffer(nil, len(request.ResponseBody.String)+1)
+	scanner.Split(splitFunc)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			chunks = append(chunks, bytes.Clone(line))
+		}
+	}
+	var timing []int
+	if request.ResponseTiming.Valid {
+		json.Unmarshal([]byte(request.ResponseTiming.String), &timing)
+	}
+	if len(timing) == 0 && len(chunks) > 0 {
+		var (
+			ttft    = int(request.ResponseTTFT.Int64)
+			latency = int(request.Latency.Int64 / int64(time.Millisecond))
+		)
+		timing = make([]int, len(chunks))
+		for i := range timing {
+			timing[i] = ttft + (latency-ttft)*i/len(chunks)
+		}
+	}
+	flusher, _ := w.(http.Flusher)
+	for i, chunk := range chunks {
+		var offset int
+		if i < len(timing) {
+			offset = timing[i]
+		} else if len(timing) > 0 {
+			offset = timing[len(timing)-1]
+		}
+		if wait := time.Duration(offset)*time.Millisecond - time.Since(createdAt); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		w.Write(chunk)
+		w.Write([]byte("\n\n"))
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MoonshotAI/moonpalace/redact"
+)
+
+func TestHashRequest(t *testing.T) {
+	const base = `{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}],"temperature":0.3}`
+	var testcases = []struct {
+		name string
+		body string
+		same bool
+	}{
+		{
+			name: "formatting",
+			body: `{ "model": "moonshot-v1-8k", "messages": [ {"role": "user", "content": "hi"} ], "temperature": 0.3 }`,
+			same: true,
+		},
+		{
+			name: "stream and other options",
+			body: `{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}],"temperature":0.3,"stream":true,"max_tokens":100}`,
+			same: true,
+		},
+		{
+			name: "model",
+			body: `{"model":"moonshot-v1-32k","messages":[{"role":"user","content":"hi"}],"temperature":0.3}`,
+		},
+		{
+			name: "messages",
+			body: `{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hello"}],"temperature":0.3}`,
+		},
+		{
+			name: "temperature",
+			body: `{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}],"temperature":0.5}`,
+		},
+		{
+			name: "tools",
+			body: `{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}],"temperature":0.3,"tools":[]}`,
+		},
+	}
+	want := hashRequest([]byte(base))
+	if want == "" {
+		t.Fatal("hashRequest: empty hash")
+	}
+	for _, testcase := range testcases {
+		if got := hashRequest([]byte(testcase.body)); (got == want) != testcase.same {
+			t.Errorf("%s: want same hash %v, got %q and %q", testcase.name, testcase.same, want, got)
+		}
+	}
+	for _, body := range []string{"", "{", `{"model":"moonshot-v1-8k"}`} {
+		if got := hashRequest([]byte(body)); got != "" {
+			t.Errorf("hashRequest(%q): want empty hash, got %q", body, got)
+		}
+	}
+}
+
+func TestBuildReplay(t *testing.T) {
+	usePersistenceForTest(t)
+	storeTestRequest(t,
+		`{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}]}`,
+	)
+	storeTestRequest(t,
+		`{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"bye"}]}`,
+		`{"id":"chatcmpl-2","choices":[{"index":0,"message":{"role":"assistant","content":"see you"},"finish_reason":"stop"}]}`,
+	)
+	var testcases = []struct {
+		name       string
+		fallback   bool
+		path       string
+		body       string
+		statusCode int
+		want       string
+	}{
+		{
+			name:       "matched",
+			path:       "/v1/chat/completions",
+			body:       `{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}],"max_tokens":10}`,
+			statusCode: http.StatusOK,
+			want:       `"content":"hello"`,
+		},
+		{
+			name:       "unmatched",
+			path:       "/v1/chat/completions",
+			body:       `{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"unknown"}]}`,
+			statusCode: http.StatusInternalServerError,
+			want:       "no captured request matches",
+		},
+		{
+			name:       "unmatched with fallback",
+			fallback:   true,
+			path:       "/v1/chat/completions",
+			body:       `{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"unknown"}]}`,
+			statusCode: http.StatusOK,
+			want:       `"content":"see you"`,
+		},
+		{
+			name:       "unmatched model with fallback",
+			fallback:   true,
+			path:       "/v1/chat/completions",
+			body:       `{"model":"moonshot-v1-32k","messages":[{"role":"user","content":"unknown"}]}`,
+			statusCode: http.StatusInternalServerError,
+			want:       "no captured request matches",
+		},
+		{
+			name:       "other endpoints",
+			fallback:   true,
+			path:       "/v1/files",
+			statusCode: http.StatusInternalServerError,
+			want:       "no captured request matches",
+		},
+	}
+	for _, testcase := range testcases {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, testcase.path, strings.NewReader(testcase.body))
+		buildReplay(testcase.fallback, nil)(recorder, request)
+		if recorder.Code != testcase.statusCode {
+			t.Errorf("%s: status code: want %d, got %d", testcase.name, testcase.statusCode, recorder.Code)
+		}
+		if body := recorder.Body.String(); !strings.Contains(body, testcase.want) {
+			t.Errorf("%s: want %q in body, got %s", testcase.name, testcase.want, body)
+		}
+	}
+}
+
+func TestReplayEventStreamCanceled(t *testing.T) {
+	request := &Request{
+		ResponseBody:   Body{NullString: sql.NullString{String: "data: {\"id\":1}\n\ndata: {\"id\":2}\n\ndata: [DONE]", Valid: true}},
+		ResponseTiming: sql.NullString{String: "[0,60000,60000]", Valid: true},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	var (
+		recorder = httptest.NewRecorder()
+		start    = time.Now()
+	)
+	replayEventStream(ctx, recorder, request, start)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("replayEventStream: returned %s after the client disconnected", elapsed)
+	}
+	if body := recorder.Body.String(); body != "data: {\"id\":1}\n\n" {
+		t.Errorf("replayEventStream: want the first chunk only, got %q", body)
+	}
+}
+
+func TestReplayPassthroughRedaction(t *testing.T) {
+	usePersistenceForTest(t)
+	var (
+		config    = MoonConfig
+		rules     = redactor
+		source    = recordSource
+		transport = httpClient.Transport
+		saved     = storages
+	)
+	t.Cleanup(func() {
+		MoonConfig, redactor, recordSource, httpClient.Transport, storages = config, rules, source, transport, saved
+	})
+	MoonConfig = Config{Redact: []*RedactConfig{{Name: "api-key", Regex: `sk-[A-Za-z0-9]+`}}}
+	httpClient.Transport = newTestMockTransport()
+	// The same as replay does with --passthrough.
+	prepareCapture()
+	proxy := buildProxy(mockEndpoint, nil, "", nil, nil, false, 0, 0, false, false, 0, 0, 0, nil)
+	recorder := serveTestProxy(t, buildReplay(false, proxy), httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"my key is sk-abcdef123456"}]}`)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("want status code %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	id, err := persistence.LatestRequestID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := persistence.GetRequest(id, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := request.RequestBody.String; strings.Contains(body, "sk-abcdef123456") || !strings.Contains(body, redact.Masked) {
+		t.Errorf("want the key redacted in the captured request, got %s", body)
+	}
+}
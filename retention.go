@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	parser "github.com/MoonshotAI/moonpalace/predicate"
+)
+
+type RetentionConfig struct {
+	// Interval is the time in seconds between two runs of the retention rules.
+	Interval        int      `yaml:"interval"`
+	KeepDays        int      `yaml:"keep-days"`
+	MaxRows         int64    `yaml:"max-rows"`
+	MaxSize         int64    `yaml:"max-size"`
+	DropBodiesAfter int      `yaml:"drop-bodies-after"`
+	Keep            []string `yaml:"keep"`
+	NoVacuum        bool     `yaml:"no-vacuum"`
+}
+
+const (
+	defaultRetentionInterval = 3600
+
+	// maxSizeRounds limits the rounds of deleting the oldest requests until the
+	// database is smaller than max-size.
+	maxSizeRounds = 16
+
+	// Requests are deleted and have their bodies dropped in batches, each batch
+	// holds the write lock of the database only briefly, so that requests
+	// captured meanwhile are not blocked for long.
+	retentionBatchSize  = 1000
+	retentionBatchPause = 10 * time.Millisecond
+
+	// VACUUM blocks requests from being captured for as long as it takes, it is
+	// run once no request is proxied for retentionIdleTime, which is checked
+	// every retentionIdleCheck.
+	retentionIdleTime  = 30 * time.Second
+	retentionIdleCheck = 5 * time.Second
+)
+
+type retention struct {
+	*RetentionConfig
+	// keep is the parsed predicate matching requests which are never deleted and
+	// whose bodies are never dropped.
+	keep string
+}
+
+type retentionResult struct {
+	Deleted int64
+	Dropped int64
+}
+
+func newRetention(cfg *RetentionConfig) (*retention, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if cfg.Interval < 0 || cfg.KeepDays < 0 || cfg.MaxRows < 0 || cfg.MaxSize < 0 || cfg.DropBodiesAfter < 0 {
+		return nil, errors.New("retention: interval, keep-days, max-rows, max-size and drop-bodies-after should not be negative")
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = defaultRetentionInterval
+	}
+	// Requests are kept if they match any of the keep predicates, good and bad
+	// cases labelled by the tag command are always kept. Predicates on NULL
+	// columns are NULL, which are taken as false, otherwise not (keep) would be
+	// NULL as well and such requests would never be deleted.
+	keep := make([]string, 0, len(cfg.Keep)+1)
+	keep = append(keep, fmt.Sprintf("coalesce((category in ('%s', '%s')), 0)", categoryGoodCase, categoryBadCase))
+	for _, predicate := range cfg.Keep {
+		parsed, err := parser.Parse(predicate)
+		if err != nil {
+			return nil, fmt.Errorf("retention: keep: %w", err)
+		}
+		keep = append(keep, "coalesce(("+parsed+"), 0)")
+	}
+	return &retention{RetentionConfig: cfg, keep: strings.Join(keep, " or ")}, nil
+}
+
+// unkept returns the predicate matching requests which can be deleted.
+func (r *retention) unkept() string {
+	if r.keep == "" {
+		return ""
+	}
+	return "not (" + r.keep + ")"
+}
+
+// run applies the retention rules once, the database is VACUUMed afterwards by
+// runRetention if any request is deleted or has its bodies dropped.
+func (r *retention) run(now time.Time) (*retentionResult, error) {
+	var (
+		result = new(retentionResult)
+		unkept = r.unkept()
+	)
+	if r.KeepDays > 0 {
+		before := now.AddDate(0, 0, -r.KeepDays).Format(time.DateTime)
+		if err := deleteRequests(result, before, 0, unkept, 0); err != nil {
+			return result, err
+		}
+	}
+	if r.MaxRows > 0 {
+		id, err := persistence.NthLatestRequestID(r.MaxRows - 1)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return result, err
+		default:
+			if err = deleteRequests(result, "", id, unkept, 0); err != nil {
+				return result, err
+			}
+		}
+	}
+	if r.DropBodiesAfter > 0 {
+		before := now.AddDate(0, 0, -r.DropBodiesAfter).Format(time.DateTime)
+		if err := dropBodies(result, before, unkept); err != nil {
+			return result, err
+		}
+	}
+	if r.MaxSize > 0 {
+		if err := r.limitSize(result, unkept); err != nil {
+			return result, err
+		}
+	}
+	if result.Deleted == 0 && result.Dropped == 0 {
+		return result, nil
+	}
+	if err := persistence.CleanupFullTextIndex(); err != nil {
+		return result, err
+	}
+	if err := persistence.CleanupAnnotations(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// limitSize deletes the oldest requests until the pages in use take less than
+// max-size MB, which is the size of the database file after VACUUM. The number
+// of requests to delete in each round is estimated by the average size of them.
+func (r *retention) limitSize(result *retentionResult, unkept string) error {
+	maxSize := r.MaxSize * 1024 * 1024
+	for round := 0; round < maxSizeRounds; round++ {
+		usage, err := persistence.databaseUsage()
+		if err != nil {
+			return err
+		}
+		if usage <= maxSize {
+			return nil
+		}
+		count, err := persistence.CountRequests()
+		if err != nil || count == 0 {
+			return err
+		}
+		n := count*(usage-maxSize)/usage + 1
+		deleted := result.Deleted
+		if err = deleteRequests(result, "", 0, unkept, n); err != nil {
+			return err
+		}
+		// Pages of the full-text index are released as well.
+		if err = persistence.CleanupFullTextIndex(); err != nil {
+			return err
+		}
+		if result.Deleted == deleted {
+			// All the remaining requests are kept.
+			return nil
+		}
+	}
+	return nil
+}
+
+// deleteRequests deletes at most n requests, or all of them if n is 0, in
+// batches of retentionBatchSize.
+func deleteRequests(result *retentionResult, before string, beforeID int64, predicate string, n int64) error {
+	return inBatches(n, &result.Deleted, func(limit int64) (sql.Result, error) {
+		return persistence.DeleteRequests(before, beforeID, predicate, limit)
+	})
+}
+
+func dropBodies(result *retentionResult, before string, predicate string) error {
+	return inBatches(0, &result.Dropped, func(limit int64) (sql.Result, error) {
+		return persistence.DropBodies(before, predicate, limit)
+	})
+}
+
+// inBatches executes the statement with a limit of retentionBatchSize until
+// fewer rows than the limit are affected, or n rows are affected in total if n
+// is not 0. The affected rows are added to total.
+func inBatches(n int64, total *int64, exec func(limit int64) (sql.Result, error)) error {
+	for affected := int64(0); n == 0 || affected < n; {
+		limit := int64(retentionBatchSize)
+		if n > 0 {
+			limit = min(limit, n-affected)
+		}
+		result, err := exec(limit)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		affected += rowsAffected
+		*total += rowsAffected
+		if rowsAffected < limit {
+			return nil
+		}
+		time.Sleep(retentionBatchPause)
+	}
+	return nil
+}
+
+// runRetention applies the retention rules on start and then every interval
+// until ctx is done. The database is VACUUMed once the proxy is idle unless
+// no-vacuum is set.
+func runRetention(ctx context.Context, r *retention) {
+	ticker := time.NewTicker(time.Duration(r.Interval) * time.Second)
+	defer ticker.Stop()
+	idleTicker := time.NewTicker(retentionIdleCheck)
+	defer idleTicker.Stop()
+	var pendingVacuum bool
+	for {
+		result, err := r.run(time.Now())
+		logRetention(result, err)
+		if result != nil && (result.Deleted > 0 || result.Dropped > 0) && !r.NoVacuum {
+			pendingVacuum = true
+		}
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				break wait
+			case now := <-idleTicker.C:
+				if pendingVacuum && proxyActivity.idle(now, retentionIdleTime) {
+					pendingVacuum = false
+					if err = vacuum(); err != nil {
+						logRetention(nil, fmt.Errorf("vacuum: %w", err))
+					}
+				}
+			}
+		}
+	}
+}
+
+// activity tracks the requests being proxied, so that the database is only
+// VACUUMed when the proxy is idle.
+type activity struct {
+	inflight atomic.Int64
+	// last is the time in Unix nanoseconds at which the last request finished.
+	last atomic.Int64
+}
+
+var proxyActivity activity
+
+func (a *activity) begin() {
+	a.inflight.Add(1)
+}
+
+func (a *activity) end() {
+	a.last.Store(time.Now().UnixNano())
+	a.inflight.Add(-1)
+}
+
+// idle reports whether no request is being proxied and none has finished for
+// the duration.
+func (a *activity) idle(now time.Time, duration time.Duration) bool {
+	return a.inflight.Load() == 0 && now.Sub(time.Unix(0, a.last.Load())) >= duration
+}
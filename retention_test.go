@@ -0,0 +1,245 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/x5iu/defc/sqlx"
+
+	"github.com/MoonshotAI/moonpalace/storage"
+)
+
+func TestRetention(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		config *RetentionConfig
+		want   []string
+	}{
+		{
+			name:   "keep days",
+			config: &RetentionConfig{KeepDays: 1},
+			want:   []string{"goodcase", "recent"},
+		},
+		{
+			name:   "keep failed requests",
+			config: &RetentionConfig{KeepDays: 1, Keep: []string{"response_status_code >= 500"}},
+			want:   []string{"failed", "goodcase", "recent"},
+		},
+		{
+			name:   "keep predicates on NULL columns",
+			config: &RetentionConfig{KeepDays: 1, Keep: []string{"response_status_code >= 500", "moonshot_id != 'chatcmpl-1'"}},
+			want:   []string{"failed", "goodcase", "recent"},
+		},
+		{
+			name:   "max rows",
+			config: &RetentionConfig{MaxRows: 2, Keep: []string{"response_status_code >= 500"}},
+			want:   []string{"failed", "goodcase", "recent"},
+		},
+	}
+	now := time.Now()
+	for _, testcase := range testcases {
+		usePersistenceForTest(t)
+		// Requests are named by request_id, the one without status code is a
+		// network error and has a NULL response_status_code.
+		names := make(map[int64]string)
+		for _, request := range []struct {
+			name       string
+			statusCode int
+			createdAt  time.Time
+		}{
+			{name: "error", createdAt: now.AddDate(0, 0, -3)},
+			{name: "failed", statusCode: 500, createdAt: now.AddDate(0, 0, -3)},
+			{name: "succeeded", statusCode: 200, createdAt: now.AddDate(0, 0, -3)},
+			{name: "goodcase", statusCode: 200, createdAt: now.AddDate(0, 0, -2)},
+			{name: "recent", statusCode: 200, createdAt: now},
+		} {
+			id, err := (sqliteStorage{}).Store(&storage.Record{
+				RequestID:          request.name,
+				RequestMethod:      "POST",
+				RequestPath:        "/v1/chat/completions",
+				RequestBody:        []byte(`{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}]}`),
+				ResponseStatusCode: request.statusCode,
+				CreatedAt:          request.createdAt,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			names[id] = request.name
+		}
+		for id, name := range names {
+			if name == "goodcase" {
+				if err := persistence.SetCategory(id, categoryGoodCase); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		testcase.config.NoVacuum = true
+		r, err := newRetention(testcase.config)
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		if _, err = r.run(now); err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		requests, err := persistence.ListRequests(10, false, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, request := range requests {
+			got = append(got, names[request.ID])
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, testcase.want) {
+			t.Errorf("%s: want %v kept, got %v", testcase.name, testcase.want, got)
+		}
+	}
+}
+
+func TestRetentionUnkept(t *testing.T) {
+	var testcases = []struct {
+		keep []string
+		want string
+	}{
+		{
+			want: "not (coalesce((category in ('goodcase', 'badcase')), 0))",
+		},
+		{
+			keep: []string{"response_status_code >= 500"},
+			want: "not (coalesce((category in ('goodcase', 'badcase')), 0) or coalesce((response_status_code >= 500), 0))",
+		},
+	}
+	for _, testcase := range testcases {
+		r, err := newRetention(&RetentionConfig{Keep: testcase.keep})
+		if err != nil {
+			t.Fatalf("%v: %s", testcase.keep, err)
+		}
+		if got := r.unkept(); got != testcase.want {
+			t.Errorf("%v: want %s, got %s", testcase.keep, testcase.want, got)
+		}
+	}
+}
+
+func TestRetentionConcurrentInsert(t *testing.T) {
+	db := usePersistenceForTest(t)
+	now := time.Now()
+	const oldRows = 3*retentionBatchSize + 1
+	if _, err := db.Exec(`
+		with recursive n(i) as (select 1 union all select i + 1 from n where i < ?)
+		insert into moonshot_requests (request_method, request_path, request_query, created_at, response_status_code)
+		select 'POST', '/v1/chat/completions', '', ?, 200 from n;
+	`, oldRows, now.AddDate(0, 0, -3).Format(time.DateTime)); err != nil {
+		t.Fatal(err)
+	}
+	r, err := newRetention(&RetentionConfig{KeepDays: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		done   = make(chan struct{})
+		result *retentionResult
+	)
+	go func() {
+		defer close(done)
+		result, err = r.run(now)
+	}()
+	// Requests are captured while the old ones are being deleted.
+	var inserted int
+	for running := true; running || inserted == 0; inserted++ {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		if _, storeErr := storeRecord(&storage.Record{
+			RequestMethod:      "POST",
+			RequestPath:        "/v1/chat/completions",
+			ResponseStatusCode: 200,
+			CreatedAt:          now,
+		}); storeErr != nil {
+			t.Fatalf("insert #%d: %s", inserted, storeErr)
+		}
+	}
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Deleted != oldRows {
+		t.Errorf("want %d requests deleted, got %d", oldRows, result.Deleted)
+	}
+	count, err := persistence.CountRequests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != int64(inserted) {
+		t.Errorf("want %d requests captured during retention kept, got %d", inserted, count)
+	}
+}
+
+func TestStoreBusy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "moonpalace.sqlite")
+	// A short busy timeout, so that stores fail with SQLITE_BUSY while the
+	// database is locked by another connection.
+	db, err := sqlx.Open(sqlDriver, "file:"+path+"?_busy_timeout=50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, previousTableInfos := persistence, tableInfos
+	t.Cleanup(func() {
+		db.Close()
+		persistence, tableInfos = previous, previousTableInfos
+	})
+	persistence = NewPersistenceFromDB(db)
+	if err = preparePersistence(); err != nil {
+		t.Fatal(err)
+	}
+	locker, err := sql.Open(sqlDriver, "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer locker.Close()
+	tx, err := locker.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("delete from moonshot_requests;"); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(3*storeBusyInterval, func() { tx.Rollback() })
+	id, err := (sqliteStorage{}).Store(&storage.Record{
+		RequestMethod:      "POST",
+		RequestPath:        "/v1/chat/completions",
+		ResponseStatusCode: 200,
+		CreatedAt:          time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("want the store retried until the lock is released, got %s", err)
+	}
+	if id == 0 {
+		t.Errorf("want the id of the stored request, got 0")
+	}
+}
+
+func TestActivityIdle(t *testing.T) {
+	var (
+		a   activity
+		now = time.Now()
+	)
+	if !a.idle(now, retentionIdleTime) {
+		t.Errorf("no requests: want idle")
+	}
+	a.begin()
+	if a.idle(now.Add(time.Hour), retentionIdleTime) {
+		t.Errorf("request in flight: want not idle")
+	}
+	a.end()
+	if a.idle(time.Now(), retentionIdleTime) {
+		t.Errorf("request just finished: want not idle")
+	}
+	if !a.idle(time.Now().Add(retentionIdleTime), retentionIdleTime) {
+		t.Errorf("request finished %s ago: want idle", retentionIdleTime)
+	}
+}
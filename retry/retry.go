@@ -0,0 +1,79 @@
+package retry
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BackoffConstant    = "constant"
+	BackoffLinear      = "linear"
+	BackoffExponential = "exponential"
+)
+
+type Policy struct {
+	Max         int
+	On          []int
+	Backoff     string
+	Interval    time.Duration
+	MaxInterval time.Duration
+}
+
+// Retryable reports whether a response with the status code should be retried,
+// statusCode is 0 when no response was received at all.
+func (p *Policy) Retryable(statusCode int) bool {
+	if statusCode == 0 {
+		return true
+	}
+	return slices.Contains(p.On, statusCode)
+}
+
+// Delay returns how long to wait before the attempt-th retry, attempt starts
+// from 1. The value of a Retry-After header takes precedence over the backoff
+// strategy, but is still capped by MaxInterval.
+func (p *Policy) Delay(attempt int, retryAfter string, now time.Time) time.Duration {
+	delay, ok := ParseRetryAfter(retryAfter, now)
+	if !ok {
+		switch strings.ToLower(p.Backoff) {
+		case BackoffConstant:
+			delay = p.Interval
+		case BackoffLinear:
+			delay = p.Interval * time.Duration(attempt)
+		default:
+			delay = time.Duration(float64(p.Interval) * math.Pow(2, float64(attempt-1)))
+		}
+	}
+	if p.MaxInterval > 0 && delay > p.MaxInterval {
+		delay = p.MaxInterval
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
+
+// ParseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,117 @@
+package retry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPolicyRetryable(t *testing.T) {
+	policy := &Policy{On: []int{429, 500, 502, 503}}
+	var testcases = []struct {
+		statusCode int
+		want       bool
+	}{
+		{statusCode: 0, want: true},
+		{statusCode: 429, want: true},
+		{statusCode: 503, want: true},
+		{statusCode: 400, want: false},
+		{statusCode: 504, want: false},
+	}
+	for _, testcase := range testcases {
+		if got := policy.Retryable(testcase.statusCode); got != testcase.want {
+			t.Errorf("Retryable(%d): want %v, got %v", testcase.statusCode, testcase.want, got)
+		}
+	}
+}
+
+func TestPolicyDelay(t *testing.T) {
+	now := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	var testcases = []struct {
+		name       string
+		policy     *Policy
+		attempt    int
+		retryAfter string
+		want       time.Duration
+	}{
+		{
+			name:    "exponential",
+			policy:  &Policy{Backoff: BackoffExponential, Interval: time.Second},
+			attempt: 3,
+			want:    4 * time.Second,
+		},
+		{
+			name:    "linear",
+			policy:  &Policy{Backoff: BackoffLinear, Interval: time.Second},
+			attempt: 3,
+			want:    3 * time.Second,
+		},
+		{
+			name:    "constant",
+			policy:  &Policy{Backoff: BackoffConstant, Interval: time.Second},
+			attempt: 3,
+			want:    time.Second,
+		},
+		{
+			name:    "unknown backoff falls back to exponential",
+			policy:  &Policy{Backoff: "", Interval: 100 * time.Millisecond},
+			attempt: 2,
+			want:    200 * time.Millisecond,
+		},
+		{
+			name:    "max interval",
+			policy:  &Policy{Backoff: BackoffExponential, Interval: time.Second, MaxInterval: 5 * time.Second},
+			attempt: 10,
+			want:    5 * time.Second,
+		},
+		{
+			name:       "retry after seconds",
+			policy:     &Policy{Backoff: BackoffExponential, Interval: time.Second},
+			attempt:    1,
+			retryAfter: "7",
+			want:       7 * time.Second,
+		},
+		{
+			name:       "retry after date",
+			policy:     &Policy{Backoff: BackoffExponential, Interval: time.Second},
+			attempt:    1,
+			retryAfter: now.Add(10 * time.Second).Format(http.TimeFormat),
+			want:       10 * time.Second,
+		},
+		{
+			name:       "retry after capped",
+			policy:     &Policy{Backoff: BackoffExponential, Interval: time.Second, MaxInterval: 3 * time.Second},
+			attempt:    1,
+			retryAfter: "60",
+			want:       3 * time.Second,
+		},
+	}
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			if got := testcase.policy.Delay(testcase.attempt, testcase.retryAfter, now); got != testcase.want {
+				t.Errorf("want %s, got %s", testcase.want, got)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	var testcases = []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{value: "", want: 0, ok: false},
+		{value: "1.5", want: 1500 * time.Millisecond, ok: true},
+		{value: "-1", want: 0, ok: false},
+		{value: "soon", want: 0, ok: false},
+		{value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, ok: true},
+	}
+	for _, testcase := range testcases {
+		got, ok := ParseRetryAfter(testcase.value, now)
+		if got != testcase.want || ok != testcase.ok {
+			t.Errorf("ParseRetryAfter(%q): want (%s, %v), got (%s, %v)", testcase.value, testcase.want, testcase.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MoonshotAI/moonpalace/retry"
+	"github.com/MoonshotAI/moonpalace/storage"
+)
+
+type RetryConfig struct {
+	// Max is a pointer so that max: 0, which turns off retries, is told apart
+	// from an unset max.
+	Max         *int   `yaml:"max"`
+	On          []int  `yaml:"on"`
+	Backoff     string `yaml:"backoff"`
+	Interval    int    `yaml:"interval"`
+	MaxInterval int    `yaml:"max-interval"`
+}
+
+const (
+	defaultRetryMax         = 3
+	defaultRetryBackoff     = retry.BackoffExponential
+	defaultRetryInterval    = 1000
+	defaultRetryMaxInterval = 30000
+)
+
+// defaultRetryMaxValue is addressable so that it can be the default max of
+// RetryConfig.
+var defaultRetryMaxValue = defaultRetryMax
+
+var defaultRetryOn = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+}
+
+// maxAttemptBodyBytes limits how much of a failed attempt's response body is
+// read and persisted, error responses are expected to be small.
+const maxAttemptBodyBytes = 1 << 20
+
+// shouldRetry reports whether the attempt-th retry should be made. Requests
+// cancelled by the client are never retried, since no one is waiting for the
+// response.
+func shouldRetry(ctx context.Context, policy *retry.Policy, attempt int, response *http.Response, err error) bool {
+	if policy == nil || attempt > policy.Max || ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return policy.Retryable(0)
+	}
+	return policy.Retryable(response.StatusCode)
+}
+
+func waitRetry(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// persistAttempt records a failed attempt as its own row and returns the id of
+// the row in the local SQLite database, or 0 if it is not one of the storages,
+// the response body of the attempt is consumed and closed.
+func persistAttempt(
+	requestID string,
+	requestContentType string,
+	requestMethod string,
+	requestPath string,
+	requestQuery string,
+	newRequest *http.Request,
+	requestBody []byte,
+	newResponse *http.Response,
+	err error,
+	createdAt time.Time,
+	requestEndpoint string,
+	attempt int,
+	kIdent string,
+) (int64, error) {
+	var (
+		moonshotGID          string
+		moonshotUID          string
+		moonshotRequestID    string
+		moonshotServerTiming int
+		responseStatusCode   int
+		responseContentType  string
+		responseBody         []byte
+		requestHash          string
+	)
+	if newResponse != nil {
+		defer newResponse.Body.Close()
+		responseBody, _ = io.ReadAll(io.LimitReader(newResponse.Body, maxAttemptBodyBytes))
+		if isGzip(newResponse.Header) {
+			if gzipReader, gzipErr := gzip.NewReader(bytes.NewReader(responseBody)); gzipErr == nil {
+				if decoded, readErr := io.ReadAll(gzipReader); readErr == nil {
+					responseBody = decoded
+				}
+				gzipReader.Close()
+			}
+		}
+		moonshotGID = newResponse.Header.Get("Msh-Gid")
+		moonshotUID = newResponse.Header.Get("Msh-Uid")
+		moonshotRequestID = newResponse.Header.Get("Msh-Request-Id")
+		moonshotServerTiming = parseServerTiming(newResponse.Header.Get("Server-Timing"))
+		responseStatusCode = newResponse.StatusCode
+		responseContentType = filterHeaderFlags(newResponse.Header.Get("Content-Type"))
+		err = &moonshotError{message: string(responseBody)}
+	}
+	if strings.HasSuffix(requestPath, "/chat/completions") {
+		requestHash = hashRequest(requestBody)
+	}
+	requestHeader, redactedRequestBody, responseHeader, redactedResponseBody :=
+		redactCapture(newRequest, requestBody, newResponse, responseBody)
+	return storeRecord(&storage.Record{
+		Source:               recordSource,
+		RequestID:            requestID,
+		RequestContentType:   requestContentType,
+		RequestMethod:        requestMethod,
+		RequestPath:          requestPath,
+		RequestQuery:         requestQuery,
+		MoonshotGID:          moonshotGID,
+		MoonshotUID:          moonshotUID,
+		MoonshotRequestID:    moonshotRequestID,
+		MoonshotServerTiming: moonshotServerTiming,
+		ResponseStatusCode:   responseStatusCode,
+		ResponseContentType:  responseContentType,
+		RequestHeader:        requestHeader,
+		RequestBody:          redactedRequestBody,
+		ResponseHeader:       responseHeader,
+		ResponseBody:         redactedResponseBody,
+		Error:                toErrMsg(err),
+		Latency:              time.Since(createdAt),
+		Endpoint:             requestEndpoint,
+		RequestHash:          requestHash,
+		Attempt:              attempt,
+		KIdent:               kIdent,
+		CreatedAt:            createdAt,
+	})
+}
+
+func parseServerTiming(serverTiming string) (timing int) {
+	if serverTiming != "" {
+		parts := strings.Split(serverTiming, ";")
+		for _, part := range parts {
+			if part = strings.TrimSpace(part); strings.HasPrefix(part, "dur=") {
+				timing, _ = strconv.Atoi(strings.TrimPrefix(part, "dur="))
+				break
+			}
+		}
+	}
+	return timing
+}
+
+func newRetryPolicy(max int, on []int, backoff string, interval int, maxInterval int) (*retry.Policy, error) {
+	switch backoff {
+	case retry.BackoffConstant, retry.BackoffLinear, retry.BackoffExponential:
+	default:
+		return nil, fmt.Errorf("retry: unknown backoff %q, expected one of constant, linear and exponential", backoff)
+	}
+	if max < 0 || interval < 0 || maxInterval < 0 {
+		return nil, errors.New("retry: max, interval and max-interval should not be negative")
+	}
+	return &retry.Policy{
+		Max:         max,
+		On:          slices.Clone(on),
+		Backoff:     backoff,
+		Interval:    time.Duration(interval) * time.Millisecond,
+		MaxInterval: time.Duration(maxInterval) * time.Millisecond,
+	}, nil
+}
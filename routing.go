@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/MoonshotAI/moonpalace/ratelimit"
+)
+
+type RouteConfig struct {
+	Model    string       `yaml:"model"`
+	Endpoint string       `yaml:"endpoint"`
+	Key      string       `yaml:"key"`
+	Limit    *LimitConfig `yaml:"limit"`
+
+	limiter *ratelimit.Limiter
+}
+
+// normalizeRoutes validates the routes from config.yaml and normalizes their
+// endpoints in the same way as the --endpoint option.
+func normalizeRoutes(routes []*RouteConfig) ([]*RouteConfig, error) {
+	normalized := make([]*RouteConfig, 0, len(routes))
+	for i, route := range routes {
+		if route == nil {
+			continue
+		}
+		if route.Model == "" {
+			return nil, fmt.Errorf("routes[%d]: model is required", i)
+		}
+		if _, err := path.Match(route.Model, ""); err != nil {
+			return nil, fmt.Errorf("routes[%d]: invalid model pattern %q: %w", i, route.Model, err)
+		}
+		if route.Endpoint == "" {
+			return nil, fmt.Errorf("routes[%d]: endpoint is required", i)
+		}
+		limiter, err := newLimiter(route.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("routes[%d].limit: %w", i, err)
+		}
+		normalized = append(normalized, &RouteConfig{
+			Model:    route.Model,
+			Endpoint: normalizeEndpoint(route.Endpoint),
+			Key:      route.Key,
+			Limit:    route.Limit,
+			limiter:  limiter,
+		})
+	}
+	return normalized, nil
+}
+
+// matchRoute returns the first route whose model pattern matches the model, the
+// patterns follow the syntax of path.Match, such as "moonshot-v1-*".
+func matchRoute(routes []*RouteConfig, model string) *RouteConfig {
+	if model == "" {
+		return nil
+	}
+	for _, route := range routes {
+		if matched, _ := path.Match(route.Model, model); matched {
+			return route
+		}
+	}
+	return nil
+}
+
+func normalizeEndpoint(endpoint string) string {
+	if eUrl, err := url.Parse(endpoint); err == nil {
+		if eUrl.Scheme == "" {
+			eUrl.Scheme = "https"
+		}
+		endpoint = eUrl.String()
+	}
+	return strings.TrimSuffix(endpoint, "/")
+}
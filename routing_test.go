@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeRoutes(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		routes []*RouteConfig
+		want   []string
+		err    string
+	}{
+		{
+			name: "endpoints",
+			routes: []*RouteConfig{
+				{Model: "moonshot-v1-*", Endpoint: "api.moonshot.cn/"},
+				nil,
+				{Model: "*", Endpoint: "http://127.0.0.1:8000"},
+			},
+			want: []string{"https://api.moonshot.cn", "http://127.0.0.1:8000"},
+		},
+		{
+			name:   "missing model",
+			routes: []*RouteConfig{{Endpoint: "https://api.moonshot.cn"}},
+			err:    "routes[0]: model is required",
+		},
+		{
+			name:   "invalid pattern",
+			routes: []*RouteConfig{{Model: "moonshot-[", Endpoint: "https://api.moonshot.cn"}},
+			err:    "routes[0]: invalid model pattern",
+		},
+		{
+			name:   "missing endpoint",
+			routes: []*RouteConfig{{Model: "*"}},
+			err:    "routes[0]: endpoint is required",
+		},
+	}
+	for _, testcase := range testcases {
+		routes, err := normalizeRoutes(testcase.routes)
+		if testcase.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), testcase.err) {
+				t.Errorf("%s: want error %q, got %v", testcase.name, testcase.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", testcase.name, err)
+		}
+		if len(routes) != len(testcase.want) {
+			t.Fatalf("%s: want %d routes, got %d", testcase.name, len(testcase.want), len(routes))
+		}
+		for i, route := range routes {
+			if route.Endpoint != testcase.want[i] {
+				t.Errorf("%s: routes[%d]: want endpoint %q, got %q", testcase.name, i, testcase.want[i], route.Endpoint)
+			}
+		}
+	}
+}
+
+func TestMatchRoute(t *testing.T) {
+	routes := []*RouteConfig{
+		{Model: "moonshot-v1-*", Endpoint: "https://api.moonshot.cn"},
+		{Model: "kimi-k?", Endpoint: "https://api-sg.moonshot.ai"},
+		{Model: "kimi-*", Endpoint: "http://127.0.0.1:8000"},
+	}
+	var testcases = []struct {
+		model string
+		want  string
+	}{
+		{model: "moonshot-v1-8k", want: "https://api.moonshot.cn"},
+		{model: "moonshot-v1-auto", want: "https://api.moonshot.cn"},
+		{model: "kimi-k2", want: "https://api-sg.moonshot.ai"},
+		{model: "kimi-latest", want: "http://127.0.0.1:8000"},
+		{model: "moonshot-v2", want: ""},
+		{model: "", want: ""},
+	}
+	for _, testcase := range testcases {
+		var got string
+		if route := matchRoute(routes, testcase.model); route != nil {
+			got = route.Endpoint
+		}
+		if got != testcase.want {
+			t.Errorf("matchRoute(%q): want %q, got %q", testcase.model, testcase.want, got)
+		}
+	}
+}
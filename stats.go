@@ -0,0 +1,299 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/mattn/go-sqlite3"
+	"github.com/spf13/cobra"
+)
+
+const (
+	groupByModel = "model"
+	groupByPath  = "path"
+	groupByGID   = "gid"
+	groupByDay   = "day"
+)
+
+type statsRow struct {
+	ID                   int64           `db:"id"`
+	RequestPath          string          `db:"request_path"`
+	MoonshotGID          sql.NullString  `db:"moonshot_gid"`
+	ResponseStatusCode   sql.NullInt64   `db:"response_status_code"`
+	Error                sql.NullString  `db:"error"`
+	ResponseTTFT         sql.NullInt64   `db:"response_ttft"`
+	Latency              sql.NullInt64   `db:"latency"`
+	MoonshotServerTiming sql.NullInt64   `db:"moonshot_server_timing"`
+	Cost                 sql.NullFloat64 `db:"cost"`
+	CreatedAt            SqliteTime      `db:"created_at"`
+	Model                sql.NullString  `db:"model"`
+	Usage                sql.NullString  `db:"usage"`
+}
+
+func (r *statsRow) HasError() bool {
+	return !r.ResponseStatusCode.Valid || r.ResponseStatusCode.Int64 >= http.StatusBadRequest || r.Error.Valid
+}
+
+func (r *statsRow) Group(groupBy string) string {
+	switch groupBy {
+	case groupByPath:
+		return r.RequestPath
+	case groupByGID:
+		return r.MoonshotGID.String
+	case groupByDay:
+		return r.CreatedAt.Format(time.DateOnly)
+	default:
+		return r.Model.String
+	}
+}
+
+// Stats is the aggregation of requests in a group, durations are measured in
+// milliseconds.
+type Stats struct {
+	Group            string       `json:"group"`
+	Requests         int          `json:"requests"`
+	Errors           int          `json:"errors"`
+	ErrorRate        float64      `json:"error_rate"`
+	TTFT             *Percentiles `json:"ttft"`
+	Latency          *Percentiles `json:"latency"`
+	ServerTiming     *Percentiles `json:"server_timing"`
+	PromptTokens     int          `json:"prompt_tokens"`
+	CompletionTokens int          `json:"completion_tokens"`
+	CachedTokens     int          `json:"cached_tokens"`
+	TotalTokens      int          `json:"total_tokens"`
+	Cost             float64      `json:"cost"`
+
+	ttft         []int64
+	latency      []int64
+	serverTiming []int64
+}
+
+type Percentiles struct {
+	P50 int64 `json:"p50"`
+	P90 int64 `json:"p90"`
+	P99 int64 `json:"p99"`
+}
+
+func (p *Percentiles) String() string {
+	if p == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d/%d", p.P50, p.P90, p.P99)
+}
+
+func (s *Stats) add(row *statsRow) {
+	s.Requests++
+	if row.HasError() {
+		s.Errors++
+	}
+	if row.ResponseTTFT.Valid && row.ResponseTTFT.Int64 > 0 {
+		s.ttft = append(s.ttft, row.ResponseTTFT.Int64)
+	}
+	if row.Latency.Valid {
+		s.latency = append(s.latency, row.Latency.Int64/int64(time.Millisecond))
+	}
+	if row.MoonshotServerTiming.Valid {
+		s.serverTiming = append(s.serverTiming, row.MoonshotServerTiming.Int64)
+	}
+	s.Cost += row.Cost.Float64
+	if row.Usage.Valid {
+		var usage MoonshotUsage
+		if err := json.Unmarshal([]byte(row.Usage.String), &usage); err == nil {
+			s.PromptTokens += usage.PromptTokens
+			s.CompletionTokens += usage.CompletionTokens
+			s.CachedTokens += usage.CachedTokens
+			s.TotalTokens += usage.TotalTokens
+		}
+	}
+}
+
+func (s *Stats) finish() {
+	if s.Requests > 0 {
+		s.ErrorRate = float64(s.Errors) / float64(s.Requests)
+	}
+	s.TTFT = percentiles(s.ttft)
+	s.Latency = percentiles(s.latency)
+	s.ServerTiming = percentiles(s.serverTiming)
+}
+
+// percentiles uses the nearest-rank method, it returns nil for no values.
+func percentiles(values []int64) *Percentiles {
+	if len(values) == 0 {
+		return nil
+	}
+	slices.Sort(values)
+	rank := func(p float64) int64 {
+		return values[int(math.Ceil(p*float64(len(values))))-1]
+	}
+	return &Percentiles{
+		P50: rank(0.50),
+		P90: rank(0.90),
+		P99: rank(0.99),
+	}
+}
+
+func statsCommand() *cobra.Command {
+	var (
+		since      string
+		until      string
+		groupBy    string
+		chatOnly   bool
+		predicates []string
+		asJSON     bool
+	)
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Aggregate Moonshot AI requests over a time window",
+		Run: func(cmd *cobra.Command, args []string) {
+			switch groupBy {
+			case groupByModel, groupByPath, groupByGID, groupByDay:
+			default:
+				logFatal(fmt.Errorf("group-by: unknown group %q, expected one of model, path, gid and day", groupBy))
+			}
+			now := time.Now()
+			sinceTime, err := parseTimeFlag(since, now)
+			if err != nil {
+				logFatal(fmt.Errorf("since: %w", err))
+			}
+			var untilString string
+			if until != "" {
+				untilTime, err := parseTimeFlag(until, now)
+				if err != nil {
+					logFatal(fmt.Errorf("until: %w", err))
+				}
+				untilString = untilTime.Format(time.DateTime)
+			}
+			predicate, err := Predicates(predicates).Parse()
+			if err != nil {
+				logFatal(fmt.Errorf("predicate: %w", err))
+			}
+			rows, err := persistence.ListStats(sinceTime.Format(time.DateTime), untilString, chatOnly, predicate)
+			if err != nil {
+				if sqliteErr := new(sqlite3.Error); errors.As(err, sqliteErr) {
+					logFatal(sqliteErr)
+				}
+				logFatal(err)
+			}
+			var (
+				groups = make(map[string]*Stats)
+				total  = &Stats{Group: "total"}
+			)
+			for _, row := range rows {
+				group := row.Group(groupBy)
+				stats, exists := groups[group]
+				if !exists {
+					stats = &Stats{Group: group}
+					groups[group] = stats
+				}
+				stats.add(row)
+				total.add(row)
+			}
+			statsList := make([]*Stats, 0, len(groups))
+			for _, stats := range groups {
+				stats.finish()
+				statsList = append(statsList, stats)
+			}
+			total.finish()
+			slices.SortFunc(statsList, func(a, b *Stats) int {
+				if groupBy == groupByDay {
+					return strings.Compare(a.Group, b.Group)
+				}
+				if a.Requests != b.Requests {
+					return b.Requests - a.Requests
+				}
+				return strings.Compare(a.Group, b.Group)
+			})
+			if asJSON {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "    ")
+				if err = encoder.Encode(map[string]any{
+					"since":    sinceTime.Format(time.DateTime),
+					"until":    untilString,
+					"group_by": groupBy,
+					"groups":   statsList,
+					"total":    total,
+				}); err != nil {
+					logFatal(err)
+				}
+				return
+			}
+			t.AppendHeader(table.Row{
+				groupBy,
+				"requests",
+				"errors",
+				"error_rate",
+				"ttft p50/p90/p99",
+				"latency p50/p90/p99",
+				"server_timing p50/p90/p99",
+				"prompt_tokens",
+				"completion_tokens",
+				"cached_tokens",
+				"total_tokens",
+				"cost",
+			})
+			for _, stats := range append(statsList, total) {
+				group := stats.Group
+				if group == "" {
+					group = "-"
+				}
+				row := table.Row{
+					group,
+					strconv.Itoa(stats.Requests),
+					strconv.Itoa(stats.Errors),
+					strconv.FormatFloat(stats.ErrorRate*100, 'f', 2, 64) + "%",
+					stats.TTFT.String(),
+					stats.Latency.String(),
+					stats.ServerTiming.String(),
+					strconv.Itoa(stats.PromptTokens),
+					strconv.Itoa(stats.CompletionTokens),
+					strconv.Itoa(stats.CachedTokens),
+					strconv.Itoa(stats.TotalTokens),
+					formatCost(stats.Cost),
+				}
+				if stats == total {
+					t.AppendFooter(row)
+				} else {
+					t.AppendRow(row)
+				}
+			}
+			t.Render()
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&since, "since", "24h", "start of the time window, either a duration before now such as 30m, 24h and 7d, or a time such as 2024-08-01 and \"2024-08-01 12:00:00\"")
+	flags.StringVar(&until, "until", "", "end of the time window in the same format as --since, now by default")
+	flags.StringVar(&groupBy, "group-by", groupByModel, "group requests by model, path, gid or day")
+	flags.BoolVar(&chatOnly, "chatonly", false, "only aggregate chat completions requests")
+	flags.StringArrayVarP(&predicates, "predicate", "p", nil, "predicate is used to set the conditions for aggregated requests")
+	flags.BoolVar(&asJSON, "json", false, "output in JSON format")
+	return cmd
+}
+
+// parseTimeFlag parses either a duration before now, which also accepts days
+// such as 7d, or a local time in the format of time.DateTime or time.DateOnly.
+func parseTimeFlag(value string, now time.Time) (time.Time, error) {
+	if days, found := strings.CutSuffix(value, "d"); found {
+		if n, err := strconv.Atoi(days); err == nil {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+	for _, layout := range []string{time.DateTime, time.DateOnly} {
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
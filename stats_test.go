@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentiles(t *testing.T) {
+	sequence := func(n int) []int64 {
+		values := make([]int64, n)
+		for i := range values {
+			// Values are given in reverse order, percentiles sorts them.
+			values[i] = int64(n - i)
+		}
+		return values
+	}
+	var testcases = []struct {
+		name   string
+		values []int64
+		want   *Percentiles
+	}{
+		{name: "no values", values: nil, want: nil},
+		{name: "1 value", values: sequence(1), want: &Percentiles{P50: 1, P90: 1, P99: 1}},
+		{name: "2 values", values: sequence(2), want: &Percentiles{P50: 1, P90: 2, P99: 2}},
+		{name: "10 values", values: sequence(10), want: &Percentiles{P50: 5, P90: 9, P99: 10}},
+		{name: "100 values", values: sequence(100), want: &Percentiles{P50: 50, P90: 90, P99: 99}},
+	}
+	for _, testcase := range testcases {
+		got := percentiles(testcase.values)
+		if (got == nil) != (testcase.want == nil) || (got != nil && *got != *testcase.want) {
+			t.Errorf("%s: want %s, got %s", testcase.name, testcase.want, got)
+		}
+	}
+}
+
+func TestParseTimeFlag(t *testing.T) {
+	now := time.Date(2024, 8, 10, 12, 30, 0, 0, time.Local)
+	var testcases = []struct {
+		value string
+		want  time.Time
+		error bool
+	}{
+		{value: "7d", want: time.Date(2024, 8, 3, 12, 30, 0, 0, time.Local)},
+		{value: "36h", want: time.Date(2024, 8, 9, 0, 30, 0, 0, time.Local)},
+		{value: "30m", want: time.Date(2024, 8, 10, 12, 0, 0, 0, time.Local)},
+		{value: "2024-08-01", want: time.Date(2024, 8, 1, 0, 0, 0, 0, time.Local)},
+		{value: "2024-08-01 08:15:00", want: time.Date(2024, 8, 1, 8, 15, 0, 0, time.Local)},
+		{value: "yesterday", error: true},
+		{value: "7days", error: true},
+		{value: "2024-08-01T08:15:00", error: true},
+	}
+	for _, testcase := range testcases {
+		got, err := parseTimeFlag(testcase.value, now)
+		if testcase.error {
+			if err == nil {
+				t.Errorf("%s: want error, got %s", testcase.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: want %s, got error %s", testcase.value, testcase.want, err)
+		} else if !got.Equal(testcase.want) {
+			t.Errorf("%s: want %s, got %s", testcase.value, testcase.want, got)
+		}
+	}
+}
+
+func TestStatsUsage(t *testing.T) {
+	usePersistenceForTest(t)
+	const requestBody = `{"model":"moonshot-v1-8k","messages":[{"role":"user","content":"hi"}]}`
+	storeTestRequest(t, requestBody,
+		`{"model":"moonshot-v1-8k","choices":[{"index":0,"message":{"role":"assistant","content":"hello"}}],`+
+			`"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12,"cached_tokens":8}}`,
+	)
+	// Usage of event streams is sent in the last chunk as the usage of the choice.
+	storeTestRequest(t, requestBody,
+		"data: {\"model\":\"moonshot-v1-8k\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"hel\"}}]}\n\n"+
+			"data: {\"model\":\"moonshot-v1-8k\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\","+
+			"\"usage\":{\"prompt_tokens\":20,\"completion_tokens\":3,\"total_tokens\":23,\"cached_tokens\":16}}]}\n\n"+
+			"data: [DONE]",
+	)
+	storeTestRequest(t, requestBody, `{"error":{"type":"rate_limit_reached_error"}}`)
+	rows, err := persistence.ListStats(time.Now().Add(-time.Hour).Format(time.DateTime), "", true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := &Stats{}
+	for _, row := range rows {
+		stats.add(row)
+	}
+	stats.finish()
+	var testcases = []struct {
+		name string
+		got  int
+		want int
+	}{
+		{name: "requests", got: stats.Requests, want: 3},
+		{name: "prompt_tokens", got: stats.PromptTokens, want: 30},
+		{name: "completion_tokens", got: stats.CompletionTokens, want: 5},
+		{name: "cached_tokens", got: stats.CachedTokens, want: 24},
+		{name: "total_tokens", got: stats.TotalTokens, want: 35},
+	}
+	for _, testcase := range testcases {
+		if testcase.got != testcase.want {
+			t.Errorf("%s: want %d, got %d", testcase.name, testcase.want, testcase.got)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/MoonshotAI/moonpalace/storage"
+)
+
+type StorageConfig struct {
+	Type   string `yaml:"type"`
+	DSN    string `yaml:"dsn"`
+	Driver string `yaml:"driver"`
+	Path   string `yaml:"path"`
+}
+
+type namedStorage struct {
+	Type string
+	storage.Storage
+}
+
+// storages are where captured requests are written to, the local SQLite
+// database is the only one by default.
+var storages = []*namedStorage{{storage.TypeSQLite, sqliteStorage{}}}
+
+// recordSource is the source of records captured by this proxy.
+var recordSource string
+
+// openStorages refuses to open storages other than SQLite when an encryption key
+// is given, since only the SQLite database is encrypted, and the headers and
+// bodies would be written to the others in plaintext.
+func openStorages(configs []*StorageConfig) ([]*namedStorage, error) {
+	if len(configs) == 0 {
+		return storages, nil
+	}
+	fieldCipher, err := getFieldCipher()
+	if err != nil {
+		return nil, err
+	}
+	opened := make([]*namedStorage, 0, len(configs))
+	for i, config := range configs {
+		var s storage.Storage
+		if fieldCipher != nil && config.Type != storage.TypeSQLite {
+			closeStorages(opened)
+			return nil, fmt.Errorf("storage #%d: %s storages are not encrypted, unset %s and %s or remove the storage",
+				i, config.Type, envEncryptionKey, envEncryptionKeyfile)
+		}
+		switch config.Type {
+		case storage.TypeSQLite:
+			s = sqliteStorage{}
+		case storage.TypePostgres:
+			if config.DSN == "" {
+				err = errors.New("dsn is required")
+				break
+			}
+			s, err = storage.OpenPostgres(config.Driver, config.DSN)
+		case storage.TypeJSONL:
+			if config.Path == "" {
+				err = errors.New("path is required")
+				break
+			}
+			s, err = storage.OpenJSONL(config.Path)
+		default:
+			err = fmt.Errorf("unknown type %q, expected one of sqlite, postgres and jsonl", config.Type)
+		}
+		if err != nil {
+			closeStorages(opened)
+			return nil, fmt.Errorf("storage #%d: %w", i, err)
+		}
+		opened = append(opened, &namedStorage{config.Type, s})
+	}
+	return opened, nil
+}
+
+// prepareCapture validates the pricing, loads the redaction rules and opens the
+// storages for commands capturing requests, which are start and replay with
+// --passthrough. The storages are closed with closeStorages when they exit.
+func prepareCapture() {
+	if err := validatePricing(MoonConfig.Pricing); err != nil {
+		logFatal(err)
+	}
+	loadRedactor()
+	var err error
+	if storages, err = openStorages(MoonConfig.Storage); err != nil {
+		logFatal(err)
+	}
+	recordSource = storageSource(MoonConfig.Source)
+}
+
+func closeStorages(storages []*namedStorage) {
+	for _, s := range storages {
+		s.Close()
+	}
+}
+
+// storageSource tells which proxy a record stored in a shared storage comes
+// from, it defaults to user@hostname.
+func storageSource(source string) string {
+	if source != "" {
+		return source
+	}
+	hostname, _ := os.Hostname()
+	if current, err := user.Current(); err == nil {
+		return current.Username + "@" + hostname
+	}
+	return hostname
+}
+
+// storeRecord writes the record to each storage and returns the id assigned by
+// the local SQLite database, or 0 if it is not one of the storages. Failures of
+// other storages are logged instead of returned, so that the proxy keeps
+// running when a shared storage is unavailable.
+func storeRecord(record *storage.Record) (id int64, err error) {
+	for _, s := range storages {
+		storedID, storeErr := s.Store(record)
+		if s.Type == storage.TypeSQLite {
+			id, err = storedID, storeErr
+			continue
+		}
+		if storeErr != nil {
+			logStorageError(s.Type, storeErr)
+		}
+	}
+	return id, err
+}
+
+const (
+	// Writes still blocked after the busy timeout of SQLite, such as by VACUUM
+	// or by deletes of retention, are retried a few more times before the
+	// record is given up.
+	storeBusyRetries  = 5
+	storeBusyInterval = 200 * time.Millisecond
+)
+
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// retryBusy calls write again while it fails with SQLITE_BUSY or SQLITE_LOCKED,
+// waiting longer before each retry.
+func retryBusy(write func() error) (err error) {
+	for retry := 0; ; retry++ {
+		if err = write(); !isBusy(err) || retry == storeBusyRetries {
+			return err
+		}
+		time.Sleep(storeBusyInterval * time.Duration(retry+1))
+	}
+}
+
+type sqliteStorage struct{}
+
+func (sqliteStorage) Store(record *storage.Record) (int64, error) {
+	var cost float64
+	if record.Cost != nil {
+		cost = *record.Cost
+	}
+	var id int64
+	err := retryBusy(func() (err error) {
+		id, err = persistence.Persistence(
+			record.RequestID,
+			record.RequestContentType,
+			record.RequestMethod,
+			record.RequestPath,
+			record.RequestQuery,
+			record.MoonshotID,
+			record.MoonshotGID,
+			record.MoonshotUID,
+			record.MoonshotRequestID,
+			record.MoonshotServerTiming,
+			record.ResponseStatusCode,
+			record.ResponseContentType,
+			encryptField([]byte(record.RequestHeader)),
+			encryptField(compressBody(record.RequestBody)),
+			encryptField([]byte(record.ResponseHeader)),
+			encryptField(compressBody(record.ResponseBody)),
+			record.Error,
+			record.ResponseTTFT,
+			record.ResponseTPOT,
+			record.ResponseOTPS,
+			record.CreatedAt.Format(time.DateTime),
+			record.Latency,
+			record.Endpoint,
+			record.RequestHash,
+			record.ResponseTiming,
+			record.Attempt,
+			record.KIdent,
+			cost,
+			record.Cost != nil,
+		)
+		return err
+	})
+	if err != nil {
+		return id, err
+	}
+	return id, retryBusy(func() error { return persistence.IndexRequest(id) })
+}
+
+func (sqliteStorage) Close() error {
+	return nil
+}
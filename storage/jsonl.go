@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// JSONL appends records to a file, one JSON object per line.
+type JSONL struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenJSONL opens the file for appending, the file is created if it does not
+// exist. Each record is written by a single write call, so that proxies on
+// different machines can append to the same file on a shared file system.
+func OpenJSONL(path string) (*JSONL, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONL{file: file}, nil
+}
+
+// jsonlRecord writes bodies as strings rather than base64, since bodies are
+// JSON documents or event streams.
+type jsonlRecord struct {
+	*Record
+	RequestBody  string `json:"request_body,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+}
+
+func (s *JSONL) Store(record *Record) (int64, error) {
+	line, err := json.Marshal(&jsonlRecord{
+		Record:       record,
+		RequestBody:  string(record.RequestBody),
+		ResponseBody: string(record.ResponseBody),
+	})
+	if err != nil {
+		return 0, err
+	}
+	line = append(line, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(line)
+	return 0, err
+}
+
+func (s *JSONL) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"database/sql"
+
+	_ "github.com/lib/pq"
+)
+
+// DefaultPostgresDriver is the name which github.com/lib/pq registers itself
+// with.
+const DefaultPostgresDriver = "postgres"
+
+const createPostgresTable = `
+create table if not exists moonshot_requests
+(
+    id                     bigserial primary key,
+    source                 text        not null,
+    request_method         text        not null,
+    request_path           text        not null,
+    request_query          text        not null,
+    request_content_type   text,
+    request_id             text,
+    moonshot_id            text,
+    moonshot_gid           text,
+    moonshot_uid           text,
+    moonshot_request_id    text,
+    moonshot_server_timing integer,
+    response_status_code   integer,
+    response_content_type  text,
+    request_header         text,
+    request_body           text,
+    response_header        text,
+    response_body          text,
+    error                  text,
+    response_ttft          integer,
+    response_tpot          integer,
+    response_otps          double precision,
+    latency                bigint,
+    endpoint               text,
+    request_hash           text,
+    response_timing        text,
+    attempt                integer,
+    k_ident                text,
+    cost                   double precision,
+    created_at             timestamptz not null
+);
+alter table moonshot_requests add column if not exists attempt integer;
+create index if not exists moonshot_requests_created_at_index on moonshot_requests (created_at);
+create index if not exists moonshot_requests_source_index on moonshot_requests (source);
+`
+
+const insertPostgresRecord = `
+insert into moonshot_requests (
+    source,
+    request_method,
+    request_path,
+    request_query,
+    request_content_type,
+    request_id,
+    moonshot_id,
+    moonshot_gid,
+    moonshot_uid,
+    moonshot_request_id,
+    moonshot_server_timing,
+    response_status_code,
+    response_content_type,
+    request_header,
+    request_body,
+    response_header,
+    response_body,
+    error,
+    response_ttft,
+    response_tpot,
+    response_otps,
+    latency,
+    endpoint,
+    request_hash,
+    response_timing,
+    attempt,
+    k_ident,
+    cost,
+    created_at
+) values (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+    $11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+    $21, $22, $23, $24, $25, $26, $27, $28, $29
+)
+returning id
+`
+
+// Postgres writes records to moonshot_requests of a PostgreSQL database, which
+// has the same columns as the SQLite one except for the columns maintained by
+// MoonPalace itself, and an extra source column telling where the record comes
+// from.
+type Postgres struct {
+	db *sql.DB
+}
+
+// OpenPostgres connects to the database with the driver and creates the table
+// if it does not exist.
+func OpenPostgres(driver string, dsn string) (*Postgres, error) {
+	if driver == "" {
+		driver = DefaultPostgresDriver
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(createPostgresTable); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Postgres{db: db}, nil
+}
+
+func (s *Postgres) Store(record *Record) (id int64, err error) {
+	err = s.db.QueryRow(insertPostgresRecord,
+		record.Source,
+		record.RequestMethod,
+		record.RequestPath,
+		record.RequestQuery,
+		nullString(record.RequestContentType),
+		nullString(record.RequestID),
+		nullString(record.MoonshotID),
+		nullString(record.MoonshotGID),
+		nullString(record.MoonshotUID),
+		nullString(record.MoonshotRequestID),
+		nullInt64(int64(record.MoonshotServerTiming)),
+		nullInt64(int64(record.ResponseStatusCode)),
+		nullString(record.ResponseContentType),
+		nullString(record.RequestHeader),
+		nullString(string(record.RequestBody)),
+		nullString(record.ResponseHeader),
+		nullString(string(record.ResponseBody)),
+		nullString(record.Error),
+		nullInt64(int64(record.ResponseTTFT)),
+		nullInt64(int64(record.ResponseTPOT)),
+		nullFloat64(record.ResponseOTPS),
+		nullInt64(int64(record.Latency)),
+		nullString(record.Endpoint),
+		nullString(record.RequestHash),
+		nullString(record.ResponseTiming),
+		nullInt64(int64(record.Attempt)),
+		nullString(record.KIdent),
+		nullCost(record.Cost),
+		record.CreatedAt,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *Postgres) Close() error {
+	return s.db.Close()
+}
+
+// Zero values are stored as NULL, in the same way as the SQLite storage.
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullInt64(i int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: i, Valid: i != 0}
+}
+
+// nullCost keeps a cost of 0, which is a free request, apart from an unknown
+// cost, which is nil.
+func nullCost(cost *float64) sql.NullFloat64 {
+	if cost == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *cost, Valid: true}
+}
+
+func nullFloat64(f float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: f, Valid: f != 0}
+}
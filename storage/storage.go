@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"time"
+)
+
+const (
+	TypeSQLite   = "sqlite"
+	TypePostgres = "postgres"
+	TypeJSONL    = "jsonl"
+)
+
+// Record is a captured request along with its response, the fields are named
+// after the columns of moonshot_requests. Headers and bodies have been redacted
+// but are neither compressed nor encrypted.
+//
+// Attempt is the number of the attempt among the records sharing RequestID, the
+// failed attempts of a retried request are numbered from 1 and the record of the
+// last attempt follows them, it is 0 for requests which were not retried. Ids
+// are assigned by each storage, so attempts are linked by RequestID and Attempt
+// instead.
+type Record struct {
+	Source               string        `json:"source"`
+	RequestID            string        `json:"request_id,omitempty"`
+	RequestContentType   string        `json:"request_content_type,omitempty"`
+	RequestMethod        string        `json:"request_method"`
+	RequestPath          string        `json:"request_path"`
+	RequestQuery         string        `json:"request_query"`
+	MoonshotID           string        `json:"moonshot_id,omitempty"`
+	MoonshotGID          string        `json:"moonshot_gid,omitempty"`
+	MoonshotUID          string        `json:"moonshot_uid,omitempty"`
+	MoonshotRequestID    string        `json:"moonshot_request_id,omitempty"`
+	MoonshotServerTiming int           `json:"moonshot_server_timing,omitempty"`
+	ResponseStatusCode   int           `json:"response_status_code,omitempty"`
+	ResponseContentType  string        `json:"response_content_type,omitempty"`
+	RequestHeader        string        `json:"request_header,omitempty"`
+	RequestBody          []byte        `json:"-"`
+	ResponseHeader       string        `json:"response_header,omitempty"`
+	ResponseBody         []byte        `json:"-"`
+	Error                string        `json:"error,omitempty"`
+	ResponseTTFT         int           `json:"response_ttft,omitempty"`
+	ResponseTPOT         int           `json:"response_tpot,omitempty"`
+	ResponseOTPS         float64       `json:"response_otps,omitempty"`
+	Latency              time.Duration `json:"latency,omitempty"`
+	Endpoint             string        `json:"endpoint,omitempty"`
+	RequestHash          string        `json:"request_hash,omitempty"`
+	ResponseTiming       string        `json:"response_timing,omitempty"`
+	Attempt              int           `json:"attempt,omitempty"`
+	KIdent               string        `json:"k_ident,omitempty"`
+	Cost                 *float64      `json:"cost,omitempty"`
+	CreatedAt            time.Time     `json:"created_at"`
+}
+
+// Storage is where captured requests are written to.
+type Storage interface {
+	// Store writes the record and returns its id, storages which do not assign
+	// ids to records return 0.
+	Store(record *Record) (int64, error)
+	Close() error
+}
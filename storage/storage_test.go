@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"bufio"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newRecord() *Record {
+	return &Record{
+		Source:             "alice@devbox",
+		RequestMethod:      "POST",
+		RequestPath:        "/v1/chat/completions",
+		RequestContentType: "application/json",
+		MoonshotID:         "chatcmpl-1",
+		ResponseStatusCode: 200,
+		RequestHeader:      "Content-Type: application/json\r\n",
+		RequestBody:        []byte(`{"model":"moonshot-v1-8k"}`),
+		ResponseBody:       []byte(`{"id":"chatcmpl-1"}`),
+		Latency:            1500 * time.Millisecond,
+		CreatedAt:          time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestJSONL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	s, err := OpenJSONL(path)
+	if err != nil {
+		t.Fatalf("OpenJSONL: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if id, err := s.Store(newRecord()); err != nil || id != 0 {
+			t.Fatalf("Store: id=%d, err=%v", id, err)
+		}
+	}
+	if err = s.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var lines int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+		var record map[string]any
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %d: %s", lines, err)
+		}
+		if record["request_body"] != `{"model":"moonshot-v1-8k"}` {
+			t.Errorf("want request_body as string, got %v", record["request_body"])
+		}
+		if record["source"] != "alice@devbox" || record["latency"] != float64(1500*time.Millisecond) {
+			t.Errorf("unexpected record %v", record)
+		}
+		if _, ok := record["moonshot_gid"]; ok {
+			t.Errorf("want empty fields omitted, got %v", record["moonshot_gid"])
+		}
+	}
+	if lines != 2 {
+		t.Errorf("want 2 lines, got %d", lines)
+	}
+}
+
+// fakeDriver records the statements executed by Postgres, since a PostgreSQL
+// server is not available in tests.
+type fakeDriver struct {
+	mu         sync.Mutex
+	statements []string
+	args       [][]driver.Value
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d}, nil }
+
+type fakeConn struct{ driver *fakeDriver }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{driver: c.driver, query: query}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type fakeStmt struct {
+	driver *fakeDriver
+	query  string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.record(args)
+	return driver.RowsAffected(0), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.record(args)
+	return &fakeRows{}, nil
+}
+
+func (s *fakeStmt) record(args []driver.Value) {
+	s.driver.mu.Lock()
+	defer s.driver.mu.Unlock()
+	s.driver.statements = append(s.driver.statements, s.query)
+	s.driver.args = append(s.driver.args, args)
+}
+
+// fakeRows returns a single row with id 42.
+type fakeRows struct{ done bool }
+
+func (r *fakeRows) Columns() []string { return []string{"id"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(42)
+	return nil
+}
+
+func TestPostgres(t *testing.T) {
+	fake := &fakeDriver{}
+	sql.Register("storage_fake_postgres", fake)
+	s, err := OpenPostgres("storage_fake_postgres", "postgres://localhost/moonpalace")
+	if err != nil {
+		t.Fatalf("OpenPostgres: %s", err)
+	}
+	defer s.Close()
+	record := newRecord()
+	record.RequestID = "moonpalace-1"
+	record.Attempt = 2
+	id, err := s.Store(record)
+	if err != nil {
+		t.Fatalf("Store: %s", err)
+	}
+	if id != 42 {
+		t.Errorf("want id 42, got %d", id)
+	}
+	if len(fake.statements) != 2 {
+		t.Fatalf("want 2 statements, got %d", len(fake.statements))
+	}
+	if !strings.Contains(fake.statements[0], "create table if not exists moonshot_requests") {
+		t.Errorf("want the table created first, got %s", fake.statements[0])
+	}
+	args := fake.args[1]
+	if len(args) != 29 {
+		t.Fatalf("want 29 args, got %d", len(args))
+	}
+	if args[0] != "alice@devbox" || args[14] != `{"model":"moonshot-v1-8k"}` {
+		t.Errorf("unexpected args %v", args)
+	}
+	// moonshot_gid is empty and stored as NULL.
+	if args[7] != nil {
+		t.Errorf("want NULL moonshot_gid, got %v", args[7])
+	}
+	if args[21] != int64(1500*time.Millisecond) {
+		t.Errorf("want latency in nanoseconds, got %v", args[21])
+	}
+	if args[5] != "moonpalace-1" || args[25] != int64(2) {
+		t.Errorf("want attempts linked by request_id and attempt, got %v and %v", args[5], args[25])
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+const (
+	categoryGoodCase = "goodcase"
+	categoryBadCase  = "badcase"
+)
+
+// annotation changes the category, note and tags of a request. Nil category
+// and note are left unchanged, an empty one removes them.
+type annotation struct {
+	Category *string  `json:"category"`
+	Note     *string  `json:"note"`
+	Tags     []string `json:"tags"`
+	Untag    []string `json:"untag"`
+	// Clear removes the existing annotations before the others are applied.
+	Clear bool `json:"clear"`
+}
+
+func (a *annotation) validate() error {
+	if a.Category != nil {
+		switch *a.Category {
+		case "", categoryGoodCase, categoryBadCase:
+		default:
+			return fmt.Errorf("category: unknown category %q, expected one of goodcase and badcase", *a.Category)
+		}
+	}
+	for _, tag := range append(a.Tags, a.Untag...) {
+		if strings.TrimSpace(tag) == "" {
+			return errors.New("tag: empty tag")
+		}
+	}
+	return nil
+}
+
+func (a *annotation) apply(id int64) error {
+	if err := a.validate(); err != nil {
+		return err
+	}
+	if a.Clear {
+		if err := persistence.ClearAnnotations(id); err != nil {
+			return err
+		}
+	}
+	if a.Category != nil {
+		if err := persistence.SetCategory(id, *a.Category); err != nil {
+			return err
+		}
+	}
+	if a.Note != nil {
+		if err := persistence.SetNote(id, *a.Note); err != nil {
+			return err
+		}
+	}
+	for _, tag := range a.Untag {
+		if err := persistence.RemoveTag(id, strings.TrimSpace(tag)); err != nil {
+			return err
+		}
+	}
+	for _, tag := range a.Tags {
+		if err := persistence.AddTag(id, strings.TrimSpace(tag)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tagCommand() *cobra.Command {
+	var (
+		id                int64
+		chatcmpl          string
+		requestID         string
+		goodCase, badCase bool
+		tags              []string
+		untags            []string
+		note              string
+		clearAll          bool
+	)
+	cmd := &cobra.Command{
+		Use:   "tag",
+		Short: "Label a Moonshot AI request with a category, tags and a note",
+		Run: func(cmd *cobra.Command, args []string) {
+			request, err := persistence.GetRequest(id, chatcmpl, requestID)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					logFatal(sql.ErrNoRows)
+				}
+				logFatal(err)
+			}
+			a := &annotation{Tags: tags, Untag: untags, Clear: clearAll}
+			var category string
+			switch {
+			case goodCase:
+				category = categoryGoodCase
+				a.Category = &category
+			case badCase:
+				category = categoryBadCase
+				a.Category = &category
+			}
+			if cmd.Flags().Changed("note") {
+				a.Note = &note
+			}
+			if err = a.apply(request.ID); err != nil {
+				logFatal(err)
+			}
+			if request, err = persistence.GetRequest(request.ID, "", ""); err != nil {
+				logFatal(err)
+			}
+			t.AppendHeader(table.Row{"id", "ident", "category", "tags", "note"})
+			t.AppendRow(table.Row{
+				request.ID,
+				request.Ident(),
+				request.Category,
+				strings.Join(request.Tags, ", "),
+				request.Note,
+			})
+			t.SetColumnConfigs([]table.ColumnConfig{
+				{Name: "note", WidthMax: 48},
+			})
+			t.Render()
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.Int64Var(&id, "id", 0, "row id")
+	flags.StringVar(&chatcmpl, "chatcmpl", "", "chatcmpl")
+	flags.StringVar(&requestID, "requestid", "", "request id returned from Moonshot AI")
+	flags.BoolVar(&goodCase, "good", false, "good case")
+	flags.BoolVar(&badCase, "bad", false, "bad case")
+	flags.StringArrayVar(&tags, "tag", nil, "tags describe the current case")
+	flags.StringArrayVar(&untags, "untag", nil, "tags to remove from the current case")
+	flags.StringVar(&note, "note", "", "note on the current case, an empty note removes it")
+	flags.BoolVar(&clearAll, "clear", false, "remove the category, tags and note before applying the other flags")
+	cmd.MarkFlagsOneRequired("id", "chatcmpl", "requestid")
+	cmd.MarkFlagsMutuallyExclusive("good", "bad")
+	return cmd
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	tailFormatCompact = "compact"
+	tailFormatFull    = "full"
+)
+
+func tailCommand() *cobra.Command {
+	var (
+		n          int64
+		chatOnly   bool
+		predicates []string
+		format     string
+		interval   time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:     "tail",
+		Aliases: []string{"watch"},
+		Short:   "Follow Moonshot AI requests as they are captured",
+		Run: func(cmd *cobra.Command, args []string) {
+			switch format {
+			case tailFormatCompact, tailFormatFull:
+			default:
+				logFatal(fmt.Errorf("format: unknown format %q, expected one of compact and full", format))
+			}
+			if interval <= 0 {
+				logFatal(errors.New("interval: should be positive"))
+			}
+			predicate, err := Predicates(predicates).Parse()
+			if err != nil {
+				logFatal(fmt.Errorf("predicate: %w", err))
+			}
+			printRequest := printCompactRequest
+			if format == tailFormatFull {
+				printRequest = printFullRequest
+			}
+			var after int64
+			// Like tail -f, the last n requests are printed before following.
+			if n > 0 {
+				requests, err := persistence.ListRequests(n, chatOnly, predicate)
+				if err != nil {
+					logFatalQuery(err)
+				}
+				slices.Reverse(requests)
+				for _, request := range requests {
+					printRequest(request)
+				}
+			}
+			// Rows inserted later than the latest row are followed, whether or
+			// not the latest row matches the predicates.
+			if after, err = persistence.LatestRequestID(); err != nil {
+				logFatalQuery(err)
+			}
+			interrupt := make(chan os.Signal, 1)
+			signal.Notify(interrupt, os.Interrupt)
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-interrupt:
+					return
+				case <-ticker.C:
+				}
+				requests, latest, err := tailRequests(after, chatOnly, predicate)
+				if err != nil {
+					logFatalQuery(err)
+				}
+				for _, request := range requests {
+					printRequest(request)
+				}
+				after = latest
+			}
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.Int64VarP(&n, "n", "n", 10, "number of existing requests to print before following")
+	flags.BoolVar(&chatOnly, "chatonly", false, "chat only output")
+	flags.StringArrayVarP(&predicates, "predicate", "p", nil, "predicate is used to set the conditions for followed requests")
+	flags.StringVar(&format, "format", tailFormatCompact, "output format, either compact (one line per request) or full (the same as the log of the start command)")
+	flags.DurationVar(&interval, "interval", time.Second, "interval between polls of the database")
+	return cmd
+}
+
+// tailRequests returns the rows after the given id which match the predicate,
+// along with the id to follow from next time. Rows which do not match are
+// skipped by the returned id, so they are not scanned again.
+func tailRequests(after int64, chatOnly bool, predicate string) ([]*Request, int64, error) {
+	latest, err := persistence.LatestRequestID()
+	if err != nil {
+		return nil, after, err
+	}
+	requests, err := persistence.TailRequests(after, chatOnly, predicate)
+	if err != nil {
+		return nil, after, err
+	}
+	if len(requests) > 0 {
+		latest = max(latest, requests[len(requests)-1].ID)
+	}
+	return requests, max(latest, after), nil
+}
+
+func logFatalQuery(err error) {
+	if sqliteErr := new(sqlite3.Error); errors.As(err, sqliteErr) {
+		logFatal(sqliteErr)
+	}
+	logFatal(err)
+}
+
+func printCompactRequest(request *Request) {
+	var (
+		status = request.Status()
+		ident  = request.Ident()
+		model  = "-"
+	)
+	if status == "" {
+		status = "-"
+	}
+	if strings.HasPrefix(status, "2") {
+		status = green(status)
+	} else {
+		status = red(status)
+	}
+	if request.IsChat() {
+		if value := gjson.Get(request.RequestBody.String, "model").String(); value != "" {
+			model = value
+		}
+	}
+	line := fmt.Sprintf("%s %s %s %s %s %.2fs %s %s",
+		boldWhite(fmt.Sprintf("%-6d", request.ID)),
+		request.CreatedAt.Format(time.DateTime),
+		boldYellowf("%-6s", request.RequestMethod),
+		boldWhite(request.RequestPath),
+		status,
+		float64(request.Latency.Int64)/float64(time.Second),
+		model,
+		ident,
+	)
+	if request.Error.Valid {
+		line += " " + boldRed(strings.ReplaceAll(request.Error.String, "\n", " "))
+	}
+	fmt.Println(line)
+}
+
+// printFullRequest prints the request in the same format as it is logged by the
+// start command, with values restored from the row.
+func printFullRequest(request *Request) {
+	var (
+		moonshot           *Moonshot
+		responseHeader     = parseHeader(request.ResponseHeader.String)
+		tokenFinishLatency time.Duration
+		cost               float64
+		costKnown          bool
+		err                error
+	)
+	if id := gjson.Get(request.ResponseBody.String, "id").String(); id != "" {
+		moonshot = &Moonshot{ID: id}
+		usage := gjson.Get(request.ResponseBody.String, "usage")
+		if !usage.Exists() {
+			usage = gjson.Get(request.ResponseBody.String, "choices.0.usage")
+		}
+		if usage.IsObject() {
+			moonshot.Usage = &MoonshotUsage{
+				PromptTokens:     int(usage.Get("prompt_tokens").Int()),
+				CompletionTokens: int(usage.Get("completion_tokens").Int()),
+				TotalTokens:      int(usage.Get("total_tokens").Int()),
+				CachedTokens:     int(usage.Get("cached_tokens").Int()),
+			}
+			if request.ResponseTPOT.Valid {
+				tokenFinishLatency = time.Duration(request.ResponseTTFT.Int64)*time.Millisecond +
+					time.Duration(request.ResponseTPOT.Int64)*time.Millisecond*
+						time.Duration(moonshot.Usage.CompletionTokens-_boolToInt(request.ResponseTTFT.Int64 != 0))
+			}
+		}
+	}
+	if request.Cost.Valid {
+		cost, costKnown = request.Cost.Float64, true
+	}
+	switch {
+	case request.ResponseStatusCode.Valid && request.ResponseStatusCode.Int64 != http.StatusOK:
+		err = &moonshotError{message: request.ResponseBody.String}
+	case request.Error.Valid:
+		err = errors.New(request.Error.String)
+	}
+	loggingMutex.Lock()
+	defer loggingMutex.Unlock()
+	logRequest(
+		request.RequestMethod,
+		request.RequestPath,
+		request.RequestQuery,
+		request.RequestContentType.String,
+		request.RequestID.String,
+		request.Status(),
+		request.ResponseContentType.String,
+		int(request.ResponseTTFT.Int64),
+		request.MoonshotRequestID.String,
+		int(request.MoonshotServerTiming.Int64),
+		responseHeader.Get("Msh-Context-Cache-Id"),
+		request.MoonshotUID.String,
+		request.MoonshotGID.String,
+		moonshot,
+		time.Duration(request.Latency.Int64),
+		tokenFinishLatency,
+		err,
+		nil,
+		parseHeader(request.RequestHeader.String),
+		responseHeader,
+		cost,
+		costKnown,
+	)
+	logNewRow(request.ID)
+}
+
+func parseHeader(header string) http.Header {
+	mimeHeader, _ := textproto.
+		NewReader(bufio.NewReader(strings.NewReader(header + "\r\n\r\n"))).
+		ReadMIMEHeader()
+	return http.Header(mimeHeader)
+}
+
+// rowNotifier wakes up followers of the proxy when new rows are inserted.
+type rowNotifier struct {
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+var newRows = &rowNotifier{
+	subscribers: make(map[chan struct{}]struct{}),
+}
+
+func (n *rowNotifier) subscribe() chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	n.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (n *rowNotifier) unsubscribe(ch chan struct{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.subscribers, ch)
+}
+
+func (n *rowNotifier) notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for ch := range n.subscribers {
+		// A pending notification already covers this one.
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// tailHeartbeat keeps idle event streams from being closed by intermediaries.
+const tailHeartbeat = 15 * time.Second
+
+// handleTailRequests streams new rows as server-sent events, it accepts the
+// same parameters as handleListRequests, n is the number of existing rows sent
+// before following and defaults to 0.
+func handleTailRequests(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var n int64
+	if value := query.Get("n"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			writeAdminError(w, http.StatusBadRequest, "invalid_request_error", fmt.Errorf("n: invalid value %q", value))
+			return
+		}
+		n = parsed
+	}
+	chatOnly, _ := strconv.ParseBool(query.Get("chatonly"))
+	full, _ := strconv.ParseBool(query.Get("full"))
+	predicate, err := Predicates(query["predicate"]).Parse()
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid_request_error", fmt.Errorf("predicate: %w", err))
+		return
+	}
+	// Subscribe before reading the latest row so that no rows are missed.
+	notification := newRows.subscribe()
+	defer newRows.unsubscribe(notification)
+	var (
+		after    int64
+		existing []*Request
+	)
+	if n > 0 {
+		if existing, err = persistence.ListRequests(n, chatOnly, predicate); err != nil {
+			writeAdminQueryError(w, err)
+			return
+		}
+		slices.Reverse(existing)
+	}
+	if after, err = persistence.LatestRequestID(); err != nil {
+		writeAdminQueryError(w, err)
+		return
+	}
+	controller := http.NewResponseController(w)
+	// Event streams outlive the write timeout of the server.
+	controller.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	send := func(requests []*Request) error {
+		for _, request := range requests {
+			var data any = request
+			if full {
+				redactRequest(request)
+			} else {
+				data = summarizeRequest(request)
+			}
+			encoded, err := json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			if _, err = fmt.Fprintf(w, "id: %d\nevent: request\ndata: %s\n\n", request.ID, encoded); err != nil {
+				return err
+			}
+		}
+		return controller.Flush()
+	}
+	if err = send(existing); err != nil {
+		return
+	}
+	heartbeat := time.NewTicker(tailHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err = fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			if err = controller.Flush(); err != nil {
+				return
+			}
+		case <-notification:
+			var requests []*Request
+			if requests, after, err = tailRequests(after, chatOnly, predicate); err != nil {
+				return
+			}
+			if err = send(requests); err != nil {
+				return
+			}
+		}
+	}
+}